@@ -11,6 +11,7 @@ import (
 	baseliboidc "github.com/aggregat4/go-baselib-services/v3/oidc"
 	"github.com/aggregat4/rssgrid/internal/config"
 	"github.com/aggregat4/rssgrid/internal/db"
+	"github.com/aggregat4/rssgrid/internal/events"
 	"github.com/aggregat4/rssgrid/internal/feed"
 	"github.com/aggregat4/rssgrid/internal/server"
 )
@@ -37,20 +38,54 @@ func main() {
 	if err != nil {
 		log.Fatalf("Error initializing database: %v", err)
 	}
+	if cfg.CredentialsKey != "" {
+		store.SetCredentialsKey(cfg.CredentialsKey)
+	}
 
-	oidcConfig := baseliboidc.CreateOidcConfiguration(
-		cfg.OIDC.IssuerURL,
-		cfg.OIDC.ClientID,
-		cfg.OIDC.ClientSecret,
-		cfg.OIDC.RedirectURL,
-	)
+	// Local accounts need no OIDC provider
+	var oidcConfig *baseliboidc.OidcConfiguration
+	if cfg.Auth.Mode == config.AuthModeOIDC {
+		oidcConfig = baseliboidc.CreateOidcConfiguration(
+			cfg.OIDC.IssuerURL,
+			cfg.OIDC.ClientID,
+			cfg.OIDC.ClientSecret,
+			cfg.OIDC.RedirectURL,
+		)
+	}
 
 	srv, err := server.NewServer(store, oidcConfig, cfg.SessionKey)
 	if err != nil {
 		log.Fatalf("Error initializing server: %v", err)
 	}
 
-	updater := feed.NewUpdater(store, cfg.UpdateInterval, cfg.MaxPostsPerFeed)
+	if cfg.Auth.Mode == config.AuthModeLocal {
+		localAuth := server.LocalAuth{Registration: cfg.Auth.Registration}
+		if cfg.Auth.PublicURL != "" {
+			localAuth.WebAuthn, err = server.NewWebAuthn(cfg.Auth.PublicURL)
+			if err != nil {
+				log.Fatalf("Error configuring passkeys: %v", err)
+			}
+		}
+		srv.SetLocalAuth(localAuth)
+	}
+
+	// The updater and the server share one fetcher, so subscribing is held
+	// to the same limits as polling.
+	fetcher := feed.NewFetcher(store)
+	fetcher.SetMaxBodySize(cfg.MaxFeedSize)
+	if err := fetcher.SetAllowedNetworks(cfg.FetchAllowedNetworks); err != nil {
+		log.Fatalf("Error configuring fetch_allowed_networks: %v", err)
+	}
+	srv.SetFetcher(fetcher)
+
+	updater := feed.NewUpdaterWithFetcher(store, cfg.UpdateInterval, cfg.MaxPostsPerFeed, fetcher)
+	updater.SetConcurrency(cfg.FetchWorkers, cfg.FetchWorkersPerHost)
+	updater.SetScheduleBounds(cfg.MinFetchInterval, cfg.MaxFetchInterval)
+	srv.SetRefresher(updater)
+
+	bus := events.NewBus()
+	updater.SetEventBus(bus)
+	srv.SetEventBus(bus)
 
 	// Create context that will be canceled on shutdown
 	ctx, cancel := context.WithCancel(context.Background())
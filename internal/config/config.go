@@ -1,22 +1,54 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
 	"github.com/kirsle/configdir"
 	"github.com/kkyr/fig"
 )
 
+// Auth modes: sign in with an external OIDC provider, or with accounts
+// stored by RSSGrid itself.
+const (
+	AuthModeOIDC  = "oidc"
+	AuthModeLocal = "local"
+)
+
+// Registration policies for local accounts. The first account can always be
+// registered and becomes the admin.
+const (
+	RegistrationOpen   = "open"
+	RegistrationInvite = "invite"
+	RegistrationClosed = "closed"
+)
+
 type Config struct {
-	Addr            string        `fig:"addr" default:":8080"`
-	DBPath          string        `fig:"db_path" default:"rssgrid.db"`
-	UpdateInterval  time.Duration `fig:"update_interval" default:"30m"`
-	MaxPostsPerFeed int           `fig:"max_posts_per_feed" default:"100"`
-	SessionKey      string        `fig:"session_key" env:"RSSGRID_SESSION_KEY" required:"true"`
-	OIDC            struct {
-		IssuerURL    string `fig:"issuer_url" env:"RSSGRID_OIDC_ISSUER_URL" required:"true"`
-		ClientID     string `fig:"client_id" env:"RSSGRID_OIDC_CLIENT_ID" required:"true"`
-		ClientSecret string `fig:"client_secret" env:"RSSGRID_OIDC_CLIENT_SECRET" required:"true"`
+	Addr                 string        `fig:"addr" default:":8080"`
+	DBPath               string        `fig:"db_path" default:"rssgrid.db"`
+	UpdateInterval       time.Duration `fig:"update_interval" default:"30m"`
+	MaxPostsPerFeed      int           `fig:"max_posts_per_feed" default:"100"`
+	FetchWorkers         int           `fig:"fetch_workers" default:"8"`
+	FetchWorkersPerHost  int           `fig:"fetch_workers_per_host" default:"2"`
+	MinFetchInterval     time.Duration `fig:"min_fetch_interval" default:"10m"`
+	MaxFetchInterval     time.Duration `fig:"max_fetch_interval" default:"24h"`
+	MaxFeedSize          int64         `fig:"max_feed_size" default:"10485760"`
+	FetchAllowedNetworks []string      `fig:"fetch_allowed_networks"`
+	SessionKey           string        `fig:"session_key" env:"RSSGRID_SESSION_KEY" required:"true"`
+	CredentialsKey       string        `fig:"credentials_key" env:"RSSGRID_CREDENTIALS_KEY"`
+	Auth                 struct {
+		Mode         string `fig:"mode" default:"oidc"`
+		Registration string `fig:"registration" default:"invite"`
+		// PublicURL is where users reach RSSGrid. Passkeys are bound to its
+		// host; leave it empty to disable them.
+		PublicURL string `fig:"public_url"`
+	} `fig:"auth"`
+	// OIDC is only required when Auth.Mode is "oidc".
+	OIDC struct {
+		IssuerURL    string `fig:"issuer_url" env:"RSSGRID_OIDC_ISSUER_URL"`
+		ClientID     string `fig:"client_id" env:"RSSGRID_OIDC_CLIENT_ID"`
+		ClientSecret string `fig:"client_secret" env:"RSSGRID_OIDC_CLIENT_SECRET"`
 		RedirectURL  string `fig:"redirect_url" default:"http://localhost:8080/auth/callback"`
 	} `fig:"oidc"`
 }
@@ -35,5 +67,27 @@ func LoadWithPath(configPath string) (*Config, error) {
 	); err != nil {
 		return nil, err
 	}
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
 	return &cfg, nil
 }
+
+// validate checks the settings that depend on each other.
+func (cfg *Config) validate() error {
+	switch cfg.Auth.Mode {
+	case AuthModeOIDC:
+		if cfg.OIDC.IssuerURL == "" || cfg.OIDC.ClientID == "" || cfg.OIDC.ClientSecret == "" {
+			return errors.New("oidc.issuer_url, oidc.client_id and oidc.client_secret are required when auth.mode is \"oidc\"")
+		}
+	case AuthModeLocal:
+		switch cfg.Auth.Registration {
+		case RegistrationOpen, RegistrationInvite, RegistrationClosed:
+		default:
+			return fmt.Errorf("auth.registration must be %q, %q or %q", RegistrationOpen, RegistrationInvite, RegistrationClosed)
+		}
+	default:
+		return fmt.Errorf("auth.mode must be %q or %q", AuthModeOIDC, AuthModeLocal)
+	}
+	return nil
+}
@@ -1,13 +1,27 @@
 package db
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/aggregat4/go-baselib/migrations"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 	"github.com/microcosm-cc/bluemonday"
+	"golang.org/x/crypto/bcrypt"
 )
 
 var mymigrations = []migrations.Migration{
@@ -102,142 +116,320 @@ ALTER TABLE feeds ADD COLUMN consecutive_failures INTEGER NOT NULL DEFAULT 0;
 ALTER TABLE feeds ADD COLUMN last_success_at DATETIME;
 `,
 	},
-}
-
-type Store struct {
-	db *sql.DB
-}
-
-func (store *Store) MoveFeedDown(userID int64, i int64) error {
-	// Start a transaction
-	tx, err := store.db.Begin()
-	if err != nil {
-		return fmt.Errorf("error starting transaction: %w", err)
-	}
-	defer tx.Rollback()
+	{
+		SequenceId: 5,
+		Sql: `
+-- Full-text index over post titles and plain-text bodies, used by search.
+-- FTS5 requires building with the sqlite_fts5 tag.
+-- Rows are added by indexPost (which strips HTML) and removed by the trigger
+-- below whenever a post is pruned or cascade-deleted with its feed.
+CREATE VIRTUAL TABLE posts_fts USING fts5(title, body, tokenize='unicode61');
+
+CREATE TRIGGER posts_fts_delete AFTER DELETE ON posts BEGIN
+    DELETE FROM posts_fts WHERE rowid = old.id;
+END;
+
+-- Index posts that existed before search was introduced, stripped of HTML
+-- like new posts.
+INSERT INTO posts_fts (rowid, title, body) SELECT id, title, plain_text(content) FROM posts;
+`,
+	},
+	{
+		SequenceId: 6,
+		Sql: `
+-- Personal access tokens for the JSON API. Only a SHA-256 hash of each token
+-- is stored; the token itself is shown to the user once when it is created.
+CREATE TABLE api_tokens (
+    id INTEGER PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_used_at DATETIME,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+`,
+	},
+	{
+		SequenceId: 7,
+		Sql: `
+-- Per-feed polling schedule. A NULL next_fetch_at means the feed is due now.
+ALTER TABLE feeds ADD COLUMN next_fetch_at DATETIME;
+-- Polling interval requested by the publisher via RSS <ttl> or <sy:updatePeriod>.
+ALTER TABLE feeds ADD COLUMN ttl_seconds INTEGER;
+CREATE INDEX idx_feeds_next_fetch_at ON feeds(next_fetch_at);
+`,
+	},
+	{
+		SequenceId: 8,
+		Sql: `
+-- Starred posts are kept for the user and never pruned.
+ALTER TABLE user_post_states ADD COLUMN starred INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE user_post_states ADD COLUMN starred_at DATETIME;
+CREATE INDEX idx_user_post_states_starred ON user_post_states(post_id) WHERE starred = 1;
+`,
+	},
+	{
+		SequenceId: 9,
+		Sql: `
+-- Detect edits to posts the publisher has changed since we stored them. A NULL
+-- content_hash is computed from the stored columns on the next fetch.
+ALTER TABLE posts ADD COLUMN content_hash TEXT;
+ALTER TABLE posts ADD COLUMN updated_at DATETIME;
+
+-- Earlier versions of posts that were changed by their publisher.
+CREATE TABLE post_revisions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id INTEGER NOT NULL,
+    title TEXT,
+    link TEXT NOT NULL,
+    content TEXT,
+    replaced_at DATETIME NOT NULL,
+    FOREIGN KEY(post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_post_revisions_post_id ON post_revisions(post_id);
 
-	// Get the current feed's grid position
-	var currentPosition int
-	err = tx.QueryRow(`
-		SELECT grid_position 
-		FROM user_feeds 
-		WHERE user_id = ? AND feed_id = ?
-	`, userID, i).Scan(&currentPosition)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return fmt.Errorf("feed not found for user")
-		}
-		return fmt.Errorf("error getting current position: %w", err)
-	}
+-- Whether an updated post is marked as unseen again.
+ALTER TABLE user_preferences ADD COLUMN unseen_on_update INTEGER NOT NULL DEFAULT 0;
+`,
+	},
+	{
+		SequenceId: 10,
+		Sql: `
+-- Named dashboards per user, shown as tabs.
+CREATE TABLE dashboards (
+    id INTEGER PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    position INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_dashboards_user_id ON dashboards(user_id);
 
-	// Get the next feed's ID and position
-	var nextFeedID int64
-	var nextPosition int
-	err = tx.QueryRow(`
-		SELECT feed_id, grid_position 
-		FROM user_feeds 
-		WHERE user_id = ? AND grid_position > ? 
-		ORDER BY grid_position ASC 
-		LIMIT 1
-	`, userID, currentPosition).Scan(&nextFeedID, &nextPosition)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return fmt.Errorf("no feed below to move down to")
-		}
-		return fmt.Errorf("error getting next feed: %w", err)
-	}
+-- Places a subscribed feed on a dashboard. A feed may be on several
+-- dashboards, each with its own position.
+CREATE TABLE dashboard_feeds (
+    dashboard_id INTEGER NOT NULL,
+    feed_id INTEGER NOT NULL,
+    position INTEGER NOT NULL DEFAULT 0,
+    FOREIGN KEY(dashboard_id) REFERENCES dashboards(id) ON DELETE CASCADE,
+    FOREIGN KEY(feed_id) REFERENCES feeds(id) ON DELETE CASCADE,
+    PRIMARY KEY(dashboard_id, feed_id)
+);
 
-	// Swap the positions
-	_, err = tx.Exec(`
-		UPDATE user_feeds 
-		SET grid_position = ? 
-		WHERE user_id = ? AND feed_id = ?
-	`, nextPosition, userID, i)
-	if err != nil {
-		return fmt.Errorf("error updating current feed position: %w", err)
-	}
+ALTER TABLE user_preferences ADD COLUMN last_dashboard_id INTEGER;
 
-	_, err = tx.Exec(`
-		UPDATE user_feeds 
-		SET grid_position = ? 
-		WHERE user_id = ? AND feed_id = ?
-	`, currentPosition, userID, nextFeedID)
-	if err != nil {
-		return fmt.Errorf("error updating next feed position: %w", err)
-	}
+-- Every existing user starts with one dashboard holding all their feeds.
+INSERT INTO dashboards (user_id, name, position) SELECT id, 'Home', 0 FROM users;
+INSERT INTO dashboard_feeds (dashboard_id, feed_id, position)
+SELECT d.id, uf.feed_id, uf.grid_position
+FROM user_feeds uf
+JOIN dashboards d ON d.user_id = uf.user_id;
+`,
+	},
+	{
+		SequenceId: 11,
+		Sql: `
+-- Explicit grid place of a widget on a dashboard. Widgets without a column
+-- are placed in the first free cell when the dashboard is rendered.
+ALTER TABLE dashboard_feeds ADD COLUMN grid_column INTEGER;
+ALTER TABLE dashboard_feeds ADD COLUMN grid_row INTEGER;
+ALTER TABLE dashboard_feeds ADD COLUMN grid_width INTEGER NOT NULL DEFAULT 1;
+ALTER TABLE dashboard_feeds ADD COLUMN grid_height INTEGER NOT NULL DEFAULT 1;
+`,
+	},
+	{
+		SequenceId: 12,
+		Sql: `
+-- Per-subscription display overrides. NULL or 0 means the user's defaults.
+ALTER TABLE user_feeds ADD COLUMN custom_title TEXT;
+ALTER TABLE user_feeds ADD COLUMN posts_per_feed INTEGER;
+ALTER TABLE user_feeds ADD COLUMN hide_read INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE user_feeds ADD COLUMN show_summaries INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE user_feeds ADD COLUMN collapsed INTEGER NOT NULL DEFAULT 0;
+`,
+	},
+	{
+		SequenceId: 13,
+		Sql: `
+ALTER TABLE user_preferences ADD COLUMN hide_read INTEGER NOT NULL DEFAULT 0;
+`,
+	},
+	{
+		SequenceId: 14,
+		Sql: `
+ALTER TABLE posts ADD COLUMN author TEXT;
 
-	// Commit the transaction
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("error committing transaction: %w", err)
-	}
+-- Per-user rules that hide, mark as seen or highlight matching posts. A NULL
+-- feed_id applies the rule to all of the user's feeds.
+CREATE TABLE filter_rules (
+    id INTEGER PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    feed_id INTEGER,
+    field TEXT NOT NULL,         -- 'title', 'content', 'author' or 'link'
+    regex INTEGER NOT NULL DEFAULT 0,
+    pattern TEXT NOT NULL,
+    action TEXT NOT NULL,        -- 'hide', 'mark_seen' or 'highlight'
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY(feed_id) REFERENCES feeds(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_filter_rules_user_id ON filter_rules(user_id);
+`,
+	},
+	{
+		SequenceId: 15,
+		Sql: `
+-- Credentials for Fever API clients. Clients authenticate with
+-- md5(username:password); only a SHA-256 hash of that key is stored.
+ALTER TABLE users ADD COLUMN fever_username TEXT;
+ALTER TABLE users ADD COLUMN fever_key_hash TEXT;
+CREATE UNIQUE INDEX idx_users_fever_key_hash ON users(fever_key_hash);
+`,
+	},
+	{
+		SequenceId: 16,
+		Sql: `
+-- User-defined tags on subscriptions. Tags compare case-insensitively.
+CREATE TABLE feed_tags (
+    user_id INTEGER NOT NULL,
+    feed_id INTEGER NOT NULL,
+    tag TEXT NOT NULL COLLATE NOCASE,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY(feed_id) REFERENCES feeds(id) ON DELETE CASCADE,
+    PRIMARY KEY(user_id, feed_id, tag)
+);
+`,
+	},
+	{
+		SequenceId: 17,
+		Sql: `
+-- Built-in accounts for installs without an OIDC provider. Local users are
+-- stored with the issuer 'local' and their username as the subject.
+ALTER TABLE users ADD COLUMN password_hash TEXT;
+ALTER TABLE users ADD COLUMN is_admin INTEGER NOT NULL DEFAULT 0;
+
+-- Single-use invitations to register a local account. Only a SHA-256 hash of
+-- the invite code is stored.
+CREATE TABLE invites (
+    id INTEGER PRIMARY KEY,
+    created_by INTEGER NOT NULL,
+    code_hash TEXT NOT NULL UNIQUE,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    used_by INTEGER,
+    used_at DATETIME,
+    FOREIGN KEY(created_by) REFERENCES users(id) ON DELETE CASCADE
+);
 
-	return nil
+-- WebAuthn passkeys of local users. The credential is the JSON encoding used
+-- by the WebAuthn library and is updated after every sign in.
+CREATE TABLE passkeys (
+    id INTEGER PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    credential_id BLOB NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    credential TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_used_at DATETIME,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX idx_passkeys_user_id ON passkeys(user_id);
+`,
+	},
+	{
+		SequenceId: 18,
+		Sql: `
+-- Where the feed was last fetched from after temporary redirects, and when
+-- its publisher reported it gone for good (HTTP 410). Gone feeds are no
+-- longer polled.
+ALTER TABLE feeds ADD COLUMN final_url TEXT;
+ALTER TABLE feeds ADD COLUMN gone_at DATETIME;
+`,
+	},
+	{
+		SequenceId: 19,
+		Sql: `
+-- When a rate-limited feed, or any feed on a rate-limited host, may be
+-- fetched again, as requested with Retry-After.
+ALTER TABLE feeds ADD COLUMN rate_limited_until DATETIME;
+CREATE TABLE host_rate_limits (
+    host TEXT PRIMARY KEY,
+    rate_limited_until DATETIME NOT NULL
+);
+`,
+	},
+	{
+		SequenceId: 20,
+		Sql: `
+-- Feeds fetched with a subscriber's credentials belong to that subscriber
+-- and are never shared, so a URL is only unique among shared feeds and among
+-- each user's own feeds. SQLite cannot drop the UNIQUE constraint on url, so
+-- the table is rebuilt.
+PRAGMA foreign_keys = OFF;
+CREATE TABLE feeds_new (
+    id INTEGER PRIMARY KEY,
+    url TEXT NOT NULL,
+    title TEXT,
+    last_fetched_at DATETIME,
+    etag TEXT,
+    last_modified TEXT,
+    cache_until DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    last_error TEXT,
+    last_error_at DATETIME,
+    consecutive_failures INTEGER NOT NULL DEFAULT 0,
+    last_success_at DATETIME,
+    next_fetch_at DATETIME,
+    ttl_seconds INTEGER,
+    final_url TEXT,
+    gone_at DATETIME,
+    rate_limited_until DATETIME,
+    owner_user_id INTEGER,             -- The only subscriber of a private feed, NULL if shared
+    credentials BLOB,                  -- Encrypted request credentials of a private feed
+    FOREIGN KEY(owner_user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+INSERT INTO feeds_new (id, url, title, last_fetched_at, etag, last_modified, cache_until, created_at,
+                       last_error, last_error_at, consecutive_failures, last_success_at, next_fetch_at,
+                       ttl_seconds, final_url, gone_at, rate_limited_until)
+SELECT id, url, title, last_fetched_at, etag, last_modified, cache_until, created_at,
+       last_error, last_error_at, consecutive_failures, last_success_at, next_fetch_at,
+       ttl_seconds, final_url, gone_at, rate_limited_until
+FROM feeds;
+DROP TABLE feeds;
+ALTER TABLE feeds_new RENAME TO feeds;
+CREATE INDEX idx_feeds_next_fetch_at ON feeds(next_fetch_at);
+CREATE UNIQUE INDEX idx_feeds_shared_url ON feeds(url) WHERE owner_user_id IS NULL;
+CREATE UNIQUE INDEX idx_feeds_owner_url ON feeds(owner_user_id, url) WHERE owner_user_id IS NOT NULL;
+PRAGMA foreign_keys = ON;
+`,
+	},
+	{
+		SequenceId: 21,
+		Sql: `
+-- Item metadata from the feed. Lists are stored as JSON arrays.
+ALTER TABLE posts ADD COLUMN summary TEXT;        -- Publisher's summary, when the post also has full content
+ALTER TABLE posts ADD COLUMN categories TEXT;
+ALTER TABLE posts ADD COLUMN image_url TEXT;
+ALTER TABLE posts ADD COLUMN comments_url TEXT;
+ALTER TABLE posts ADD COLUMN enclosures TEXT;
+ALTER TABLE posts ADD COLUMN source_updated_at DATETIME; -- When the feed says the post was last updated
+`,
+	},
+	{
+		SequenceId: 22,
+		Sql: `
+-- Read-only tokens only give access to output feeds, whose URLs carry the
+-- token and so end up in other services and logs.
+ALTER TABLE api_tokens ADD COLUMN read_only INTEGER NOT NULL DEFAULT 0;
+`,
+	},
 }
 
-func (store *Store) MoveFeedUp(userID int64, i int64) error {
-	// Start a transaction
-	tx, err := store.db.Begin()
-	if err != nil {
-		return fmt.Errorf("error starting transaction: %w", err)
-	}
-	defer tx.Rollback()
-
-	// Get the current feed's grid position
-	var currentPosition int
-	err = tx.QueryRow(`
-		SELECT grid_position 
-		FROM user_feeds 
-		WHERE user_id = ? AND feed_id = ?
-	`, userID, i).Scan(&currentPosition)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return fmt.Errorf("feed not found for user")
-		}
-		return fmt.Errorf("error getting current position: %w", err)
-	}
-
-	// Get the previous feed's ID and position
-	var prevFeedID int64
-	var prevPosition int
-	err = tx.QueryRow(`
-		SELECT feed_id, grid_position 
-		FROM user_feeds 
-		WHERE user_id = ? AND grid_position < ? 
-		ORDER BY grid_position DESC 
-		LIMIT 1
-	`, userID, currentPosition).Scan(&prevFeedID, &prevPosition)
-	if err != nil {
-		if err == sql.ErrNoRows {
-			return fmt.Errorf("no feed above to move up to")
-		}
-		return fmt.Errorf("error getting previous feed: %w", err)
-	}
-
-	// Swap the positions
-	_, err = tx.Exec(`
-		UPDATE user_feeds 
-		SET grid_position = ? 
-		WHERE user_id = ? AND feed_id = ?
-	`, prevPosition, userID, i)
-	if err != nil {
-		return fmt.Errorf("error updating current feed position: %w", err)
-	}
-
-	_, err = tx.Exec(`
-		UPDATE user_feeds 
-		SET grid_position = ? 
-		WHERE user_id = ? AND feed_id = ?
-	`, currentPosition, userID, prevFeedID)
-	if err != nil {
-		return fmt.Errorf("error updating previous feed position: %w", err)
-	}
-
-	// Commit the transaction
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("error committing transaction: %w", err)
-	}
-
-	return nil
+type Store struct {
+	db *sql.DB
+	// credentialsKey encrypts feed credentials; nil if none is configured.
+	credentialsKey []byte
 }
 
 func NewStore(dbPath string) (*Store, error) {
@@ -253,9 +445,38 @@ func (store *Store) Close() error {
 	return store.db.Close()
 }
 
+// sqliteConnectionParams are applied to every pooled connection. The feed
+// updater writes from several goroutines at once: a busy timeout makes
+// writers wait for the lock instead of failing with SQLITE_BUSY, and
+// immediate transactions take the write lock up front so two transactions
+// never deadlock trying to upgrade from a read lock.
+const sqliteConnectionParams = "_busy_timeout=5000&_txlock=immediate"
+
+// sqliteDriver is go-sqlite3 with the SQL functions used by our queries
+// registered on every connection.
+const sqliteDriver = "sqlite3_rssgrid"
+
+func init() {
+	sql.Register(sqliteDriver, &sqlite3.SQLiteDriver{
+		ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+			if err := conn.RegisterFunc("filter_match", filterMatch, true); err != nil {
+				return err
+			}
+			return conn.RegisterFunc("plain_text", plainText, true)
+		},
+	})
+}
+
 func (store *Store) InitAndVerifyDb(dbPath string) error {
+	dsn := dbPath
+	if strings.Contains(dsn, "?") {
+		dsn += "&" + sqliteConnectionParams
+	} else {
+		dsn += "?" + sqliteConnectionParams
+	}
+
 	var err error
-	store.db, err = sql.Open("sqlite3", dbPath)
+	store.db, err = sql.Open(sqliteDriver, dsn)
 	if err != nil {
 		return fmt.Errorf("error opening database: %w", err)
 	}
@@ -308,12 +529,17 @@ func (store *Store) AddFeedForUser(userId int64, url string) (int64, error) {
 	}
 	defer tx.Rollback()
 
-	// Try to insert the feed, or get existing feed ID if it already exists
+	// The user's own private feed for the URL takes the place of the shared
+	// one. Otherwise try to insert the shared feed, or get its ID if it
+	// already exists.
 	var feedId int64
-	err = tx.QueryRow(
-		"INSERT INTO feeds (url) VALUES (?) ON CONFLICT(url) DO UPDATE SET url = url RETURNING id",
-		url,
-	).Scan(&feedId)
+	err = tx.QueryRow("SELECT id FROM feeds WHERE url = ? AND owner_user_id = ?", url, userId).Scan(&feedId)
+	if err == sql.ErrNoRows {
+		err = tx.QueryRow(
+			"INSERT INTO feeds (url) VALUES (?) ON CONFLICT(url) WHERE owner_user_id IS NULL DO UPDATE SET url = url RETURNING id",
+			url,
+		).Scan(&feedId)
+	}
 	if err != nil {
 		return 0, fmt.Errorf("error adding or getting feed: %w", err)
 	}
@@ -343,6 +569,15 @@ func (store *Store) AddFeedForUser(userId int64, url string) (int64, error) {
 		if err != nil {
 			return 0, fmt.Errorf("error associating feed with user: %w", err)
 		}
+
+		// New subscriptions appear on the user's first dashboard.
+		dashboardId, err := ensureDashboard(tx, userId)
+		if err != nil {
+			return 0, err
+		}
+		if err := placeFeedOnDashboard(tx, dashboardId, feedId); err != nil {
+			return 0, err
+		}
 	} else if err != nil {
 		return 0, fmt.Errorf("error checking existing feed association: %w", err)
 	}
@@ -357,61 +592,7 @@ func (store *Store) AddFeedForUser(userId int64, url string) (int64, error) {
 }
 
 func (store *Store) GetUserFeeds(userId int64) ([]Feed, error) {
-	rows, err := store.db.Query(`
-		SELECT f.id, f.url, f.title, f.last_fetched_at, f.etag, f.last_modified, f.cache_until, uf.grid_position,
-		       f.last_error, f.last_error_at, f.consecutive_failures, f.last_success_at
-		FROM feeds f
-		JOIN user_feeds uf ON f.id = uf.feed_id
-		WHERE uf.user_id = ?
-		ORDER BY uf.grid_position ASC
-	`, userId)
-	if err != nil {
-		return nil, fmt.Errorf("error querying user feeds: %w", err)
-	}
-	defer rows.Close()
-
-	var feeds []Feed
-	for rows.Next() {
-		var f Feed
-		var title sql.NullString
-		var lastFetched sql.NullTime
-		var etag sql.NullString
-		var lastModified sql.NullString
-		var cacheUntil sql.NullTime
-		var lastError sql.NullString
-		var lastErrorAt sql.NullTime
-		var lastSuccessAt sql.NullTime
-		err := rows.Scan(&f.ID, &f.URL, &title, &lastFetched, &etag, &lastModified, &cacheUntil, &f.GridPosition, &lastError, &lastErrorAt, &f.ConsecutiveFailures, &lastSuccessAt)
-		if err != nil {
-			return nil, fmt.Errorf("error scanning feed: %w", err)
-		}
-		if title.Valid {
-			f.Title = title.String
-		}
-		if lastFetched.Valid {
-			f.LastFetchedAt = lastFetched.Time
-		}
-		if etag.Valid {
-			f.ETag = etag.String
-		}
-		if lastModified.Valid {
-			f.LastModified = lastModified.String
-		}
-		if cacheUntil.Valid {
-			f.CacheUntil = cacheUntil.Time
-		}
-		if lastError.Valid {
-			f.LastError = lastError.String
-		}
-		if lastErrorAt.Valid {
-			f.LastErrorAt = lastErrorAt.Time
-		}
-		if lastSuccessAt.Valid {
-			f.LastSuccessAt = lastSuccessAt.Time
-		}
-		feeds = append(feeds, f)
-	}
-	return feeds, nil
+	return store.queryUserFeeds("WHERE uf.user_id = ? ORDER BY uf.grid_position ASC", userId)
 }
 
 type Feed struct {
@@ -427,49 +608,351 @@ type Feed struct {
 	LastErrorAt         time.Time
 	ConsecutiveFailures int
 	LastSuccessAt       time.Time
+	NextFetchAt         time.Time
+	TTL                 time.Duration
+	// FinalURL is where the feed was last fetched from if URL temporarily
+	// redirects elsewhere, and empty otherwise.
+	FinalURL string
+	// GoneAt is when the publisher reported the feed as permanently removed.
+	// Gone feeds are not polled any more.
+	GoneAt time.Time
+	// RateLimitedUntil is when the feed's host asked not to be fetched again
+	// before, the last time it rate limited the feed.
+	RateLimitedUntil time.Time
+	// OwnerUserID is the only subscriber of a private feed, which is fetched
+	// with their credentials, and 0 for feeds shared by all subscribers.
+	OwnerUserID int64
+	// HasCredentials is set when the feed is fetched with credentials.
+	HasCredentials bool
+	// Settings are the user's overrides for the subscription. They are only
+	// filled in by queries for one user's feeds, whose Title is then the
+	// custom title if the user set one.
+	Settings FeedSettings
+	// Tags are the user's tags on the subscription in alphabetical order,
+	// filled in like Settings.
+	Tags []string
+}
+
+// HasTag reports whether the feed carries the tag, ignoring case.
+func (f Feed) HasTag(tag string) bool {
+	for _, t := range f.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// RateLimited reports whether the feed's host has asked not to fetch the feed
+// again yet.
+func (f Feed) RateLimited() bool {
+	return f.RateLimitedUntil.After(time.Now())
+}
+
+// FeedSettings are a user's display overrides for one subscription. Zero
+// values mean the user's defaults apply.
+type FeedSettings struct {
+	CustomTitle   string
+	PostsPerFeed  int
+	HideRead      bool
+	ShowSummaries bool
+	Collapsed     bool
 }
 
+// plainTextPolicy strips all markup from post content for the search index.
+var plainTextPolicy = bluemonday.StrictPolicy().AddSpaceWhenStrippingTag(true)
+
 // AddPost adds a post to the database but makes sure that the contents of the post are sanitized using the UGC policy of bluemonday
 func (store *Store) AddPost(feedId int64, guid, title, link string, publishedAt time.Time, content string) error {
-	sanitizedContent := bluemonday.UGCPolicy().Sanitize(content)
-	_, err := store.db.Exec(`
-		INSERT OR IGNORE INTO posts (feed_id, guid, title, link, published_at, content)
-		VALUES (?, ?, ?, ?, ?, ?)
-	`, feedId, guid, title, link, publishedAt, sanitizedContent)
+	_, err := store.UpsertPost(feedId, guid, title, link, "", publishedAt, content)
+	return err
+}
+
+// PostChange describes what UpsertPost did with a post.
+type PostChange int
+
+const (
+	PostUnchanged PostChange = iota
+	PostInserted
+	PostUpdated
+)
+
+// maxPostRevisions is the number of earlier versions kept for each post.
+const maxPostRevisions = 5
+
+// postContentHash fingerprints the parts of a post a publisher may edit.
+func postContentHash(title, link, sanitizedContent string) string {
+	sum := sha256.Sum256([]byte(title + "\x00" + link + "\x00" + sanitizedContent))
+	return hex.EncodeToString(sum[:])
+}
+
+// PostMetadata is what a feed says about a post besides its title, link,
+// author and content.
+type PostMetadata struct {
+	// Summary is the publisher's summary of a post that also has full
+	// content, sanitized like the content.
+	Summary     string
+	Categories  []string
+	ImageURL    string
+	CommentsURL string
+	Enclosures  []Enclosure
+	// SourceUpdatedAt is when the feed says the post was last updated; zero
+	// if it does not say. Unlike Post.UpdatedAt it is not a detected change.
+	SourceUpdatedAt time.Time
+}
+
+// Enclosure is a file attached to a post, such as a podcast episode.
+type Enclosure struct {
+	URL    string `json:"url"`
+	Type   string `json:"type,omitempty"`
+	Length int64  `json:"length,omitempty"`
+}
+
+// columnValues returns the values of the summary, categories, image_url,
+// comments_url, enclosures and source_updated_at columns, in that order.
+func (m PostMetadata) columnValues() ([]any, error) {
+	categories, err := jsonList(m.Categories, len(m.Categories))
 	if err != nil {
-		return fmt.Errorf("error adding post: %w", err)
+		return nil, fmt.Errorf("error encoding post categories: %w", err)
 	}
-	return nil
+	enclosures, err := jsonList(m.Enclosures, len(m.Enclosures))
+	if err != nil {
+		return nil, fmt.Errorf("error encoding post enclosures: %w", err)
+	}
+	return []any{
+		bluemonday.UGCPolicy().Sanitize(m.Summary),
+		categories,
+		m.ImageURL,
+		m.CommentsURL,
+		enclosures,
+		sql.NullTime{Time: m.SourceUpdatedAt, Valid: !m.SourceUpdatedAt.IsZero()},
+	}, nil
 }
 
-// PruneFeedPosts deletes old posts for a feed, keeping only the most recent `keep` posts.
-func (store *Store) PruneFeedPosts(feedId int64, keep int) error {
-	_, err := store.db.Exec(`
-		DELETE FROM posts
-		WHERE id IN (
-			SELECT id FROM posts
-			WHERE feed_id = ?
-			ORDER BY published_at DESC
-			LIMIT -1 OFFSET ?
-		)
-	`, feedId, keep)
+// jsonList encodes a list as a JSON array, or as NULL if it is empty.
+func jsonList(list any, length int) (sql.NullString, error) {
+	if length == 0 {
+		return sql.NullString{}, nil
+	}
+	encoded, err := json.Marshal(list)
+	if err != nil {
+		return sql.NullString{}, err
+	}
+	return sql.NullString{String: string(encoded), Valid: true}, nil
+}
+
+// decodeLists fills the categories and enclosures of m from their JSON
+// columns.
+func (m *PostMetadata) decodeLists(categories, enclosures sql.NullString) error {
+	if categories.Valid {
+		if err := json.Unmarshal([]byte(categories.String), &m.Categories); err != nil {
+			return fmt.Errorf("error decoding post categories: %w", err)
+		}
+	}
+	if enclosures.Valid {
+		if err := json.Unmarshal([]byte(enclosures.String), &m.Enclosures); err != nil {
+			return fmt.Errorf("error decoding post enclosures: %w", err)
+		}
+	}
+	return nil
+}
+
+// UpsertPost adds a post like AddPost. If the feed already has a post with
+// the same guid whose title, link or content differ, the post is updated
+// instead: the previous version is kept as a revision and users who opted in
+// see the post as unseen again.
+func (store *Store) UpsertPost(feedId int64, guid, title, link, author string, publishedAt time.Time, content string) (PostChange, error) {
+	return store.UpsertPostWithMetadata(feedId, guid, title, link, author, publishedAt, content, PostMetadata{})
+}
+
+// UpsertPostWithMetadata is UpsertPost for a post with metadata. Changes to
+// the metadata alone are stored without a revision and do not count as an
+// update of the post.
+func (store *Store) UpsertPostWithMetadata(feedId int64, guid, title, link, author string, publishedAt time.Time, content string, metadata PostMetadata) (PostChange, error) {
+	sanitizedContent := bluemonday.UGCPolicy().Sanitize(content)
+	hash := postContentHash(title, link, sanitizedContent)
+	metadataValues, err := metadata.columnValues()
+	if err != nil {
+		return PostUnchanged, err
+	}
+
+	tx, err := store.db.Begin()
+	if err != nil {
+		return PostUnchanged, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var postId int64
+	var oldTitle, oldLink, oldContent string
+	var oldHash sql.NullString
+	err = tx.QueryRow(`
+		SELECT id, COALESCE(title, ''), link, COALESCE(content, ''), content_hash
+		FROM posts
+		WHERE feed_id = ? AND guid = ?
+	`, feedId, guid).Scan(&postId, &oldTitle, &oldLink, &oldContent, &oldHash)
+
+	change := PostUnchanged
+	switch {
+	case err == sql.ErrNoRows:
+		res, err := tx.Exec(`
+			INSERT INTO posts (feed_id, guid, title, link, author, published_at, content, content_hash,
+			                   summary, categories, image_url, comments_url, enclosures, source_updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, append([]any{feedId, guid, title, link, author, publishedAt, sanitizedContent, hash}, metadataValues...)...)
+		if err != nil {
+			return PostUnchanged, fmt.Errorf("error adding post: %w", err)
+		}
+		postId, err = res.LastInsertId()
+		if err != nil {
+			return PostUnchanged, fmt.Errorf("error getting last insert id: %w", err)
+		}
+		if err := indexPost(tx, postId, title, sanitizedContent); err != nil {
+			return PostUnchanged, err
+		}
+		change = PostInserted
+	case err != nil:
+		return PostUnchanged, fmt.Errorf("error looking up existing post: %w", err)
+	case oldHash.Valid && oldHash.String == hash:
+		// Unchanged, nothing to do.
+	case !oldHash.Valid && postContentHash(oldTitle, oldLink, oldContent) == hash:
+		// Stored before hashes existed and unchanged since.
+		if _, err := tx.Exec("UPDATE posts SET content_hash = ? WHERE id = ?", hash, postId); err != nil {
+			return PostUnchanged, fmt.Errorf("error storing post hash: %w", err)
+		}
+	default:
+		if err := updatePost(tx, postId, oldTitle, oldLink, oldContent, title, link, author, sanitizedContent, hash); err != nil {
+			return PostUnchanged, err
+		}
+		change = PostUpdated
+	}
+
+	if change != PostInserted {
+		if err := updatePostMetadata(tx, postId, author, metadataValues); err != nil {
+			return PostUnchanged, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return PostUnchanged, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return change, nil
+}
+
+// updatePostMetadata stores the author and metadata column values of an
+// existing post, writing only if they changed.
+func updatePostMetadata(tx *sql.Tx, postId int64, author string, metadataValues []any) error {
+	_, err := tx.Exec(`
+		UPDATE posts
+		SET author = ?1, summary = ?2, categories = ?3, image_url = ?4, comments_url = ?5,
+		    enclosures = ?6, source_updated_at = ?7
+		WHERE id = ?8
+		AND (author IS NOT ?1 OR summary IS NOT ?2 OR categories IS NOT ?3 OR image_url IS NOT ?4
+		     OR comments_url IS NOT ?5 OR enclosures IS NOT ?6 OR source_updated_at IS NOT ?7)
+	`, append(append([]any{author}, metadataValues...), postId)...)
+	if err != nil {
+		return fmt.Errorf("error updating post metadata: %w", err)
+	}
+	return nil
+}
+
+// updatePost replaces the content of an existing post, keeping the previous
+// version as a revision.
+func updatePost(tx *sql.Tx, postId int64, oldTitle, oldLink, oldContent, title, link, author, sanitizedContent, hash string) error {
+	now := time.Now().UTC()
+	if _, err := tx.Exec(`
+		INSERT INTO post_revisions (post_id, title, link, content, replaced_at)
+		VALUES (?, ?, ?, ?, ?)
+	`, postId, oldTitle, oldLink, oldContent, now); err != nil {
+		return fmt.Errorf("error saving post revision: %w", err)
+	}
+	if _, err := tx.Exec(`
+		DELETE FROM post_revisions
+		WHERE id IN (
+			SELECT id FROM post_revisions
+			WHERE post_id = ?
+			ORDER BY id DESC
+			LIMIT -1 OFFSET ?
+		)
+	`, postId, maxPostRevisions); err != nil {
+		return fmt.Errorf("error pruning post revisions: %w", err)
+	}
+	if _, err := tx.Exec(`
+		UPDATE posts SET title = ?, link = ?, author = ?, content = ?, content_hash = ?, updated_at = ?
+		WHERE id = ?
+	`, title, link, author, sanitizedContent, hash, now, postId); err != nil {
+		return fmt.Errorf("error updating post: %w", err)
+	}
+	if _, err := tx.Exec(`
+		UPDATE user_post_states SET seen = 0
+		WHERE post_id = ?
+		AND user_id IN (SELECT user_id FROM user_preferences WHERE unseen_on_update = 1)
+	`, postId); err != nil {
+		return fmt.Errorf("error resetting seen state of updated post: %w", err)
+	}
+	return indexPost(tx, postId, title, sanitizedContent)
+}
+
+// plainText returns the text of HTML post content, as it is indexed for
+// search. It is also available to SQL as plain_text.
+func plainText(content string) string {
+	return html.UnescapeString(plainTextPolicy.Sanitize(content))
+}
+
+// indexPost adds (or replaces) the search index entry for a post.
+func indexPost(tx *sql.Tx, postId int64, title, content string) error {
+	if _, err := tx.Exec("DELETE FROM posts_fts WHERE rowid = ?", postId); err != nil {
+		return fmt.Errorf("error removing stale search index entry: %w", err)
+	}
+	if _, err := tx.Exec(
+		"INSERT INTO posts_fts (rowid, title, body) VALUES (?, ?, ?)",
+		postId, title, plainText(content),
+	); err != nil {
+		return fmt.Errorf("error indexing post: %w", err)
+	}
+	return nil
+}
+
+// PruneFeedPosts deletes old posts for a feed, keeping only the most recent `keep` posts.
+// Posts starred by any user are never deleted.
+func (store *Store) PruneFeedPosts(feedId int64, keep int) error {
+	_, err := store.db.Exec(`
+		DELETE FROM posts
+		WHERE id IN (
+			SELECT id FROM posts
+			WHERE feed_id = ?
+			ORDER BY published_at DESC
+			LIMIT -1 OFFSET ?
+		)
+		AND id NOT IN (SELECT post_id FROM user_post_states WHERE starred = 1)
+	`, feedId, keep)
 	if err != nil {
 		return fmt.Errorf("error pruning feed posts: %w", err)
 	}
 	return nil
 }
 
-// GetFeedPosts gets the posts for a given feed and user, and returns them in descending order of published_at
+// GetFeedPosts gets the posts for a given feed and user, and returns them in descending order of published_at.
+// Posts the user has seen are left out if they chose to hide read posts for the feed or for all feeds,
+// as are posts matching one of the user's hide filter rules.
 func (store *Store) GetFeedPosts(feedId int64, userId int64, limit int) ([]Post, error) {
 	rows, err := store.db.Query(`
 		SELECT p.id, p.title, p.link, p.published_at, p.content,
-		       COALESCE(ups.seen, 0) as seen
+		       COALESCE(ups.seen, 0) as seen, COALESCE(ups.starred, 0) as starred, p.updated_at,
+		       EXISTS (
+		           SELECT 1 FROM filter_rules fr
+		           WHERE fr.user_id = ? AND fr.action = 'highlight' AND `+filterRuleMatches+`
+		       ) as highlighted,
+		       COALESCE(p.author, ''), COALESCE(p.summary, '')
 		FROM posts p
 		LEFT JOIN user_post_states ups ON p.id = ups.post_id AND ups.user_id = ?
+		LEFT JOIN user_feeds uf ON uf.feed_id = p.feed_id AND uf.user_id = ?
+		LEFT JOIN user_preferences up ON up.user_id = ?
 		WHERE p.feed_id = ?
+		AND ((COALESCE(uf.hide_read, 0) = 0 AND COALESCE(up.hide_read, 0) = 0) OR COALESCE(ups.seen, 0) = 0)
+		AND `+notHiddenByFilter+`
 		ORDER BY p.published_at DESC
 		LIMIT ?
-	`, userId, feedId, limit)
+	`, userId, userId, userId, userId, feedId, userId, limit)
 	if err != nil {
 		return nil, fmt.Errorf("error querying feed posts: %w", err)
 	}
@@ -478,10 +961,12 @@ func (store *Store) GetFeedPosts(feedId int64, userId int64, limit int) ([]Post,
 	var posts []Post
 	for rows.Next() {
 		var p Post
-		err := rows.Scan(&p.ID, &p.Title, &p.Link, &p.PublishedAt, &p.Content, &p.Seen)
+		var updatedAt sql.NullTime
+		err := rows.Scan(&p.ID, &p.Title, &p.Link, &p.PublishedAt, &p.Content, &p.Seen, &p.Starred, &updatedAt, &p.Highlighted, &p.Author, &p.Summary)
 		if err != nil {
 			return nil, fmt.Errorf("error scanning post: %w", err)
 		}
+		p.UpdatedAt = updatedAt.Time
 		posts = append(posts, p)
 	}
 	return posts, nil
@@ -494,6 +979,22 @@ type Post struct {
 	PublishedAt time.Time
 	Content     string
 	Seen        bool
+	Starred     bool
+	// UpdatedAt is when the publisher last changed the post; zero if never.
+	UpdatedAt time.Time
+	// Highlighted is set when the post matches one of the user's highlight
+	// filter rules.
+	Highlighted bool
+	Author      string
+	PostMetadata
+}
+
+// PostRevision is an earlier version of a post that its publisher changed.
+type PostRevision struct {
+	Title      string
+	Link       string
+	Content    string
+	ReplacedAt time.Time
 }
 
 // MarkPostAsSeenForUser marks a post as seen for a given user, but only if the
@@ -550,167 +1051,104 @@ func (store *Store) MarkAllFeedPostsAsSeenForUser(userID, feedID int64) error {
 	return nil
 }
 
-func (store *Store) GetAllFeeds() ([]Feed, error) {
-	rows, err := store.db.Query(`
-		SELECT id, url, title, last_fetched_at, etag, last_modified, cache_until,
-		       last_error, last_error_at, consecutive_failures, last_success_at
-		FROM feeds
-	`)
-	if err != nil {
-		return nil, fmt.Errorf("error querying feeds: %w", err)
-	}
-	defer rows.Close()
-
-	var feeds []Feed
-	for rows.Next() {
-		var f Feed
-		var lastFetched sql.NullTime
-		var etag sql.NullString
-		var lastModified sql.NullString
-		var cacheUntil sql.NullTime
-		var lastError sql.NullString
-		var lastErrorAt sql.NullTime
-		var lastSuccessAt sql.NullTime
-		var title sql.NullString
-		err := rows.Scan(&f.ID, &f.URL, &title, &lastFetched, &etag, &lastModified, &cacheUntil, &lastError, &lastErrorAt, &f.ConsecutiveFailures, &lastSuccessAt)
-		if err != nil {
-			return nil, fmt.Errorf("error scanning feed: %w", err)
-		}
-		if title.Valid {
-			f.Title = title.String
-		}
-		if lastFetched.Valid {
-			f.LastFetchedAt = lastFetched.Time
-		}
-		if etag.Valid {
-			f.ETag = etag.String
-		}
-		if lastModified.Valid {
-			f.LastModified = lastModified.String
-		}
-		if cacheUntil.Valid {
-			f.CacheUntil = cacheUntil.Time
-		}
-		if lastError.Valid {
-			f.LastError = lastError.String
-		}
-		if lastErrorAt.Valid {
-			f.LastErrorAt = lastErrorAt.Time
-		}
-		if lastSuccessAt.Valid {
-			f.LastSuccessAt = lastSuccessAt.Time
-		}
-		feeds = append(feeds, f)
+// SetPostStarredForUser stars or unstars a post for a user, but only if the
+// post belongs to one of the user's subscribed feeds. It returns sql.ErrNoRows
+// when the post is not accessible to the user.
+func (store *Store) SetPostStarredForUser(userID, postID int64, starred bool) error {
+	var starredAt any
+	if starred {
+		starredAt = time.Now().UTC()
 	}
-	return feeds, nil
-}
-
-func (store *Store) UpdateFeedTitle(feedId int64, title string) error {
-	_, err := store.db.Exec(`
-		UPDATE feeds
-		SET title = ?
-		WHERE id = ?
-	`, title, feedId)
+	res, err := store.db.Exec(`
+		INSERT INTO user_post_states (user_id, post_id, starred, starred_at)
+		SELECT ?, p.id, ?, ?
+		FROM posts p
+		JOIN user_feeds uf ON uf.feed_id = p.feed_id AND uf.user_id = ?
+		WHERE p.id = ?
+		ON CONFLICT(user_id, post_id) DO UPDATE SET starred = excluded.starred, starred_at = excluded.starred_at
+	`, userID, starred, starredAt, userID, postID)
 	if err != nil {
-		return fmt.Errorf("error updating feed title: %w", err)
+		return fmt.Errorf("error setting post starred state for user: %w", err)
 	}
-	return nil
-}
-
-func (store *Store) UpdateFeedLastFetched(feedId int64, timestamp time.Time) error {
-	_, err := store.db.Exec(`
-		UPDATE feeds
-		SET last_fetched_at = ?
-		WHERE id = ?
-	`, timestamp, feedId)
+	rows, err := res.RowsAffected()
 	if err != nil {
-		return fmt.Errorf("error updating feed last fetched: %w", err)
+		return fmt.Errorf("error getting rows affected: %w", err)
 	}
-	return nil
-}
-
-// RecordFeedFailure records a fetch failure on the feed: it increments
-// consecutive_failures and stores the error message and timestamp.
-func (store *Store) RecordFeedFailure(feedID int64, fetchErr error, at time.Time) error {
-	_, err := store.db.Exec(`
-		UPDATE feeds
-		SET last_error = ?, last_error_at = ?, consecutive_failures = consecutive_failures + 1
-		WHERE id = ?
-	`, fetchErr.Error(), at, feedID)
-	if err != nil {
-		return fmt.Errorf("error recording feed failure: %w", err)
+	if rows == 0 {
+		return sql.ErrNoRows
 	}
 	return nil
 }
 
-// RecordFeedSuccess clears any failure state and records the time of a
-// successful fetch, resetting consecutive_failures to 0.
-func (store *Store) RecordFeedSuccess(feedID int64, at time.Time) error {
-	_, err := store.db.Exec(`
-		UPDATE feeds
-		SET last_error = NULL, last_error_at = NULL, consecutive_failures = 0, last_success_at = ?
-		WHERE id = ?
-	`, at, feedID)
-	if err != nil {
-		return fmt.Errorf("error recording feed success: %w", err)
-	}
-	return nil
+// StarredPost is a post the user has starred.
+type StarredPost struct {
+	Post
+	FeedID    int64
+	FeedTitle string
+	FeedURL   string
+	StarredAt time.Time
 }
 
-// DeleteFeedForUser removes a user's subscription to a feed. If no users
-// remain subscribed, the feed row (and its posts, via cascade) is deleted as
-// well. It returns sql.ErrNoRows when the user is not subscribed to the feed.
-func (store *Store) DeleteFeedForUser(userID, feedID int64) error {
-	tx, err := store.db.Begin()
+// GetStarredPostsForUser returns the posts the user has starred in any of
+// their subscribed feeds, most recently starred first.
+func (store *Store) GetStarredPostsForUser(userID int64) ([]StarredPost, error) {
+	rows, err := store.db.Query(`
+		SELECT p.id, p.title, p.link, p.published_at, p.content, ups.seen, ups.starred,
+		       f.id, COALESCE(NULLIF(uf.custom_title, ''), f.title, ''), f.url, ups.starred_at
+		FROM user_post_states ups
+		JOIN posts p ON p.id = ups.post_id
+		JOIN user_feeds uf ON uf.feed_id = p.feed_id AND uf.user_id = ups.user_id
+		JOIN feeds f ON f.id = p.feed_id
+		WHERE ups.user_id = ? AND ups.starred = 1
+		ORDER BY ups.starred_at DESC, p.id DESC
+	`, userID)
 	if err != nil {
-		return fmt.Errorf("error starting transaction: %w", err)
+		return nil, fmt.Errorf("error querying starred posts: %w", err)
 	}
-	defer tx.Rollback()
+	defer rows.Close()
 
-	res, err := tx.Exec(
-		"DELETE FROM user_feeds WHERE user_id = ? AND feed_id = ?",
-		userID, feedID,
-	)
-	if err != nil {
-		return fmt.Errorf("error deleting user feed subscription: %w", err)
-	}
-	rows, err := res.RowsAffected()
-	if err != nil {
-		return fmt.Errorf("error getting rows affected: %w", err)
-	}
-	if rows == 0 {
-		return sql.ErrNoRows
+	var posts []StarredPost
+	for rows.Next() {
+		var p StarredPost
+		var starredAt sql.NullTime
+		err := rows.Scan(&p.ID, &p.Title, &p.Link, &p.PublishedAt, &p.Content, &p.Seen, &p.Starred,
+			&p.FeedID, &p.FeedTitle, &p.FeedURL, &starredAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning starred post: %w", err)
+		}
+		p.StarredAt = starredAt.Time
+		posts = append(posts, p)
 	}
+	return posts, rows.Err()
+}
 
-	// Garbage-collect the feed row when no subscribers remain.
-	if _, err := tx.Exec(`
-		DELETE FROM feeds
-		WHERE id = ? AND NOT EXISTS (
-			SELECT 1 FROM user_feeds WHERE feed_id = ?
-		)
-	`, feedID, feedID); err != nil {
-		return fmt.Errorf("error garbage-collecting orphaned feed: %w", err)
-	}
+func (store *Store) GetAllFeeds() ([]Feed, error) {
+	return store.queryFeeds("")
+}
 
-	if err := tx.Commit(); err != nil {
-		return fmt.Errorf("error committing transaction: %w", err)
-	}
-	return nil
+// GetDueFeeds returns the feeds whose next scheduled fetch is at or before
+// now, including feeds that have never been scheduled, most overdue first.
+// Gone feeds are never due.
+func (store *Store) GetDueFeeds(now time.Time) ([]Feed, error) {
+	return store.queryFeeds(
+		"WHERE gone_at IS NULL AND (next_fetch_at IS NULL OR next_fetch_at <= ?) ORDER BY next_fetch_at",
+		now.UTC(),
+	)
 }
 
-func (store *Store) UpdateFeedCacheInfo(feedId int64, etag, lastModified string, cacheUntil time.Time) error {
-	_, err := store.db.Exec(`
-		UPDATE feeds
-		SET etag = ?, last_modified = ?, cache_until = ?
-		WHERE id = ?
-	`, etag, lastModified, cacheUntil, feedId)
-	if err != nil {
-		return fmt.Errorf("error updating feed cache info: %w", err)
-	}
-	return nil
+// feedColumns are the columns read by scanFeed, in order.
+const feedColumns = `id, url, title, last_fetched_at, etag, last_modified, cache_until,
+		       last_error, last_error_at, consecutive_failures, last_success_at,
+		       next_fetch_at, ttl_seconds, final_url, gone_at, rate_limited_until,
+		       owner_user_id, credentials IS NOT NULL`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
 }
 
-func (store *Store) GetFeedByURL(url string) (*Feed, error) {
+// scanFeed scans a row selected with feedColumns into a Feed.
+func scanFeed(row rowScanner, extra ...any) (Feed, error) {
 	var f Feed
 	var lastFetched sql.NullTime
 	var etag sql.NullString
@@ -719,22 +1157,20 @@ func (store *Store) GetFeedByURL(url string) (*Feed, error) {
 	var lastError sql.NullString
 	var lastErrorAt sql.NullTime
 	var lastSuccessAt sql.NullTime
+	var nextFetchAt sql.NullTime
+	var ttlSeconds sql.NullInt64
 	var title sql.NullString
-
-	err := store.db.QueryRow(`
-		SELECT id, url, title, last_fetched_at, etag, last_modified, cache_until,
-		       last_error, last_error_at, consecutive_failures, last_success_at
-		FROM feeds
-		WHERE url = ?
-	`, url).Scan(&f.ID, &f.URL, &title, &lastFetched, &etag, &lastModified, &cacheUntil, &lastError, &lastErrorAt, &f.ConsecutiveFailures, &lastSuccessAt)
-
-	if err == sql.ErrNoRows {
-		return nil, nil
-	}
+	var finalURL sql.NullString
+	var goneAt sql.NullTime
+	var rateLimitedUntil sql.NullTime
+	var ownerUserID sql.NullInt64
+	dest := []any{&f.ID, &f.URL, &title, &lastFetched, &etag, &lastModified, &cacheUntil,
+		&lastError, &lastErrorAt, &f.ConsecutiveFailures, &lastSuccessAt, &nextFetchAt, &ttlSeconds,
+		&finalURL, &goneAt, &rateLimitedUntil, &ownerUserID, &f.HasCredentials}
+	err := row.Scan(append(dest, extra...)...)
 	if err != nil {
-		return nil, fmt.Errorf("error querying feed by URL: %w", err)
+		return Feed{}, err
 	}
-
 	if title.Valid {
 		f.Title = title.String
 	}
@@ -759,92 +1195,2434 @@ func (store *Store) GetFeedByURL(url string) (*Feed, error) {
 	if lastSuccessAt.Valid {
 		f.LastSuccessAt = lastSuccessAt.Time
 	}
-
-	return &f, nil
+	if nextFetchAt.Valid {
+		f.NextFetchAt = nextFetchAt.Time
+	}
+	if ttlSeconds.Valid {
+		f.TTL = time.Duration(ttlSeconds.Int64) * time.Second
+	}
+	f.FinalURL = finalURL.String
+	if goneAt.Valid {
+		f.GoneAt = goneAt.Time
+	}
+	if rateLimitedUntil.Valid {
+		f.RateLimitedUntil = rateLimitedUntil.Time
+	}
+	f.OwnerUserID = ownerUserID.Int64
+	return f, nil
 }
 
-// GetUserPostsPerFeed gets the number of posts per feed for a user
-func (store *Store) GetUserPostsPerFeed(userId int64) (int, error) {
-	var postsPerFeed int
-	err := store.db.QueryRow(`
-		SELECT posts_per_feed 
-		FROM user_preferences 
-		WHERE user_id = ?
-	`, userId).Scan(&postsPerFeed)
-
-	if err == sql.ErrNoRows {
-		// Return default value if no preference is set
-		return 10, nil
-	}
+// queryFeeds returns all feeds matching the given WHERE/ORDER BY clause.
+func (store *Store) queryFeeds(clause string, args ...any) ([]Feed, error) {
+	rows, err := store.db.Query("SELECT "+feedColumns+" FROM feeds "+clause, args...)
 	if err != nil {
-		return 0, fmt.Errorf("error querying user posts per feed preference: %w", err)
+		return nil, fmt.Errorf("error querying feeds: %w", err)
 	}
+	defer rows.Close()
 
-	return postsPerFeed, nil
+	var feeds []Feed
+	for rows.Next() {
+		f, err := scanFeed(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning feed: %w", err)
+		}
+		feeds = append(feeds, f)
+	}
+	return feeds, rows.Err()
 }
 
-// SetUserPostsPerFeed sets the number of posts per feed for a user
-func (store *Store) SetUserPostsPerFeed(userId int64, postsPerFeed int) error {
-	_, err := store.db.Exec(`
-		INSERT INTO user_preferences (user_id, posts_per_feed) 
-		VALUES (?, ?) 
-		ON CONFLICT(user_id) DO UPDATE SET posts_per_feed = ?
-	`, userId, postsPerFeed, postsPerFeed)
+// userFeedColumns are the columns of feedColumns followed by the user's
+// settings for the subscription, for queries joining user_feeds as uf.
+const userFeedColumns = `feeds.id, feeds.url, COALESCE(NULLIF(uf.custom_title, ''), feeds.title),
+		       feeds.last_fetched_at, feeds.etag, feeds.last_modified, feeds.cache_until,
+		       feeds.last_error, feeds.last_error_at, feeds.consecutive_failures, feeds.last_success_at,
+		       feeds.next_fetch_at, feeds.ttl_seconds, feeds.final_url, feeds.gone_at, feeds.rate_limited_until,
+		       feeds.owner_user_id, feeds.credentials IS NOT NULL,
+		       COALESCE(uf.grid_position, 0), COALESCE(uf.custom_title, ''), COALESCE(uf.posts_per_feed, 0),
+		       uf.hide_read, uf.show_summaries, uf.collapsed,
+		       COALESCE((SELECT group_concat(tag, char(31)) FROM (
+		           SELECT ft.tag FROM feed_tags ft
+		           WHERE ft.user_id = uf.user_id AND ft.feed_id = feeds.id
+		           ORDER BY ft.tag
+		       )), '')`
+
+// tagSeparator joins the tags of a feed in userFeedColumns. It cannot occur
+// in tags, which are single lines of text.
+const tagSeparator = "\x1f"
+
+// queryUserFeeds returns the subscriptions matching the given clause, which
+// must restrict uf.user_id, together with their settings.
+func (store *Store) queryUserFeeds(clause string, args ...any) ([]Feed, error) {
+	rows, err := store.db.Query("SELECT "+userFeedColumns+" FROM feeds JOIN user_feeds uf ON uf.feed_id = feeds.id "+clause, args...)
 	if err != nil {
-		return fmt.Errorf("error setting user posts per feed preference: %w", err)
+		return nil, fmt.Errorf("error querying user feeds: %w", err)
 	}
-	return nil
-}
+	defer rows.Close()
 
-// GetPostForUser retrieves a single post by its ID, but only if the post's feed
+	var feeds []Feed
+	for rows.Next() {
+		var gridPosition int
+		var settings FeedSettings
+		var tags string
+		f, err := scanFeed(rows, &gridPosition, &settings.CustomTitle, &settings.PostsPerFeed,
+			&settings.HideRead, &settings.ShowSummaries, &settings.Collapsed, &tags)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning user feed: %w", err)
+		}
+		f.GridPosition = gridPosition
+		f.Settings = settings
+		if tags != "" {
+			f.Tags = strings.Split(tags, tagSeparator)
+		}
+		feeds = append(feeds, f)
+	}
+	return feeds, rows.Err()
+}
+
+// SetFeedTagsForUser replaces the user's tags on a subscription. The caller
+// normalizes the tags. It returns sql.ErrNoRows if the user is not subscribed
+// to the feed.
+func (store *Store) SetFeedTagsForUser(userId, feedId int64, tags []string) error {
+	return store.updateFeedTags(userId, feedId, tags, true)
+}
+
+// AddFeedTagsForUser adds tags to a subscription, keeping the tags it has.
+// It returns sql.ErrNoRows if the user is not subscribed to the feed.
+func (store *Store) AddFeedTagsForUser(userId, feedId int64, tags []string) error {
+	return store.updateFeedTags(userId, feedId, tags, false)
+}
+
+func (store *Store) updateFeedTags(userId, feedId int64, tags []string, replace bool) error {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var subscribed int
+	err = tx.QueryRow(
+		"SELECT COUNT(*) FROM user_feeds WHERE user_id = ? AND feed_id = ?",
+		userId, feedId,
+	).Scan(&subscribed)
+	if err != nil {
+		return fmt.Errorf("error checking feed subscription: %w", err)
+	}
+	if subscribed == 0 {
+		return sql.ErrNoRows
+	}
+
+	if replace {
+		if _, err := tx.Exec("DELETE FROM feed_tags WHERE user_id = ? AND feed_id = ?", userId, feedId); err != nil {
+			return fmt.Errorf("error removing feed tags: %w", err)
+		}
+	}
+	for _, tag := range tags {
+		if _, err := tx.Exec(
+			"INSERT OR IGNORE INTO feed_tags (user_id, feed_id, tag) VALUES (?, ?, ?)",
+			userId, feedId, tag,
+		); err != nil {
+			return fmt.Errorf("error adding feed tag: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// GetTagsForUser lists the distinct tags on the user's subscriptions in
+// alphabetical order.
+func (store *Store) GetTagsForUser(userId int64) ([]string, error) {
+	rows, err := store.db.Query(`
+		SELECT MIN(tag) FROM feed_tags
+		WHERE user_id = ?
+		GROUP BY tag
+		ORDER BY tag
+	`, userId)
+	if err != nil {
+		return nil, fmt.Errorf("error querying tags: %w", err)
+	}
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, fmt.Errorf("error scanning tag: %w", err)
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
+
+// MarkTagPostsAsSeenForUser marks every post in the user's feeds with the
+// tag as seen. It returns sql.ErrNoRows if none of their feeds has the tag.
+func (store *Store) MarkTagPostsAsSeenForUser(userId int64, tag string) error {
+	result, err := store.db.Exec(`
+		INSERT INTO user_post_states (user_id, post_id, seen)
+		SELECT ?, p.id, 1
+		FROM posts p
+		WHERE p.feed_id IN (SELECT feed_id FROM feed_tags WHERE user_id = ? AND tag = ?)
+		ON CONFLICT(user_id, post_id) DO UPDATE SET seen = 1
+	`, userId, userId, tag)
+	if err != nil {
+		return fmt.Errorf("error marking tag posts as seen for user: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking tag posts update: %w", err)
+	}
+	if affected > 0 {
+		return nil
+	}
+
+	// No posts changed; tell an unknown tag apart from a tag without posts.
+	var tagged int
+	err = store.db.QueryRow("SELECT COUNT(*) FROM feed_tags WHERE user_id = ? AND tag = ?", userId, tag).Scan(&tagged)
+	if err != nil {
+		return fmt.Errorf("error checking tag: %w", err)
+	}
+	if tagged == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SetFeedSettingsForUser stores the user's overrides for a subscription. It
+// returns sql.ErrNoRows if the user is not subscribed to the feed.
+func (store *Store) SetFeedSettingsForUser(userId, feedId int64, settings FeedSettings) error {
+	var customTitle sql.NullString
+	if settings.CustomTitle != "" {
+		customTitle = sql.NullString{String: settings.CustomTitle, Valid: true}
+	}
+	var postsPerFeed sql.NullInt64
+	if settings.PostsPerFeed > 0 {
+		postsPerFeed = sql.NullInt64{Int64: int64(settings.PostsPerFeed), Valid: true}
+	}
+	result, err := store.db.Exec(`
+		UPDATE user_feeds
+		SET custom_title = ?, posts_per_feed = ?, hide_read = ?, show_summaries = ?, collapsed = ?
+		WHERE user_id = ? AND feed_id = ?
+	`, customTitle, postsPerFeed, settings.HideRead, settings.ShowSummaries, settings.Collapsed, userId, feedId)
+	if err != nil {
+		return fmt.Errorf("error setting feed settings: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking feed settings update: %w", err)
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ScheduleFeedFetch records when a feed should next be fetched, together with
+// the publisher's requested polling interval (zero if none).
+func (store *Store) ScheduleFeedFetch(feedID int64, nextFetchAt time.Time, ttl time.Duration) error {
+	var ttlSeconds sql.NullInt64
+	if ttl > 0 {
+		ttlSeconds = sql.NullInt64{Int64: int64(ttl / time.Second), Valid: true}
+	}
+	_, err := store.db.Exec(
+		"UPDATE feeds SET next_fetch_at = ?, ttl_seconds = ? WHERE id = ?",
+		nextFetchAt.UTC(), ttlSeconds, feedID,
+	)
+	if err != nil {
+		return fmt.Errorf("error scheduling feed fetch: %w", err)
+	}
+	return nil
+}
+
+// GetFeedPostTimes returns the publication times of a feed's most recent
+// posts, newest first.
+func (store *Store) GetFeedPostTimes(feedID int64, limit int) ([]time.Time, error) {
+	rows, err := store.db.Query(`
+		SELECT published_at
+		FROM posts
+		WHERE feed_id = ? AND published_at IS NOT NULL
+		ORDER BY published_at DESC
+		LIMIT ?
+	`, feedID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error querying post times: %w", err)
+	}
+	defer rows.Close()
+
+	var times []time.Time
+	for rows.Next() {
+		var t time.Time
+		if err := rows.Scan(&t); err != nil {
+			return nil, fmt.Errorf("error scanning post time: %w", err)
+		}
+		times = append(times, t)
+	}
+	return times, rows.Err()
+}
+
+func (store *Store) UpdateFeedTitle(feedId int64, title string) error {
+	_, err := store.db.Exec(`
+		UPDATE feeds
+		SET title = ?
+		WHERE id = ?
+	`, title, feedId)
+	if err != nil {
+		return fmt.Errorf("error updating feed title: %w", err)
+	}
+	return nil
+}
+
+// UpdateFeedTitleIfEmpty sets the feed title only when the feed does not have
+// one yet, so that a user-supplied title (e.g. from an OPML import) never
+// overwrites the title fetched from the feed itself.
+func (store *Store) UpdateFeedTitleIfEmpty(feedId int64, title string) error {
+	_, err := store.db.Exec(`
+		UPDATE feeds
+		SET title = ?
+		WHERE id = ? AND (title IS NULL OR title = '')
+	`, title, feedId)
+	if err != nil {
+		return fmt.Errorf("error updating empty feed title: %w", err)
+	}
+	return nil
+}
+
+func (store *Store) UpdateFeedLastFetched(feedId int64, timestamp time.Time) error {
+	_, err := store.db.Exec(`
+		UPDATE feeds
+		SET last_fetched_at = ?
+		WHERE id = ?
+	`, timestamp, feedId)
+	if err != nil {
+		return fmt.Errorf("error updating feed last fetched: %w", err)
+	}
+	return nil
+}
+
+// RecordFeedFailure records a fetch failure on the feed: it increments
+// consecutive_failures and stores the error message and timestamp.
+func (store *Store) RecordFeedFailure(feedID int64, fetchErr error, at time.Time) error {
+	_, err := store.db.Exec(`
+		UPDATE feeds
+		SET last_error = ?, last_error_at = ?, consecutive_failures = consecutive_failures + 1
+		WHERE id = ?
+	`, fetchErr.Error(), at, feedID)
+	if err != nil {
+		return fmt.Errorf("error recording feed failure: %w", err)
+	}
+	return nil
+}
+
+// RecordFeedSuccess clears any failure and rate limit state and records the
+// time of a successful fetch, resetting consecutive_failures to 0. A feed that
+// was gone but can be fetched again, e.g. on a manual refresh, is polled
+// again.
+func (store *Store) RecordFeedSuccess(feedID int64, at time.Time) error {
+	_, err := store.db.Exec(`
+		UPDATE feeds
+		SET last_error = NULL, last_error_at = NULL, consecutive_failures = 0, last_success_at = ?,
+		    gone_at = NULL, rate_limited_until = NULL
+		WHERE id = ?
+	`, at, feedID)
+	if err != nil {
+		return fmt.Errorf("error recording feed success: %w", err)
+	}
+	return nil
+}
+
+// MarkFeedGone records that the publisher removed the feed for good, which
+// stops it from being polled.
+func (store *Store) MarkFeedGone(feedID int64, at time.Time) error {
+	if _, err := store.db.Exec("UPDATE feeds SET gone_at = ? WHERE id = ?", at, feedID); err != nil {
+		return fmt.Errorf("error marking feed gone: %w", err)
+	}
+	return nil
+}
+
+// RecordFeedRateLimited records that the feed's host rate limited it and asked
+// not to be fetched again before until. It does not count as a failure.
+func (store *Store) RecordFeedRateLimited(feedID int64, until time.Time) error {
+	if _, err := store.db.Exec(
+		"UPDATE feeds SET rate_limited_until = ? WHERE id = ?", until.UTC(), feedID,
+	); err != nil {
+		return fmt.Errorf("error recording feed rate limit: %w", err)
+	}
+	return nil
+}
+
+// SetHostRateLimit records that no feed on host may be fetched before until.
+// An earlier limit never shortens a later one.
+func (store *Store) SetHostRateLimit(host string, until time.Time) error {
+	if _, err := store.db.Exec(`
+		INSERT INTO host_rate_limits (host, rate_limited_until) VALUES (?, ?)
+		ON CONFLICT (host) DO UPDATE
+		SET rate_limited_until = max(rate_limited_until, excluded.rate_limited_until)
+	`, host, until.UTC()); err != nil {
+		return fmt.Errorf("error setting host rate limit: %w", err)
+	}
+	return nil
+}
+
+// GetHostRateLimits returns the hosts that may not be fetched from at now,
+// mapped to when they may be again. Expired limits are removed.
+func (store *Store) GetHostRateLimits(now time.Time) (map[string]time.Time, error) {
+	if _, err := store.db.Exec(
+		"DELETE FROM host_rate_limits WHERE rate_limited_until <= ?", now.UTC(),
+	); err != nil {
+		return nil, fmt.Errorf("error removing expired host rate limits: %w", err)
+	}
+	rows, err := store.db.Query("SELECT host, rate_limited_until FROM host_rate_limits")
+	if err != nil {
+		return nil, fmt.Errorf("error querying host rate limits: %w", err)
+	}
+	defer rows.Close()
+
+	limits := make(map[string]time.Time)
+	for rows.Next() {
+		var host string
+		var until time.Time
+		if err := rows.Scan(&host, &until); err != nil {
+			return nil, fmt.Errorf("error scanning host rate limit: %w", err)
+		}
+		limits[host] = until
+	}
+	return limits, rows.Err()
+}
+
+// SetFeedFinalURL records where the feed was fetched from after temporary
+// redirects. An empty URL means it was not redirected.
+func (store *Store) SetFeedFinalURL(feedID int64, finalURL string) error {
+	if _, err := store.db.Exec(
+		"UPDATE feeds SET final_url = NULLIF(?, '') WHERE id = ?",
+		finalURL, feedID,
+	); err != nil {
+		return fmt.Errorf("error setting feed final url: %w", err)
+	}
+	return nil
+}
+
+// MoveFeed changes the URL of a feed that permanently moved. If another feed
+// with the same owner, or another shared feed, already has the new URL, that
+// feed is merged into this one: its
+// subscribers, dashboard places, tags, filter rules and posts move over, and
+// the read and starred state of posts both feeds have is combined. The feed
+// keeps its ID either way.
+func (store *Store) MoveFeed(feedID int64, newURL string) error {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var otherID int64
+	err = tx.QueryRow(`
+		SELECT id FROM feeds
+		WHERE url = ?1 AND id != ?2 AND owner_user_id IS (SELECT owner_user_id FROM feeds WHERE id = ?2)
+	`, newURL, feedID).Scan(&otherID)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("error looking up feed by url: %w", err)
+	}
+
+	if otherID != 0 {
+		// Subscribers of both feeds keep their settings for this one.
+		merges := []struct{ what, query string }{
+			{"subscriptions", `
+				INSERT OR IGNORE INTO user_feeds (user_id, feed_id, grid_position, custom_title, posts_per_feed,
+				                                  hide_read, show_summaries, collapsed)
+				SELECT user_id, ?1, grid_position, custom_title, posts_per_feed, hide_read, show_summaries, collapsed
+				FROM user_feeds WHERE feed_id = ?2`},
+			{"dashboard places", "UPDATE OR IGNORE dashboard_feeds SET feed_id = ?1 WHERE feed_id = ?2"},
+			{"tags", "UPDATE OR IGNORE feed_tags SET feed_id = ?1 WHERE feed_id = ?2"},
+			{"filter rules", "UPDATE filter_rules SET feed_id = ?1 WHERE feed_id = ?2"},
+			// Posts this feed does not have yet move over with their state.
+			{"posts", "UPDATE OR IGNORE posts SET feed_id = ?1 WHERE feed_id = ?2"},
+			// The remaining posts are duplicates; keep their state on the
+			// post with the same GUID.
+			{"post states", `
+				INSERT INTO user_post_states (user_id, post_id, seen, starred, starred_at)
+				SELECT s.user_id, kept.id, s.seen, s.starred, s.starred_at
+				FROM user_post_states s
+				JOIN posts dup ON dup.id = s.post_id AND dup.feed_id = ?2
+				JOIN posts kept ON kept.feed_id = ?1 AND kept.guid = dup.guid
+				WHERE true
+				ON CONFLICT(user_id, post_id) DO UPDATE SET
+					seen = max(seen, excluded.seen),
+					starred = max(starred, excluded.starred),
+					starred_at = COALESCE(starred_at, excluded.starred_at)`},
+			{"duplicate post states", "DELETE FROM user_post_states WHERE post_id IN (SELECT id FROM posts WHERE feed_id = ?2)"},
+			{"duplicate post revisions", "DELETE FROM post_revisions WHERE post_id IN (SELECT id FROM posts WHERE feed_id = ?2)"},
+			{"duplicate posts", "DELETE FROM posts WHERE feed_id = ?2"},
+			{"subscriptions", "DELETE FROM user_feeds WHERE feed_id = ?2"},
+			{"dashboard places", "DELETE FROM dashboard_feeds WHERE feed_id = ?2"},
+			{"tags", "DELETE FROM feed_tags WHERE feed_id = ?2"},
+			{"feed", "DELETE FROM feeds WHERE id = ?2"},
+		}
+		for _, merge := range merges {
+			if _, err := tx.Exec(merge.query, feedID, otherID); err != nil {
+				return fmt.Errorf("error merging %s: %w", merge.what, err)
+			}
+		}
+	}
+
+	if _, err := tx.Exec(
+		"UPDATE feeds SET url = ?, final_url = NULL WHERE id = ?",
+		newURL, feedID,
+	); err != nil {
+		return fmt.Errorf("error updating feed url: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// DeleteFeedForUser removes a user's subscription to a feed. If no users
+// remain subscribed, the feed row (and its posts, via cascade) is deleted as
+// well. It returns sql.ErrNoRows when the user is not subscribed to the feed.
+func (store *Store) DeleteFeedForUser(userID, feedID int64) error {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		"DELETE FROM user_feeds WHERE user_id = ? AND feed_id = ?",
+		userID, feedID,
+	)
+	if err != nil {
+		return fmt.Errorf("error deleting user feed subscription: %w", err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+
+	if _, err := tx.Exec(`
+		DELETE FROM dashboard_feeds
+		WHERE feed_id = ? AND dashboard_id IN (SELECT id FROM dashboards WHERE user_id = ?)
+	`, feedID, userID); err != nil {
+		return fmt.Errorf("error removing feed from dashboards: %w", err)
+	}
+
+	if _, err := tx.Exec(
+		"DELETE FROM filter_rules WHERE user_id = ? AND feed_id = ?",
+		userID, feedID,
+	); err != nil {
+		return fmt.Errorf("error removing feed filter rules: %w", err)
+	}
+
+	if _, err := tx.Exec(
+		"DELETE FROM feed_tags WHERE user_id = ? AND feed_id = ?",
+		userID, feedID,
+	); err != nil {
+		return fmt.Errorf("error removing feed tags: %w", err)
+	}
+
+	// Garbage-collect the feed row when no subscribers remain.
+	if _, err := tx.Exec(`
+		DELETE FROM feeds
+		WHERE id = ? AND NOT EXISTS (
+			SELECT 1 FROM user_feeds WHERE feed_id = ?
+		)
+	`, feedID, feedID); err != nil {
+		return fmt.Errorf("error garbage-collecting orphaned feed: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+func (store *Store) UpdateFeedCacheInfo(feedId int64, etag, lastModified string, cacheUntil time.Time) error {
+	_, err := store.db.Exec(`
+		UPDATE feeds
+		SET etag = ?, last_modified = ?, cache_until = ?
+		WHERE id = ?
+	`, etag, lastModified, cacheUntil, feedId)
+	if err != nil {
+		return fmt.Errorf("error updating feed cache info: %w", err)
+	}
+	return nil
+}
+
+// GetFeedByID returns the feed with the given ID, or nil if there is none.
+func (store *Store) GetFeedByID(feedID int64) (*Feed, error) {
+	f, err := scanFeed(store.db.QueryRow("SELECT "+feedColumns+" FROM feeds WHERE id = ?", feedID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error querying feed by ID: %w", err)
+	}
+	return &f, nil
+}
+
+// GetFeedByURL returns the shared feed with the given URL, or nil if there is
+// none. Private feeds with the URL are not considered.
+func (store *Store) GetFeedByURL(url string) (*Feed, error) {
+	f, err := scanFeed(store.db.QueryRow("SELECT "+feedColumns+" FROM feeds WHERE url = ? AND owner_user_id IS NULL", url))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error querying feed by URL: %w", err)
+	}
+	return &f, nil
+}
+
+// GetUserPostsPerFeed gets the number of posts per feed for a user
+func (store *Store) GetUserPostsPerFeed(userId int64) (int, error) {
+	var postsPerFeed int
+	err := store.db.QueryRow(`
+		SELECT posts_per_feed 
+		FROM user_preferences 
+		WHERE user_id = ?
+	`, userId).Scan(&postsPerFeed)
+
+	if err == sql.ErrNoRows {
+		// Return default value if no preference is set
+		return 10, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error querying user posts per feed preference: %w", err)
+	}
+
+	return postsPerFeed, nil
+}
+
+// SetUserPostsPerFeed sets the number of posts per feed for a user
+func (store *Store) SetUserPostsPerFeed(userId int64, postsPerFeed int) error {
+	_, err := store.db.Exec(`
+		INSERT INTO user_preferences (user_id, posts_per_feed) 
+		VALUES (?, ?) 
+		ON CONFLICT(user_id) DO UPDATE SET posts_per_feed = ?
+	`, userId, postsPerFeed, postsPerFeed)
+	if err != nil {
+		return fmt.Errorf("error setting user posts per feed preference: %w", err)
+	}
+	return nil
+}
+
+// GetPostForUser retrieves a single post by its ID, but only if the post's feed
 // is subscribed to by the given user. It returns sql.ErrNoRows when the post
 // does not exist or the user has no subscription to its feed.
 func (store *Store) GetPostForUser(userID, postID int64) (*Post, error) {
 	var p Post
+	var updatedAt, sourceUpdatedAt sql.NullTime
+	var categories, enclosures sql.NullString
+	err := store.db.QueryRow(`
+		SELECT p.id, p.title, p.link, p.published_at, p.content, COALESCE(ups.seen, 0), COALESCE(ups.starred, 0), p.updated_at,
+		       COALESCE(p.author, ''), COALESCE(p.summary, ''), p.categories, COALESCE(p.image_url, ''),
+		       COALESCE(p.comments_url, ''), p.enclosures, p.source_updated_at
+		FROM posts p
+		JOIN user_feeds uf ON uf.feed_id = p.feed_id AND uf.user_id = ?
+		LEFT JOIN user_post_states ups ON ups.post_id = p.id AND ups.user_id = uf.user_id
+		WHERE p.id = ?
+	`, userID, postID).Scan(&p.ID, &p.Title, &p.Link, &p.PublishedAt, &p.Content, &p.Seen, &p.Starred, &updatedAt,
+		&p.Author, &p.Summary, &categories, &p.ImageURL, &p.CommentsURL, &enclosures, &sourceUpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, sql.ErrNoRows
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error querying post for user: %w", err)
+	}
+	p.UpdatedAt = updatedAt.Time
+	p.SourceUpdatedAt = sourceUpdatedAt.Time
+	if err := p.decodeLists(categories, enclosures); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// GetPostRevisions returns the earlier versions of a post, newest first.
+// Callers must check that the user may see the post.
+func (store *Store) GetPostRevisions(postID int64) ([]PostRevision, error) {
+	rows, err := store.db.Query(`
+		SELECT COALESCE(title, ''), link, COALESCE(content, ''), replaced_at
+		FROM post_revisions
+		WHERE post_id = ?
+		ORDER BY id DESC
+	`, postID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying post revisions: %w", err)
+	}
+	defer rows.Close()
+
+	var revisions []PostRevision
+	for rows.Next() {
+		var r PostRevision
+		if err := rows.Scan(&r.Title, &r.Link, &r.Content, &r.ReplacedAt); err != nil {
+			return nil, fmt.Errorf("error scanning post revision: %w", err)
+		}
+		revisions = append(revisions, r)
+	}
+	return revisions, rows.Err()
+}
+
+// GetUserUnseenOnUpdate reports whether posts the user has seen become unseen
+// again when their publisher updates them.
+func (store *Store) GetUserUnseenOnUpdate(userId int64) (bool, error) {
+	var unseenOnUpdate bool
+	err := store.db.QueryRow(`
+		SELECT unseen_on_update
+		FROM user_preferences
+		WHERE user_id = ?
+	`, userId).Scan(&unseenOnUpdate)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error querying user unseen on update preference: %w", err)
+	}
+	return unseenOnUpdate, nil
+}
+
+func (store *Store) SetUserUnseenOnUpdate(userId int64, unseenOnUpdate bool) error {
+	_, err := store.db.Exec(`
+		INSERT INTO user_preferences (user_id, unseen_on_update)
+		VALUES (?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET unseen_on_update = excluded.unseen_on_update
+	`, userId, unseenOnUpdate)
+	if err != nil {
+		return fmt.Errorf("error setting user unseen on update preference: %w", err)
+	}
+	return nil
+}
+
+// GetUserHideRead reports whether the user hides read posts on every widget.
+func (store *Store) GetUserHideRead(userId int64) (bool, error) {
+	var hideRead bool
+	err := store.db.QueryRow(`
+		SELECT hide_read
+		FROM user_preferences
+		WHERE user_id = ?
+	`, userId).Scan(&hideRead)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("error querying user hide read preference: %w", err)
+	}
+	return hideRead, nil
+}
+
+func (store *Store) SetUserHideRead(userId int64, hideRead bool) error {
+	_, err := store.db.Exec(`
+		INSERT INTO user_preferences (user_id, hide_read)
+		VALUES (?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET hide_read = excluded.hide_read
+	`, userId, hideRead)
+	if err != nil {
+		return fmt.Errorf("error setting user hide read preference: %w", err)
+	}
+	return nil
+}
+
+// SetFeedHideReadForUser changes whether read posts are hidden for one of
+// the user's subscriptions. It returns sql.ErrNoRows if the user is not
+// subscribed to the feed.
+func (store *Store) SetFeedHideReadForUser(userId, feedId int64, hideRead bool) error {
+	result, err := store.db.Exec(
+		"UPDATE user_feeds SET hide_read = ? WHERE user_id = ? AND feed_id = ?",
+		hideRead, userId, feedId,
+	)
+	if err != nil {
+		return fmt.Errorf("error setting feed hide read: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error checking feed hide read update: %w", err)
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetUnreadCountsForUser counts the posts the user has not seen in each of
+// their subscribed feeds, not counting posts hidden by filter rules. Feeds
+// without unread posts are left out.
+func (store *Store) GetUnreadCountsForUser(userId int64) (map[int64]int, error) {
+	rows, err := store.db.Query(`
+		SELECT p.feed_id, COUNT(*)
+		FROM posts p
+		JOIN user_feeds uf ON uf.feed_id = p.feed_id AND uf.user_id = ?
+		LEFT JOIN user_post_states ups ON ups.post_id = p.id AND ups.user_id = ?
+		WHERE COALESCE(ups.seen, 0) = 0
+		AND `+notHiddenByFilter+`
+		GROUP BY p.feed_id
+	`, userId, userId, userId)
+	if err != nil {
+		return nil, fmt.Errorf("error counting unread posts: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[int64]int)
+	for rows.Next() {
+		var feedId int64
+		var count int
+		if err := rows.Scan(&feedId, &count); err != nil {
+			return nil, fmt.Errorf("error scanning unread count: %w", err)
+		}
+		counts[feedId] = count
+	}
+	return counts, rows.Err()
+}
+
+// Markers surrounding the matched terms in SearchResult.Snippet. They are
+// control characters so they can never collide with post text.
+const (
+	SnippetMatchStart = "\x02"
+	SnippetMatchEnd   = "\x03"
+)
+
+// SearchResult is a post matching a full-text search.
+type SearchResult struct {
+	Post
+	FeedID    int64
+	FeedTitle string
+	FeedURL   string
+	// Snippet is a plain-text excerpt with matches wrapped in
+	// SnippetMatchStart and SnippetMatchEnd.
+	Snippet string
+}
+
+// ftsQuery turns free-form user input into an FTS MATCH expression in which
+// every word must occur. Each word is quoted so that FTS operators and
+// punctuation in the input cannot cause syntax errors.
+func ftsQuery(query string) string {
+	var terms []string
+	for _, word := range strings.Fields(query) {
+		word = strings.ReplaceAll(word, `"`, "")
+		if word == "" {
+			continue
+		}
+		terms = append(terms, `"`+word+`"`)
+	}
+	return strings.Join(terms, " ")
+}
+
+// SearchPostsForUser runs a full-text search over the titles and content of
+// posts in the feeds the user is subscribed to, newest first.
+func (store *Store) SearchPostsForUser(userID int64, query string, limit int) ([]SearchResult, error) {
+	match := ftsQuery(query)
+	if match == "" {
+		return nil, nil
+	}
+
+	rows, err := store.db.Query(`
+		SELECT p.id, p.title, p.link, p.published_at, p.content, COALESCE(ups.seen, 0),
+		       f.id, COALESCE(NULLIF(uf.custom_title, ''), f.title, ''), f.url,
+		       snippet(posts_fts, -1, char(2), char(3), '…', 24)
+		FROM posts_fts
+		JOIN posts p ON p.id = posts_fts.rowid
+		JOIN user_feeds uf ON uf.feed_id = p.feed_id AND uf.user_id = ?
+		JOIN feeds f ON f.id = p.feed_id
+		LEFT JOIN user_post_states ups ON ups.post_id = p.id AND ups.user_id = ?
+		WHERE posts_fts MATCH ?
+		ORDER BY p.published_at DESC
+		LIMIT ?
+	`, userID, userID, match, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error searching posts: %w", err)
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		var r SearchResult
+		err := rows.Scan(&r.ID, &r.Title, &r.Link, &r.PublishedAt, &r.Content, &r.Seen,
+			&r.FeedID, &r.FeedTitle, &r.FeedURL, &r.Snippet)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning search result: %w", err)
+		}
+		results = append(results, r)
+	}
+	return results, rows.Err()
+}
+
+// GetUserColumns gets the number of columns for a user
+func (store *Store) GetUserColumns(userId int64) (int, error) {
+	var columns int
+	err := store.db.QueryRow(`
+		SELECT columns 
+		FROM user_preferences 
+		WHERE user_id = ?
+	`, userId).Scan(&columns)
+
+	if err == sql.ErrNoRows {
+		// Return default value if no preference is set
+		return 2, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error querying user columns preference: %w", err)
+	}
+
+	return columns, nil
+}
+
+// SetUserColumns sets the number of columns for a user
+func (store *Store) SetUserColumns(userId int64, columns int) error {
+	_, err := store.db.Exec(`
+		INSERT INTO user_preferences (user_id, columns) 
+		VALUES (?, ?) 
+		ON CONFLICT(user_id) DO UPDATE SET columns = ?
+	`, userId, columns, columns)
+	if err != nil {
+		return fmt.Errorf("error setting user columns preference: %w", err)
+	}
+	return nil
+}
+
+// apiTokenPrefix makes personal access tokens recognisable, e.g. to secret
+// scanners.
+const apiTokenPrefix = "rsg_"
+
+// APIToken describes a personal access token. The secret token value is never
+// stored and so is not part of this struct.
+type APIToken struct {
+	ID         int64
+	Name       string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	// ReadOnly tokens can only read output feeds; see CreateFeedTokenForUser.
+	ReadOnly bool
+}
+
+func hashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPITokenForUser creates a new personal access token for the user and
+// returns its secret value, which cannot be retrieved again later.
+func (store *Store) CreateAPITokenForUser(userID int64, name string) (string, error) {
+	return store.createAPIToken(userID, name, false)
+}
+
+// CreateFeedTokenForUser creates a read-only token that can only be used to
+// read the user's output feeds, and returns its secret value.
+func (store *Store) CreateFeedTokenForUser(userID int64, name string) (string, error) {
+	return store.createAPIToken(userID, name, true)
+}
+
+func (store *Store) createAPIToken(userID int64, name string, readOnly bool) (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("error generating token: %w", err)
+	}
+	token := apiTokenPrefix + hex.EncodeToString(secret)
+
+	_, err := store.db.Exec(
+		"INSERT INTO api_tokens (user_id, name, token_hash, read_only) VALUES (?, ?, ?, ?)",
+		userID, name, hashAPIToken(token), readOnly,
+	)
+	if err != nil {
+		return "", fmt.Errorf("error creating api token: %w", err)
+	}
+	return token, nil
+}
+
+// GetAPITokensForUser lists the user's personal access tokens, newest first.
+func (store *Store) GetAPITokensForUser(userID int64) ([]APIToken, error) {
+	rows, err := store.db.Query(`
+		SELECT id, name, created_at, last_used_at, read_only
+		FROM api_tokens
+		WHERE user_id = ?
+		ORDER BY created_at DESC, id DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying api tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []APIToken
+	for rows.Next() {
+		var t APIToken
+		var lastUsedAt sql.NullTime
+		if err := rows.Scan(&t.ID, &t.Name, &t.CreatedAt, &lastUsedAt, &t.ReadOnly); err != nil {
+			return nil, fmt.Errorf("error scanning api token: %w", err)
+		}
+		if lastUsedAt.Valid {
+			t.LastUsedAt = lastUsedAt.Time
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// DeleteAPITokenForUser revokes one of the user's tokens. Returns
+// sql.ErrNoRows when the token does not exist or belongs to another user.
+func (store *Store) DeleteAPITokenForUser(userID, tokenID int64) error {
+	res, err := store.db.Exec("DELETE FROM api_tokens WHERE id = ? AND user_id = ?", tokenID, userID)
+	if err != nil {
+		return fmt.Errorf("error deleting api token: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetUserIDForAPIToken resolves a presented token to its user and records
+// when it was last used. Returns sql.ErrNoRows for unknown or revoked tokens,
+// and for read-only tokens.
+func (store *Store) GetUserIDForAPIToken(token string) (int64, error) {
+	return store.userIDForAPIToken(token, false)
+}
+
+// GetUserIDForFeedToken is GetUserIDForAPIToken for read-only tokens, and
+// returns sql.ErrNoRows for any other token.
+func (store *Store) GetUserIDForFeedToken(token string) (int64, error) {
+	return store.userIDForAPIToken(token, true)
+}
+
+func (store *Store) userIDForAPIToken(token string, readOnly bool) (int64, error) {
+	hash := hashAPIToken(token)
+	var userID int64
+	err := store.db.QueryRow("SELECT user_id FROM api_tokens WHERE token_hash = ? AND read_only = ?", hash, readOnly).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, sql.ErrNoRows
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error looking up api token: %w", err)
+	}
+
+	if _, err := store.db.Exec(
+		"UPDATE api_tokens SET last_used_at = ? WHERE token_hash = ?",
+		time.Now().UTC(), hash,
+	); err != nil {
+		return 0, fmt.Errorf("error updating api token last use: %w", err)
+	}
+	return userID, nil
+}
+
+// Dashboard is a named page of feeds. Every user has at least one.
+type Dashboard struct {
+	ID       int64
+	Name     string
+	Position int
+}
+
+// defaultDashboardName names the dashboard created for users who have none.
+const defaultDashboardName = "Home"
+
+// ErrLastDashboard is returned when deleting a user's only dashboard.
+var ErrLastDashboard = errors.New("cannot delete the last dashboard")
+
+// ensureDashboard returns the user's first dashboard, creating the default
+// dashboard if the user has none yet.
+func ensureDashboard(tx *sql.Tx, userId int64) (int64, error) {
+	var dashboardId int64
+	err := tx.QueryRow(
+		"SELECT id FROM dashboards WHERE user_id = ? ORDER BY position, id LIMIT 1",
+		userId,
+	).Scan(&dashboardId)
+	if err == sql.ErrNoRows {
+		err = tx.QueryRow(
+			"INSERT INTO dashboards (user_id, name, position) VALUES (?, ?, 0) RETURNING id",
+			userId, defaultDashboardName,
+		).Scan(&dashboardId)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error getting default dashboard: %w", err)
+	}
+	return dashboardId, nil
+}
+
+// placeFeedOnDashboard appends a feed to a dashboard unless it is already on it.
+func placeFeedOnDashboard(tx *sql.Tx, dashboardId, feedId int64) error {
+	_, err := tx.Exec(`
+		INSERT OR IGNORE INTO dashboard_feeds (dashboard_id, feed_id, position)
+		SELECT ?, ?, COALESCE(MAX(position), -1) + 1 FROM dashboard_feeds WHERE dashboard_id = ?
+	`, dashboardId, feedId, dashboardId)
+	if err != nil {
+		return fmt.Errorf("error placing feed on dashboard: %w", err)
+	}
+	return nil
+}
+
+// GetDashboardsForUser returns the user's dashboards in tab order, creating
+// the default dashboard first if the user has none.
+func (store *Store) GetDashboardsForUser(userId int64) ([]Dashboard, error) {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := ensureDashboard(tx, userId); err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(
+		"SELECT id, name, position FROM dashboards WHERE user_id = ? ORDER BY position, id",
+		userId,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying dashboards: %w", err)
+	}
+	defer rows.Close()
+
+	var dashboards []Dashboard
+	for rows.Next() {
+		var d Dashboard
+		if err := rows.Scan(&d.ID, &d.Name, &d.Position); err != nil {
+			return nil, fmt.Errorf("error scanning dashboard: %w", err)
+		}
+		dashboards = append(dashboards, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating dashboards: %w", err)
+	}
+	rows.Close()
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return dashboards, nil
+}
+
+// CreateDashboardForUser adds an empty dashboard after the user's existing ones.
+func (store *Store) CreateDashboardForUser(userId int64, name string) (int64, error) {
+	var dashboardId int64
+	err := store.db.QueryRow(`
+		INSERT INTO dashboards (user_id, name, position)
+		SELECT ?, ?, COALESCE(MAX(position), -1) + 1 FROM dashboards WHERE user_id = ?
+		RETURNING id
+	`, userId, name, userId).Scan(&dashboardId)
+	if err != nil {
+		return 0, fmt.Errorf("error creating dashboard: %w", err)
+	}
+	return dashboardId, nil
+}
+
+// RenameDashboardForUser renames one of the user's dashboards. It returns
+// sql.ErrNoRows if the dashboard does not belong to the user.
+func (store *Store) RenameDashboardForUser(userId, dashboardId int64, name string) error {
+	res, err := store.db.Exec(
+		"UPDATE dashboards SET name = ? WHERE id = ? AND user_id = ?",
+		name, dashboardId, userId,
+	)
+	if err != nil {
+		return fmt.Errorf("error renaming dashboard: %w", err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteDashboardForUser deletes one of the user's dashboards. Feeds on it
+// stay subscribed. It returns sql.ErrNoRows if the dashboard does not belong
+// to the user and ErrLastDashboard if it is the user's only dashboard.
+func (store *Store) DeleteDashboardForUser(userId, dashboardId int64) error {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var owned, total int
+	err = tx.QueryRow(`
+		SELECT COUNT(CASE WHEN id = ? THEN 1 END), COUNT(*)
+		FROM dashboards WHERE user_id = ?
+	`, dashboardId, userId).Scan(&owned, &total)
+	if err != nil {
+		return fmt.Errorf("error checking dashboard ownership: %w", err)
+	}
+	if owned == 0 {
+		return sql.ErrNoRows
+	}
+	if total == 1 {
+		return ErrLastDashboard
+	}
+
+	if _, err := tx.Exec("DELETE FROM dashboard_feeds WHERE dashboard_id = ?", dashboardId); err != nil {
+		return fmt.Errorf("error removing feeds from dashboard: %w", err)
+	}
+	if _, err := tx.Exec("DELETE FROM dashboards WHERE id = ?", dashboardId); err != nil {
+		return fmt.Errorf("error deleting dashboard: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// GetDashboardFeeds returns the subscribed feeds on one of the user's
+// dashboards in their dashboard order.
+func (store *Store) GetDashboardFeeds(userId, dashboardId int64) ([]Feed, error) {
+	return store.queryUserFeeds(`
+		JOIN dashboard_feeds df ON df.feed_id = feeds.id
+		JOIN dashboards d ON d.id = df.dashboard_id AND d.user_id = uf.user_id
+		WHERE df.dashboard_id = ? AND uf.user_id = ?
+		ORDER BY df.position, feeds.id
+	`, dashboardId, userId)
+}
+
+// GetFeedDashboardIDsForUser maps each of the user's feeds to the dashboards
+// it is placed on.
+func (store *Store) GetFeedDashboardIDsForUser(userId int64) (map[int64][]int64, error) {
+	rows, err := store.db.Query(`
+		SELECT df.feed_id, df.dashboard_id
+		FROM dashboard_feeds df
+		JOIN dashboards d ON d.id = df.dashboard_id
+		WHERE d.user_id = ?
+		ORDER BY d.position, d.id
+	`, userId)
+	if err != nil {
+		return nil, fmt.Errorf("error querying feed dashboards: %w", err)
+	}
+	defer rows.Close()
+
+	placements := make(map[int64][]int64)
+	for rows.Next() {
+		var feedId, dashboardId int64
+		if err := rows.Scan(&feedId, &dashboardId); err != nil {
+			return nil, fmt.Errorf("error scanning feed dashboard: %w", err)
+		}
+		placements[feedId] = append(placements[feedId], dashboardId)
+	}
+	return placements, rows.Err()
+}
+
+// SetFeedDashboardsForUser places a subscribed feed on exactly the given
+// dashboards of the user. Feeds newly placed on a dashboard go last. It
+// returns sql.ErrNoRows if the user is not subscribed to the feed or a
+// dashboard does not belong to the user.
+func (store *Store) SetFeedDashboardsForUser(userId, feedId int64, dashboardIds []int64) error {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var subscribed int
+	err = tx.QueryRow(
+		"SELECT COUNT(*) FROM user_feeds WHERE user_id = ? AND feed_id = ?",
+		userId, feedId,
+	).Scan(&subscribed)
+	if err != nil {
+		return fmt.Errorf("error checking feed subscription: %w", err)
+	}
+	if subscribed == 0 {
+		return sql.ErrNoRows
+	}
+
+	selected := make(map[int64]bool, len(dashboardIds))
+	for _, dashboardId := range dashboardIds {
+		var owner int64
+		err := tx.QueryRow("SELECT user_id FROM dashboards WHERE id = ?", dashboardId).Scan(&owner)
+		if err == sql.ErrNoRows || (err == nil && owner != userId) {
+			return sql.ErrNoRows
+		}
+		if err != nil {
+			return fmt.Errorf("error checking dashboard ownership: %w", err)
+		}
+		selected[dashboardId] = true
+	}
+
+	rows, err := tx.Query("SELECT id FROM dashboards WHERE user_id = ?", userId)
+	if err != nil {
+		return fmt.Errorf("error querying dashboards: %w", err)
+	}
+	var unselected []int64
+	for rows.Next() {
+		var dashboardId int64
+		if err := rows.Scan(&dashboardId); err != nil {
+			rows.Close()
+			return fmt.Errorf("error scanning dashboard: %w", err)
+		}
+		if !selected[dashboardId] {
+			unselected = append(unselected, dashboardId)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating dashboards: %w", err)
+	}
+
+	for _, dashboardId := range unselected {
+		if _, err := tx.Exec(
+			"DELETE FROM dashboard_feeds WHERE dashboard_id = ? AND feed_id = ?",
+			dashboardId, feedId,
+		); err != nil {
+			return fmt.Errorf("error removing feed from dashboard: %w", err)
+		}
+	}
+	for dashboardId := range selected {
+		if err := placeFeedOnDashboard(tx, dashboardId, feedId); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// WidgetLayout places a feed widget on a dashboard grid. Column and Row are
+// 1-based; a zero Column means the widget has no saved place and goes in the
+// first free cell. Width and Height are the number of columns and rows the
+// widget spans.
+type WidgetLayout struct {
+	Column int
+	Row    int
+	Width  int
+	Height int
+}
+
+// GetDashboardLayout returns the saved layout of every feed on one of the
+// user's dashboards, keyed by feed ID.
+func (store *Store) GetDashboardLayout(userId, dashboardId int64) (map[int64]WidgetLayout, error) {
+	rows, err := store.db.Query(`
+		SELECT df.feed_id, COALESCE(df.grid_column, 0), COALESCE(df.grid_row, 0), df.grid_width, df.grid_height
+		FROM dashboard_feeds df
+		JOIN dashboards d ON d.id = df.dashboard_id
+		WHERE df.dashboard_id = ? AND d.user_id = ?
+	`, dashboardId, userId)
+	if err != nil {
+		return nil, fmt.Errorf("error querying dashboard layout: %w", err)
+	}
+	defer rows.Close()
+
+	layout := make(map[int64]WidgetLayout)
+	for rows.Next() {
+		var feedId int64
+		var l WidgetLayout
+		if err := rows.Scan(&feedId, &l.Column, &l.Row, &l.Width, &l.Height); err != nil {
+			return nil, fmt.Errorf("error scanning dashboard layout: %w", err)
+		}
+		layout[feedId] = l
+	}
+	return layout, rows.Err()
+}
+
+// SaveDashboardLayoutForUser stores the grid place of the given feeds on one
+// of the user's dashboards in a single transaction. Positions are renumbered
+// in reading order so lists of the dashboard's feeds match the grid. It
+// returns sql.ErrNoRows if the dashboard does not belong to the user or a feed
+// is not on it.
+func (store *Store) SaveDashboardLayoutForUser(userId, dashboardId int64, layout map[int64]WidgetLayout) error {
+	tx, err := store.db.Begin()
+	if err != nil {
+		return fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var owner int64
+	err = tx.QueryRow("SELECT user_id FROM dashboards WHERE id = ?", dashboardId).Scan(&owner)
+	if err == sql.ErrNoRows || (err == nil && owner != userId) {
+		return sql.ErrNoRows
+	}
+	if err != nil {
+		return fmt.Errorf("error checking dashboard ownership: %w", err)
+	}
+
+	feedIds := make([]int64, 0, len(layout))
+	for feedId := range layout {
+		feedIds = append(feedIds, feedId)
+	}
+	sort.Slice(feedIds, func(i, j int) bool {
+		a, b := layout[feedIds[i]], layout[feedIds[j]]
+		if a.Row != b.Row {
+			return a.Row < b.Row
+		}
+		if a.Column != b.Column {
+			return a.Column < b.Column
+		}
+		return feedIds[i] < feedIds[j]
+	})
+
+	for position, feedId := range feedIds {
+		l := layout[feedId]
+		result, err := tx.Exec(`
+			UPDATE dashboard_feeds
+			SET grid_column = ?, grid_row = ?, grid_width = ?, grid_height = ?, position = ?
+			WHERE dashboard_id = ? AND feed_id = ?
+		`, l.Column, l.Row, l.Width, l.Height, position, dashboardId, feedId)
+		if err != nil {
+			return fmt.Errorf("error saving widget layout: %w", err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("error checking saved widget layout: %w", err)
+		}
+		if affected == 0 {
+			return sql.ErrNoRows
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+	return nil
+}
+
+// GetLastDashboardID returns the dashboard the user viewed last, or 0.
+func (store *Store) GetLastDashboardID(userId int64) (int64, error) {
+	var dashboardId sql.NullInt64
+	err := store.db.QueryRow(
+		"SELECT last_dashboard_id FROM user_preferences WHERE user_id = ?",
+		userId,
+	).Scan(&dashboardId)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error querying last dashboard: %w", err)
+	}
+	return dashboardId.Int64, nil
+}
+
+// SetLastDashboardID remembers the dashboard the user viewed last.
+func (store *Store) SetLastDashboardID(userId, dashboardId int64) error {
+	_, err := store.db.Exec(`
+		INSERT INTO user_preferences (user_id, last_dashboard_id)
+		VALUES (?, ?)
+		ON CONFLICT(user_id) DO UPDATE SET last_dashboard_id = excluded.last_dashboard_id
+	`, userId, dashboardId)
+	if err != nil {
+		return fmt.Errorf("error setting last dashboard: %w", err)
+	}
+	return nil
+}
+
+// Fields of a post a FilterRule can match.
+const (
+	FilterFieldTitle   = "title"
+	FilterFieldContent = "content"
+	FilterFieldAuthor  = "author"
+	FilterFieldLink    = "link"
+)
+
+// What happens to posts matching a FilterRule.
+const (
+	// FilterActionHide leaves matching posts off the dashboard.
+	FilterActionHide = "hide"
+	// FilterActionMarkSeen marks matching posts as seen when they are fetched.
+	FilterActionMarkSeen = "mark_seen"
+	// FilterActionHighlight makes matching posts stand out in their widget.
+	FilterActionHighlight = "highlight"
+)
+
+// FilterRule matches posts by a substring or regular expression on one of
+// their fields and hides, marks as seen or highlights them.
+type FilterRule struct {
+	ID int64
+	// FeedID limits the rule to one feed; 0 applies it to all feeds.
+	FeedID    int64
+	FeedTitle string
+	Field     string
+	// Regex tells whether Pattern is a regular expression rather than a
+	// case-insensitive substring.
+	Regex   bool
+	Pattern string
+	Action  string
+}
+
+// filterRuleMatches is an SQL condition that holds when the filter rule fr
+// matches the post p. Content is matched as plain text, without markup.
+const filterRuleMatches = `(fr.feed_id IS NULL OR fr.feed_id = p.feed_id)
+	AND filter_match(fr.regex, fr.pattern, CASE fr.field
+		WHEN 'title' THEN COALESCE(p.title, '')
+		WHEN 'content' THEN COALESCE((SELECT body FROM posts_fts WHERE rowid = p.id), '')
+		WHEN 'author' THEN COALESCE(p.author, '')
+		ELSE p.link
+	END)`
+
+// notHiddenByFilter is an SQL condition that holds when none of the user's
+// hide rules match the post p. It takes the user id as its only argument.
+const notHiddenByFilter = `NOT EXISTS (
+	SELECT 1 FROM filter_rules fr
+	WHERE fr.user_id = ? AND fr.action = 'hide' AND ` + filterRuleMatches + `
+)`
+
+// filterRegexps caches compiled filter patterns. Invalid patterns are stored
+// as nil and never match.
+var filterRegexps sync.Map
+
+// filterMatch implements the filter_match SQL function. Substring matches
+// ignore case and differences in whitespace.
+func filterMatch(regex bool, pattern, value string) bool {
+	if !regex {
+		return strings.Contains(normalizeFilterText(value), normalizeFilterText(pattern))
+	}
+	cached, ok := filterRegexps.Load(pattern)
+	if !ok {
+		re, _ := regexp.Compile(pattern)
+		cached, _ = filterRegexps.LoadOrStore(pattern, re)
+	}
+	re := cached.(*regexp.Regexp)
+	return re != nil && re.MatchString(value)
+}
+
+func normalizeFilterText(text string) string {
+	return strings.ToLower(strings.Join(strings.Fields(text), " "))
+}
+
+// GetFilterRulesForUser lists the user's filter rules in the order they were
+// created.
+func (store *Store) GetFilterRulesForUser(userId int64) ([]FilterRule, error) {
+	rows, err := store.db.Query(`
+		SELECT fr.id, COALESCE(fr.feed_id, 0), COALESCE(NULLIF(uf.custom_title, ''), feeds.title, ''),
+		       fr.field, fr.regex, fr.pattern, fr.action
+		FROM filter_rules fr
+		LEFT JOIN feeds ON feeds.id = fr.feed_id
+		LEFT JOIN user_feeds uf ON uf.feed_id = fr.feed_id AND uf.user_id = fr.user_id
+		WHERE fr.user_id = ?
+		ORDER BY fr.id
+	`, userId)
+	if err != nil {
+		return nil, fmt.Errorf("error querying filter rules: %w", err)
+	}
+	defer rows.Close()
+
+	var rules []FilterRule
+	for rows.Next() {
+		var rule FilterRule
+		if err := rows.Scan(&rule.ID, &rule.FeedID, &rule.FeedTitle, &rule.Field, &rule.Regex, &rule.Pattern, &rule.Action); err != nil {
+			return nil, fmt.Errorf("error scanning filter rule: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// CreateFilterRuleForUser adds a filter rule. The caller validates the field,
+// action and pattern. Returns sql.ErrNoRows when the rule is limited to a feed
+// the user is not subscribed to.
+func (store *Store) CreateFilterRuleForUser(userId int64, rule FilterRule) (int64, error) {
+	var feedId sql.NullInt64
+	if rule.FeedID != 0 {
+		var subscribed int
+		err := store.db.QueryRow(
+			"SELECT COUNT(*) FROM user_feeds WHERE user_id = ? AND feed_id = ?",
+			userId, rule.FeedID,
+		).Scan(&subscribed)
+		if err != nil {
+			return 0, fmt.Errorf("error checking feed subscription: %w", err)
+		}
+		if subscribed == 0 {
+			return 0, sql.ErrNoRows
+		}
+		feedId = sql.NullInt64{Int64: rule.FeedID, Valid: true}
+	}
+
+	res, err := store.db.Exec(`
+		INSERT INTO filter_rules (user_id, feed_id, field, regex, pattern, action)
+		VALUES (?, ?, ?, ?, ?, ?)
+	`, userId, feedId, rule.Field, rule.Regex, rule.Pattern, rule.Action)
+	if err != nil {
+		return 0, fmt.Errorf("error creating filter rule: %w", err)
+	}
+	return res.LastInsertId()
+}
+
+// DeleteFilterRuleForUser removes one of the user's filter rules. Returns
+// sql.ErrNoRows when the rule does not exist or belongs to another user.
+func (store *Store) DeleteFilterRuleForUser(userId, ruleId int64) error {
+	res, err := store.db.Exec("DELETE FROM filter_rules WHERE id = ? AND user_id = ?", ruleId, userId)
+	if err != nil {
+		return fmt.Errorf("error deleting filter rule: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ApplyMarkSeenFilterRules marks a freshly fetched post as seen for every
+// subscriber with a matching mark-as-seen filter rule.
+func (store *Store) ApplyMarkSeenFilterRules(feedId int64, guid string) error {
+	_, err := store.db.Exec(`
+		INSERT INTO user_post_states (user_id, post_id, seen)
+		SELECT DISTINCT fr.user_id, p.id, 1
+		FROM posts p
+		JOIN filter_rules fr ON fr.action = 'mark_seen'
+		JOIN user_feeds uf ON uf.user_id = fr.user_id AND uf.feed_id = p.feed_id
+		WHERE p.feed_id = ? AND p.guid = ? AND `+filterRuleMatches+`
+		ON CONFLICT(user_id, post_id) DO UPDATE SET seen = 1
+	`, feedId, guid)
+	if err != nil {
+		return fmt.Errorf("error applying mark seen filter rules: %w", err)
+	}
+	return nil
+}
+
+// FeedPost is a post together with its feed, as listed for sync clients that
+// read posts across all feeds at once.
+type FeedPost struct {
+	Post
+	FeedID int64
+}
+
+// PostQuery selects posts from all of a user's feeds for sync clients. All
+// set fields must match.
+type PostQuery struct {
+	// SinceID selects posts with a larger id.
+	SinceID int64
+	// MaxID selects posts with a smaller id.
+	MaxID int64
+	// IDs selects only these posts.
+	IDs []int64
+	// FeedIDs selects only posts from these feeds.
+	FeedIDs                       []int64
+	OnlyUnread, OnlyRead, Starred bool
+	// PublishedAfter and PublishedBefore bound the publication time.
+	PublishedAfter, PublishedBefore time.Time
+	// FilterRuleID selects only posts matching this filter rule of the user.
+	FilterRuleID int64
+	// Posts are ordered by ascending id, or by publication time and then id
+	// if ByPublished is set. NewestFirst reverses the order.
+	ByPublished bool
+	NewestFirst bool
+	Limit       int
+}
+
+// sqlPlaceholders returns n comma-separated SQL parameter placeholders.
+func sqlPlaceholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?,", n), ",")
+}
+
+// QueryPostsForUser lists posts from the user's subscribed feeds, leaving out
+// posts hidden by the user's filter rules.
+func (store *Store) QueryPostsForUser(userID int64, query PostQuery) ([]FeedPost, error) {
+	conditions := []string{notHiddenByFilter}
+	args := []any{userID, userID, userID}
+	if query.SinceID > 0 {
+		conditions = append(conditions, "p.id > ?")
+		args = append(args, query.SinceID)
+	}
+	if query.MaxID > 0 {
+		conditions = append(conditions, "p.id < ?")
+		args = append(args, query.MaxID)
+	}
+	if len(query.IDs) > 0 {
+		conditions = append(conditions, "p.id IN ("+sqlPlaceholders(len(query.IDs))+")")
+		for _, id := range query.IDs {
+			args = append(args, id)
+		}
+	}
+	if query.FeedIDs != nil {
+		if len(query.FeedIDs) == 0 {
+			return nil, nil
+		}
+		conditions = append(conditions, "p.feed_id IN ("+sqlPlaceholders(len(query.FeedIDs))+")")
+		for _, id := range query.FeedIDs {
+			args = append(args, id)
+		}
+	}
+	if query.OnlyUnread {
+		conditions = append(conditions, "COALESCE(ups.seen, 0) = 0")
+	}
+	if query.OnlyRead {
+		conditions = append(conditions, "ups.seen = 1")
+	}
+	if query.Starred {
+		conditions = append(conditions, "ups.starred = 1")
+	}
+	if !query.PublishedAfter.IsZero() {
+		conditions = append(conditions, "julianday(p.published_at) > julianday(?)")
+		args = append(args, query.PublishedAfter)
+	}
+	if !query.PublishedBefore.IsZero() {
+		conditions = append(conditions, "julianday(p.published_at) < julianday(?)")
+		args = append(args, query.PublishedBefore)
+	}
+	if query.FilterRuleID > 0 {
+		conditions = append(conditions, `EXISTS (
+			SELECT 1 FROM filter_rules fr
+			WHERE fr.id = ? AND fr.user_id = ? AND `+filterRuleMatches+`
+		)`)
+		args = append(args, query.FilterRuleID, userID)
+	}
+	direction := "ASC"
+	if query.NewestFirst {
+		direction = "DESC"
+	}
+	order := "p.id " + direction
+	if query.ByPublished {
+		order = "julianday(p.published_at) " + direction + ", " + order
+	}
+	args = append(args, query.Limit)
+
+	rows, err := store.db.Query(`
+		SELECT p.id, COALESCE(p.title, ''), p.link, p.published_at, COALESCE(p.content, ''),
+		       COALESCE(ups.seen, 0), COALESCE(ups.starred, 0), p.updated_at, p.feed_id, COALESCE(p.author, '')
+		FROM posts p
+		JOIN user_feeds uf ON uf.feed_id = p.feed_id AND uf.user_id = ?
+		LEFT JOIN user_post_states ups ON ups.post_id = p.id AND ups.user_id = ?
+		WHERE `+strings.Join(conditions, " AND ")+`
+		ORDER BY `+order+`
+		LIMIT ?
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying posts for user: %w", err)
+	}
+	defer rows.Close()
+
+	var posts []FeedPost
+	for rows.Next() {
+		var p FeedPost
+		var updatedAt sql.NullTime
+		err := rows.Scan(&p.ID, &p.Title, &p.Link, &p.PublishedAt, &p.Content, &p.Seen, &p.Starred, &updatedAt, &p.FeedID, &p.Author)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning post: %w", err)
+		}
+		p.UpdatedAt = updatedAt.Time
+		posts = append(posts, p)
+	}
+	return posts, rows.Err()
+}
+
+// CountPostsForUser counts the posts in the user's subscribed feeds, not
+// counting posts hidden by filter rules.
+func (store *Store) CountPostsForUser(userID int64) (int, error) {
+	var count int
 	err := store.db.QueryRow(`
-		SELECT p.id, p.title, p.link, p.published_at, p.content
+		SELECT COUNT(*)
+		FROM posts p
+		JOIN user_feeds uf ON uf.feed_id = p.feed_id AND uf.user_id = ?
+		WHERE `+notHiddenByFilter, userID, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("error counting posts for user: %w", err)
+	}
+	return count, nil
+}
+
+// GetUnreadPostIDsForUser lists the ids of all posts in the user's
+// subscribed feeds they have not seen, leaving out posts hidden by filter
+// rules.
+func (store *Store) GetUnreadPostIDsForUser(userID int64) ([]int64, error) {
+	return store.queryPostIDs(`
+		SELECT p.id
+		FROM posts p
+		JOIN user_feeds uf ON uf.feed_id = p.feed_id AND uf.user_id = ?
+		LEFT JOIN user_post_states ups ON ups.post_id = p.id AND ups.user_id = ?
+		WHERE COALESCE(ups.seen, 0) = 0 AND `+notHiddenByFilter+`
+		ORDER BY p.id
+	`, userID, userID, userID)
+}
+
+// GetStarredPostIDsForUser lists the ids of the posts the user has starred.
+func (store *Store) GetStarredPostIDsForUser(userID int64) ([]int64, error) {
+	return store.queryPostIDs(`
+		SELECT ups.post_id
+		FROM user_post_states ups
+		JOIN posts p ON p.id = ups.post_id
+		JOIN user_feeds uf ON uf.feed_id = p.feed_id AND uf.user_id = ups.user_id
+		WHERE ups.user_id = ? AND ups.starred = 1
+		ORDER BY ups.post_id
+	`, userID)
+}
+
+func (store *Store) queryPostIDs(query string, args ...any) ([]int64, error) {
+	rows, err := store.db.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error querying post ids: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("error scanning post id: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// MarkPostAsUnseenForUser marks a post as not seen for a given user. It
+// returns sql.ErrNoRows when the post is not accessible to the user.
+func (store *Store) MarkPostAsUnseenForUser(userID, postID int64) error {
+	res, err := store.db.Exec(`
+		INSERT INTO user_post_states (user_id, post_id, seen)
+		SELECT ?, p.id, 0
+		FROM posts p
+		JOIN user_feeds uf ON uf.feed_id = p.feed_id AND uf.user_id = ?
+		WHERE p.id = ?
+		ON CONFLICT(user_id, post_id) DO UPDATE SET seen = 0
+	`, userID, userID, postID)
+	if err != nil {
+		return fmt.Errorf("error marking post as unseen for user: %w", err)
+	}
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// MarkFeedPostsAsSeenBeforeForUser marks the posts of a feed published at or
+// before the given time as seen for a user. It returns sql.ErrNoRows when the
+// user is not subscribed to the feed.
+func (store *Store) MarkFeedPostsAsSeenBeforeForUser(userID, feedID int64, before time.Time) error {
+	var subscribed int
+	err := store.db.QueryRow(
+		"SELECT COUNT(*) FROM user_feeds WHERE user_id = ? AND feed_id = ?",
+		userID, feedID,
+	).Scan(&subscribed)
+	if err != nil {
+		return fmt.Errorf("error checking feed subscription: %w", err)
+	}
+	if subscribed == 0 {
+		return sql.ErrNoRows
+	}
+
+	_, err = store.db.Exec(`
+		INSERT INTO user_post_states (user_id, post_id, seen)
+		SELECT ?, p.id, 1
 		FROM posts p
-		JOIN user_feeds uf ON uf.feed_id = p.feed_id AND uf.user_id = ?
-		WHERE p.id = ?
-	`, userID, postID).Scan(&p.ID, &p.Title, &p.Link, &p.PublishedAt, &p.Content)
+		WHERE p.feed_id = ? AND julianday(p.published_at) <= julianday(?)
+		ON CONFLICT(user_id, post_id) DO UPDATE SET seen = 1
+	`, userID, feedID, before)
+	if err != nil {
+		return fmt.Errorf("error marking feed posts as seen for user: %w", err)
+	}
+	return nil
+}
+
+// ErrFeverCredentialsInUse is returned when another user already uses the
+// same Fever username and password.
+var ErrFeverCredentialsInUse = errors.New("fever credentials are already in use")
+
+// FeverAPIKey is the key Fever clients send for a username and password.
+func FeverAPIKey(username, password string) string {
+	sum := md5.Sum([]byte(username + ":" + password))
+	return hex.EncodeToString(sum[:])
+}
+
+// SetFeverCredentialsForUser enables the Fever API for a user with the given
+// username and password, replacing earlier credentials.
+func (store *Store) SetFeverCredentialsForUser(userID int64, username, password string) error {
+	hash := hashAPIToken(FeverAPIKey(username, password))
+	var otherUsers int
+	err := store.db.QueryRow(
+		"SELECT COUNT(*) FROM users WHERE fever_key_hash = ? AND id != ?",
+		hash, userID,
+	).Scan(&otherUsers)
+	if err != nil {
+		return fmt.Errorf("error checking fever credentials: %w", err)
+	}
+	if otherUsers > 0 {
+		return ErrFeverCredentialsInUse
+	}
+
+	if _, err := store.db.Exec(
+		"UPDATE users SET fever_username = ?, fever_key_hash = ? WHERE id = ?",
+		username, hash, userID,
+	); err != nil {
+		return fmt.Errorf("error setting fever credentials: %w", err)
+	}
+	return nil
+}
+
+// ClearFeverCredentialsForUser disables the Fever API for a user.
+func (store *Store) ClearFeverCredentialsForUser(userID int64) error {
+	if _, err := store.db.Exec(
+		"UPDATE users SET fever_username = NULL, fever_key_hash = NULL WHERE id = ?",
+		userID,
+	); err != nil {
+		return fmt.Errorf("error clearing fever credentials: %w", err)
+	}
+	return nil
+}
+
+// GetFeverUsernameForUser returns the user's Fever username, or an empty
+// string if the Fever API is not enabled for them.
+func (store *Store) GetFeverUsernameForUser(userID int64) (string, error) {
+	var username sql.NullString
+	err := store.db.QueryRow("SELECT fever_username FROM users WHERE id = ?", userID).Scan(&username)
+	if err != nil {
+		return "", fmt.Errorf("error getting fever username: %w", err)
+	}
+	return username.String, nil
+}
+
+// GetUserIDForFeverAPIKey resolves the key sent by a Fever client to its
+// user. Returns sql.ErrNoRows for unknown keys.
+func (store *Store) GetUserIDForFeverAPIKey(apiKey string) (int64, error) {
+	var userID int64
+	err := store.db.QueryRow(
+		"SELECT id FROM users WHERE fever_key_hash = ?",
+		hashAPIToken(strings.ToLower(apiKey)),
+	).Scan(&userID)
 	if err == sql.ErrNoRows {
-		return nil, sql.ErrNoRows
+		return 0, sql.ErrNoRows
 	}
 	if err != nil {
-		return nil, fmt.Errorf("error querying post for user: %w", err)
+		return 0, fmt.Errorf("error looking up fever api key: %w", err)
 	}
-	return &p, nil
+	return userID, nil
 }
 
-// GetUserColumns gets the number of columns for a user
-func (store *Store) GetUserColumns(userId int64) (int, error) {
-	var columns int
-	err := store.db.QueryRow(`
-		SELECT columns 
-		FROM user_preferences 
-		WHERE user_id = ?
-	`, userId).Scan(&columns)
+// LocalIssuer is the issuer of users with a built-in account. Their username
+// is stored as the subject, so they live alongside OIDC users.
+const LocalIssuer = "local"
+
+var (
+	// ErrUsernameTaken is returned when registering a username that exists.
+	ErrUsernameTaken = errors.New("username is already taken")
+	// ErrInvalidCredentials is returned for an unknown username or a wrong
+	// password.
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	// ErrInvalidInvite is returned for unknown or already used invite codes.
+	ErrInvalidInvite = errors.New("invite code is invalid or already used")
+)
+
+// LocalAccount describes a user's built-in account.
+type LocalAccount struct {
+	Username string
+	IsAdmin  bool
+}
+
+// CountLocalUsers returns the number of users with a built-in account.
+func (store *Store) CountLocalUsers() (int, error) {
+	var count int
+	if err := store.db.QueryRow("SELECT COUNT(*) FROM users WHERE oidc_issuer = ?", LocalIssuer).Scan(&count); err != nil {
+		return 0, fmt.Errorf("error counting local users: %w", err)
+	}
+	return count, nil
+}
+
+// CreateLocalUser creates a built-in account with a bcrypt hash of the
+// password. A non-empty invite code is used up by the new account. The first
+// local account becomes the admin.
+func (store *Store) CreateLocalUser(username, password, inviteCode string) (int64, error) {
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, fmt.Errorf("error hashing password: %w", err)
+	}
+
+	tx, err := store.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var existing int
+	if err := tx.QueryRow(
+		"SELECT COUNT(*) FROM users WHERE oidc_subject = ? AND oidc_issuer = ?",
+		username, LocalIssuer,
+	).Scan(&existing); err != nil {
+		return 0, fmt.Errorf("error checking username: %w", err)
+	}
+	if existing > 0 {
+		return 0, ErrUsernameTaken
+	}
+
+	result, err := tx.Exec(`
+		INSERT INTO users (oidc_subject, oidc_issuer, password_hash, is_admin)
+		VALUES (?, ?, ?, NOT EXISTS (SELECT 1 FROM users WHERE oidc_issuer = ?))
+	`, username, LocalIssuer, string(passwordHash), LocalIssuer)
+	if err != nil {
+		return 0, fmt.Errorf("error creating local user: %w", err)
+	}
+	userID, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("error getting last insert id: %w", err)
+	}
+
+	if inviteCode != "" {
+		result, err := tx.Exec(
+			"UPDATE invites SET used_by = ?, used_at = ? WHERE code_hash = ? AND used_by IS NULL",
+			userID, time.Now().UTC(), hashAPIToken(inviteCode),
+		)
+		if err != nil {
+			return 0, fmt.Errorf("error using invite: %w", err)
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return 0, fmt.Errorf("error getting rows affected: %w", err)
+		}
+		if affected == 0 {
+			return 0, ErrInvalidInvite
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return userID, nil
+}
+
+// AuthenticateLocalUser checks a username and password and returns the
+// user's ID, or ErrInvalidCredentials.
+func (store *Store) AuthenticateLocalUser(username, password string) (int64, error) {
+	var userID int64
+	var passwordHash sql.NullString
+	err := store.db.QueryRow(
+		"SELECT id, password_hash FROM users WHERE oidc_subject = ? AND oidc_issuer = ?",
+		username, LocalIssuer,
+	).Scan(&userID, &passwordHash)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("error looking up local user: %w", err)
+	}
+	// Unknown users and accounts without a password are checked against a
+	// dummy hash, so that the response time does not tell them apart.
+	hash := []byte(passwordHash.String)
+	if !passwordHash.Valid {
+		hash = dummyPasswordHash
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil || !passwordHash.Valid {
+		return 0, ErrInvalidCredentials
+	}
+	return userID, nil
+}
+
+// dummyPasswordHash is a bcrypt hash with the cost of real password hashes,
+// of a random password that was thrown away.
+var dummyPasswordHash = []byte("$2a$10$LacyjaE7A/7ZRx6xAHNezOVBJGmSa8fJ4evmSRD3W0yJ4ZPTZBXNy")
 
+// ChangePasswordForUser replaces the password of a local account after
+// checking the current one. Returns ErrInvalidCredentials if it is wrong.
+func (store *Store) ChangePasswordForUser(userID int64, currentPassword, newPassword string) error {
+	var passwordHash sql.NullString
+	err := store.db.QueryRow(
+		"SELECT password_hash FROM users WHERE id = ? AND oidc_issuer = ?",
+		userID, LocalIssuer,
+	).Scan(&passwordHash)
 	if err == sql.ErrNoRows {
-		// Return default value if no preference is set
-		return 2, nil
+		return ErrInvalidCredentials
 	}
 	if err != nil {
-		return 0, fmt.Errorf("error querying user columns preference: %w", err)
+		return fmt.Errorf("error looking up local user: %w", err)
+	}
+	if !passwordHash.Valid || bcrypt.CompareHashAndPassword([]byte(passwordHash.String), []byte(currentPassword)) != nil {
+		return ErrInvalidCredentials
 	}
 
-	return columns, nil
+	newHash, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("error hashing password: %w", err)
+	}
+	if _, err := store.db.Exec("UPDATE users SET password_hash = ? WHERE id = ?", string(newHash), userID); err != nil {
+		return fmt.Errorf("error updating password: %w", err)
+	}
+	return nil
 }
 
-// SetUserColumns sets the number of columns for a user
-func (store *Store) SetUserColumns(userId int64, columns int) error {
-	_, err := store.db.Exec(`
-		INSERT INTO user_preferences (user_id, columns) 
-		VALUES (?, ?) 
-		ON CONFLICT(user_id) DO UPDATE SET columns = ?
-	`, userId, columns, columns)
+// GetLocalAccountForUser returns the user's built-in account. Returns
+// sql.ErrNoRows for users who sign in with OIDC.
+func (store *Store) GetLocalAccountForUser(userID int64) (LocalAccount, error) {
+	var account LocalAccount
+	err := store.db.QueryRow(
+		"SELECT oidc_subject, is_admin FROM users WHERE id = ? AND oidc_issuer = ?",
+		userID, LocalIssuer,
+	).Scan(&account.Username, &account.IsAdmin)
+	if err == sql.ErrNoRows {
+		return LocalAccount{}, sql.ErrNoRows
+	}
 	if err != nil {
-		return fmt.Errorf("error setting user columns preference: %w", err)
+		return LocalAccount{}, fmt.Errorf("error getting local account: %w", err)
+	}
+	return account, nil
+}
+
+// Invite describes an invitation to register. The invite code itself is
+// never stored and so is not part of this struct.
+type Invite struct {
+	ID        int64
+	CreatedAt time.Time
+	// UsedBy is the username of the account registered with the invite, or
+	// empty while it is unused.
+	UsedBy string
+	UsedAt time.Time
+}
+
+// CreateInviteForUser creates a single-use invite and returns its code, which
+// cannot be retrieved again later.
+func (store *Store) CreateInviteForUser(userID int64) (string, error) {
+	secret := make([]byte, 16)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("error generating invite code: %w", err)
+	}
+	code := hex.EncodeToString(secret)
+
+	if _, err := store.db.Exec(
+		"INSERT INTO invites (created_by, code_hash) VALUES (?, ?)",
+		userID, hashAPIToken(code),
+	); err != nil {
+		return "", fmt.Errorf("error creating invite: %w", err)
+	}
+	return code, nil
+}
+
+// GetInvitesForUser lists the invites the user created, newest first.
+func (store *Store) GetInvitesForUser(userID int64) ([]Invite, error) {
+	rows, err := store.db.Query(`
+		SELECT i.id, i.created_at, COALESCE(u.oidc_subject, ''), i.used_at
+		FROM invites i
+		LEFT JOIN users u ON u.id = i.used_by
+		WHERE i.created_by = ?
+		ORDER BY i.created_at DESC, i.id DESC
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying invites: %w", err)
+	}
+	defer rows.Close()
+
+	var invites []Invite
+	for rows.Next() {
+		var invite Invite
+		var usedAt sql.NullTime
+		if err := rows.Scan(&invite.ID, &invite.CreatedAt, &invite.UsedBy, &usedAt); err != nil {
+			return nil, fmt.Errorf("error scanning invite: %w", err)
+		}
+		if usedAt.Valid {
+			invite.UsedAt = usedAt.Time
+		}
+		invites = append(invites, invite)
+	}
+	return invites, rows.Err()
+}
+
+// DeleteInviteForUser withdraws one of the user's invites. Returns
+// sql.ErrNoRows when the invite does not exist or belongs to another user.
+func (store *Store) DeleteInviteForUser(userID, inviteID int64) error {
+	res, err := store.db.Exec("DELETE FROM invites WHERE id = ? AND created_by = ?", inviteID, userID)
+	if err != nil {
+		return fmt.Errorf("error deleting invite: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// Passkey describes a WebAuthn credential registered by a local user.
+type Passkey struct {
+	ID         int64
+	Name       string
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+}
+
+// AddPasskeyForUser stores a newly registered passkey. The credential is
+// opaque to the store.
+func (store *Store) AddPasskeyForUser(userID int64, name string, credentialID []byte, credential string) error {
+	if _, err := store.db.Exec(
+		"INSERT INTO passkeys (user_id, name, credential_id, credential) VALUES (?, ?, ?, ?)",
+		userID, name, credentialID, credential,
+	); err != nil {
+		return fmt.Errorf("error adding passkey: %w", err)
+	}
+	return nil
+}
+
+// GetPasskeysForUser lists the user's passkeys, oldest first.
+func (store *Store) GetPasskeysForUser(userID int64) ([]Passkey, error) {
+	rows, err := store.db.Query(`
+		SELECT id, name, created_at, last_used_at
+		FROM passkeys
+		WHERE user_id = ?
+		ORDER BY created_at, id
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying passkeys: %w", err)
+	}
+	defer rows.Close()
+
+	var passkeys []Passkey
+	for rows.Next() {
+		var p Passkey
+		var lastUsedAt sql.NullTime
+		if err := rows.Scan(&p.ID, &p.Name, &p.CreatedAt, &lastUsedAt); err != nil {
+			return nil, fmt.Errorf("error scanning passkey: %w", err)
+		}
+		if lastUsedAt.Valid {
+			p.LastUsedAt = lastUsedAt.Time
+		}
+		passkeys = append(passkeys, p)
+	}
+	return passkeys, rows.Err()
+}
+
+// GetPasskeyCredentialsForUser returns the stored credentials of all of the
+// user's passkeys.
+func (store *Store) GetPasskeyCredentialsForUser(userID int64) ([]string, error) {
+	rows, err := store.db.Query("SELECT credential FROM passkeys WHERE user_id = ? ORDER BY id", userID)
+	if err != nil {
+		return nil, fmt.Errorf("error querying passkey credentials: %w", err)
+	}
+	defer rows.Close()
+
+	var credentials []string
+	for rows.Next() {
+		var credential string
+		if err := rows.Scan(&credential); err != nil {
+			return nil, fmt.Errorf("error scanning passkey credential: %w", err)
+		}
+		credentials = append(credentials, credential)
+	}
+	return credentials, rows.Err()
+}
+
+// UpdatePasskeyCredential replaces the stored credential after a sign in,
+// e.g. to record the authenticator's new signature counter.
+func (store *Store) UpdatePasskeyCredential(credentialID []byte, credential string) error {
+	if _, err := store.db.Exec(
+		"UPDATE passkeys SET credential = ?, last_used_at = ? WHERE credential_id = ?",
+		credential, time.Now().UTC(), credentialID,
+	); err != nil {
+		return fmt.Errorf("error updating passkey: %w", err)
+	}
+	return nil
+}
+
+// DeletePasskeyForUser removes one of the user's passkeys. Returns
+// sql.ErrNoRows when the passkey does not exist or belongs to another user.
+func (store *Store) DeletePasskeyForUser(userID, passkeyID int64) error {
+	res, err := store.db.Exec("DELETE FROM passkeys WHERE id = ? AND user_id = ?", passkeyID, userID)
+	if err != nil {
+		return fmt.Errorf("error deleting passkey: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("error getting rows affected: %w", err)
+	}
+	if affected == 0 {
+		return sql.ErrNoRows
 	}
 	return nil
 }
+
+// ErrNoCredentialsKey is returned when storing feed credentials without a
+// key to encrypt them with.
+var ErrNoCredentialsKey = errors.New("no key for encrypting feed credentials is configured")
+
+// FeedCredentials are sent with every request for a private feed. They are
+// stored encrypted.
+type FeedCredentials struct {
+	// Username and Password are sent with HTTP basic auth.
+	Username    string       `json:"username,omitempty"`
+	Password    string       `json:"password,omitempty"`
+	BearerToken string       `json:"bearer_token,omitempty"`
+	Cookie      string       `json:"cookie,omitempty"`
+	Headers     []FeedHeader `json:"headers,omitempty"`
+}
+
+// FeedHeader is a custom request header.
+type FeedHeader struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// IsZero reports whether there are no credentials at all.
+func (c FeedCredentials) IsZero() bool {
+	return c.Username == "" && c.Password == "" && c.BearerToken == "" && c.Cookie == "" && len(c.Headers) == 0
+}
+
+// SetCredentialsKey derives the key that encrypts feed credentials at rest
+// from secret. Without one, feed credentials cannot be stored.
+func (store *Store) SetCredentialsKey(secret string) {
+	key := sha256.Sum256([]byte(secret))
+	store.credentialsKey = key[:]
+}
+
+// credentialsCipher returns the AEAD that encrypts feed credentials.
+func (store *Store) credentialsCipher() (cipher.AEAD, error) {
+	if store.credentialsKey == nil {
+		return nil, ErrNoCredentialsKey
+	}
+	block, err := aes.NewCipher(store.credentialsKey)
+	if err != nil {
+		return nil, fmt.Errorf("error creating cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptCredentials returns the stored form of creds: a random nonce
+// followed by the AES-GCM sealed JSON.
+func (store *Store) encryptCredentials(creds FeedCredentials) ([]byte, error) {
+	aead, err := store.credentialsCipher()
+	if err != nil {
+		return nil, err
+	}
+	plaintext, err := json.Marshal(creds)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding credentials: %w", err)
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("error generating nonce: %w", err)
+	}
+	return aead.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+func (store *Store) decryptCredentials(sealed []byte) (FeedCredentials, error) {
+	var creds FeedCredentials
+	aead, err := store.credentialsCipher()
+	if err != nil {
+		return creds, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return creds, errors.New("stored credentials are truncated")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return creds, fmt.Errorf("error decrypting credentials: %w", err)
+	}
+	if err := json.Unmarshal(plaintext, &creds); err != nil {
+		return creds, fmt.Errorf("error decoding credentials: %w", err)
+	}
+	return creds, nil
+}
+
+// GetFeedCredentials returns the credentials a feed is fetched with, which
+// are empty for feeds without any.
+func (store *Store) GetFeedCredentials(feedID int64) (FeedCredentials, error) {
+	var sealed []byte
+	err := store.db.QueryRow("SELECT credentials FROM feeds WHERE id = ?", feedID).Scan(&sealed)
+	if err != nil {
+		return FeedCredentials{}, fmt.Errorf("error querying feed credentials: %w", err)
+	}
+	if sealed == nil {
+		return FeedCredentials{}, nil
+	}
+	return store.decryptCredentials(sealed)
+}
+
+// SetFeedCredentialsForUser sets the credentials the user's subscription is
+// fetched with and returns the ID of the feed they are subscribed to
+// afterwards. A feed with credentials is private to the user: if others
+// subscribe to the same feed, the user's subscription moves to a private copy
+// of it, with its posts and the user's tags, dashboard places, filter rules
+// and read and starred state. Empty credentials remove them, but the feed
+// stays private. The feed is fetched again from scratch at the next
+// opportunity. It returns sql.ErrNoRows if the user is not subscribed to the
+// feed.
+func (store *Store) SetFeedCredentialsForUser(userID, feedID int64, creds FeedCredentials) (int64, error) {
+	var sealed []byte
+	if !creds.IsZero() {
+		var err error
+		if sealed, err = store.encryptCredentials(creds); err != nil {
+			return 0, err
+		}
+	}
+
+	tx, err := store.db.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("error starting transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var ownerUserID sql.NullInt64
+	var others int
+	err = tx.QueryRow(`
+		SELECT f.owner_user_id,
+		       (SELECT COUNT(*) FROM user_feeds o WHERE o.feed_id = f.id AND o.user_id != uf.user_id)
+		FROM feeds f JOIN user_feeds uf ON uf.feed_id = f.id
+		WHERE f.id = ? AND uf.user_id = ?
+	`, feedID, userID).Scan(&ownerUserID, &others)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return 0, err
+		}
+		return 0, fmt.Errorf("error looking up subscription: %w", err)
+	}
+	if !ownerUserID.Valid && sealed == nil {
+		// A shared feed without credentials stays shared.
+		return feedID, nil
+	}
+
+	privateID := feedID
+	if !ownerUserID.Valid && others > 0 {
+		if privateID, err = forkFeedForUser(tx, userID, feedID); err != nil {
+			return 0, err
+		}
+	}
+
+	if _, err := tx.Exec(`
+		UPDATE feeds
+		SET owner_user_id = ?, credentials = ?, etag = NULL, last_modified = NULL, cache_until = NULL,
+		    next_fetch_at = NULL
+		WHERE id = ?
+	`, userID, sealed, privateID); err != nil {
+		return 0, fmt.Errorf("error setting feed credentials: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error committing transaction: %w", err)
+	}
+	return privateID, nil
+}
+
+// forkFeedForUser copies a shared feed and its posts into a new feed owned by
+// the user and moves the user's subscription and everything attached to it
+// over. It returns the ID of the copy.
+func forkFeedForUser(tx *sql.Tx, userID, feedID int64) (int64, error) {
+	var privateID int64
+	err := tx.QueryRow(`
+		INSERT INTO feeds (url, title, owner_user_id)
+		SELECT url, title, ? FROM feeds WHERE id = ?
+		RETURNING id
+	`, userID, feedID).Scan(&privateID)
+	if err != nil {
+		return 0, fmt.Errorf("error copying feed: %w", err)
+	}
+
+	// ?1 is the shared feed, ?2 the copy and ?3 the user.
+	steps := []struct{ what, query string }{
+		{"posts", `
+			INSERT INTO posts (feed_id, guid, title, link, published_at, content, created_at,
+			                   content_hash, updated_at, author, summary, categories, image_url,
+			                   comments_url, enclosures, source_updated_at)
+			SELECT ?2, guid, title, link, published_at, content, created_at, content_hash, updated_at, author,
+			       summary, categories, image_url, comments_url, enclosures, source_updated_at
+			FROM posts WHERE feed_id = ?1`},
+		{"post states", `
+			INSERT INTO user_post_states (user_id, post_id, seen, starred, starred_at)
+			SELECT s.user_id, copy.id, s.seen, s.starred, s.starred_at
+			FROM user_post_states s
+			JOIN posts shared ON shared.id = s.post_id AND shared.feed_id = ?1
+			JOIN posts copy ON copy.feed_id = ?2 AND copy.guid = shared.guid
+			WHERE s.user_id = ?3`},
+		{"post states", "DELETE FROM user_post_states WHERE user_id = ?3 AND post_id IN (SELECT id FROM posts WHERE feed_id = ?1)"},
+		{"subscription", "UPDATE user_feeds SET feed_id = ?2 WHERE feed_id = ?1 AND user_id = ?3"},
+		{"dashboard places", `
+			UPDATE dashboard_feeds SET feed_id = ?2
+			WHERE feed_id = ?1 AND dashboard_id IN (SELECT id FROM dashboards WHERE user_id = ?3)`},
+		{"tags", "UPDATE feed_tags SET feed_id = ?2 WHERE feed_id = ?1 AND user_id = ?3"},
+		{"filter rules", "UPDATE filter_rules SET feed_id = ?2 WHERE feed_id = ?1 AND user_id = ?3"},
+	}
+	for _, step := range steps {
+		if _, err := tx.Exec(step.query, feedID, privateID, userID); err != nil {
+			return 0, fmt.Errorf("error moving %s to private feed: %w", step.what, err)
+		}
+	}
+	return privateID, nil
+}
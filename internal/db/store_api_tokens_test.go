@@ -0,0 +1,91 @@
+package db
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPITokens_CreateLookupAndRevoke(t *testing.T) {
+	store := newSearchTestStore(t)
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+
+	token, err := store.CreateAPITokenForUser(userID, "script")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(token, apiTokenPrefix))
+
+	var stored string
+	require.NoError(t, store.db.QueryRow("SELECT token_hash FROM api_tokens").Scan(&stored))
+	assert.NotContains(t, stored, token, "only the hash of the token may be stored")
+
+	tokens, err := store.GetAPITokensForUser(userID)
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	assert.Equal(t, "script", tokens[0].Name)
+	assert.True(t, tokens[0].LastUsedAt.IsZero())
+
+	got, err := store.GetUserIDForAPIToken(token)
+	require.NoError(t, err)
+	assert.Equal(t, userID, got)
+
+	tokens, err = store.GetAPITokensForUser(userID)
+	require.NoError(t, err)
+	assert.False(t, tokens[0].LastUsedAt.IsZero(), "using a token records its last use")
+
+	require.NoError(t, store.DeleteAPITokenForUser(userID, tokens[0].ID))
+	_, err = store.GetUserIDForAPIToken(token)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestAPITokens_ScopedToOwner(t *testing.T) {
+	store := newSearchTestStore(t)
+	alice, err := store.GetOrCreateUser("alice", "iss")
+	require.NoError(t, err)
+	bob, err := store.GetOrCreateUser("bob", "iss")
+	require.NoError(t, err)
+
+	_, err = store.CreateAPITokenForUser(alice, "alice's token")
+	require.NoError(t, err)
+	tokens, err := store.GetAPITokensForUser(alice)
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+
+	bobTokens, err := store.GetAPITokensForUser(bob)
+	require.NoError(t, err)
+	assert.Empty(t, bobTokens)
+
+	err = store.DeleteAPITokenForUser(bob, tokens[0].ID)
+	assert.ErrorIs(t, err, sql.ErrNoRows, "users cannot revoke each other's tokens")
+
+	_, err = store.GetUserIDForAPIToken("rsg_not-a-real-token")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestAPITokens_FeedTokensAreReadOnly(t *testing.T) {
+	store := newSearchTestStore(t)
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+
+	feedToken, err := store.CreateFeedTokenForUser(userID, "reader")
+	require.NoError(t, err)
+	apiToken, err := store.CreateAPITokenForUser(userID, "script")
+	require.NoError(t, err)
+
+	got, err := store.GetUserIDForFeedToken(feedToken)
+	require.NoError(t, err)
+	assert.Equal(t, userID, got)
+	_, err = store.GetUserIDForAPIToken(feedToken)
+	assert.ErrorIs(t, err, sql.ErrNoRows, "feed tokens cannot be used for the API")
+	_, err = store.GetUserIDForFeedToken(apiToken)
+	assert.ErrorIs(t, err, sql.ErrNoRows, "full access tokens cannot be used for output feeds")
+
+	tokens, err := store.GetAPITokensForUser(userID)
+	require.NoError(t, err)
+	require.Len(t, tokens, 2)
+	assert.False(t, tokens[0].ReadOnly)
+	assert.True(t, tokens[1].ReadOnly)
+}
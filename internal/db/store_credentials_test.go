@@ -0,0 +1,113 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetFeedCredentialsForUser_ForksSharedFeed(t *testing.T) {
+	store := newSearchTestStore(t)
+	store.SetCredentialsKey("secret")
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	otherID, err := store.GetOrCreateUser("other", "iss")
+	require.NoError(t, err)
+	sharedID, err := store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+	_, err = store.AddFeedForUser(otherID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+	require.NoError(t, store.SetFeedTagsForUser(userID, sharedID, []string{"private"}))
+	require.NoError(t, store.AddPost(sharedID, "1", "Post", "https://example.com/1", time.Now(), ""))
+	posts, err := store.GetFeedPosts(sharedID, userID, 10)
+	require.NoError(t, err)
+	require.NoError(t, store.SetPostStarredForUser(userID, posts[0].ID, true))
+
+	creds := FeedCredentials{
+		Username: "reader",
+		Password: "hunter2",
+		Headers:  []FeedHeader{{Name: "X-Api-Key", Value: "key"}},
+	}
+	privateID, err := store.SetFeedCredentialsForUser(userID, sharedID, creds)
+	require.NoError(t, err)
+	assert.NotEqual(t, sharedID, privateID, "others' subscriptions stay on the shared feed")
+
+	feeds, err := store.GetUserFeeds(userID)
+	require.NoError(t, err)
+	require.Len(t, feeds, 1)
+	assert.Equal(t, privateID, feeds[0].ID)
+	assert.Equal(t, userID, feeds[0].OwnerUserID)
+	assert.True(t, feeds[0].HasCredentials)
+	assert.Equal(t, []string{"private"}, feeds[0].Tags)
+	otherFeeds, err := store.GetUserFeeds(otherID)
+	require.NoError(t, err)
+	assert.Equal(t, sharedID, otherFeeds[0].ID)
+	assert.False(t, otherFeeds[0].HasCredentials)
+
+	starred, err := store.GetStarredPostsForUser(userID)
+	require.NoError(t, err)
+	require.Len(t, starred, 1, "posts are copied with the user's state")
+	assert.Equal(t, privateID, starred[0].FeedID)
+
+	stored, err := store.GetFeedCredentials(privateID)
+	require.NoError(t, err)
+	assert.Equal(t, creds, stored)
+	var sealed []byte
+	require.NoError(t, store.db.QueryRow("SELECT credentials FROM feeds WHERE id = ?", privateID).Scan(&sealed))
+	assert.NotContains(t, string(sealed), "hunter2", "credentials are encrypted at rest")
+
+	// The URL now leads each user to their own feed.
+	feedID, err := store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+	assert.Equal(t, privateID, feedID)
+	newID, err := store.GetOrCreateUser("new", "iss")
+	require.NoError(t, err)
+	feedID, err = store.AddFeedForUser(newID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+	assert.Equal(t, sharedID, feedID)
+	shared, err := store.GetFeedByURL("https://example.com/feed.xml")
+	require.NoError(t, err)
+	assert.Equal(t, sharedID, shared.ID)
+}
+
+func TestSetFeedCredentialsForUser_SoleSubscriber(t *testing.T) {
+	store := newSearchTestStore(t)
+	store.SetCredentialsKey("secret")
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+
+	privateID, err := store.SetFeedCredentialsForUser(userID, feedID, FeedCredentials{BearerToken: "token"})
+	require.NoError(t, err)
+	assert.Equal(t, feedID, privateID, "a feed nobody else reads becomes private in place")
+
+	_, err = store.SetFeedCredentialsForUser(userID, feedID, FeedCredentials{})
+	require.NoError(t, err)
+	feed, err := store.GetFeedByID(feedID)
+	require.NoError(t, err)
+	assert.False(t, feed.HasCredentials)
+	assert.Equal(t, userID, feed.OwnerUserID, "the feed stays private")
+
+	otherID, err := store.GetOrCreateUser("other", "iss")
+	require.NoError(t, err)
+	otherFeedID, err := store.AddFeedForUser(otherID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+	assert.NotEqual(t, feedID, otherFeedID, "private feeds are not shared")
+	_, err = store.SetFeedCredentialsForUser(otherID, feedID, FeedCredentials{BearerToken: "token"})
+	assert.Equal(t, sql.ErrNoRows, err)
+}
+
+func TestSetFeedCredentialsForUser_RequiresKey(t *testing.T) {
+	store := newSearchTestStore(t)
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+
+	_, err = store.SetFeedCredentialsForUser(userID, feedID, FeedCredentials{Cookie: "session=1"})
+	assert.ErrorIs(t, err, ErrNoCredentialsKey)
+}
@@ -0,0 +1,152 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func dashboardFeedIDs(t *testing.T, store *Store, userID, dashboardID int64) []int64 {
+	t.Helper()
+	feeds, err := store.GetDashboardFeeds(userID, dashboardID)
+	require.NoError(t, err)
+	ids := make([]int64, 0, len(feeds))
+	for _, f := range feeds {
+		ids = append(ids, f.ID)
+	}
+	return ids
+}
+
+func TestDashboards_DefaultDashboardHoldsNewSubscriptions(t *testing.T) {
+	store := newSearchTestStore(t)
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+
+	feed1, err := store.AddFeedForUser(userID, "https://example.com/1.xml")
+	require.NoError(t, err)
+	feed2, err := store.AddFeedForUser(userID, "https://example.com/2.xml")
+	require.NoError(t, err)
+
+	dashboards, err := store.GetDashboardsForUser(userID)
+	require.NoError(t, err)
+	require.Len(t, dashboards, 1)
+	assert.Equal(t, "Home", dashboards[0].Name)
+	assert.Equal(t, []int64{feed1, feed2}, dashboardFeedIDs(t, store, userID, dashboards[0].ID))
+}
+
+func TestDashboards_PlaceMoveAndDelete(t *testing.T) {
+	store := newSearchTestStore(t)
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	feed1, err := store.AddFeedForUser(userID, "https://example.com/1.xml")
+	require.NoError(t, err)
+	feed2, err := store.AddFeedForUser(userID, "https://example.com/2.xml")
+	require.NoError(t, err)
+
+	dashboards, err := store.GetDashboardsForUser(userID)
+	require.NoError(t, err)
+	home := dashboards[0].ID
+
+	news, err := store.CreateDashboardForUser(userID, "News")
+	require.NoError(t, err)
+	require.NoError(t, store.RenameDashboardForUser(userID, news, "Tech"))
+
+	// A feed can be on several dashboards at once.
+	require.NoError(t, store.SetFeedDashboardsForUser(userID, feed2, []int64{home, news}))
+	require.NoError(t, store.SetFeedDashboardsForUser(userID, feed1, []int64{news}))
+	assert.Equal(t, []int64{feed2}, dashboardFeedIDs(t, store, userID, home))
+	assert.Equal(t, []int64{feed2, feed1}, dashboardFeedIDs(t, store, userID, news))
+
+	placements, err := store.GetFeedDashboardIDsForUser(userID)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []int64{home, news}, placements[feed2])
+	assert.Equal(t, []int64{news}, placements[feed1])
+
+	// Layouts are per dashboard and renumber the order in reading order.
+	require.NoError(t, store.SaveDashboardLayoutForUser(userID, news, map[int64]WidgetLayout{
+		feed1: {Column: 1, Row: 1, Width: 2, Height: 1},
+		feed2: {Column: 1, Row: 2, Width: 1, Height: 3},
+	}))
+	assert.Equal(t, []int64{feed1, feed2}, dashboardFeedIDs(t, store, userID, news))
+	layout, err := store.GetDashboardLayout(userID, news)
+	require.NoError(t, err)
+	assert.Equal(t, WidgetLayout{Column: 1, Row: 2, Width: 1, Height: 3}, layout[feed2])
+	layout, err = store.GetDashboardLayout(userID, home)
+	require.NoError(t, err)
+	assert.Equal(t, WidgetLayout{Width: 1, Height: 1}, layout[feed2], "other dashboards keep their layout")
+
+	// A feed that is not on the dashboard fails the whole save.
+	err = store.SaveDashboardLayoutForUser(userID, home, map[int64]WidgetLayout{
+		feed2: {Column: 2, Row: 1, Width: 1, Height: 1},
+		feed1: {Column: 1, Row: 1, Width: 1, Height: 1},
+	})
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	layout, err = store.GetDashboardLayout(userID, home)
+	require.NoError(t, err)
+	assert.Zero(t, layout[feed2].Column)
+
+	require.NoError(t, store.SetLastDashboardID(userID, news))
+	last, err := store.GetLastDashboardID(userID)
+	require.NoError(t, err)
+	assert.Equal(t, news, last)
+
+	require.NoError(t, store.DeleteDashboardForUser(userID, news))
+	dashboards, err = store.GetDashboardsForUser(userID)
+	require.NoError(t, err)
+	require.Len(t, dashboards, 1)
+	assert.ErrorIs(t, store.DeleteDashboardForUser(userID, home), ErrLastDashboard)
+
+	// Deleting a dashboard keeps its feeds subscribed.
+	feeds, err := store.GetUserFeeds(userID)
+	require.NoError(t, err)
+	assert.Len(t, feeds, 2)
+}
+
+func TestDashboards_CrossUserDenied(t *testing.T) {
+	store := newSearchTestStore(t)
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	otherID, err := store.GetOrCreateUser("other", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://example.com/1.xml")
+	require.NoError(t, err)
+	otherFeedID, err := store.AddFeedForUser(otherID, "https://example.com/2.xml")
+	require.NoError(t, err)
+
+	dashboards, err := store.GetDashboardsForUser(userID)
+	require.NoError(t, err)
+	home := dashboards[0].ID
+
+	assert.ErrorIs(t, store.RenameDashboardForUser(otherID, home, "Mine"), sql.ErrNoRows)
+	assert.ErrorIs(t, store.DeleteDashboardForUser(otherID, home), sql.ErrNoRows)
+	assert.ErrorIs(t, store.SetFeedDashboardsForUser(otherID, otherFeedID, []int64{home}), sql.ErrNoRows)
+	assert.ErrorIs(t, store.SetFeedDashboardsForUser(userID, otherFeedID, []int64{home}), sql.ErrNoRows)
+	assert.ErrorIs(t, store.SaveDashboardLayoutForUser(otherID, home, map[int64]WidgetLayout{
+		feedID: {Column: 1, Row: 1, Width: 1, Height: 1},
+	}), sql.ErrNoRows)
+	layout, err := store.GetDashboardLayout(otherID, home)
+	require.NoError(t, err)
+	assert.Empty(t, layout)
+	assert.Empty(t, dashboardFeedIDs(t, store, otherID, home))
+	assert.Equal(t, []int64{feedID}, dashboardFeedIDs(t, store, userID, home))
+}
+
+func TestDashboards_UnsubscribeRemovesPlacements(t *testing.T) {
+	store := newSearchTestStore(t)
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://example.com/1.xml")
+	require.NoError(t, err)
+
+	dashboards, err := store.GetDashboardsForUser(userID)
+	require.NoError(t, err)
+
+	require.NoError(t, store.DeleteFeedForUser(userID, feedID))
+	assert.Empty(t, dashboardFeedIDs(t, store, userID, dashboards[0].ID))
+
+	var placements int
+	require.NoError(t, store.db.QueryRow(`SELECT COUNT(*) FROM dashboard_feeds`).Scan(&placements))
+	assert.Zero(t, placements)
+}
@@ -0,0 +1,99 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetFeedSettingsForUser(t *testing.T) {
+	store := newSearchTestStore(t)
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	otherID, err := store.GetOrCreateUser("other", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+	_, err = store.AddFeedForUser(otherID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+	require.NoError(t, store.UpdateFeedTitle(feedID, "Example"))
+	require.NoError(t, store.AddPost(feedID, "1", "Starred post", "https://example.com/1", time.Now(), "content"))
+
+	settings := FeedSettings{CustomTitle: "Mine", PostsPerFeed: 25, HideRead: true, ShowSummaries: true, Collapsed: true}
+	require.NoError(t, store.SetFeedSettingsForUser(userID, feedID, settings))
+
+	feeds, err := store.GetUserFeeds(userID)
+	require.NoError(t, err)
+	require.Len(t, feeds, 1)
+	assert.Equal(t, "Mine", feeds[0].Title, "the custom title replaces the feed's own")
+	assert.Equal(t, settings, feeds[0].Settings)
+
+	dashboards, err := store.GetDashboardsForUser(userID)
+	require.NoError(t, err)
+	feeds, err = store.GetDashboardFeeds(userID, dashboards[0].ID)
+	require.NoError(t, err)
+	require.Len(t, feeds, 1)
+	assert.Equal(t, settings, feeds[0].Settings)
+
+	posts, err := store.GetFeedPosts(feedID, userID, 10)
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	require.NoError(t, store.SetPostStarredForUser(userID, posts[0].ID, true))
+	starred, err := store.GetStarredPostsForUser(userID)
+	require.NoError(t, err)
+	require.Len(t, starred, 1)
+	assert.Equal(t, "Mine", starred[0].FeedTitle)
+
+	// Other subscribers keep the publisher's title and the defaults.
+	feeds, err = store.GetUserFeeds(otherID)
+	require.NoError(t, err)
+	require.Len(t, feeds, 1)
+	assert.Equal(t, "Example", feeds[0].Title)
+	assert.Equal(t, FeedSettings{}, feeds[0].Settings)
+
+	// Clearing the overrides restores the defaults.
+	require.NoError(t, store.SetFeedSettingsForUser(userID, feedID, FeedSettings{}))
+	feeds, err = store.GetUserFeeds(userID)
+	require.NoError(t, err)
+	assert.Equal(t, "Example", feeds[0].Title)
+	assert.Equal(t, FeedSettings{}, feeds[0].Settings)
+
+	unsubscribedID, err := store.AddFeedForUser(otherID, "https://example.com/other.xml")
+	require.NoError(t, err)
+	assert.ErrorIs(t, store.SetFeedSettingsForUser(userID, unsubscribedID, settings), sql.ErrNoRows)
+}
+
+func TestGetFeedPosts_HidesReadPosts(t *testing.T) {
+	store := newSearchTestStore(t)
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	otherID, err := store.GetOrCreateUser("other", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+	_, err = store.AddFeedForUser(otherID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+	now := time.Now()
+	require.NoError(t, store.AddPost(feedID, "1", "Read", "https://example.com/1", now.Add(-time.Hour), "content"))
+	require.NoError(t, store.AddPost(feedID, "2", "Unread", "https://example.com/2", now, "content"))
+
+	posts, err := store.GetFeedPosts(feedID, userID, 10)
+	require.NoError(t, err)
+	require.Len(t, posts, 2)
+	require.NoError(t, store.MarkPostAsSeenForUser(userID, posts[1].ID))
+	require.NoError(t, store.MarkPostAsSeenForUser(otherID, posts[1].ID))
+
+	require.NoError(t, store.SetFeedSettingsForUser(userID, feedID, FeedSettings{HideRead: true}))
+	posts, err = store.GetFeedPosts(feedID, userID, 10)
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	assert.Equal(t, "Unread", posts[0].Title)
+
+	// The setting only applies to the user who made it.
+	posts, err = store.GetFeedPosts(feedID, otherID, 10)
+	require.NoError(t, err)
+	assert.Len(t, posts, 2)
+}
@@ -0,0 +1,180 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func postIDs(posts []FeedPost) []int64 {
+	ids := make([]int64, 0, len(posts))
+	for _, p := range posts {
+		ids = append(ids, p.ID)
+	}
+	return ids
+}
+
+func feedPostTitles(posts []FeedPost) []string {
+	titles := make([]string, 0, len(posts))
+	for _, p := range posts {
+		titles = append(titles, p.Title)
+	}
+	return titles
+}
+
+func TestQueryPostsForUser(t *testing.T) {
+	store := newSearchTestStore(t)
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	otherID, err := store.GetOrCreateUser("other", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+	otherFeedID, err := store.AddFeedForUser(otherID, "https://example.com/other.xml")
+	require.NoError(t, err)
+
+	now := time.Now()
+	for _, guid := range []string{"1", "2", "3", "4"} {
+		_, err := store.UpsertPost(feedID, guid, "Post "+guid, "https://example.com/"+guid, "Jo", now, "")
+		require.NoError(t, err)
+	}
+	require.NoError(t, store.AddPost(otherFeedID, "x", "Not mine", "https://example.com/x", now, ""))
+	all, err := store.QueryPostsForUser(userID, PostQuery{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, all, 4)
+	ids := postIDs(all)
+	assert.Equal(t, feedID, all[0].FeedID)
+	assert.Equal(t, "Jo", all[0].Post.Author)
+
+	page, err := store.QueryPostsForUser(userID, PostQuery{SinceID: ids[1], Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, ids[2:], postIDs(page))
+
+	page, err = store.QueryPostsForUser(userID, PostQuery{MaxID: ids[3], NewestFirst: true, Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{ids[2], ids[1]}, postIDs(page))
+
+	otherPost, err := store.QueryPostsForUser(otherID, PostQuery{Limit: 1})
+	require.NoError(t, err)
+	page, err = store.QueryPostsForUser(userID, PostQuery{IDs: []int64{ids[0], otherPost[0].ID}, Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []int64{ids[0]}, postIDs(page), "posts from other users' feeds are left out")
+
+	count, err := store.CountPostsForUser(userID)
+	require.NoError(t, err)
+	assert.Equal(t, 4, count)
+
+	require.NoError(t, store.MarkPostAsSeenForUser(userID, ids[0]))
+	require.NoError(t, store.SetPostStarredForUser(userID, ids[1], true))
+	unread, err := store.GetUnreadPostIDsForUser(userID)
+	require.NoError(t, err)
+	assert.Equal(t, ids[1:], unread)
+	starred, err := store.GetStarredPostIDsForUser(userID)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{ids[1]}, starred)
+
+	require.NoError(t, store.MarkPostAsUnseenForUser(userID, ids[0]))
+	unread, err = store.GetUnreadPostIDsForUser(userID)
+	require.NoError(t, err)
+	assert.Equal(t, ids, unread)
+	assert.ErrorIs(t, store.MarkPostAsUnseenForUser(userID, otherPost[0].ID), sql.ErrNoRows)
+}
+
+func TestQueryPostsForUser_ByPublishedAndFilterRule(t *testing.T) {
+	store := newSearchTestStore(t)
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	otherID, err := store.GetOrCreateUser("other", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+
+	// Inserted out of publication order, with a different time zone.
+	now := time.Now()
+	_, err = store.UpsertPost(feedID, "1", "Go news", "https://example.com/1", "", now.Add(-time.Hour), "")
+	require.NoError(t, err)
+	_, err = store.UpsertPost(feedID, "2", "Rust news", "https://example.com/2", "", now.In(time.FixedZone("X", -5*3600)), "")
+	require.NoError(t, err)
+	_, err = store.UpsertPost(feedID, "3", "Go tips", "https://example.com/3", "", now.Add(-2*time.Hour), "")
+	require.NoError(t, err)
+
+	posts, err := store.QueryPostsForUser(userID, PostQuery{ByPublished: true, NewestFirst: true, Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Rust news", "Go news", "Go tips"}, feedPostTitles(posts))
+
+	ruleID, err := store.CreateFilterRuleForUser(userID, FilterRule{Field: FilterFieldTitle, Pattern: "go", Action: FilterActionHighlight})
+	require.NoError(t, err)
+	posts, err = store.QueryPostsForUser(userID, PostQuery{FilterRuleID: ruleID, ByPublished: true, Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Go tips", "Go news"}, feedPostTitles(posts))
+
+	_, err = store.AddFeedForUser(otherID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+	posts, err = store.QueryPostsForUser(otherID, PostQuery{FilterRuleID: ruleID, Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, posts, "other users' filter rules do not match")
+}
+
+func TestMarkFeedPostsAsSeenBeforeForUser(t *testing.T) {
+	store := newSearchTestStore(t)
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+
+	cutoff := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	// Published in a different time zone, so comparing the stored text would
+	// get the order wrong.
+	berlin := time.FixedZone("CEST", 2*60*60)
+	require.NoError(t, store.AddPost(feedID, "old", "Old", "https://example.com/old", cutoff.Add(-time.Minute).In(berlin), ""))
+	require.NoError(t, store.AddPost(feedID, "new", "New", "https://example.com/new", cutoff.Add(time.Minute), ""))
+
+	require.NoError(t, store.MarkFeedPostsAsSeenBeforeForUser(userID, feedID, cutoff))
+	posts, err := store.GetFeedPosts(feedID, userID, 10)
+	require.NoError(t, err)
+	seen := map[string]bool{}
+	for _, p := range posts {
+		seen[p.Title] = p.Seen
+	}
+	assert.Equal(t, map[string]bool{"Old": true, "New": false}, seen)
+
+	otherID, err := store.GetOrCreateUser("other", "iss")
+	require.NoError(t, err)
+	assert.ErrorIs(t, store.MarkFeedPostsAsSeenBeforeForUser(otherID, feedID, cutoff), sql.ErrNoRows)
+}
+
+func TestFeverCredentials(t *testing.T) {
+	store := newSearchTestStore(t)
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	otherID, err := store.GetOrCreateUser("other", "iss")
+	require.NoError(t, err)
+
+	username, err := store.GetFeverUsernameForUser(userID)
+	require.NoError(t, err)
+	assert.Empty(t, username)
+
+	require.NoError(t, store.SetFeverCredentialsForUser(userID, "jo@example.com", "correct horse"))
+	username, err = store.GetFeverUsernameForUser(userID)
+	require.NoError(t, err)
+	assert.Equal(t, "jo@example.com", username)
+
+	// Fever clients send md5("username:password").
+	key := FeverAPIKey("jo@example.com", "correct horse")
+	assert.Equal(t, "f3f1244f88283421d3a2c3515d733e67", key)
+	id, err := store.GetUserIDForFeverAPIKey(key)
+	require.NoError(t, err)
+	assert.Equal(t, userID, id)
+	_, err = store.GetUserIDForFeverAPIKey(FeverAPIKey("jo@example.com", "wrong"))
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	assert.ErrorIs(t, store.SetFeverCredentialsForUser(otherID, "jo@example.com", "correct horse"), ErrFeverCredentialsInUse)
+	require.NoError(t, store.SetFeverCredentialsForUser(userID, "jo@example.com", "correct horse"), "a user may save their own credentials again")
+
+	require.NoError(t, store.ClearFeverCredentialsForUser(userID))
+	_, err = store.GetUserIDForFeverAPIKey(key)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
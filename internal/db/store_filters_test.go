@@ -0,0 +1,115 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func postTitles(posts []Post) []string {
+	titles := make([]string, 0, len(posts))
+	for _, p := range posts {
+		titles = append(titles, p.Title)
+	}
+	return titles
+}
+
+func TestFilterRules_HideAndHighlight(t *testing.T) {
+	store := newSearchTestStore(t)
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	otherID, err := store.GetOrCreateUser("other", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+	_, err = store.AddFeedForUser(otherID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+	otherFeedID, err := store.AddFeedForUser(userID, "https://example.com/other.xml")
+	require.NoError(t, err)
+
+	now := time.Now()
+	_, err = store.UpsertPost(feedID, "1", "Crypto weekly", "https://example.com/1", "", now, "<p>Markets</p>")
+	require.NoError(t, err)
+	_, err = store.UpsertPost(feedID, "2", "Go 2.0 released", "https://example.com/2", "", now.Add(-time.Minute), "<p>Generics <b>everywhere</b></p>")
+	require.NoError(t, err)
+	_, err = store.UpsertPost(feedID, "3", "Weekend links", "https://sponsor.example.com/3", "", now.Add(-2*time.Minute), "")
+	require.NoError(t, err)
+	_, err = store.UpsertPost(otherFeedID, "4", "More crypto", "https://example.com/4", "", now, "")
+	require.NoError(t, err)
+
+	_, err = store.CreateFilterRuleForUser(userID, FilterRule{Field: FilterFieldTitle, Pattern: "CRYPTO", Action: FilterActionHide, FeedID: feedID})
+	require.NoError(t, err)
+	_, err = store.CreateFilterRuleForUser(userID, FilterRule{Field: FilterFieldLink, Regex: true, Pattern: `^https://sponsor\.`, Action: FilterActionHide})
+	require.NoError(t, err)
+	_, err = store.CreateFilterRuleForUser(userID, FilterRule{Field: FilterFieldContent, Pattern: "generics everywhere", Action: FilterActionHighlight})
+	require.NoError(t, err)
+
+	posts, err := store.GetFeedPosts(feedID, userID, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Go 2.0 released"}, postTitles(posts))
+	assert.True(t, posts[0].Highlighted, "content is matched without markup")
+
+	// The title rule is limited to the first feed.
+	posts, err = store.GetFeedPosts(otherFeedID, userID, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"More crypto"}, postTitles(posts))
+	assert.False(t, posts[0].Highlighted)
+
+	counts, err := store.GetUnreadCountsForUser(userID)
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]int{feedID: 1, otherFeedID: 1}, counts, "hidden posts are not counted as unread")
+
+	// Rules are per user.
+	posts, err = store.GetFeedPosts(feedID, otherID, 10)
+	require.NoError(t, err)
+	assert.Len(t, posts, 3)
+}
+
+func TestFilterRules_Management(t *testing.T) {
+	store := newSearchTestStore(t)
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	otherID, err := store.GetOrCreateUser("other", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+	require.NoError(t, store.UpdateFeedTitle(feedID, "Example"))
+	otherFeedID, err := store.AddFeedForUser(otherID, "https://example.com/other.xml")
+	require.NoError(t, err)
+
+	_, err = store.CreateFilterRuleForUser(userID, FilterRule{Field: FilterFieldTitle, Pattern: "x", Action: FilterActionHide, FeedID: otherFeedID})
+	assert.ErrorIs(t, err, sql.ErrNoRows, "rules can only be limited to subscribed feeds")
+
+	allFeedsID, err := store.CreateFilterRuleForUser(userID, FilterRule{Field: FilterFieldAuthor, Pattern: "bot", Action: FilterActionMarkSeen})
+	require.NoError(t, err)
+	feedRuleID, err := store.CreateFilterRuleForUser(userID, FilterRule{Field: FilterFieldTitle, Regex: true, Pattern: "^Ad:", Action: FilterActionHide, FeedID: feedID})
+	require.NoError(t, err)
+
+	rules, err := store.GetFilterRulesForUser(userID)
+	require.NoError(t, err)
+	assert.Equal(t, []FilterRule{
+		{ID: allFeedsID, Field: FilterFieldAuthor, Pattern: "bot", Action: FilterActionMarkSeen},
+		{ID: feedRuleID, FeedID: feedID, FeedTitle: "Example", Field: FilterFieldTitle, Regex: true, Pattern: "^Ad:", Action: FilterActionHide},
+	}, rules)
+
+	assert.ErrorIs(t, store.DeleteFilterRuleForUser(otherID, allFeedsID), sql.ErrNoRows)
+	require.NoError(t, store.DeleteFilterRuleForUser(userID, allFeedsID))
+
+	// Unsubscribing drops the rules limited to that feed.
+	require.NoError(t, store.DeleteFeedForUser(userID, feedID))
+	rules, err = store.GetFilterRulesForUser(userID)
+	require.NoError(t, err)
+	assert.Empty(t, rules)
+}
+
+func TestFilterMatch(t *testing.T) {
+	assert.True(t, filterMatch(false, "Go", "Learning go"))
+	assert.False(t, filterMatch(false, "rust", "Learning go"))
+	assert.True(t, filterMatch(false, "learning go", "Learning\n  go"))
+	assert.True(t, filterMatch(true, `^\[ad\]`, "[ad] Buy now"))
+	assert.False(t, filterMatch(true, `^\[ad\]`, "[AD] Buy now"))
+	assert.False(t, filterMatch(true, `(`, "("), "invalid patterns never match")
+}
@@ -150,3 +150,176 @@ func TestGetFeedByURL_ReturnsHealthFields(t *testing.T) {
 	assert.Equal(t, 1, feed.ConsecutiveFailures)
 	assert.Equal(t, "timeout", feed.LastError)
 }
+
+func TestGetDueFeeds(t *testing.T) {
+	store, cleanup := newHealthTestStore(t)
+	t.Cleanup(cleanup)
+
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	neverID, err := store.AddFeedForUser(userID, "https://never.example.com/feed.xml")
+	require.NoError(t, err)
+	overdueID, err := store.AddFeedForUser(userID, "https://overdue.example.com/feed.xml")
+	require.NoError(t, err)
+	futureID, err := store.AddFeedForUser(userID, "https://future.example.com/feed.xml")
+	require.NoError(t, err)
+
+	now := time.Date(2026, 6, 20, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, store.ScheduleFeedFetch(overdueID, now.Add(-time.Minute), 2*time.Hour))
+	require.NoError(t, store.ScheduleFeedFetch(futureID, now.Add(time.Minute), 0))
+
+	due, err := store.GetDueFeeds(now)
+	require.NoError(t, err)
+	var ids []int64
+	for _, f := range due {
+		ids = append(ids, f.ID)
+	}
+	assert.ElementsMatch(t, []int64{neverID, overdueID}, ids)
+
+	feed, err := store.GetFeedByURL("https://overdue.example.com/feed.xml")
+	require.NoError(t, err)
+	assert.Equal(t, 2*time.Hour, feed.TTL)
+	assert.True(t, feed.NextFetchAt.Equal(now.Add(-time.Minute)))
+}
+
+func TestMarkFeedGone_StopsPollingUntilNextSuccess(t *testing.T) {
+	store, cleanup := newHealthTestStore(t)
+	t.Cleanup(cleanup)
+
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+
+	now := time.Now().UTC()
+	require.NoError(t, store.MarkFeedGone(feedID, now))
+	due, err := store.GetDueFeeds(now)
+	require.NoError(t, err)
+	assert.Empty(t, due, "gone feeds are not polled")
+	feeds, err := store.GetUserFeeds(userID)
+	require.NoError(t, err)
+	assert.WithinDuration(t, now, feeds[0].GoneAt, time.Second)
+
+	require.NoError(t, store.RecordFeedSuccess(feedID, now))
+	due, err = store.GetDueFeeds(now)
+	require.NoError(t, err)
+	assert.Len(t, due, 1, "a feed that can be fetched again is polled again")
+}
+
+func TestMoveFeed_ChangesURL(t *testing.T) {
+	store, cleanup := newHealthTestStore(t)
+	t.Cleanup(cleanup)
+
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://old.example.com/feed.xml")
+	require.NoError(t, err)
+	require.NoError(t, store.SetFeedFinalURL(feedID, "https://cdn.example.com/feed.xml"))
+
+	require.NoError(t, store.MoveFeed(feedID, "https://new.example.com/feed.xml"))
+
+	feed, err := store.GetFeedByID(feedID)
+	require.NoError(t, err)
+	assert.Equal(t, "https://new.example.com/feed.xml", feed.URL)
+	assert.Empty(t, feed.FinalURL, "the final URL belonged to the old URL")
+}
+
+func TestMoveFeed_MergesWithExistingFeed(t *testing.T) {
+	store, cleanup := newHealthTestStore(t)
+	t.Cleanup(cleanup)
+
+	movedBy, err := store.GetOrCreateUser("moved", "iss")
+	require.NoError(t, err)
+	existingBy, err := store.GetOrCreateUser("existing", "iss")
+	require.NoError(t, err)
+	bothBy, err := store.GetOrCreateUser("both", "iss")
+	require.NoError(t, err)
+
+	oldID, err := store.AddFeedForUser(movedBy, "https://old.example.com/feed.xml")
+	require.NoError(t, err)
+	_, err = store.AddFeedForUser(bothBy, "https://old.example.com/feed.xml")
+	require.NoError(t, err)
+	newID, err := store.AddFeedForUser(existingBy, "https://new.example.com/feed.xml")
+	require.NoError(t, err)
+	_, err = store.AddFeedForUser(bothBy, "https://new.example.com/feed.xml")
+	require.NoError(t, err)
+	require.NoError(t, store.SetFeedTagsForUser(existingBy, newID, []string{"news"}))
+
+	published := time.Now()
+	require.NoError(t, store.AddPost(oldID, "shared", "Shared", "https://example.com/shared", published, ""))
+	require.NoError(t, store.AddPost(newID, "shared", "Shared", "https://example.com/shared", published, ""))
+	require.NoError(t, store.AddPost(newID, "only-new", "Only new", "https://example.com/new", published, ""))
+	newPosts, err := store.GetFeedPosts(newID, existingBy, 10)
+	require.NoError(t, err)
+	for _, post := range newPosts {
+		if post.Link == "https://example.com/shared" {
+			require.NoError(t, store.SetPostStarredForUser(existingBy, post.ID, true))
+		}
+	}
+
+	require.NoError(t, store.MoveFeed(oldID, "https://new.example.com/feed.xml"))
+
+	feeds, err := store.GetAllFeeds()
+	require.NoError(t, err)
+	require.Len(t, feeds, 1)
+	assert.Equal(t, oldID, feeds[0].ID, "the moved feed keeps its ID")
+	assert.Equal(t, "https://new.example.com/feed.xml", feeds[0].URL)
+
+	for _, userID := range []int64{movedBy, existingBy, bothBy} {
+		userFeeds, err := store.GetUserFeeds(userID)
+		require.NoError(t, err)
+		require.Len(t, userFeeds, 1, "every subscriber keeps one subscription")
+		assert.Equal(t, oldID, userFeeds[0].ID)
+	}
+	existingFeeds, err := store.GetUserFeeds(existingBy)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"news"}, existingFeeds[0].Tags)
+
+	posts, err := store.GetFeedPosts(oldID, existingBy, 10)
+	require.NoError(t, err)
+	assert.Len(t, posts, 2, "duplicate posts are merged")
+	starred, err := store.GetStarredPostsForUser(existingBy)
+	require.NoError(t, err)
+	require.Len(t, starred, 1, "the starred state survives the merge")
+	assert.Equal(t, "Shared", starred[0].Title)
+}
+
+func TestRecordFeedRateLimited_ClearedBySuccess(t *testing.T) {
+	store, cleanup := newHealthTestStore(t)
+	t.Cleanup(cleanup)
+
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+
+	until := time.Now().Add(time.Hour)
+	require.NoError(t, store.RecordFeedRateLimited(feedID, until))
+	feed, err := store.GetFeedByID(feedID)
+	require.NoError(t, err)
+	assert.WithinDuration(t, until, feed.RateLimitedUntil, time.Second)
+	assert.True(t, feed.RateLimited())
+	assert.Equal(t, 0, feed.ConsecutiveFailures, "rate limits are not failures")
+
+	require.NoError(t, store.RecordFeedSuccess(feedID, time.Now()))
+	feed, err = store.GetFeedByID(feedID)
+	require.NoError(t, err)
+	assert.True(t, feed.RateLimitedUntil.IsZero())
+	assert.False(t, feed.RateLimited())
+}
+
+func TestHostRateLimits(t *testing.T) {
+	store, cleanup := newHealthTestStore(t)
+	t.Cleanup(cleanup)
+
+	now := time.Now()
+	require.NoError(t, store.SetHostRateLimit("example.com", now.Add(2*time.Hour)))
+	require.NoError(t, store.SetHostRateLimit("example.com", now.Add(time.Hour)))
+	require.NoError(t, store.SetHostRateLimit("expired.example.com", now.Add(-time.Minute)))
+
+	limits, err := store.GetHostRateLimits(now)
+	require.NoError(t, err)
+	require.Len(t, limits, 1, "expired limits are dropped")
+	assert.WithinDuration(t, now.Add(2*time.Hour), limits["example.com"], time.Second,
+		"a shorter limit does not replace a longer one")
+}
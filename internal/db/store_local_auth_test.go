@@ -0,0 +1,110 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalUsers(t *testing.T) {
+	store := newSearchTestStore(t)
+	_, err := store.GetOrCreateUser("sub", "https://issuer.example.com")
+	require.NoError(t, err)
+
+	count, err := store.CountLocalUsers()
+	require.NoError(t, err)
+	assert.Zero(t, count, "OIDC users are not local users")
+
+	adminID, err := store.CreateLocalUser("alice", "correct horse", "")
+	require.NoError(t, err)
+	userID, err := store.CreateLocalUser("bob", "battery staple", "")
+	require.NoError(t, err)
+	_, err = store.CreateLocalUser("alice", "another password", "")
+	assert.Equal(t, ErrUsernameTaken, err)
+
+	account, err := store.GetLocalAccountForUser(adminID)
+	require.NoError(t, err)
+	assert.Equal(t, LocalAccount{Username: "alice", IsAdmin: true}, account, "the first local user is the admin")
+	account, err = store.GetLocalAccountForUser(userID)
+	require.NoError(t, err)
+	assert.False(t, account.IsAdmin)
+
+	authenticated, err := store.AuthenticateLocalUser("alice", "correct horse")
+	require.NoError(t, err)
+	assert.Equal(t, adminID, authenticated)
+	_, err = store.AuthenticateLocalUser("alice", "wrong")
+	assert.Equal(t, ErrInvalidCredentials, err)
+	_, err = store.AuthenticateLocalUser("nobody", "correct horse")
+	assert.Equal(t, ErrInvalidCredentials, err)
+
+	assert.Equal(t, ErrInvalidCredentials, store.ChangePasswordForUser(adminID, "wrong", "new password"))
+	require.NoError(t, store.ChangePasswordForUser(adminID, "correct horse", "new password"))
+	_, err = store.AuthenticateLocalUser("alice", "correct horse")
+	assert.Equal(t, ErrInvalidCredentials, err)
+	_, err = store.AuthenticateLocalUser("alice", "new password")
+	assert.NoError(t, err)
+}
+
+func TestInvites(t *testing.T) {
+	store := newSearchTestStore(t)
+	adminID, err := store.CreateLocalUser("admin", "password1", "")
+	require.NoError(t, err)
+
+	code, err := store.CreateInviteForUser(adminID)
+	require.NoError(t, err)
+	withdrawn, err := store.CreateInviteForUser(adminID)
+	require.NoError(t, err)
+
+	_, err = store.CreateLocalUser("guest", "password2", "unknown")
+	assert.Equal(t, ErrInvalidInvite, err)
+	_, err = store.AuthenticateLocalUser("guest", "password2")
+	assert.Equal(t, ErrInvalidCredentials, err, "a failed registration creates no account")
+
+	_, err = store.CreateLocalUser("guest", "password2", code)
+	require.NoError(t, err)
+	_, err = store.CreateLocalUser("another", "password3", code)
+	assert.Equal(t, ErrInvalidInvite, err, "invites work only once")
+
+	invites, err := store.GetInvitesForUser(adminID)
+	require.NoError(t, err)
+	require.Len(t, invites, 2)
+	assert.Empty(t, invites[0].UsedBy)
+	assert.Equal(t, "guest", invites[1].UsedBy)
+
+	assert.Equal(t, sql.ErrNoRows, store.DeleteInviteForUser(adminID+1, invites[0].ID))
+	require.NoError(t, store.DeleteInviteForUser(adminID, invites[0].ID))
+	_, err = store.CreateLocalUser("another", "password3", withdrawn)
+	assert.Equal(t, ErrInvalidInvite, err, "withdrawn invites cannot be used")
+}
+
+func TestPasskeys(t *testing.T) {
+	store := newSearchTestStore(t)
+	userID, err := store.CreateLocalUser("alice", "password1", "")
+	require.NoError(t, err)
+	otherID, err := store.CreateLocalUser("bob", "password2", "")
+	require.NoError(t, err)
+
+	require.NoError(t, store.AddPasskeyForUser(userID, "Laptop", []byte{1, 2, 3}, `{"id":"AQID"}`))
+	require.NoError(t, store.AddPasskeyForUser(userID, "Phone", []byte{4, 5, 6}, `{"id":"BAUG"}`))
+	assert.Error(t, store.AddPasskeyForUser(otherID, "Stolen", []byte{1, 2, 3}, `{}`), "credential IDs are unique")
+
+	require.NoError(t, store.UpdatePasskeyCredential([]byte{1, 2, 3}, `{"id":"AQID","signCount":1}`))
+	credentials, err := store.GetPasskeyCredentialsForUser(userID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{`{"id":"AQID","signCount":1}`, `{"id":"BAUG"}`}, credentials)
+
+	passkeys, err := store.GetPasskeysForUser(userID)
+	require.NoError(t, err)
+	require.Len(t, passkeys, 2)
+	assert.Equal(t, "Laptop", passkeys[0].Name)
+	assert.False(t, passkeys[0].LastUsedAt.IsZero())
+	assert.True(t, passkeys[1].LastUsedAt.IsZero())
+
+	assert.Equal(t, sql.ErrNoRows, store.DeletePasskeyForUser(otherID, passkeys[0].ID))
+	require.NoError(t, store.DeletePasskeyForUser(userID, passkeys[0].ID))
+	passkeys, err = store.GetPasskeysForUser(userID)
+	require.NoError(t, err)
+	assert.Len(t, passkeys, 1)
+}
@@ -0,0 +1,182 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUpsertPost_DetectsChangedPosts(t *testing.T) {
+	store := newSearchTestStore(t)
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+	published := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	change, err := store.UpsertPost(feedID, "1", "Helo world", "https://example.com/1", "", published, "<p>First draft</p>")
+	require.NoError(t, err)
+	assert.Equal(t, PostInserted, change)
+
+	change, err = store.UpsertPost(feedID, "1", "Helo world", "https://example.com/1", "", published, "<p>First draft</p>")
+	require.NoError(t, err)
+	assert.Equal(t, PostUnchanged, change)
+
+	change, err = store.UpsertPost(feedID, "1", "Hello world", "https://example.com/1", "", published, "<p>Final text</p>")
+	require.NoError(t, err)
+	assert.Equal(t, PostUpdated, change)
+
+	posts, err := store.GetFeedPosts(feedID, userID, 10)
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	assert.Equal(t, "Hello world", posts[0].Title)
+	assert.Equal(t, "<p>Final text</p>", posts[0].Content)
+	assert.False(t, posts[0].UpdatedAt.IsZero())
+
+	revisions, err := store.GetPostRevisions(posts[0].ID)
+	require.NoError(t, err)
+	require.Len(t, revisions, 1)
+	assert.Equal(t, "Helo world", revisions[0].Title)
+	assert.Equal(t, "<p>First draft</p>", revisions[0].Content)
+
+	results, err := store.SearchPostsForUser(userID, "final", 10)
+	require.NoError(t, err)
+	assert.Len(t, results, 1, "the search index must follow the update")
+	results, err = store.SearchPostsForUser(userID, "draft", 10)
+	require.NoError(t, err)
+	assert.Empty(t, results)
+}
+
+func TestUpsertPost_KeepsLimitedRevisions(t *testing.T) {
+	store := newSearchTestStore(t)
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+
+	for i := 0; i <= maxPostRevisions+2; i++ {
+		_, err := store.UpsertPost(feedID, "1", "Title", "https://example.com/1", "", time.Now(), string(rune('a'+i)))
+		require.NoError(t, err)
+	}
+
+	posts, err := store.GetFeedPosts(feedID, userID, 10)
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	revisions, err := store.GetPostRevisions(posts[0].ID)
+	require.NoError(t, err)
+	assert.Len(t, revisions, maxPostRevisions)
+}
+
+func TestUpsertPost_SeenStateFollowsPreference(t *testing.T) {
+	store := newSearchTestStore(t)
+	keeper, err := store.GetOrCreateUser("keeper", "iss")
+	require.NoError(t, err)
+	rereader, err := store.GetOrCreateUser("rereader", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(keeper, "https://example.com/feed.xml")
+	require.NoError(t, err)
+	_, err = store.AddFeedForUser(rereader, "https://example.com/feed.xml")
+	require.NoError(t, err)
+	require.NoError(t, store.SetUserUnseenOnUpdate(rereader, true))
+
+	_, err = store.UpsertPost(feedID, "1", "Title", "https://example.com/1", "", time.Now(), "v1")
+	require.NoError(t, err)
+	posts, err := store.GetFeedPosts(feedID, keeper, 10)
+	require.NoError(t, err)
+	postID := posts[0].ID
+	require.NoError(t, store.MarkPostAsSeenForUser(keeper, postID))
+	require.NoError(t, store.MarkPostAsSeenForUser(rereader, postID))
+
+	change, err := store.UpsertPost(feedID, "1", "Title", "https://example.com/1", "", time.Now(), "v2")
+	require.NoError(t, err)
+	require.Equal(t, PostUpdated, change)
+
+	post, err := store.GetPostForUser(keeper, postID)
+	require.NoError(t, err)
+	assert.True(t, post.Seen, "users who did not opt in keep their seen state")
+	post, err = store.GetPostForUser(rereader, postID)
+	require.NoError(t, err)
+	assert.False(t, post.Seen, "users who opted in see updated posts as unseen")
+
+	unseenOnUpdate, err := store.GetUserUnseenOnUpdate(rereader)
+	require.NoError(t, err)
+	assert.True(t, unseenOnUpdate)
+	unseenOnUpdate, err = store.GetUserUnseenOnUpdate(keeper)
+	require.NoError(t, err)
+	assert.False(t, unseenOnUpdate)
+}
+
+func TestUpsertPost_BackfillsHashForExistingPosts(t *testing.T) {
+	store := newSearchTestStore(t)
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+
+	// Simulate a post stored before content hashes existed.
+	_, err = store.UpsertPost(feedID, "1", "Title", "https://example.com/1", "", time.Now(), "<p>Body</p>")
+	require.NoError(t, err)
+	_, err = store.db.Exec("UPDATE posts SET content_hash = NULL")
+	require.NoError(t, err)
+
+	change, err := store.UpsertPost(feedID, "1", "Title", "https://example.com/1", "", time.Now(), "<p>Body</p>")
+	require.NoError(t, err)
+	assert.Equal(t, PostUnchanged, change)
+
+	var hash string
+	require.NoError(t, store.db.QueryRow("SELECT content_hash FROM posts").Scan(&hash))
+	assert.NotEmpty(t, hash)
+}
+
+func TestUpsertPostWithMetadata_StoresMetadataWithoutRevisions(t *testing.T) {
+	store := newSearchTestStore(t)
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+	published := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	metadata := PostMetadata{
+		Summary:         `<p onclick="x()">Short version</p>`,
+		Categories:      []string{"go", "feeds"},
+		ImageURL:        "https://example.com/1.png",
+		CommentsURL:     "https://example.com/1#comments",
+		Enclosures:      []Enclosure{{URL: "https://example.com/1.mp3", Type: "audio/mpeg", Length: 1234}},
+		SourceUpdatedAt: published.Add(time.Hour),
+	}
+
+	change, err := store.UpsertPostWithMetadata(feedID, "1", "Hello", "https://example.com/1", "Alice, Bob", published, "<p>Long version</p>", metadata)
+	require.NoError(t, err)
+	assert.Equal(t, PostInserted, change)
+
+	posts, err := store.GetFeedPosts(feedID, userID, 10)
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	post, err := store.GetPostForUser(userID, posts[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Alice, Bob", post.Author)
+	assert.Equal(t, "<p>Short version</p>", post.Summary, "summaries are sanitized")
+	assert.Equal(t, []string{"go", "feeds"}, post.Categories)
+	assert.Equal(t, "https://example.com/1.png", post.ImageURL)
+	assert.Equal(t, "https://example.com/1#comments", post.CommentsURL)
+	assert.Equal(t, metadata.Enclosures, post.Enclosures)
+	assert.True(t, post.SourceUpdatedAt.Equal(metadata.SourceUpdatedAt))
+
+	// Changed metadata alone is stored but is not an update of the post.
+	metadata.Categories = []string{"go"}
+	metadata.Enclosures = nil
+	change, err = store.UpsertPostWithMetadata(feedID, "1", "Hello", "https://example.com/1", "Alice", published, "<p>Long version</p>", metadata)
+	require.NoError(t, err)
+	assert.Equal(t, PostUnchanged, change)
+
+	post, err = store.GetPostForUser(userID, posts[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Alice", post.Author)
+	assert.Equal(t, []string{"go"}, post.Categories)
+	assert.Empty(t, post.Enclosures)
+	assert.True(t, post.UpdatedAt.IsZero())
+	revisions, err := store.GetPostRevisions(post.ID)
+	require.NoError(t, err)
+	assert.Empty(t, revisions)
+}
@@ -0,0 +1,153 @@
+package db
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aggregat4/go-baselib/migrations"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSearchTestStore(t *testing.T) *Store {
+	t.Helper()
+	tmpFile, err := os.CreateTemp("", "search-test-*.db")
+	require.NoError(t, err)
+	_ = tmpFile.Close()
+	store, err := NewStore(tmpFile.Name())
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = store.db.Close()
+		_ = os.Remove(tmpFile.Name())
+	})
+	return store
+}
+
+func TestSearchPostsForUser_MatchesTitleAndContent(t *testing.T) {
+	store := newSearchTestStore(t)
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+	require.NoError(t, store.UpdateFeedTitle(feedID, "Example"))
+
+	base := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, store.AddPost(feedID, "1", "Gardening tips", "https://example.com/1", base, "<p>Tomatoes need <b>sunshine</b>.</p>"))
+	require.NoError(t, store.AddPost(feedID, "2", "Sunshine report", "https://example.com/2", base.Add(time.Hour), "<p>Clear skies all week.</p>"))
+	require.NoError(t, store.AddPost(feedID, "3", "Unrelated", "https://example.com/3", base.Add(2*time.Hour), "<p>Nothing to see.</p>"))
+
+	results, err := store.SearchPostsForUser(userID, "sunshine", 10)
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Equal(t, "Sunshine report", results[0].Title, "results should be newest first")
+	assert.Equal(t, "Gardening tips", results[1].Title)
+	assert.Equal(t, feedID, results[1].FeedID)
+	assert.Equal(t, "Example", results[1].FeedTitle)
+	assert.Contains(t, results[1].Snippet, SnippetMatchStart+"sunshine"+SnippetMatchEnd)
+	assert.NotContains(t, results[1].Snippet, "<b>", "snippets are built from plain text")
+}
+
+func TestSearchMigration_IndexesExistingPostsAsPlainText(t *testing.T) {
+	tmpFile, err := os.CreateTemp("", "search-migration-test-*.db")
+	require.NoError(t, err)
+	_ = tmpFile.Close()
+	t.Cleanup(func() { _ = os.Remove(tmpFile.Name()) })
+
+	// A database from before search existed.
+	conn, err := sql.Open(sqliteDriver, tmpFile.Name())
+	require.NoError(t, err)
+	require.NoError(t, migrations.MigrateSchema(conn, mymigrations[:4]))
+	_, err = conn.Exec(`
+		INSERT INTO users (id, oidc_subject, oidc_issuer) VALUES (1, 'sub', 'iss');
+		INSERT INTO feeds (id, url) VALUES (1, 'https://example.com/feed.xml');
+		INSERT INTO user_feeds (user_id, feed_id) VALUES (1, 1);
+		INSERT INTO posts (feed_id, guid, title, link, published_at, content)
+		VALUES (1, '1', 'Gardening tips', 'https://example.com/1', '2026-05-01 12:00:00', '<p class="intro">Tomatoes need <strong>sunshine</strong> &amp; water.</p>');
+	`)
+	require.NoError(t, err)
+	require.NoError(t, conn.Close())
+
+	store, err := NewStore(tmpFile.Name())
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = store.db.Close() })
+
+	results, err := store.SearchPostsForUser(1, "sunshine", 10)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.NotContains(t, results[0].Snippet, "<strong>", "snippets are built from plain text")
+	assert.Contains(t, results[0].Snippet, "& water")
+
+	for _, markup := range []string{"strong", "intro", "amp"} {
+		results, err = store.SearchPostsForUser(1, markup, 10)
+		require.NoError(t, err)
+		assert.Empty(t, results, "markup %q must not be indexed", markup)
+	}
+}
+
+func TestSearchPostsForUser_ScopedToSubscriptions(t *testing.T) {
+	store := newSearchTestStore(t)
+	alice, err := store.GetOrCreateUser("alice", "iss")
+	require.NoError(t, err)
+	bob, err := store.GetOrCreateUser("bob", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(alice, "https://alice.example.com/feed.xml")
+	require.NoError(t, err)
+	require.NoError(t, store.AddPost(feedID, "1", "Private interest", "https://alice.example.com/1", time.Now(), "quokka"))
+
+	results, err := store.SearchPostsForUser(alice, "quokka", 10)
+	require.NoError(t, err)
+	assert.Len(t, results, 1)
+
+	results, err = store.SearchPostsForUser(bob, "quokka", 10)
+	require.NoError(t, err)
+	assert.Empty(t, results, "posts from feeds the user is not subscribed to must not be found")
+}
+
+func TestSearchPostsForUser_PrunedPostsLeaveIndex(t *testing.T) {
+	store := newSearchTestStore(t)
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+
+	base := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, store.AddPost(feedID, "old", "Old zebra", "https://example.com/old", base, ""))
+	require.NoError(t, store.AddPost(feedID, "new", "New zebra", "https://example.com/new", base.Add(time.Hour), ""))
+	// A duplicate guid is ignored and must not create a second index entry.
+	require.NoError(t, store.AddPost(feedID, "new", "New zebra", "https://example.com/new", base.Add(time.Hour), ""))
+
+	require.NoError(t, store.PruneFeedPosts(feedID, 1))
+
+	results, err := store.SearchPostsForUser(userID, "zebra", 10)
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "New zebra", results[0].Title)
+
+	var indexed int
+	require.NoError(t, store.db.QueryRow("SELECT COUNT(*) FROM posts_fts").Scan(&indexed))
+	assert.Equal(t, 1, indexed)
+}
+
+func TestSearchPostsForUser_QuerySyntaxIsNeutralised(t *testing.T) {
+	store := newSearchTestStore(t)
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+	require.NoError(t, store.AddPost(feedID, "1", "Go release notes", "https://example.com/1", time.Now(), "generics AND iterators"))
+
+	for _, q := range []string{`"unbalanced`, `AND`, `go*`, `title:go NEAR(`} {
+		_, err := store.SearchPostsForUser(userID, q, 10)
+		assert.NoError(t, err, "query %q", q)
+	}
+
+	results, err := store.SearchPostsForUser(userID, "   ", 10)
+	require.NoError(t, err)
+	assert.Empty(t, results)
+
+	results, err = store.SearchPostsForUser(userID, "release generics", 10)
+	require.NoError(t, err)
+	assert.Len(t, results, 1, "all words must match, across title and body")
+}
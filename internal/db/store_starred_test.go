@@ -0,0 +1,84 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetPostStarredForUser(t *testing.T) {
+	store := newSearchTestStore(t)
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	otherID, err := store.GetOrCreateUser("other", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+	require.NoError(t, store.UpdateFeedTitle(feedID, "Example"))
+	require.NoError(t, store.AddPost(feedID, "1", "Keep me", "https://example.com/1", time.Now(), "content"))
+
+	posts, err := store.GetFeedPosts(feedID, userID, 10)
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	postID := posts[0].ID
+	assert.False(t, posts[0].Starred)
+
+	require.NoError(t, store.SetPostStarredForUser(userID, postID, true))
+	require.NoError(t, store.MarkPostAsSeenForUser(userID, postID))
+
+	post, err := store.GetPostForUser(userID, postID)
+	require.NoError(t, err)
+	assert.True(t, post.Starred)
+	assert.True(t, post.Seen, "marking as seen must keep the star")
+
+	starred, err := store.GetStarredPostsForUser(userID)
+	require.NoError(t, err)
+	require.Len(t, starred, 1)
+	assert.Equal(t, postID, starred[0].ID)
+	assert.Equal(t, "Example", starred[0].FeedTitle)
+	assert.False(t, starred[0].StarredAt.IsZero())
+
+	// Other users can neither star the post nor see the star.
+	assert.ErrorIs(t, store.SetPostStarredForUser(otherID, postID, true), sql.ErrNoRows)
+	starred, err = store.GetStarredPostsForUser(otherID)
+	require.NoError(t, err)
+	assert.Empty(t, starred)
+
+	require.NoError(t, store.SetPostStarredForUser(userID, postID, false))
+	starred, err = store.GetStarredPostsForUser(userID)
+	require.NoError(t, err)
+	assert.Empty(t, starred)
+}
+
+func TestPruneFeedPosts_KeepsStarredPosts(t *testing.T) {
+	store := newSearchTestStore(t)
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+
+	base := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, store.AddPost(feedID, fmt.Sprint(i), fmt.Sprintf("Post %d", i), "https://example.com", base.Add(time.Duration(i)*time.Hour), ""))
+	}
+	posts, err := store.GetFeedPosts(feedID, userID, 10)
+	require.NoError(t, err)
+	require.Len(t, posts, 5)
+	oldest := posts[4]
+	require.Equal(t, "Post 0", oldest.Title)
+	require.NoError(t, store.SetPostStarredForUser(userID, oldest.ID, true))
+
+	require.NoError(t, store.PruneFeedPosts(feedID, 2))
+
+	posts, err = store.GetFeedPosts(feedID, userID, 10)
+	require.NoError(t, err)
+	var titles []string
+	for _, p := range posts {
+		titles = append(titles, p.Title)
+	}
+	assert.Equal(t, []string{"Post 4", "Post 3", "Post 0"}, titles)
+}
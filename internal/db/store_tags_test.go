@@ -0,0 +1,74 @@
+package db
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeedTags(t *testing.T) {
+	store := newSearchTestStore(t)
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	otherID, err := store.GetOrCreateUser("other", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+	otherFeedID, err := store.AddFeedForUser(userID, "https://example.com/other.xml")
+	require.NoError(t, err)
+	_, err = store.AddFeedForUser(otherID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+
+	require.NoError(t, store.SetFeedTagsForUser(userID, feedID, []string{"Tech", "news"}))
+	require.NoError(t, store.AddFeedTagsForUser(userID, otherFeedID, []string{"tech"}))
+	require.NoError(t, store.AddFeedTagsForUser(userID, otherFeedID, []string{"Go", "TECH"}))
+	assert.Equal(t, sql.ErrNoRows, store.SetFeedTagsForUser(otherID, otherFeedID, []string{"x"}))
+
+	feeds, err := store.GetUserFeeds(userID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"news", "Tech"}, feeds[0].Tags)
+	assert.Equal(t, []string{"Go", "tech"}, feeds[1].Tags, "tags compare case-insensitively")
+	assert.True(t, feeds[1].HasTag("TECH"))
+	otherFeeds, err := store.GetUserFeeds(otherID)
+	require.NoError(t, err)
+	assert.Empty(t, otherFeeds[0].Tags, "tags belong to one user's subscription")
+
+	tags, err := store.GetTagsForUser(userID)
+	require.NoError(t, err)
+	assert.Len(t, tags, 3)
+	assert.Equal(t, "Go", tags[0])
+
+	require.NoError(t, store.SetFeedTagsForUser(userID, feedID, []string{"news"}))
+	feeds, err = store.GetUserFeeds(userID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"news"}, feeds[0].Tags, "setting tags replaces them")
+
+	require.NoError(t, store.DeleteFeedForUser(userID, otherFeedID))
+	tags, err = store.GetTagsForUser(userID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"news"}, tags, "unsubscribing removes the feed's tags")
+}
+
+func TestMarkTagPostsAsSeenForUser(t *testing.T) {
+	store := newSearchTestStore(t)
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	taggedID, err := store.AddFeedForUser(userID, "https://example.com/tagged.xml")
+	require.NoError(t, err)
+	untaggedID, err := store.AddFeedForUser(userID, "https://example.com/untagged.xml")
+	require.NoError(t, err)
+	require.NoError(t, store.SetFeedTagsForUser(userID, taggedID, []string{"News"}))
+	require.NoError(t, store.AddPost(taggedID, "1", "Tagged", "https://example.com/1", time.Now(), ""))
+	require.NoError(t, store.AddPost(untaggedID, "2", "Untagged", "https://example.com/2", time.Now(), ""))
+
+	assert.Equal(t, sql.ErrNoRows, store.MarkTagPostsAsSeenForUser(userID, "unknown"))
+	require.NoError(t, store.MarkTagPostsAsSeenForUser(userID, "news"))
+
+	counts, err := store.GetUnreadCountsForUser(userID)
+	require.NoError(t, err)
+	assert.Equal(t, 0, counts[taggedID])
+	assert.Equal(t, 1, counts[untaggedID])
+}
@@ -275,56 +275,6 @@ func TestUserPreferences(t *testing.T) {
 		t.Errorf("Expected different preferences for different users, got %d and %d", postsPerFeed1, postsPerFeed2)
 	}
 }
-
-func BenchmarkMoveFeedOperations(b *testing.B) {
-	// Create a temporary database
-	tmpFile, err := os.CreateTemp("", "bench-*.db")
-	if err != nil {
-		b.Fatalf("Failed to create temp file: %v", err)
-	}
-	defer os.Remove(tmpFile.Name())
-	tmpFile.Close()
-
-	store, err := NewStore(tmpFile.Name())
-	if err != nil {
-		b.Fatalf("Failed to create store: %v", err)
-	}
-	defer store.db.Close()
-
-	// Create a test user
-	userID, err := store.GetOrCreateUser("bench-user", "bench-issuer")
-	if err != nil {
-		b.Fatalf("Failed to create test user: %v", err)
-	}
-
-	// Add 10 feeds for the user
-	var feedIDs []int64
-	for i := 0; i < 10; i++ {
-		feedID, err := store.AddFeedForUser(userID, fmt.Sprintf("https://example.com/feed%d.xml", i))
-		if err != nil {
-			b.Fatalf("Failed to add feed: %v", err)
-		}
-		feedIDs = append(feedIDs, feedID)
-	}
-
-	b.ResetTimer()
-
-	// Benchmark moving feeds up and down
-	for i := 0; i < b.N; i++ {
-		// Move a feed up
-		err := store.MoveFeedUp(userID, feedIDs[5])
-		if err != nil {
-			b.Fatalf("Failed to move feed up: %v", err)
-		}
-
-		// Move a feed down
-		err = store.MoveFeedDown(userID, feedIDs[3])
-		if err != nil {
-			b.Fatalf("Failed to move feed down: %v", err)
-		}
-	}
-}
-
 func TestPruneFeedPosts(t *testing.T) {
 	// Create a temporary database
 	tmpFile, err := os.CreateTemp("", "test-*.db")
@@ -416,98 +366,3 @@ func TestPruneFeedPosts(t *testing.T) {
 		t.Errorf("Expected 5 posts after no-op prune, got %d", count)
 	}
 }
-
-func TestMoveFeedEfficiency(t *testing.T) {
-	// Create a temporary database
-	tmpFile, err := os.CreateTemp("", "test-*.db")
-	if err != nil {
-		t.Fatalf("Failed to create temp file: %v", err)
-	}
-	defer os.Remove(tmpFile.Name())
-	tmpFile.Close()
-
-	store, err := NewStore(tmpFile.Name())
-	if err != nil {
-		t.Fatalf("Failed to create store: %v", err)
-	}
-	defer store.db.Close()
-
-	// Create a test user
-	userID, err := store.GetOrCreateUser("efficiency-user", "efficiency-issuer")
-	if err != nil {
-		t.Fatalf("Failed to create test user: %v", err)
-	}
-
-	// Add 5 feeds for the user
-	for i := 0; i < 5; i++ {
-		_, err := store.AddFeedForUser(userID, fmt.Sprintf("https://example.com/feed%d.xml", i))
-		if err != nil {
-			t.Fatalf("Failed to add feed: %v", err)
-		}
-	}
-
-	// Get initial order
-	feeds, err := store.GetUserFeeds(userID)
-	if err != nil {
-		t.Fatalf("Failed to get user feeds: %v", err)
-	}
-
-	t.Logf("Initial order:")
-	for i, feed := range feeds {
-		t.Logf("  %d: Feed ID %d", i, feed.ID)
-	}
-
-	// Test that the efficient implementation works correctly
-	// The new implementation should:
-	// 1. Make 1 query to get all feed positions
-	// 2. Make 1 query to update both positions
-	// Total: 2 queries instead of 4+ queries in the old implementation
-
-	// Move the feed at position 2 up (should swap with position 1)
-	targetFeedID := feeds[2].ID
-	err = store.MoveFeedUp(userID, targetFeedID)
-	if err != nil {
-		t.Fatalf("Failed to move feed up: %v", err)
-	}
-
-	// Verify the order changed correctly
-	feeds, err = store.GetUserFeeds(userID)
-	if err != nil {
-		t.Fatalf("Failed to get user feeds: %v", err)
-	}
-
-	t.Logf("After moving feed %d up:", targetFeedID)
-	for i, feed := range feeds {
-		t.Logf("  %d: Feed ID %d", i, feed.ID)
-	}
-
-	// The target feed should now be at position 1 (was at position 2)
-	if feeds[1].ID != targetFeedID {
-		t.Errorf("Expected feed ID %d at position 1 after moving up, got %d", targetFeedID, feeds[1].ID)
-	}
-
-	// Move the feed at position 1 down (should swap with position 2)
-	targetFeedID = feeds[1].ID
-	err = store.MoveFeedDown(userID, targetFeedID)
-	if err != nil {
-		t.Fatalf("Failed to move feed down: %v", err)
-	}
-
-	// Verify the order changed correctly again
-	feeds, err = store.GetUserFeeds(userID)
-	if err != nil {
-		t.Fatalf("Failed to get user feeds: %v", err)
-	}
-
-	t.Logf("After moving feed %d down:", targetFeedID)
-	for i, feed := range feeds {
-		t.Logf("  %d: Feed ID %d", i, feed.ID)
-	}
-
-	// The target feed should now be at position 2 (was at position 1)
-	if feeds[2].ID != targetFeedID {
-		t.Errorf("Expected feed ID %d at position 2 after moving down, got %d", targetFeedID, feeds[2].ID)
-	}
-
-	t.Logf("Efficiency test passed: Feed reordering works correctly with optimized queries")
-}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetUnreadCountsForUser(t *testing.T) {
+	store := newSearchTestStore(t)
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	otherID, err := store.GetOrCreateUser("other", "iss")
+	require.NoError(t, err)
+	feed1, err := store.AddFeedForUser(userID, "https://example.com/1.xml")
+	require.NoError(t, err)
+	feed2, err := store.AddFeedForUser(userID, "https://example.com/2.xml")
+	require.NoError(t, err)
+	otherFeed, err := store.AddFeedForUser(otherID, "https://example.com/other.xml")
+	require.NoError(t, err)
+	now := time.Now()
+	require.NoError(t, store.AddPost(feed1, "1", "One", "https://example.com/1", now, ""))
+	require.NoError(t, store.AddPost(feed1, "2", "Two", "https://example.com/2", now, ""))
+	require.NoError(t, store.AddPost(feed2, "3", "Three", "https://example.com/3", now, ""))
+	require.NoError(t, store.AddPost(otherFeed, "4", "Four", "https://example.com/4", now, ""))
+
+	counts, err := store.GetUnreadCountsForUser(userID)
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]int{feed1: 2, feed2: 1}, counts)
+
+	require.NoError(t, store.MarkAllFeedPostsAsSeenForUser(userID, feed1))
+	counts, err = store.GetUnreadCountsForUser(userID)
+	require.NoError(t, err)
+	assert.Equal(t, map[int64]int{feed2: 1}, counts)
+}
+
+func TestGetFeedPosts_HidesReadPostsEverywhere(t *testing.T) {
+	store := newSearchTestStore(t)
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+	now := time.Now()
+	require.NoError(t, store.AddPost(feedID, "1", "Read", "https://example.com/1", now.Add(-time.Hour), ""))
+	require.NoError(t, store.AddPost(feedID, "2", "Unread", "https://example.com/2", now, ""))
+	posts, err := store.GetFeedPosts(feedID, userID, 10)
+	require.NoError(t, err)
+	require.NoError(t, store.MarkPostAsSeenForUser(userID, posts[1].ID))
+
+	hideRead, err := store.GetUserHideRead(userID)
+	require.NoError(t, err)
+	assert.False(t, hideRead)
+
+	require.NoError(t, store.SetUserHideRead(userID, true))
+	posts, err = store.GetFeedPosts(feedID, userID, 10)
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	assert.Equal(t, "Unread", posts[0].Title)
+
+	require.NoError(t, store.SetUserHideRead(userID, false))
+	require.NoError(t, store.SetFeedHideReadForUser(userID, feedID, true))
+	posts, err = store.GetFeedPosts(feedID, userID, 10)
+	require.NoError(t, err)
+	assert.Len(t, posts, 1)
+}
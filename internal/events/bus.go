@@ -0,0 +1,76 @@
+// Package events is an in-process publish/subscribe bus that lets the feed
+// updater notify connected dashboards about changes to feeds.
+package events
+
+import "sync"
+
+// Kind identifies what changed about a feed.
+type Kind string
+
+const (
+	// PostsAdded means new posts were stored for the feed.
+	PostsAdded Kind = "posts"
+	// PostsUpdated means the publisher changed posts already stored.
+	PostsUpdated Kind = "updated"
+	// HealthChanged means the feed started failing, failed again, was rate
+	// limited, recovered, or was retired by its publisher.
+	HealthChanged Kind = "health"
+)
+
+// Event describes a change to a single feed. Events carry no user
+// information; subscribers decide which feeds they are interested in.
+type Event struct {
+	Kind   Kind
+	FeedID int64
+}
+
+// subscriberBuffer is the number of events a subscriber may fall behind
+// before further events are dropped for it.
+const subscriberBuffer = 64
+
+// Bus fans events out to all current subscribers. A nil *Bus is valid and
+// discards everything published to it.
+type Bus struct {
+	mu          sync.Mutex
+	subscribers map[chan Event]struct{}
+}
+
+func NewBus() *Bus {
+	return &Bus{subscribers: make(map[chan Event]struct{})}
+}
+
+// Subscribe registers a new subscriber. The returned function unsubscribes
+// and closes the channel; it must be called once the subscriber is done.
+func (b *Bus) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+	b.mu.Lock()
+	b.subscribers[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subscribers, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Publish delivers the event to every subscriber without blocking. Events
+// for subscribers whose buffer is full are dropped, so a stalled client never
+// holds up the updater.
+func (b *Bus) Publish(event Event) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for ch := range b.subscribers {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
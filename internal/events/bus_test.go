@@ -0,0 +1,50 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBus_DeliversToAllSubscribers(t *testing.T) {
+	bus := NewBus()
+	a, unsubscribeA := bus.Subscribe()
+	defer unsubscribeA()
+	b, unsubscribeB := bus.Subscribe()
+	defer unsubscribeB()
+
+	bus.Publish(Event{Kind: PostsAdded, FeedID: 7})
+
+	assert.Equal(t, Event{Kind: PostsAdded, FeedID: 7}, <-a)
+	assert.Equal(t, Event{Kind: PostsAdded, FeedID: 7}, <-b)
+}
+
+func TestBus_UnsubscribeClosesChannel(t *testing.T) {
+	bus := NewBus()
+	ch, unsubscribe := bus.Subscribe()
+	unsubscribe()
+	unsubscribe() // safe to call twice
+
+	bus.Publish(Event{Kind: HealthChanged, FeedID: 1})
+
+	_, open := <-ch
+	assert.False(t, open)
+}
+
+func TestBus_DropsEventsForSlowSubscribers(t *testing.T) {
+	bus := NewBus()
+	ch, unsubscribe := bus.Subscribe()
+	defer unsubscribe()
+
+	for i := 0; i < subscriberBuffer+10; i++ {
+		bus.Publish(Event{Kind: PostsAdded, FeedID: int64(i)})
+	}
+
+	assert.Len(t, ch, subscriberBuffer)
+	assert.Equal(t, int64(0), (<-ch).FeedID, "the oldest events are kept")
+}
+
+func TestBus_NilBusDiscardsEvents(t *testing.T) {
+	var bus *Bus
+	assert.NotPanics(t, func() { bus.Publish(Event{Kind: PostsAdded, FeedID: 1}) })
+}
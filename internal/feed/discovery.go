@@ -0,0 +1,218 @@
+package feed
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// ErrNotAFeed is returned when a URL could be fetched but its body could not
+// be parsed as RSS, Atom or JSON Feed (typically because it is a web page).
+var ErrNotAFeed = errors.New("not a feed")
+
+// NotAFeedError is the ErrNotAFeed returned when fetching a feed. It keeps
+// what was fetched, so that feeds can be discovered on the page without
+// fetching it again.
+type NotAFeedError struct {
+	// URL is where the page was fetched from, after any redirects.
+	URL *url.URL
+	// Page is the body of the page, or nil if its content type already showed
+	// that it is not a feed.
+	Page []byte
+	err  error
+}
+
+func (e *NotAFeedError) Error() string {
+	return e.err.Error()
+}
+
+func (e *NotAFeedError) Unwrap() error {
+	return e.err
+}
+
+// FeedCandidate is a feed URL discovered on a web page.
+type FeedCandidate struct {
+	URL   string `json:"url"`
+	Title string `json:"title,omitempty"`
+}
+
+// feedLinkTypes are the <link rel="alternate"> types that advertise a feed.
+var feedLinkTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/feed+json": true,
+}
+
+// commonFeedPaths are probed on the page's host when the page does not
+// advertise any feeds itself.
+var commonFeedPaths = []string{"/feed", "/rss.xml", "/atom.xml", "/feed.xml", "/index.xml", "/rss", "/feed.json"}
+
+// maxDiscoveryPageSize caps how much of an HTML page is read while looking
+// for feed links.
+const maxDiscoveryPageSize = 2 << 20
+
+// DiscoverFeeds looks for feeds advertised by the web page at pageURL. It
+// first reads <link rel="alternate"> tags from the page and, if there are
+// none, probes a few common feed paths on the same host. Only probed URLs that
+// actually parse as feeds are returned.
+func (f *Fetcher) DiscoverFeeds(ctx context.Context, pageURL string) ([]FeedCandidate, error) {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing page URL: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", pageURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+	req.Header.Set("User-Agent", "RSSGrid/1.0")
+	req.Header.Set("Accept", "text/html, application/xhtml+xml")
+
+	resp, err := f.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching page: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("page returned non-200 status code: %d", resp.StatusCode)
+	}
+
+	// Resolve relative links against the final URL after any redirects.
+	if resp.Request != nil && resp.Request.URL != nil {
+		base = resp.Request.URL
+	}
+
+	page, err := io.ReadAll(io.LimitReader(resp.Body, maxDiscoveryPageSize))
+	if err != nil {
+		return nil, fmt.Errorf("error reading page: %w", err)
+	}
+	return f.DiscoverFeedsOnPage(ctx, base, page), nil
+}
+
+// DiscoverFeedsOnPage is DiscoverFeeds for a page that was already fetched
+// from pageURL, such as the one a NotAFeedError carries.
+func (f *Fetcher) DiscoverFeedsOnPage(ctx context.Context, pageURL *url.URL, page []byte) []FeedCandidate {
+	candidates := parseFeedLinks(io.LimitReader(bytes.NewReader(page), maxDiscoveryPageSize), pageURL)
+	if len(candidates) > 0 {
+		return candidates
+	}
+
+	for _, path := range commonFeedPaths {
+		probeURL := (&url.URL{Scheme: pageURL.Scheme, Host: pageURL.Host, Path: path}).String()
+		if title, ok := f.probeFeed(ctx, probeURL); ok {
+			candidates = append(candidates, FeedCandidate{URL: probeURL, Title: title})
+		}
+	}
+	return candidates
+}
+
+// probeFeed reports whether the given URL serves a parseable feed, returning
+// the feed's title if so.
+func (f *Fetcher) probeFeed(ctx context.Context, feedURL string) (string, bool) {
+	req, err := http.NewRequestWithContext(ctx, "GET", feedURL, nil)
+	if err != nil {
+		return "", false
+	}
+	req.Header.Set("User-Agent", "RSSGrid/1.0")
+	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/json")
+
+	resp, err := f.do(req)
+	if err != nil {
+		return "", false
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", false
+	}
+	parsed, err := f.parser.Parse(resp.Body)
+	if err != nil {
+		return "", false
+	}
+	return parsed.Title, true
+}
+
+// parseFeedLinks extracts feed URLs from <link rel="alternate"> tags in an
+// HTML document, resolving them against base (or the document's <base href>).
+// Duplicate URLs are only returned once.
+func parseFeedLinks(r io.Reader, base *url.URL) []FeedCandidate {
+	var candidates []FeedCandidate
+	seen := make(map[string]bool)
+
+	tokenizer := html.NewTokenizer(r)
+	for {
+		tt := tokenizer.Next()
+		if tt == html.ErrorToken {
+			return candidates
+		}
+		if tt != html.StartTagToken && tt != html.SelfClosingTagToken {
+			continue
+		}
+
+		token := tokenizer.Token()
+		switch token.Data {
+		case "base":
+			if href := attr(token, "href"); href != "" {
+				if resolved, err := base.Parse(href); err == nil {
+					base = resolved
+				}
+			}
+		case "link":
+			if !hasToken(attr(token, "rel"), "alternate") {
+				continue
+			}
+			linkType := strings.ToLower(strings.TrimSpace(attr(token, "type")))
+			if i := strings.Index(linkType, ";"); i >= 0 {
+				linkType = strings.TrimSpace(linkType[:i])
+			}
+			if !feedLinkTypes[linkType] {
+				continue
+			}
+			href := strings.TrimSpace(attr(token, "href"))
+			if href == "" {
+				continue
+			}
+			resolved, err := base.Parse(href)
+			if err != nil || (resolved.Scheme != "http" && resolved.Scheme != "https") {
+				continue
+			}
+			feedURL := resolved.String()
+			if seen[feedURL] {
+				continue
+			}
+			seen[feedURL] = true
+			candidates = append(candidates, FeedCandidate{URL: feedURL, Title: attr(token, "title")})
+		case "body":
+			// Feed links live in <head>; stop once the body starts.
+			return candidates
+		}
+	}
+}
+
+func attr(token html.Token, name string) string {
+	for _, a := range token.Attr {
+		if strings.EqualFold(a.Key, name) {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// hasToken reports whether the space-separated list contains the given token,
+// case-insensitively (e.g. rel="alternate feed").
+func hasToken(list, token string) bool {
+	for _, field := range strings.Fields(list) {
+		if strings.EqualFold(field, token) {
+			return true
+		}
+	}
+	return false
+}
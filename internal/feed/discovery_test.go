@@ -0,0 +1,109 @@
+package feed
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testRSS = `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>%s</title><link>https://example.com/</link>
+<item><guid>1</guid><title>Hello</title><link>https://example.com/1</link></item>
+</channel></rss>`
+
+func TestParseFeedLinks(t *testing.T) {
+	base, err := url.Parse("https://blog.example.com/posts/hello")
+	require.NoError(t, err)
+
+	page := `<!DOCTYPE html><html><head>
+<link rel="stylesheet" href="/style.css">
+<link rel="alternate" type="application/rss+xml" title="RSS" href="/feed.xml">
+<link rel="Alternate" type="application/atom+xml; charset=utf-8" title="Atom" href="https://blog.example.com/atom.xml">
+<link rel="alternate" type="application/feed+json" href="feed.json">
+<link rel="alternate" type="application/rss+xml" href="/feed.xml">
+<link rel="alternate" type="application/json" href="/wp-json/wp/v2/pages/1">
+<link rel="alternate" hreflang="de" href="/de/">
+</head><body><link rel="alternate" type="application/rss+xml" href="/ignored.xml"></body></html>`
+
+	candidates := parseFeedLinks(strings.NewReader(page), base)
+	assert.Equal(t, []FeedCandidate{
+		{URL: "https://blog.example.com/feed.xml", Title: "RSS"},
+		{URL: "https://blog.example.com/atom.xml", Title: "Atom"},
+		{URL: "https://blog.example.com/posts/feed.json"},
+	}, candidates)
+}
+
+func TestParseFeedLinks_RespectsBaseHref(t *testing.T) {
+	base, err := url.Parse("https://example.com/")
+	require.NoError(t, err)
+
+	page := `<html><head><base href="https://cdn.example.net/site/">
+<link rel="alternate" type="application/rss+xml" href="rss"></head></html>`
+
+	candidates := parseFeedLinks(strings.NewReader(page), base)
+	require.Len(t, candidates, 1)
+	assert.Equal(t, "https://cdn.example.net/site/rss", candidates[0].URL)
+}
+
+func TestDiscoverFeeds_FromLinkTags(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><head><link rel="alternate" type="application/rss+xml" title="Main" href="/main.xml"></head><body></body></html>`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	candidates, err := newTestFetcher(nil).DiscoverFeeds(context.Background(), srv.URL+"/")
+	require.NoError(t, err)
+	assert.Equal(t, []FeedCandidate{{URL: srv.URL + "/main.xml", Title: "Main"}}, candidates)
+}
+
+func TestDiscoverFeeds_ProbesCommonPaths(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/blog/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `<html><head><title>No feed links here</title></head><body></body></html>`)
+	})
+	mux.HandleFunc("/atom.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, testRSS, "Probed Feed")
+	})
+	// /feed exists but is not a feed and must not be suggested.
+	mux.HandleFunc("/feed", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `<html><body>Not a feed</body></html>`)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	candidates, err := newTestFetcher(nil).DiscoverFeeds(context.Background(), srv.URL+"/blog/")
+	require.NoError(t, err)
+	assert.Equal(t, []FeedCandidate{{URL: srv.URL + "/atom.xml", Title: "Probed Feed"}}, candidates)
+}
+
+func TestFetchFeed_HTMLPageReturnsErrNotAFeed(t *testing.T) {
+	store, cleanup := newUpdaterTestStore(t)
+	t.Cleanup(cleanup)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<!DOCTYPE html><html><body>Just a page</body></html>`)
+	}))
+	defer srv.Close()
+
+	_, err := newTestFetcher(store).FetchFeed(context.Background(), srv.URL)
+	assert.ErrorIs(t, err, ErrNotAFeed)
+	var notAFeed *NotAFeedError
+	require.ErrorAs(t, err, &notAFeed)
+	assert.Equal(t, srv.URL, notAFeed.URL.String())
+	assert.Equal(t, `<!DOCTYPE html><html><body>Just a page</body></html>`, string(notAFeed.Page))
+}
@@ -1,45 +1,120 @@
 package feed
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"html"
+	"io"
+	"net"
 	"net/http"
+	"net/netip"
+	neturl "net/url"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/aggregat4/rssgrid/internal/db"
 	"github.com/mmcdole/gofeed"
+	"github.com/mmcdole/gofeed/atom"
+	"github.com/mmcdole/gofeed/json"
+	"github.com/mmcdole/gofeed/rss"
 )
 
+// ErrFeedGone is returned when the publisher reports that a feed was removed
+// for good (HTTP 410 Gone).
+var ErrFeedGone = errors.New("feed is gone")
+
+// ErrUnauthorized is returned when the host refuses to serve a feed without
+// credentials (HTTP 401 or 403).
+var ErrUnauthorized = errors.New("feed requires credentials")
+
+// maxRetryAfter caps how long a host can ask not to be fetched from.
+const maxRetryAfter = 24 * time.Hour
+
+// RateLimitError is returned when the host answers 429 Too Many Requests or
+// 503 Service Unavailable with a Retry-After header.
+type RateLimitError struct {
+	// Until is when the host may be fetched from again.
+	Until time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	return "rate limited until " + e.Until.Format(time.RFC3339)
+}
+
 type Fetcher struct {
 	client *http.Client
 	parser *gofeed.Parser
 	store  *db.Store
+	// maxBodySize caps responses and allowedNetworks exempts internal
+	// addresses from being blocked; see guard.go.
+	maxBodySize     int64
+	allowedNetworks []netip.Prefix
 }
 
+// NewFetcher creates a Fetcher. A Fetcher is safe for concurrent use.
 func NewFetcher(store *db.Store) *Fetcher {
-	return &Fetcher{
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
-		parser: gofeed.NewParser(),
-		store:  store,
+	// gofeed initialises its translators lazily on first use, which races when
+	// feeds are parsed concurrently; set them up front instead.
+	parser := gofeed.NewParser()
+	parser.RSSTranslator = &gofeed.DefaultRSSTranslator{}
+	parser.AtomTranslator = &gofeed.DefaultAtomTranslator{}
+	parser.JSONTranslator = &gofeed.DefaultJSONTranslator{}
+
+	f := &Fetcher{
+		parser:      parser,
+		store:       store,
+		maxBodySize: defaultMaxBodySize,
+	}
+	// Every connection is checked against the address rules once the host
+	// name is resolved.
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   f.checkAddress,
 	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// Through a proxy only the proxy's address would be checked, so feeds
+	// are always fetched directly.
+	transport.Proxy = nil
+	f.client = &http.Client{
+		Timeout:       30 * time.Second,
+		Transport:     transport,
+		CheckRedirect: checkRedirect,
+	}
+	return f
 }
 
 type FeedContent struct {
 	Title       string
 	Items       []FeedItem
 	LastUpdated time.Time
+	// TTL is how long the publisher asks readers to wait between polls, from
+	// RSS <ttl> or <sy:updatePeriod>. Zero when the feed gives no hint.
+	TTL time.Duration
 }
 
 type FeedItem struct {
-	GUID        string
-	Title       string
-	Link        string
+	GUID  string
+	Title string
+	Link  string
+	// Author holds the names of all authors, separated by commas.
+	Author      string
 	PublishedAt time.Time
 	Content     string
+	// Summary is the publisher's summary, set only when it differs from the
+	// content.
+	Summary    string
+	Categories []string
+	// UpdatedAt is when the feed says the item was last updated; zero if it
+	// does not say.
+	UpdatedAt   time.Time
+	ImageURL    string
+	CommentsURL string
+	Enclosures  []db.Enclosure
 }
 
 // fetchResult is internal to the fetcher - caching details are hidden from callers
@@ -48,6 +123,12 @@ type fetchResult struct {
 	shouldCache bool
 	cacheInfo   *cacheInfo
 	error       error
+	// feed is the stored feed for the fetched URL, if there is one.
+	feed *db.Feed
+	// movedTo is the URL the feed permanently redirected to, and finalURL
+	// where it was fetched from after any further temporary redirects.
+	movedTo  string
+	finalURL string
 }
 
 // cacheInfo is internal to the fetcher
@@ -58,36 +139,132 @@ type cacheInfo struct {
 }
 
 func (f *Fetcher) FetchFeed(ctx context.Context, url string) (*FeedContent, error) {
-	result, err := f.fetchFeedWithCache(ctx, url)
+	return f.fetchFeed(ctx, url, false)
+}
+
+// FetchFeedNow fetches a feed even if its cache window has not expired yet,
+// for manual refreshes. Conditional request headers are still sent, so an
+// unchanged feed returns nil content.
+func (f *Fetcher) FetchFeedNow(ctx context.Context, url string) (*FeedContent, error) {
+	return f.fetchFeed(ctx, url, true)
+}
+
+// FetchStoredFeed fetches a stored feed with its own cache state and
+// credentials, which matters for private feeds that share their URL with
+// other feeds. With ignoreCacheWindow set it behaves like FetchFeedNow.
+func (f *Fetcher) FetchStoredFeed(ctx context.Context, feed db.Feed, ignoreCacheWindow bool) (*FeedContent, error) {
+	return f.fetchKnownFeed(ctx, feed.URL, &feed, ignoreCacheWindow)
+}
+
+func (f *Fetcher) fetchFeed(ctx context.Context, url string, ignoreCacheWindow bool) (*FeedContent, error) {
+	// Check if we have cached information for this feed
+	feed, err := f.store.GetFeedByURL(url)
+	if err != nil {
+		return nil, fmt.Errorf("error checking feed cache: %w", err)
+	}
+	return f.fetchKnownFeed(ctx, url, feed, ignoreCacheWindow)
+}
+
+// fetchKnownFeed fetches url, the URL of feed if that is not nil, and records
+// cache and redirect information on feed.
+func (f *Fetcher) fetchKnownFeed(ctx context.Context, url string, feed *db.Feed, ignoreCacheWindow bool) (*FeedContent, error) {
+	result, err := f.fetchFeedWithCache(ctx, url, feed, ignoreCacheWindow)
 	if err != nil {
 		return nil, err
 	}
 
-	// Update cache if we should cache and have cache info
-	if result.shouldCache && result.cacheInfo != nil {
-		// We need to get the feed ID to update cache info
-		feed, err := f.store.GetFeedByURL(url)
-		if err == nil && feed != nil {
-			if err := f.updateFeedCache(feed.ID, result.cacheInfo); err != nil {
+	if result.feed != nil {
+		// Update cache if we should cache and have cache info
+		if result.shouldCache && result.cacheInfo != nil {
+			if err := f.updateFeedCache(result.feed.ID, result.cacheInfo); err != nil {
 				// Log error but don't fail the fetch
 				fmt.Printf("Error updating feed cache info: %v\n", err)
 			}
 		}
+		f.recordRedirects(result)
 	}
 
 	return result.content, nil
 }
 
-// fetchFeedWithCache is the internal method that handles caching logic
-func (f *Fetcher) fetchFeedWithCache(ctx context.Context, url string) (*fetchResult, error) {
-	// Check if we have cached information for this feed
-	feed, err := f.store.GetFeedByURL(url)
+// recordRedirects moves a feed that permanently redirected to its new URL and
+// remembers where a temporarily redirected feed was fetched from. A private
+// feed is not moved to another host, since its credentials would be sent
+// there from then on; where it was fetched from is remembered instead.
+func (f *Fetcher) recordRedirects(result *fetchResult) {
+	feed := result.feed
+	finalURL := feed.FinalURL
+	if result.movedTo != "" && feed.HasCredentials && !sameHost(feed.URL, result.movedTo) {
+		fmt.Printf("Not moving private feed %s to another host at %s\n", feed.URL, result.movedTo)
+		if result.finalURL == "" {
+			result.finalURL = result.movedTo
+		}
+		result.movedTo = ""
+	}
+	if result.movedTo != "" {
+		fmt.Printf("Feed %s moved permanently to %s\n", feed.URL, result.movedTo)
+		if err := f.store.MoveFeed(feed.ID, result.movedTo); err != nil {
+			fmt.Printf("Error moving feed %s: %v\n", feed.URL, err)
+			return
+		}
+		finalURL = ""
+	}
+	if result.finalURL != finalURL {
+		if err := f.store.SetFeedFinalURL(feed.ID, result.finalURL); err != nil {
+			fmt.Printf("Error updating final URL of feed %s: %v\n", feed.URL, err)
+		}
+	}
+}
+
+// sameHost reports whether two URLs have the same host and port.
+func sameHost(a, b string) bool {
+	aURL, err := neturl.Parse(a)
 	if err != nil {
-		return nil, fmt.Errorf("error checking feed cache: %w", err)
+		return false
+	}
+	bURL, err := neturl.Parse(b)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(aURL.Host, bURL.Host)
+}
+
+// redirectTargets follows the redirects that led to resp. movedTo is the last
+// URL reached from url through permanent redirects (301 and 308) only, and
+// finalURL is where resp came from if a temporary redirect came after that.
+// Both are empty when they would be the same as the URL before them.
+func redirectTargets(url string, resp *http.Response) (movedTo, finalURL string) {
+	// Each request after the first carries the redirect response that
+	// caused it, which in turn carries the previous request.
+	var hops []*http.Request
+	for req := resp.Request; req != nil; {
+		hops = append([]*http.Request{req}, hops...)
+		if req.Response == nil {
+			break
+		}
+		req = req.Response.Request
 	}
 
+	current := url
+	permanent := true
+	for _, hop := range hops[1:] {
+		code := hop.Response.StatusCode
+		permanent = permanent && (code == http.StatusMovedPermanently || code == http.StatusPermanentRedirect)
+		if permanent {
+			movedTo = hop.URL.String()
+			current = movedTo
+		}
+	}
+	if last := hops[len(hops)-1].URL.String(); last != current {
+		finalURL = last
+	}
+	return movedTo, finalURL
+}
+
+// fetchFeedWithCache is the internal method that handles caching logic
+func (f *Fetcher) fetchFeedWithCache(ctx context.Context, url string, feed *db.Feed, ignoreCacheWindow bool) (*fetchResult, error) {
 	// If we have cache info, check if we should skip fetching
-	if feed != nil {
+	if feed != nil && !ignoreCacheWindow {
 		if f.shouldSkipFetch(feed) {
 			return &fetchResult{
 				content:     nil,
@@ -107,6 +284,15 @@ func (f *Fetcher) fetchFeedWithCache(ctx context.Context, url string) (*fetchRes
 	req.Header.Set("User-Agent", "RSSGrid/1.0")
 	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/json")
 
+	// Private feeds are fetched with their subscriber's credentials
+	if feed != nil && feed.HasCredentials {
+		creds, err := f.store.GetFeedCredentials(feed.ID)
+		if err != nil {
+			return nil, fmt.Errorf("error loading feed credentials: %w", err)
+		}
+		req = applyCredentials(req, creds)
+	}
+
 	// Add cache headers if we have them
 	if feed != nil {
 		if feed.ETag != "" {
@@ -117,33 +303,62 @@ func (f *Fetcher) fetchFeedWithCache(ctx context.Context, url string) (*fetchRes
 		}
 	}
 
-	resp, err := f.client.Do(req)
+	resp, err := f.do(req)
 	if err != nil {
 		return nil, fmt.Errorf("error fetching feed: %w", err)
 	}
 	defer resp.Body.Close()
 
+	movedTo, finalURL := redirectTargets(url, resp)
+
 	// Handle 304 Not Modified
 	if resp.StatusCode == http.StatusNotModified {
 		return &fetchResult{
 			content:     nil,
 			shouldCache: false,
 			error:       nil,
+			feed:        feed,
+			movedTo:     movedTo,
+			finalURL:    finalURL,
 		}, nil
 	}
 
+	if resp.StatusCode == http.StatusGone {
+		return nil, ErrFeedGone
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+		return nil, fmt.Errorf("%w: status code %d", ErrUnauthorized, resp.StatusCode)
+	}
+
+	if resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable {
+		if until, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			return nil, &RateLimitError{Until: until}
+		}
+	}
+
 	if resp.StatusCode != http.StatusOK {
 		return nil, fmt.Errorf("feed returned non-200 status code: %d", resp.StatusCode)
 	}
 
-	feedContent, err := f.parser.Parse(resp.Body)
+	if err := checkContentType(resp.Header.Get("Content-Type")); err != nil {
+		return nil, &NotAFeedError{URL: resp.Request.URL, err: err}
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading feed: %w", err)
+	}
+
+	feedContent, ttl, err := f.parseFeed(data)
 	if err != nil {
-		return nil, fmt.Errorf("error parsing feed: %w", err)
+		return nil, &NotAFeedError{URL: resp.Request.URL, Page: data, err: fmt.Errorf("error parsing feed: %w: %w", ErrNotAFeed, err)}
 	}
 
 	content := &FeedContent{
 		Title: feedContent.Title,
 		Items: make([]FeedItem, 0, len(feedContent.Items)),
+		TTL:   ttl,
 	}
 
 	if feedContent.UpdatedParsed != nil {
@@ -153,33 +368,7 @@ func (f *Fetcher) fetchFeedWithCache(ctx context.Context, url string) (*fetchRes
 	}
 
 	for _, item := range feedContent.Items {
-		// Determine GUID
-		guid := item.GUID
-		if guid == "" {
-			guid = item.Link
-		}
-
-		// Determine published time
-		publishedAt := time.Now()
-		if item.PublishedParsed != nil {
-			publishedAt = *item.PublishedParsed
-		} else if item.UpdatedParsed != nil {
-			publishedAt = *item.UpdatedParsed
-		}
-
-		// Get content
-		postContent := item.Content
-		if postContent == "" {
-			postContent = item.Description
-		}
-
-		content.Items = append(content.Items, FeedItem{
-			GUID:        guid,
-			Title:       item.Title,
-			Link:        item.Link,
-			PublishedAt: publishedAt,
-			Content:     postContent,
-		})
+		content.Items = append(content.Items, newFeedItem(item))
 	}
 
 	// Extract cache information from response headers
@@ -190,9 +379,101 @@ func (f *Fetcher) fetchFeedWithCache(ctx context.Context, url string) (*fetchRes
 		shouldCache: true,
 		cacheInfo:   cacheInfo,
 		error:       nil,
+		feed:        feed,
+		movedTo:     movedTo,
+		finalURL:    finalURL,
 	}, nil
 }
 
+// parseFeed parses an RSS, Atom or JSON feed. Each format is parsed with its
+// own parser before translating it, so that what the generic gofeed.Feed
+// drops can be kept: RSS polling hints, RSS and Atom comment links (in each
+// item's Custom[commentsKey]), whether JSON Feed text is plain text and the
+// size of JSON Feed attachments.
+func (f *Fetcher) parseFeed(data []byte) (*gofeed.Feed, time.Duration, error) {
+	switch gofeed.DetectFeedType(bytes.NewReader(data)) {
+	case gofeed.FeedTypeRSS:
+		rssFeed, err := (&rss.Parser{}).Parse(bytes.NewReader(data))
+		if err != nil {
+			return nil, 0, err
+		}
+		parsed, err := f.parser.RSSTranslator.Translate(rssFeed)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(parsed.Items) == len(rssFeed.Items) {
+			for i, item := range rssFeed.Items {
+				setCommentsURL(parsed.Items[i], item.Comments)
+			}
+		}
+		return parsed, rssTTL(rssFeed), nil
+
+	case gofeed.FeedTypeAtom:
+		atomFeed, err := (&atom.Parser{}).Parse(bytes.NewReader(data))
+		if err != nil {
+			return nil, 0, err
+		}
+		parsed, err := f.parser.AtomTranslator.Translate(atomFeed)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(parsed.Items) == len(atomFeed.Entries) {
+			for i, entry := range atomFeed.Entries {
+				for _, link := range entry.Links {
+					if link.Rel == "replies" && (link.Type == "" || link.Type == "text/html") {
+						setCommentsURL(parsed.Items[i], link.Href)
+						break
+					}
+				}
+			}
+		}
+		return parsed, 0, nil
+
+	case gofeed.FeedTypeJSON:
+		jsonFeed, err := (&json.Parser{}).Parse(bytes.NewReader(data))
+		if err != nil {
+			return nil, 0, err
+		}
+		parsed, err := f.parser.JSONTranslator.Translate(jsonFeed)
+		if err != nil {
+			return nil, 0, err
+		}
+		if len(parsed.Items) == len(jsonFeed.Items) {
+			// Everything but content_html is plain text.
+			for i, item := range jsonFeed.Items {
+				if item.ContentHTML == "" && item.ContentText != "" {
+					parsed.Items[i].Content = textToHTML(item.ContentText)
+				}
+				if item.Summary != "" {
+					parsed.Items[i].Description = html.EscapeString(item.Summary)
+				}
+				// gofeed reports the duration of attachments as their length.
+				if item.Attachments != nil && len(*item.Attachments) == len(parsed.Items[i].Enclosures) {
+					for j, attachment := range *item.Attachments {
+						parsed.Items[i].Enclosures[j].Length = strconv.FormatInt(attachment.SizeInBytes, 10)
+					}
+				}
+			}
+		}
+		return parsed, 0, nil
+
+	default:
+		parsed, err := f.parser.Parse(bytes.NewReader(data))
+		return parsed, 0, err
+	}
+}
+
+// setCommentsURL keeps the comments link of an item.
+func setCommentsURL(item *gofeed.Item, commentsURL string) {
+	if commentsURL == "" {
+		return
+	}
+	if item.Custom == nil {
+		item.Custom = make(map[string]string)
+	}
+	item.Custom[commentsKey] = commentsURL
+}
+
 func (f *Fetcher) extractCacheInfo(headers http.Header) *cacheInfo {
 	info := &cacheInfo{
 		cacheUntil: time.Now().Add(1 * time.Hour), // Default to 1 hour
@@ -240,6 +521,79 @@ func (f *Fetcher) parseMaxAge(cacheControl string) int {
 	return 0
 }
 
+// credentialHeadersKey is the request context key under which
+// applyCredentials records the names of a feed's custom headers.
+type credentialHeadersKey struct{}
+
+// applyCredentials adds a private feed's credentials to req. Custom headers
+// come first, so they can replace the default User-Agent and Accept. The
+// returned request remembers the custom header names for checkRedirect.
+func applyCredentials(req *http.Request, creds db.FeedCredentials) *http.Request {
+	var names []string
+	for _, header := range creds.Headers {
+		req.Header.Set(header.Name, header.Value)
+		names = append(names, header.Name)
+	}
+	if creds.Username != "" || creds.Password != "" {
+		req.SetBasicAuth(creds.Username, creds.Password)
+	}
+	if creds.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+creds.BearerToken)
+	}
+	if creds.Cookie != "" {
+		req.Header.Set("Cookie", creds.Cookie)
+	}
+	if len(names) == 0 {
+		return req
+	}
+	return req.WithContext(context.WithValue(req.Context(), credentialHeadersKey{}, names))
+}
+
+// checkRedirect follows at most 10 redirects, like the default policy. Go
+// copies a private feed's custom headers to every redirect target, and keeps
+// Authorization and Cookie for other ports of the same host name, so all
+// credentials are dropped here once a redirect leaves the feed's host.
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	if !strings.EqualFold(req.URL.Host, via[0].URL.Host) {
+		names, _ := req.Context().Value(credentialHeadersKey{}).([]string)
+		for _, name := range append(names, "Authorization", "Cookie") {
+			req.Header.Del(name)
+		}
+	}
+	return nil
+}
+
+// parseRetryAfter parses a Retry-After header, which is either a number of
+// seconds or an HTTP date, into the time the request may be retried, capped
+// at maxRetryAfter from now.
+func parseRetryAfter(value string, now time.Time) (time.Time, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, false
+	}
+	var until time.Time
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return time.Time{}, false
+		}
+		until = now.Add(time.Duration(min(seconds, int(maxRetryAfter/time.Second))) * time.Second)
+	} else if date, err := http.ParseTime(value); err == nil {
+		until = date
+	} else {
+		return time.Time{}, false
+	}
+	if until.Before(now) {
+		until = now
+	}
+	if limit := now.Add(maxRetryAfter); until.After(limit) {
+		until = limit
+	}
+	return until, true
+}
+
 func (f *Fetcher) shouldSkipFetch(feed *db.Feed) bool {
 	// Check if cache hasn't expired yet
 	if !feed.CacheUntil.IsZero() && time.Now().Before(feed.CacheUntil) {
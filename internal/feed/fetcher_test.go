@@ -1,13 +1,28 @@
 package feed
 
 import (
+	"context"
+	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"testing"
 	"time"
 
 	"github.com/aggregat4/rssgrid/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+// newTestFetcher returns a fetcher that may fetch from httptest servers, which
+// listen on the loopback interface.
+func newTestFetcher(store *db.Store) *Fetcher {
+	f := NewFetcher(store)
+	if err := f.SetAllowedNetworks([]string{"127.0.0.0/8", "::1"}); err != nil {
+		panic(err)
+	}
+	return f
+}
+
 func TestFetcher_ShouldSkipFetch(t *testing.T) {
 	// Create a mock feed with cache info
 	feed := &db.Feed{
@@ -83,3 +98,304 @@ func TestFetcher_ParseMaxAge(t *testing.T) {
 		}
 	}
 }
+
+// newRedirectServer serves testRSS at /feed.xml and /cdn.xml and the given
+// redirects from path to path.
+func newRedirectServer(t *testing.T, redirects map[string]int) *httptest.Server {
+	t.Helper()
+	targets := map[string]string{"/old.xml": "/feed.xml", "/moved.xml": "/cdn.xml"}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if code, ok := redirects[r.URL.Path]; ok {
+			http.Redirect(w, r, targets[r.URL.Path], code)
+			return
+		}
+		switch r.URL.Path {
+		case "/feed.xml", "/cdn.xml":
+			fmt.Fprintf(w, testRSS, "Redirected")
+		case "/gone.xml":
+			w.WriteHeader(http.StatusGone)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFetchFeed_PermanentRedirectMovesFeed(t *testing.T) {
+	store, cleanup := newUpdaterTestStore(t)
+	t.Cleanup(cleanup)
+	srv := newRedirectServer(t, map[string]int{"/old.xml": http.StatusMovedPermanently})
+
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, srv.URL+"/old.xml")
+	require.NoError(t, err)
+
+	content, err := newTestFetcher(store).FetchFeed(context.Background(), srv.URL+"/old.xml")
+	require.NoError(t, err)
+	assert.Equal(t, "Redirected", content.Title)
+
+	feed, err := store.GetFeedByID(feedID)
+	require.NoError(t, err)
+	assert.Equal(t, srv.URL+"/feed.xml", feed.URL)
+	assert.Empty(t, feed.FinalURL)
+}
+
+func TestFetchFeed_PermanentRedirectMergesWithExistingFeed(t *testing.T) {
+	store, cleanup := newUpdaterTestStore(t)
+	t.Cleanup(cleanup)
+	srv := newRedirectServer(t, map[string]int{"/old.xml": http.StatusPermanentRedirect})
+
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	otherID, err := store.GetOrCreateUser("other", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, srv.URL+"/old.xml")
+	require.NoError(t, err)
+	_, err = store.AddFeedForUser(otherID, srv.URL+"/feed.xml")
+	require.NoError(t, err)
+
+	_, err = newTestFetcher(store).FetchFeed(context.Background(), srv.URL+"/old.xml")
+	require.NoError(t, err)
+
+	feeds, err := store.GetAllFeeds()
+	require.NoError(t, err)
+	require.Len(t, feeds, 1)
+	assert.Equal(t, feedID, feeds[0].ID)
+	assert.Equal(t, srv.URL+"/feed.xml", feeds[0].URL)
+	otherFeeds, err := store.GetUserFeeds(otherID)
+	require.NoError(t, err)
+	require.Len(t, otherFeeds, 1)
+	assert.Equal(t, feedID, otherFeeds[0].ID)
+}
+
+func TestFetchFeed_TemporaryRedirectRecordsFinalURL(t *testing.T) {
+	store, cleanup := newUpdaterTestStore(t)
+	t.Cleanup(cleanup)
+	srv := newRedirectServer(t, map[string]int{"/old.xml": http.StatusFound})
+
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, srv.URL+"/old.xml")
+	require.NoError(t, err)
+
+	_, err = newTestFetcher(store).FetchFeed(context.Background(), srv.URL+"/old.xml")
+	require.NoError(t, err)
+
+	feed, err := store.GetFeedByID(feedID)
+	require.NoError(t, err)
+	assert.Equal(t, srv.URL+"/old.xml", feed.URL, "temporary redirects keep the URL")
+	assert.Equal(t, srv.URL+"/feed.xml", feed.FinalURL)
+}
+
+func TestRedirectTargets(t *testing.T) {
+	srv := newRedirectServer(t, map[string]int{
+		"/old.xml":   http.StatusMovedPermanently,
+		"/moved.xml": http.StatusTemporaryRedirect,
+	})
+
+	tests := []struct {
+		path     string
+		movedTo  string
+		finalURL string
+	}{
+		{path: "/feed.xml"},
+		{path: "/old.xml", movedTo: "/feed.xml"},
+		{path: "/moved.xml", finalURL: "/cdn.xml"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			resp, err := http.Get(srv.URL + tt.path)
+			require.NoError(t, err)
+			resp.Body.Close()
+			movedTo, finalURL := redirectTargets(srv.URL+tt.path, resp)
+			if tt.movedTo != "" {
+				tt.movedTo = srv.URL + tt.movedTo
+			}
+			if tt.finalURL != "" {
+				tt.finalURL = srv.URL + tt.finalURL
+			}
+			assert.Equal(t, tt.movedTo, movedTo)
+			assert.Equal(t, tt.finalURL, finalURL)
+		})
+	}
+}
+
+func TestFetchFeed_GoneReturnsErrFeedGone(t *testing.T) {
+	store, cleanup := newUpdaterTestStore(t)
+	t.Cleanup(cleanup)
+	srv := newRedirectServer(t, nil)
+
+	_, err := newTestFetcher(store).FetchFeed(context.Background(), srv.URL+"/gone.xml")
+	assert.ErrorIs(t, err, ErrFeedGone)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2026, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		value string
+		want  time.Time
+		ok    bool
+	}{
+		{"seconds", "120", now.Add(2 * time.Minute), true},
+		{"http date", "Fri, 02 Jan 2026 16:04:05 GMT", now.Add(time.Hour), true},
+		{"date in the past", "Fri, 02 Jan 2026 14:04:05 GMT", now, true},
+		{"capped", "999999", now.Add(maxRetryAfter), true},
+		{"missing", "", time.Time{}, false},
+		{"negative", "-5", time.Time{}, false},
+		{"garbage", "soon", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := parseRetryAfter(tt.value, now)
+			assert.Equal(t, tt.ok, ok)
+			assert.True(t, tt.want.Equal(got), "got %v, want %v", got, tt.want)
+		})
+	}
+}
+
+func TestFetchFeed_RateLimitedReturnsRateLimitError(t *testing.T) {
+	store, cleanup := newUpdaterTestStore(t)
+	t.Cleanup(cleanup)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/limited.xml":
+			w.Header().Set("Retry-After", "600")
+			w.WriteHeader(http.StatusTooManyRequests)
+		case "/unavailable.xml":
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	_, err := newTestFetcher(store).FetchFeed(context.Background(), srv.URL+"/limited.xml")
+	var rateLimit *RateLimitError
+	require.ErrorAs(t, err, &rateLimit)
+	assert.WithinDuration(t, time.Now().Add(10*time.Minute), rateLimit.Until, 5*time.Second)
+
+	_, err = newTestFetcher(store).FetchFeed(context.Background(), srv.URL+"/unavailable.xml")
+	require.Error(t, err)
+	assert.NotErrorAs(t, err, &rateLimit, "without Retry-After a 503 is an ordinary failure")
+}
+
+func TestFetchStoredFeed_SendsCredentials(t *testing.T) {
+	store, cleanup := newUpdaterTestStore(t)
+	t.Cleanup(cleanup)
+	store.SetCredentialsKey("secret")
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		username, password, ok := r.BasicAuth()
+		if !ok || username != "reader" || password != "hunter2" || r.Header.Get("X-Api-Key") != "key" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, testRSS, "Private")
+	}))
+	t.Cleanup(srv.Close)
+
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, srv.URL)
+	require.NoError(t, err)
+
+	fetcher := newTestFetcher(store)
+	_, err = fetcher.FetchFeed(context.Background(), srv.URL)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	_, err = store.SetFeedCredentialsForUser(userID, feedID, db.FeedCredentials{
+		Username: "reader",
+		Password: "hunter2",
+		Headers:  []db.FeedHeader{{Name: "X-Api-Key", Value: "key"}},
+	})
+	require.NoError(t, err)
+	feed, err := store.GetFeedByID(feedID)
+	require.NoError(t, err)
+	content, err := fetcher.FetchStoredFeed(context.Background(), *feed, false)
+	require.NoError(t, err)
+	assert.Equal(t, "Private", content.Title)
+}
+
+func TestFetchStoredFeed_DropsCredentialsOnCrossHostRedirect(t *testing.T) {
+	store, cleanup := newUpdaterTestStore(t)
+	t.Cleanup(cleanup)
+	store.SetCredentialsKey("secret")
+
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, ok := r.BasicAuth(); ok || r.Header.Get("X-Api-Key") != "" {
+			w.WriteHeader(http.StatusTeapot)
+			return
+		}
+		fmt.Fprintf(w, testRSS, "Moved")
+	}))
+	t.Cleanup(target.Close)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL+"/feed.xml", http.StatusFound)
+	}))
+	t.Cleanup(origin.Close)
+
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, origin.URL)
+	require.NoError(t, err)
+	_, err = store.SetFeedCredentialsForUser(userID, feedID, db.FeedCredentials{
+		Username: "reader",
+		Password: "hunter2",
+		Headers:  []db.FeedHeader{{Name: "X-Api-Key", Value: "key"}},
+	})
+	require.NoError(t, err)
+	feed, err := store.GetFeedByID(feedID)
+	require.NoError(t, err)
+
+	content, err := newTestFetcher(store).FetchStoredFeed(context.Background(), *feed, false)
+	require.NoError(t, err)
+	assert.Equal(t, "Moved", content.Title)
+}
+
+func TestFetchStoredFeed_DoesNotMovePrivateFeedToAnotherHost(t *testing.T) {
+	store, cleanup := newUpdaterTestStore(t)
+	t.Cleanup(cleanup)
+	store.SetCredentialsKey("secret")
+
+	leaked := false
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, _, ok := r.BasicAuth(); ok || r.Header.Get("X-Api-Key") != "" || r.Header.Get("Cookie") != "" {
+			leaked = true
+		}
+		fmt.Fprintf(w, testRSS, "Moved")
+	}))
+	t.Cleanup(target.Close)
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL+"/feed.xml", http.StatusMovedPermanently)
+	}))
+	t.Cleanup(origin.Close)
+
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, origin.URL+"/feed.xml")
+	require.NoError(t, err)
+	_, err = store.SetFeedCredentialsForUser(userID, feedID, db.FeedCredentials{
+		Username: "reader",
+		Password: "hunter2",
+		Cookie:   "session=1",
+		Headers:  []db.FeedHeader{{Name: "X-Api-Key", Value: "key"}},
+	})
+	require.NoError(t, err)
+
+	fetcher := newTestFetcher(store)
+	for range 2 {
+		feed, err := store.GetFeedByID(feedID)
+		require.NoError(t, err)
+		_, err = fetcher.FetchStoredFeed(context.Background(), *feed, true)
+		require.NoError(t, err)
+	}
+	assert.False(t, leaked, "credentials must not reach the new host")
+
+	feed, err := store.GetFeedByID(feedID)
+	require.NoError(t, err)
+	assert.Equal(t, origin.URL+"/feed.xml", feed.URL)
+	assert.Equal(t, target.URL+"/feed.xml", feed.FinalURL)
+}
@@ -0,0 +1,236 @@
+package feed
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+
+	"github.com/andybalholm/brotli"
+)
+
+// defaultMaxBodySize caps the size of a response, both as sent and after
+// decompression, overridable with SetMaxBodySize.
+const defaultMaxBodySize = 10 << 20
+
+// maxCompressionRatio is how many times its compressed size a response may
+// decompress to once it is larger than ratioCheckThreshold. Feeds compress
+// well, but not by orders of magnitude more than this.
+const (
+	maxCompressionRatio = 100
+	ratioCheckThreshold = 1 << 20
+)
+
+var (
+	// ErrResponseTooLarge is returned when a response exceeds the maximum
+	// body size.
+	ErrResponseTooLarge = errors.New("response is too large")
+	// ErrCompressionRatio is returned when a response decompresses to far
+	// more data than was sent, as decompression bombs do.
+	ErrCompressionRatio = errors.New("response decompresses to too much data")
+	// ErrBlockedAddress is returned when a URL resolves to a loopback,
+	// private, link-local or other non-public address that is not explicitly
+	// allowed.
+	ErrBlockedAddress = errors.New("address is not allowed")
+)
+
+// deniedNetworks are special-purpose ranges that are not on the public
+// internet but not covered by the netip predicates either.
+var deniedNetworks = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "this network"
+	netip.MustParsePrefix("100.64.0.0/10"), // carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"), // benchmarking
+	netip.MustParsePrefix("2001::/32"),     // Teredo, which tunnels to an obfuscated IPv4 address
+}
+
+// IPv6 prefixes whose addresses embed an IPv4 address: well-known NAT64 in
+// the last four bytes, 6to4 in the two bytes after the prefix.
+var (
+	nat64Prefix = netip.MustParsePrefix("64:ff9b::/96")
+	sixToFour   = netip.MustParsePrefix("2002::/16")
+)
+
+// embeddedIPv4 returns the IPv4 address that a NAT64 or 6to4 address
+// translates to, or ip itself.
+func embeddedIPv4(ip netip.Addr) netip.Addr {
+	b := ip.As16()
+	switch {
+	case nat64Prefix.Contains(ip):
+		return netip.AddrFrom4([4]byte(b[12:16]))
+	case sixToFour.Contains(ip):
+		return netip.AddrFrom4([4]byte(b[2:6]))
+	}
+	return ip
+}
+
+// SetMaxBodySize sets the largest response the fetcher reads, both as sent
+// and after decompression. It must be called before the fetcher is used.
+func (f *Fetcher) SetMaxBodySize(size int64) {
+	f.maxBodySize = size
+}
+
+// SetAllowedNetworks allows fetching from the given addresses or CIDR
+// networks even though they are loopback, private or link-local, e.g. for
+// feeds on the local network. It must be called before the fetcher is used.
+func (f *Fetcher) SetAllowedNetworks(networks []string) error {
+	allowed := make([]netip.Prefix, 0, len(networks))
+	for _, network := range networks {
+		prefix, err := netip.ParsePrefix(network)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(network)
+			if addrErr != nil {
+				return fmt.Errorf("invalid network %q: %w", network, err)
+			}
+			prefix = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		allowed = append(allowed, prefix.Masked())
+	}
+	f.allowedNetworks = allowed
+	return nil
+}
+
+// checkAddress rejects addresses that are not on the public internet unless
+// they are in an allowed network. It runs when connecting, after DNS
+// resolution, so a host name cannot be pointed at an internal address.
+func (f *Fetcher) checkAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	// Addresses that embed an IPv4 address are checked as that address.
+	ip = embeddedIPv4(ip.Unmap())
+	for _, prefix := range f.allowedNetworks {
+		if prefix.Contains(ip) {
+			return nil
+		}
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, ip)
+	}
+	for _, prefix := range deniedNetworks {
+		if prefix.Contains(ip) {
+			return fmt.Errorf("%w: %s", ErrBlockedAddress, ip)
+		}
+	}
+	return nil
+}
+
+// do sends req and returns the response with its body decompressed and
+// limited to the maximum body size. Reading more than that, or a body that
+// decompresses suspiciously well, fails with ErrResponseTooLarge or
+// ErrCompressionRatio.
+func (f *Fetcher) do(req *http.Request) (*http.Response, error) {
+	// Decompress here rather than in the transport, which does not limit
+	// how much a response decompresses to.
+	req.Header.Set("Accept-Encoding", "gzip, deflate, br")
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.ContentLength > f.maxBodySize {
+		resp.Body.Close()
+		return nil, fmt.Errorf("%w: %d bytes", ErrResponseTooLarge, resp.ContentLength)
+	}
+
+	sent := &limitedReader{r: resp.Body, remaining: f.maxBodySize}
+	var body io.Reader
+	switch encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding"))); encoding {
+	case "", "identity":
+		body = sent
+	case "gzip", "x-gzip":
+		body, err = gzip.NewReader(sent)
+	case "deflate":
+		body, err = zlib.NewReader(sent)
+	case "br":
+		body = brotli.NewReader(sent)
+	default:
+		err = fmt.Errorf("unsupported content encoding %q", encoding)
+	}
+	if err != nil {
+		resp.Body.Close()
+		return nil, fmt.Errorf("error decoding response: %w", err)
+	}
+	if body != sent {
+		body = &ratioReader{r: &limitedReader{r: body, remaining: f.maxBodySize}, sent: sent}
+		resp.Header.Del("Content-Encoding")
+		resp.Header.Del("Content-Length")
+		resp.ContentLength = -1
+		resp.Uncompressed = true
+	}
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{body, resp.Body}
+	return resp, nil
+}
+
+// limitedReader reads from r until remaining bytes were read and then fails
+// with ErrResponseTooLarge, unlike io.LimitReader which ends silently.
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+	read      int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		// Only fail if there is more to read.
+		var probe [1]byte
+		if n, _ := l.r.Read(probe[:]); n > 0 {
+			return 0, ErrResponseTooLarge
+		}
+		return 0, io.EOF
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	l.read += int64(n)
+	return n, err
+}
+
+// ratioReader fails with ErrCompressionRatio when the decompressed data read
+// from r grows too large compared to the compressed data read from sent.
+type ratioReader struct {
+	r    *limitedReader
+	sent *limitedReader
+}
+
+func (c *ratioReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if c.r.read > ratioCheckThreshold && c.r.read > c.sent.read*maxCompressionRatio {
+		return n, ErrCompressionRatio
+	}
+	return n, err
+}
+
+// checkContentType rejects responses that are clearly not feeds, such as
+// images or archives. Text types are let through for the parser to decide,
+// since feeds are often served as text/html or text/plain.
+func checkContentType(contentType string) error {
+	if contentType == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("%w: invalid content type %q", ErrNotAFeed, contentType)
+	}
+	if strings.HasPrefix(mediaType, "text/") || strings.Contains(mediaType, "xml") || strings.Contains(mediaType, "json") {
+		return nil
+	}
+	return fmt.Errorf("%w: content type %s is not a feed", ErrNotAFeed, mediaType)
+}
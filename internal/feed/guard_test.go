@@ -0,0 +1,152 @@
+package feed
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFetchFeed_BlocksLoopbackAddresses(t *testing.T) {
+	store, cleanup := newUpdaterTestStore(t)
+	t.Cleanup(cleanup)
+	srv := newRedirectServer(t, nil)
+
+	_, err := NewFetcher(store).FetchFeed(context.Background(), srv.URL+"/feed.xml")
+	assert.ErrorIs(t, err, ErrBlockedAddress)
+}
+
+func TestFetchFeed_IgnoresProxy(t *testing.T) {
+	store, cleanup := newUpdaterTestStore(t)
+	t.Cleanup(cleanup)
+	// The proxy would serve any feed it is asked for.
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, testRSS, "Proxied")
+	}))
+	t.Cleanup(proxy.Close)
+	t.Setenv("HTTP_PROXY", proxy.URL)
+	t.Setenv("HTTPS_PROXY", proxy.URL)
+
+	f := NewFetcher(store)
+	require.NoError(t, f.SetAllowedNetworks([]string{"127.0.0.0/8"}))
+	assert.Nil(t, f.client.Transport.(*http.Transport).Proxy)
+	_, err := f.FetchFeed(context.Background(), "http://10.0.0.1/feed.xml")
+	assert.ErrorIs(t, err, ErrBlockedAddress)
+}
+
+func TestSetAllowedNetworks(t *testing.T) {
+	f := NewFetcher(nil)
+	require.NoError(t, f.SetAllowedNetworks([]string{"192.168.1.0/24", "10.0.0.5", "fd00::/8"}))
+
+	assert.NoError(t, f.checkAddress("tcp", "192.168.1.20:80", nil))
+	assert.NoError(t, f.checkAddress("tcp", "10.0.0.5:443", nil))
+	assert.NoError(t, f.checkAddress("tcp", "[fd00::1]:80", nil))
+	assert.ErrorIs(t, f.checkAddress("tcp", "10.0.0.6:443", nil), ErrBlockedAddress)
+	assert.ErrorIs(t, f.checkAddress("tcp", "169.254.169.254:80", nil), ErrBlockedAddress)
+	assert.ErrorIs(t, f.checkAddress("tcp", "[::ffff:127.0.0.1]:80", nil), ErrBlockedAddress)
+	assert.NoError(t, f.checkAddress("tcp", "93.184.215.14:443", nil))
+
+	for _, address := range []string{"0.1.2.3:80", "100.64.0.1:80", "100.127.255.254:80", "192.0.0.170:80", "198.18.0.1:80", "198.19.255.255:80", "[64:ff9b::7f00:1]:80", "[64:ff9b::a9fe:a9fe]:80",
+		"[2002:7f00:1::1]:80", "[2002:a9fe:a9fe::]:80", "[2002:c0a8:201::1]:80", "[2001:0:4136:e378:8000:63bf:3fff:fdd2]:80"} {
+		assert.ErrorIs(t, f.checkAddress("tcp", address, nil), ErrBlockedAddress, address)
+	}
+	assert.NoError(t, f.checkAddress("tcp", "100.128.0.1:80", nil))
+	assert.NoError(t, f.checkAddress("tcp", "[64:ff9b::5db8:d70e]:443", nil), "NAT64 of a public address")
+	assert.NoError(t, f.checkAddress("tcp", "[64:ff9b::c0a8:114]:80", nil), "NAT64 of an allowed address")
+	assert.NoError(t, f.checkAddress("tcp", "[2002:5db8:d70e::1]:443", nil), "6to4 of a public address")
+	assert.NoError(t, f.checkAddress("tcp", "[2002:c0a8:114::1]:80", nil), "6to4 of an allowed address")
+
+	assert.Error(t, f.SetAllowedNetworks([]string{"not-a-network"}))
+}
+
+// newEncodedFeedServer serves body at /feed.xml with the given content type
+// and encoding.
+func newEncodedFeedServer(t *testing.T, contentType, encoding string, body []byte) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		if encoding != "" {
+			w.Header().Set("Content-Encoding", encoding)
+		}
+		w.Write(body)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFetchFeed_DecodesCompressedResponses(t *testing.T) {
+	store, cleanup := newUpdaterTestStore(t)
+	t.Cleanup(cleanup)
+	feed := fmt.Sprintf(testRSS, "Compressed Feed")
+
+	var gzipped bytes.Buffer
+	gw := gzip.NewWriter(&gzipped)
+	gw.Write([]byte(feed))
+	gw.Close()
+
+	var brotlied bytes.Buffer
+	bw := brotli.NewWriter(&brotlied)
+	bw.Write([]byte(feed))
+	bw.Close()
+
+	for encoding, body := range map[string][]byte{"gzip": gzipped.Bytes(), "br": brotlied.Bytes()} {
+		t.Run(encoding, func(t *testing.T) {
+			srv := newEncodedFeedServer(t, "application/rss+xml", encoding, body)
+			content, err := newTestFetcher(store).FetchFeedNow(context.Background(), srv.URL+"/feed.xml")
+			require.NoError(t, err)
+			assert.Equal(t, "Compressed Feed", content.Title)
+		})
+	}
+}
+
+func TestFetchFeed_RejectsOversizedResponse(t *testing.T) {
+	store, cleanup := newUpdaterTestStore(t)
+	t.Cleanup(cleanup)
+	body := []byte(fmt.Sprintf(testRSS, strings.Repeat("x", 4096)))
+	srv := newEncodedFeedServer(t, "application/rss+xml", "", body)
+
+	f := newTestFetcher(store)
+	f.SetMaxBodySize(1024)
+	_, err := f.FetchFeedNow(context.Background(), srv.URL+"/feed.xml")
+	assert.ErrorIs(t, err, ErrResponseTooLarge)
+}
+
+func TestFetchFeed_RejectsDecompressionBomb(t *testing.T) {
+	store, cleanup := newUpdaterTestStore(t)
+	t.Cleanup(cleanup)
+
+	var bomb bytes.Buffer
+	gw := gzip.NewWriter(&bomb)
+	gw.Write(bytes.Repeat([]byte(" "), 8<<20))
+	gw.Close()
+	srv := newEncodedFeedServer(t, "application/rss+xml", "gzip", bomb.Bytes())
+
+	_, err := newTestFetcher(store).FetchFeedNow(context.Background(), srv.URL+"/feed.xml")
+	assert.ErrorIs(t, err, ErrCompressionRatio)
+}
+
+func TestFetchFeed_RejectsNonFeedContentType(t *testing.T) {
+	store, cleanup := newUpdaterTestStore(t)
+	t.Cleanup(cleanup)
+	srv := newEncodedFeedServer(t, "image/png", "", []byte("\x89PNG\r\n\x1a\n"))
+
+	_, err := newTestFetcher(store).FetchFeedNow(context.Background(), srv.URL+"/feed.xml")
+	assert.ErrorIs(t, err, ErrNotAFeed)
+}
+
+func TestCheckContentType(t *testing.T) {
+	for _, contentType := range []string{"", "application/rss+xml", "application/atom+xml; charset=utf-8", "text/xml", "text/html", "application/feed+json"} {
+		assert.NoError(t, checkContentType(contentType), contentType)
+	}
+	for _, contentType := range []string{"image/png", "application/zip", "application/octet-stream"} {
+		assert.ErrorIs(t, checkContentType(contentType), ErrNotAFeed, contentType)
+	}
+}
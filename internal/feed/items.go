@@ -0,0 +1,178 @@
+package feed
+
+import (
+	"html"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aggregat4/rssgrid/internal/db"
+	"github.com/mmcdole/gofeed"
+	ext "github.com/mmcdole/gofeed/extensions"
+)
+
+// commentsKey is the key in gofeed.Item.Custom that parseFeed keeps the
+// comments link of an item under, since gofeed does not translate it.
+const commentsKey = "comments"
+
+// newFeedItem converts a parsed item into a FeedItem.
+func newFeedItem(item *gofeed.Item) FeedItem {
+	guid := item.GUID
+	if guid == "" {
+		guid = item.Link
+	}
+
+	publishedAt := time.Now()
+	if item.PublishedParsed != nil {
+		publishedAt = *item.PublishedParsed
+	} else if item.UpdatedParsed != nil {
+		publishedAt = *item.UpdatedParsed
+	}
+
+	// Keep the description as a separate summary only when there is full
+	// content to go with it.
+	content, summary := item.Content, item.Description
+	if content == "" {
+		content, summary = summary, ""
+	} else if strings.TrimSpace(summary) == strings.TrimSpace(content) {
+		summary = ""
+	}
+
+	var updatedAt time.Time
+	if item.UpdatedParsed != nil {
+		updatedAt = *item.UpdatedParsed
+	}
+
+	imageURL := ""
+	if item.Image != nil {
+		imageURL = item.Image.URL
+	}
+	if imageURL == "" {
+		imageURL = mediaThumbnail(item.Extensions)
+	}
+
+	var enclosures []db.Enclosure
+	for _, enclosure := range item.Enclosures {
+		if enclosure == nil {
+			continue
+		}
+		enclosureURL := absoluteURL(enclosure.URL, item.Link)
+		if enclosureURL == "" {
+			continue
+		}
+		length, _ := strconv.ParseInt(strings.TrimSpace(enclosure.Length), 10, 64)
+		enclosures = append(enclosures, db.Enclosure{URL: enclosureURL, Type: enclosure.Type, Length: max(length, 0)})
+	}
+
+	return FeedItem{
+		GUID:        guid,
+		Title:       item.Title,
+		Link:        item.Link,
+		Author:      itemAuthors(item),
+		PublishedAt: publishedAt,
+		Content:     content,
+		Summary:     summary,
+		Categories:  uniqueNonEmpty(item.Categories),
+		UpdatedAt:   updatedAt,
+		ImageURL:    absoluteURL(imageURL, item.Link),
+		CommentsURL: absoluteURL(item.Custom[commentsKey], item.Link),
+		Enclosures:  enclosures,
+	}
+}
+
+// Metadata returns the parts of the item that are stored as post metadata.
+func (item FeedItem) Metadata() db.PostMetadata {
+	return db.PostMetadata{
+		Summary:         item.Summary,
+		Categories:      item.Categories,
+		ImageURL:        item.ImageURL,
+		CommentsURL:     item.CommentsURL,
+		Enclosures:      item.Enclosures,
+		SourceUpdatedAt: item.UpdatedAt,
+	}
+}
+
+// itemAuthors joins the names of all authors of an item.
+func itemAuthors(item *gofeed.Item) string {
+	var names []string
+	for _, author := range item.Authors {
+		if author != nil {
+			names = append(names, author.Name)
+		}
+	}
+	if len(names) == 0 && item.Author != nil {
+		names = append(names, item.Author.Name)
+	}
+	return strings.Join(uniqueNonEmpty(names), ", ")
+}
+
+// uniqueNonEmpty trims the values and drops empty and repeated ones.
+func uniqueNonEmpty(values []string) []string {
+	var result []string
+	seen := make(map[string]bool)
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		result = append(result, value)
+	}
+	return result
+}
+
+// mediaThumbnail returns the Media RSS thumbnail of an item, which Atom feeds
+// such as YouTube's nest in a media:group.
+func mediaThumbnail(extensions ext.Extensions) string {
+	media := extensions["media"]
+	for _, thumbnail := range media["thumbnail"] {
+		if thumbnail.Attrs["url"] != "" {
+			return thumbnail.Attrs["url"]
+		}
+	}
+	for _, group := range media["group"] {
+		for _, thumbnail := range group.Children["thumbnail"] {
+			if thumbnail.Attrs["url"] != "" {
+				return thumbnail.Attrs["url"]
+			}
+		}
+	}
+	return ""
+}
+
+// absoluteURL resolves ref against the item link and returns it if it is an
+// http or https URL, or "" otherwise.
+func absoluteURL(ref, base string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return ""
+	}
+	resolved, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	if baseURL, err := url.Parse(base); err == nil {
+		resolved = baseURL.ResolveReference(resolved)
+	}
+	if resolved.Scheme != "http" && resolved.Scheme != "https" {
+		return ""
+	}
+	return resolved.String()
+}
+
+// textToHTML renders plain text, such as JSON Feed content_text, as HTML
+// paragraphs.
+func textToHTML(text string) string {
+	var b strings.Builder
+	for _, paragraph := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" {
+			continue
+		}
+		b.WriteString("<p>")
+		b.WriteString(strings.ReplaceAll(html.EscapeString(paragraph), "\n", "<br>"))
+		b.WriteString("</p>")
+	}
+	return b.String()
+}
@@ -0,0 +1,127 @@
+package feed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aggregat4/rssgrid/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// parseItems parses a feed document into FeedItems like the fetcher does.
+func parseItems(t *testing.T, doc string) []FeedItem {
+	t.Helper()
+	parsed, _, err := NewFetcher(nil).parseFeed([]byte(doc))
+	require.NoError(t, err)
+	var items []FeedItem
+	for _, item := range parsed.Items {
+		items = append(items, newFeedItem(item))
+	}
+	return items
+}
+
+func TestNewFeedItem_RSSMetadata(t *testing.T) {
+	items := parseItems(t, `<?xml version="1.0"?>
+<rss version="2.0" xmlns:content="http://purl.org/rss/1.0/modules/content/" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<channel><title>Podcast</title>
+<item>
+  <title>Episode 1</title>
+  <link>https://example.com/episodes/1</link>
+  <guid>ep1</guid>
+  <dc:creator>Alice</dc:creator>
+  <pubDate>Mon, 02 Mar 2026 10:00:00 GMT</pubDate>
+  <description>The short version.</description>
+  <content:encoded><![CDATA[<p>The long version.</p>]]></content:encoded>
+  <category>Go</category>
+  <category> Go </category>
+  <category>Feeds</category>
+  <comments>/episodes/1#comments</comments>
+  <enclosure url="https://cdn.example.com/ep1.mp3" length="12345678" type="audio/mpeg"/>
+  <enclosure url="javascript:alert(1)" length="1" type="audio/mpeg"/>
+</item>
+<item>
+  <title>Episode 2</title>
+  <link>https://example.com/episodes/2</link>
+  <description><![CDATA[<p>Only a description.</p>]]></description>
+</item>
+</channel></rss>`)
+	require.Len(t, items, 2)
+
+	item := items[0]
+	assert.Equal(t, "Alice", item.Author)
+	assert.Equal(t, "<p>The long version.</p>", item.Content)
+	assert.Equal(t, "The short version.", item.Summary)
+	assert.Equal(t, []string{"Go", "Feeds"}, item.Categories)
+	assert.Equal(t, "https://example.com/episodes/1#comments", item.CommentsURL)
+	assert.Equal(t, []db.Enclosure{{URL: "https://cdn.example.com/ep1.mp3", Type: "audio/mpeg", Length: 12345678}}, item.Enclosures)
+
+	item = items[1]
+	assert.Equal(t, "<p>Only a description.</p>", item.Content)
+	assert.Empty(t, item.Summary, "a description without content is the content")
+}
+
+func TestNewFeedItem_AtomMetadata(t *testing.T) {
+	items := parseItems(t, `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom" xmlns:media="http://search.yahoo.com/mrss/">
+<title>Videos</title>
+<entry>
+  <title>A video</title>
+  <id>urn:video:1</id>
+  <link rel="alternate" href="https://example.com/videos/1"/>
+  <link rel="replies" type="text/html" href="https://example.com/videos/1/comments"/>
+  <author><name>Alice</name></author>
+  <author><name>Bob</name></author>
+  <published>2026-03-02T10:00:00Z</published>
+  <updated>2026-03-03T08:30:00Z</updated>
+  <summary>What the video is about.</summary>
+  <content type="html">&lt;p&gt;Transcript&lt;/p&gt;</content>
+  <category term="go" label="Go"/>
+  <media:group>
+    <media:thumbnail url="https://i.example.com/1.jpg" width="480" height="360"/>
+  </media:group>
+</entry>
+</feed>`)
+	require.Len(t, items, 1)
+
+	item := items[0]
+	assert.Equal(t, "Alice, Bob", item.Author)
+	assert.Equal(t, "What the video is about.", item.Summary)
+	assert.Equal(t, []string{"Go"}, item.Categories)
+	assert.Equal(t, "https://example.com/videos/1/comments", item.CommentsURL)
+	assert.Equal(t, "https://i.example.com/1.jpg", item.ImageURL)
+	assert.Equal(t, time.Date(2026, 3, 3, 8, 30, 0, 0, time.UTC), item.UpdatedAt.UTC())
+}
+
+func TestNewFeedItem_JSONFeed(t *testing.T) {
+	items := parseItems(t, `{
+  "version": "https://jsonfeed.org/version/1.1",
+  "title": "Notes",
+  "items": [
+    {
+      "id": "1",
+      "url": "https://example.com/notes/1",
+      "title": "A note",
+      "content_text": "First <paragraph>.\n\nSecond line\nand third.",
+      "summary": "Notes & more",
+      "image": "/images/1.png",
+      "date_published": "2026-03-02T10:00:00Z",
+      "date_modified": "2026-03-02T12:00:00Z",
+      "authors": [{"name": "Alice"}],
+      "tags": ["notes"],
+      "attachments": [{"url": "https://example.com/notes/1.pdf", "mime_type": "application/pdf", "size_in_bytes": 2048}]
+    }
+  ]
+}`)
+	require.Len(t, items, 1)
+
+	item := items[0]
+	assert.Equal(t, "1", item.GUID)
+	assert.Equal(t, "<p>First &lt;paragraph&gt;.</p><p>Second line<br>and third.</p>", item.Content)
+	assert.Equal(t, "Notes &amp; more", item.Summary)
+	assert.Equal(t, "Alice", item.Author)
+	assert.Equal(t, []string{"notes"}, item.Categories)
+	assert.Equal(t, "https://example.com/images/1.png", item.ImageURL)
+	assert.Equal(t, time.Date(2026, 3, 2, 12, 0, 0, 0, time.UTC), item.UpdatedAt.UTC())
+	assert.Equal(t, []db.Enclosure{{URL: "https://example.com/notes/1.pdf", Type: "application/pdf", Length: 2048}}, item.Enclosures)
+}
@@ -0,0 +1,147 @@
+package feed
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"slices"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+// OPMLOutline is a single feed subscription read from or written to an OPML
+// document.
+type OPMLOutline struct {
+	Title   string
+	XMLURL  string
+	HTMLURL string
+	// Tags are the folders the feed is filed under.
+	Tags []string
+}
+
+type opmlDocument struct {
+	XMLName xml.Name `xml:"opml"`
+	Version string   `xml:"version,attr"`
+	Head    opmlHead `xml:"head"`
+	Body    opmlBody `xml:"body"`
+}
+
+type opmlHead struct {
+	Title       string `xml:"title"`
+	DateCreated string `xml:"dateCreated,omitempty"`
+}
+
+type opmlBody struct {
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	Type     string        `xml:"type,attr,omitempty"`
+	XMLURL   string        `xml:"xmlUrl,attr,omitempty"`
+	HTMLURL  string        `xml:"htmlUrl,attr,omitempty"`
+	Outlines []opmlOutline `xml:"outline"`
+}
+
+// ParseOPML reads an OPML document and returns the feed outlines it contains
+// in document order. Folder outlines (outlines without an xmlUrl) are
+// flattened so that their children are returned in place, tagged with the
+// names of the folders around them. A feed filed under several folders is
+// returned once, at its first place, with the tags of all of them.
+func ParseOPML(r io.Reader) ([]OPMLOutline, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.CharsetReader = charset.NewReaderLabel
+
+	var doc opmlDocument
+	if err := decoder.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("error parsing OPML: %w", err)
+	}
+
+	var outlines []OPMLOutline
+	seen := make(map[string]int)
+	var walk func(items []opmlOutline, folders []string)
+	walk = func(items []opmlOutline, folders []string) {
+		for _, item := range items {
+			title := item.Title
+			if title == "" {
+				title = item.Text
+			}
+			if item.XMLURL == "" {
+				if title != "" {
+					walk(item.Outlines, append(folders[:len(folders):len(folders)], title))
+				} else {
+					walk(item.Outlines, folders)
+				}
+				continue
+			}
+
+			i, ok := seen[item.XMLURL]
+			if !ok {
+				i = len(outlines)
+				seen[item.XMLURL] = i
+				outlines = append(outlines, OPMLOutline{
+					Title:   title,
+					XMLURL:  item.XMLURL,
+					HTMLURL: item.HTMLURL,
+				})
+			}
+			for _, folder := range folders {
+				if !slices.Contains(outlines[i].Tags, folder) {
+					outlines[i].Tags = append(outlines[i].Tags, folder)
+				}
+			}
+			walk(item.Outlines, folders)
+		}
+	}
+	walk(doc.Body.Outlines, nil)
+
+	return outlines, nil
+}
+
+// WriteOPML writes the given outlines as an OPML 2.0 document. Tagged feeds
+// are filed in a folder for each of their tags, which are placed where the
+// first feed with the tag would be.
+func WriteOPML(w io.Writer, title string, outlines []OPMLOutline) error {
+	doc := opmlDocument{
+		Version: "2.0",
+		Head: opmlHead{
+			Title:       title,
+			DateCreated: time.Now().UTC().Format(time.RFC1123Z),
+		},
+	}
+	folders := make(map[string]int)
+	for _, o := range outlines {
+		outline := opmlOutline{
+			Text:    o.Title,
+			Title:   o.Title,
+			Type:    "rss",
+			XMLURL:  o.XMLURL,
+			HTMLURL: o.HTMLURL,
+		}
+		if len(o.Tags) == 0 {
+			doc.Body.Outlines = append(doc.Body.Outlines, outline)
+			continue
+		}
+		for _, tag := range o.Tags {
+			i, ok := folders[tag]
+			if !ok {
+				i = len(doc.Body.Outlines)
+				folders[tag] = i
+				doc.Body.Outlines = append(doc.Body.Outlines, opmlOutline{Text: tag, Title: tag})
+			}
+			doc.Body.Outlines[i].Outlines = append(doc.Body.Outlines[i].Outlines, outline)
+		}
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return fmt.Errorf("error writing OPML header: %w", err)
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("error writing OPML: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package feed
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const sampleOPML = `<?xml version="1.0" encoding="UTF-8"?>
+<opml version="1.0">
+  <head><title>My Feeds</title></head>
+  <body>
+    <outline text="First Blog" type="rss" xmlUrl="https://first.example.com/feed.xml" htmlUrl="https://first.example.com/"/>
+    <outline text="Tech">
+      <outline text="Nested Text" title="Nested Title" type="rss" xmlUrl="https://nested.example.com/atom.xml"/>
+    </outline>
+    <outline text="Last Blog" type="rss" xmlUrl="https://last.example.com/rss"/>
+  </body>
+</opml>`
+
+func TestParseOPML_FlattensFoldersInDocumentOrder(t *testing.T) {
+	outlines, err := ParseOPML(strings.NewReader(sampleOPML))
+	require.NoError(t, err)
+	require.Len(t, outlines, 3)
+
+	assert.Equal(t, OPMLOutline{Title: "First Blog", XMLURL: "https://first.example.com/feed.xml", HTMLURL: "https://first.example.com/"}, outlines[0])
+	assert.Equal(t, "Nested Title", outlines[1].Title, "title attribute should win over text")
+	assert.Equal(t, []string{"Tech"}, outlines[1].Tags, "folders become tags")
+	assert.Equal(t, "https://nested.example.com/atom.xml", outlines[1].XMLURL)
+	assert.Equal(t, "https://last.example.com/rss", outlines[2].XMLURL)
+}
+
+func TestParseOPML_HandlesNonUTF8Charset(t *testing.T) {
+	doc := "<?xml version=\"1.0\" encoding=\"ISO-8859-1\"?>\n" +
+		"<opml version=\"1.0\"><body><outline text=\"Caf\xe9\" xmlUrl=\"https://cafe.example.com/feed\"/></body></opml>"
+
+	outlines, err := ParseOPML(strings.NewReader(doc))
+	require.NoError(t, err)
+	require.Len(t, outlines, 1)
+	assert.Equal(t, "Café", outlines[0].Title)
+}
+
+func TestParseOPML_MergesFeedsFiledInSeveralFolders(t *testing.T) {
+	doc := `<opml version="2.0"><body>
+		<outline text="News">
+			<outline text="Daily" xmlUrl="https://daily.example.com/feed"/>
+			<outline text="Local">
+				<outline text="City" xmlUrl="https://city.example.com/feed"/>
+			</outline>
+		</outline>
+		<outline text="Favourites">
+			<outline text="Daily" xmlUrl="https://daily.example.com/feed"/>
+		</outline>
+	</body></opml>`
+
+	outlines, err := ParseOPML(strings.NewReader(doc))
+	require.NoError(t, err)
+	require.Len(t, outlines, 2)
+	assert.Equal(t, "https://daily.example.com/feed", outlines[0].XMLURL)
+	assert.Equal(t, []string{"News", "Favourites"}, outlines[0].Tags)
+	assert.Equal(t, []string{"News", "Local"}, outlines[1].Tags)
+}
+
+func TestParseOPML_RejectsInvalidDocument(t *testing.T) {
+	_, err := ParseOPML(strings.NewReader("this is not xml"))
+	assert.Error(t, err)
+}
+
+func TestWriteOPML_RoundTrips(t *testing.T) {
+	in := []OPMLOutline{
+		{Title: "Feed A", XMLURL: "https://a.example.com/feed"},
+		{Title: "Feed <B> & Co", XMLURL: "https://b.example.com/feed?x=1&y=2"},
+		{Title: "Feed C", XMLURL: "https://c.example.com/feed", Tags: []string{"News", "Tech"}},
+		{Title: "Feed D", XMLURL: "https://d.example.com/feed", Tags: []string{"Tech"}},
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, WriteOPML(&buf, "RSSGrid subscriptions", in))
+	assert.Contains(t, buf.String(), `<opml version="2.0">`)
+	assert.Contains(t, buf.String(), "<title>RSSGrid subscriptions</title>")
+
+	out, err := ParseOPML(&buf)
+	require.NoError(t, err)
+	assert.Equal(t, in, out)
+}
@@ -0,0 +1,180 @@
+package feed
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"time"
+)
+
+// OutputFeed is a feed published by RSSGrid that merges the posts of several
+// subscribed feeds.
+type OutputFeed struct {
+	Title string
+	// SelfURL is where the feed itself is served and doubles as its id.
+	SelfURL string
+	// HomeURL is the page the feed belongs to.
+	HomeURL string
+	Updated time.Time
+	Items   []OutputItem
+}
+
+// OutputItem is a single post of an OutputFeed.
+type OutputItem struct {
+	// ID is a unique and stable identifier for the post.
+	ID        string
+	Title     string
+	Link      string
+	Author    string
+	Content   string
+	Published time.Time
+	// Updated is zero if the post was never changed.
+	Updated time.Time
+	// SourceTitle and SourceURL describe the feed the post came from.
+	SourceTitle string
+	SourceURL   string
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Author  atomPerson  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomContent struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+type atomSource struct {
+	Title string     `xml:"title,omitempty"`
+	Links []atomLink `xml:"link"`
+}
+
+type atomEntry struct {
+	Title     string      `xml:"title"`
+	ID        string      `xml:"id"`
+	Links     []atomLink  `xml:"link"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Author    *atomPerson `xml:"author"`
+	Content   atomContent `xml:"content"`
+	Source    *atomSource `xml:"source"`
+}
+
+// WriteAtom writes the feed as an Atom 1.0 document.
+func WriteAtom(w io.Writer, feed OutputFeed) error {
+	doc := atomFeed{
+		Title:   feed.Title,
+		ID:      feed.SelfURL,
+		Updated: feed.Updated.UTC().Format(time.RFC3339),
+		Links: []atomLink{
+			{Rel: "self", Type: "application/atom+xml", Href: feed.SelfURL},
+			{Rel: "alternate", Type: "text/html", Href: feed.HomeURL},
+		},
+		Author: atomPerson{Name: "RSSGrid"},
+	}
+	for _, item := range feed.Items {
+		updated := item.Updated
+		if updated.IsZero() {
+			updated = item.Published
+		}
+		entry := atomEntry{
+			Title:     item.Title,
+			ID:        item.ID,
+			Links:     []atomLink{{Rel: "alternate", Href: item.Link}},
+			Published: item.Published.UTC().Format(time.RFC3339),
+			Updated:   updated.UTC().Format(time.RFC3339),
+			Content:   atomContent{Type: "html", Body: item.Content},
+		}
+		if item.Author != "" {
+			entry.Author = &atomPerson{Name: item.Author}
+		}
+		if item.SourceURL != "" {
+			entry.Source = &atomSource{Title: item.SourceTitle, Links: []atomLink{{Rel: "self", Href: item.SourceURL}}}
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return fmt.Errorf("error writing Atom header: %w", err)
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("error writing Atom feed: %w", err)
+	}
+	return nil
+}
+
+type jsonFeed struct {
+	Version     string         `json:"version"`
+	Title       string         `json:"title"`
+	HomePageURL string         `json:"home_page_url"`
+	FeedURL     string         `json:"feed_url"`
+	Items       []jsonFeedItem `json:"items"`
+}
+
+type jsonFeedAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url,omitempty"`
+	Title         string           `json:"title,omitempty"`
+	ContentHTML   string           `json:"content_html"`
+	DatePublished string           `json:"date_published"`
+	DateModified  string           `json:"date_modified,omitempty"`
+	Authors       []jsonFeedAuthor `json:"authors,omitempty"`
+}
+
+// WriteJSONFeed writes the feed as a JSON Feed 1.1 document. JSON Feed has no
+// way to name the feed a post came from, so sources are left out.
+func WriteJSONFeed(w io.Writer, feed OutputFeed) error {
+	doc := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       feed.Title,
+		HomePageURL: feed.HomeURL,
+		FeedURL:     feed.SelfURL,
+		Items:       []jsonFeedItem{},
+	}
+	for _, item := range feed.Items {
+		jsonItem := jsonFeedItem{
+			ID:            item.ID,
+			URL:           item.Link,
+			Title:         item.Title,
+			ContentHTML:   item.Content,
+			DatePublished: item.Published.UTC().Format(time.RFC3339),
+		}
+		if !item.Updated.IsZero() {
+			jsonItem.DateModified = item.Updated.UTC().Format(time.RFC3339)
+		}
+		if item.Author != "" {
+			jsonItem.Authors = []jsonFeedAuthor{{Name: item.Author}}
+		}
+		doc.Items = append(doc.Items, jsonItem)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return fmt.Errorf("error writing JSON feed: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package feed
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/mmcdole/gofeed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var sampleOutputFeed = OutputFeed{
+	Title:   "RSSGrid",
+	SelfURL: "https://rssgrid.example.com/output/atom.xml",
+	HomeURL: "https://rssgrid.example.com/",
+	Updated: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+	Items: []OutputItem{
+		{
+			ID:          "https://rssgrid.example.com/posts/2",
+			Title:       "Second & last",
+			Link:        "https://blog.example.com/2",
+			Author:      "Jo",
+			Content:     "<p>Hello <b>world</b></p>",
+			Published:   time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+			SourceTitle: "Blog",
+			SourceURL:   "https://blog.example.com/feed.xml",
+		},
+		{
+			ID:        "https://rssgrid.example.com/posts/1",
+			Title:     "First",
+			Link:      "https://other.example.com/1",
+			Published: time.Date(2024, 4, 30, 8, 0, 0, 0, time.UTC),
+			Updated:   time.Date(2024, 4, 30, 9, 0, 0, 0, time.UTC),
+		},
+	},
+}
+
+// The written feeds are checked by parsing them back the way any feed reader
+// would.
+func TestWriteAtom_RoundTrips(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteAtom(&buf, sampleOutputFeed))
+
+	parsed, err := gofeed.NewParser().ParseString(buf.String())
+	require.NoError(t, err)
+	assert.Equal(t, "atom", parsed.FeedType)
+	assert.Equal(t, "RSSGrid", parsed.Title)
+	require.Len(t, parsed.Items, 2)
+	assert.Equal(t, "Second & last", parsed.Items[0].Title)
+	assert.Equal(t, "<p>Hello <b>world</b></p>", parsed.Items[0].Content)
+	assert.Equal(t, "Jo", parsed.Items[0].Author.Name)
+	assert.Equal(t, "https://rssgrid.example.com/posts/1", parsed.Items[1].GUID)
+	assert.Equal(t, "2024-04-30T09:00:00Z", parsed.Items[1].Updated)
+}
+
+func TestWriteJSONFeed_RoundTrips(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, WriteJSONFeed(&buf, sampleOutputFeed))
+
+	parsed, err := gofeed.NewParser().ParseString(buf.String())
+	require.NoError(t, err)
+	assert.Equal(t, "json", parsed.FeedType)
+	assert.Equal(t, "https://rssgrid.example.com/output/atom.xml", parsed.FeedLink)
+	require.Len(t, parsed.Items, 2)
+	assert.Equal(t, "https://blog.example.com/2", parsed.Items[0].Link)
+	assert.Equal(t, "<p>Hello <b>world</b></p>", parsed.Items[0].Content)
+	assert.Empty(t, parsed.Items[0].Updated, "unchanged posts have no modification date")
+}
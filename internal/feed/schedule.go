@@ -0,0 +1,94 @@
+package feed
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mmcdole/gofeed/rss"
+)
+
+// scheduleSampleSize is the number of recent posts used to estimate how often
+// a feed publishes.
+const scheduleSampleSize = 20
+
+// syUpdatePeriods maps RSS syndication module periods to durations.
+var syUpdatePeriods = map[string]time.Duration{
+	"hourly":  time.Hour,
+	"daily":   24 * time.Hour,
+	"weekly":  7 * 24 * time.Hour,
+	"monthly": 30 * 24 * time.Hour,
+	"yearly":  365 * 24 * time.Hour,
+}
+
+// rssTTL returns the polling interval an RSS feed asks for, from <ttl>
+// (minutes) or else <sy:updatePeriod> divided by <sy:updateFrequency>.
+func rssTTL(feed *rss.Feed) time.Duration {
+	if minutes, err := strconv.Atoi(strings.TrimSpace(feed.TTL)); err == nil && minutes > 0 {
+		return time.Duration(minutes) * time.Minute
+	}
+
+	sy := feed.Extensions["sy"]
+	if sy == nil {
+		return 0
+	}
+	var period time.Duration
+	if values := sy["updatePeriod"]; len(values) > 0 {
+		period = syUpdatePeriods[strings.ToLower(strings.TrimSpace(values[0].Value))]
+	}
+	if period == 0 {
+		return 0
+	}
+	frequency := 1
+	if values := sy["updateFrequency"]; len(values) > 0 {
+		if n, err := strconv.Atoi(strings.TrimSpace(values[0].Value)); err == nil && n > 0 {
+			frequency = n
+		}
+	}
+	return period / time.Duration(frequency)
+}
+
+// nextFetchInterval decides how long to wait before polling a feed again.
+//
+// It starts from the observed posting frequency: half the median gap between
+// recent posts (newest first in postTimes), or half the time since the latest
+// post if the feed has gone quiet for longer than that. Feeds with too little
+// history use defaultInterval. The publisher's ttl and the HTTP cache expiry
+// can only lengthen the interval, and the result is clamped to
+// [minInterval, maxInterval].
+func nextFetchInterval(postTimes []time.Time, ttl time.Duration, cacheUntil, now time.Time,
+	defaultInterval, minInterval, maxInterval time.Duration) time.Duration {
+	interval := defaultInterval
+	if len(postTimes) >= 2 {
+		var gaps []time.Duration
+		for i := 1; i < len(postTimes); i++ {
+			if gap := postTimes[i-1].Sub(postTimes[i]); gap > 0 {
+				gaps = append(gaps, gap)
+			}
+		}
+		if len(gaps) > 0 {
+			slices.Sort(gaps)
+			typicalGap := gaps[len(gaps)/2]
+			if sinceLatest := now.Sub(postTimes[0]); sinceLatest > typicalGap {
+				typicalGap = sinceLatest
+			}
+			interval = typicalGap / 2
+		}
+	}
+
+	if ttl > interval {
+		interval = ttl
+	}
+	if untilExpiry := cacheUntil.Sub(now); untilExpiry > interval {
+		interval = untilExpiry
+	}
+
+	if interval < minInterval {
+		interval = minInterval
+	}
+	if interval > maxInterval {
+		interval = maxInterval
+	}
+	return interval
+}
@@ -0,0 +1,141 @@
+package feed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNextFetchInterval(t *testing.T) {
+	now := time.Date(2026, 6, 20, 12, 0, 0, 0, time.UTC)
+	const (
+		defaultInterval = 30 * time.Minute
+		minInterval     = 10 * time.Minute
+		maxInterval     = 24 * time.Hour
+	)
+
+	// every returns n post times spaced gap apart, the newest at newest.
+	every := func(newest time.Time, gap time.Duration, n int) []time.Time {
+		var times []time.Time
+		for i := 0; i < n; i++ {
+			times = append(times, newest.Add(-time.Duration(i)*gap))
+		}
+		return times
+	}
+
+	tests := []struct {
+		name       string
+		postTimes  []time.Time
+		ttl        time.Duration
+		cacheUntil time.Time
+		expected   time.Duration
+	}{
+		{
+			name:     "no history uses the default interval",
+			expected: defaultInterval,
+		},
+		{
+			name:      "daily feed is polled twice a day",
+			postTimes: every(now.Add(-time.Hour), 24*time.Hour, 10),
+			expected:  12 * time.Hour,
+		},
+		{
+			name:      "very active feed is clamped to the minimum",
+			postTimes: every(now, time.Minute, 10),
+			expected:  minInterval,
+		},
+		{
+			name:      "feed that went quiet slows down to the maximum",
+			postTimes: every(now.Add(-90*24*time.Hour), time.Hour, 10),
+			expected:  maxInterval,
+		},
+		{
+			name:      "ttl lengthens a short interval",
+			postTimes: every(now, 20*time.Minute, 10),
+			ttl:       2 * time.Hour,
+			expected:  2 * time.Hour,
+		},
+		{
+			name:      "ttl does not shorten a long interval",
+			postTimes: every(now.Add(-time.Hour), 24*time.Hour, 10),
+			ttl:       time.Hour,
+			expected:  12 * time.Hour,
+		},
+		{
+			name:       "cache expiry lengthens the interval",
+			cacheUntil: now.Add(3 * time.Hour),
+			expected:   3 * time.Hour,
+		},
+		{
+			name:       "expired cache is ignored",
+			cacheUntil: now.Add(-3 * time.Hour),
+			expected:   defaultInterval,
+		},
+		{
+			name:     "huge ttl is capped at the maximum",
+			ttl:      7 * 24 * time.Hour,
+			expected: maxInterval,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := nextFetchInterval(tt.postTimes, tt.ttl, tt.cacheUntil, now, defaultInterval, minInterval, maxInterval)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestParseFeed_ReadsPollingHints(t *testing.T) {
+	tests := []struct {
+		name     string
+		channel  string
+		expected time.Duration
+	}{
+		{
+			name:     "ttl in minutes",
+			channel:  `<ttl>90</ttl>`,
+			expected: 90 * time.Minute,
+		},
+		{
+			name:     "syndication module period and frequency",
+			channel:  `<sy:updatePeriod>daily</sy:updatePeriod><sy:updateFrequency>4</sy:updateFrequency>`,
+			expected: 6 * time.Hour,
+		},
+		{
+			name:     "syndication period without frequency",
+			channel:  `<sy:updatePeriod>hourly</sy:updatePeriod>`,
+			expected: time.Hour,
+		},
+		{
+			name:     "no hints",
+			expected: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc := `<?xml version="1.0"?>
+<rss version="2.0" xmlns:sy="http://purl.org/rss/1.0/modules/syndication/"><channel>
+<title>Hinted</title>` + tt.channel + `
+<item><guid>1</guid><title>Post</title><link>https://example.com/1</link></item>
+</channel></rss>`
+			parsed, ttl, err := NewFetcher(nil).parseFeed([]byte(doc))
+			require.NoError(t, err)
+			assert.Equal(t, "Hinted", parsed.Title)
+			require.Len(t, parsed.Items, 1)
+			assert.Equal(t, tt.expected, ttl)
+		})
+	}
+}
+
+func TestParseFeed_AtomHasNoHint(t *testing.T) {
+	doc := `<?xml version="1.0"?><feed xmlns="http://www.w3.org/2005/Atom"><title>Atom</title>
+<entry><id>1</id><title>Post</title><link href="https://example.com/1"/></entry></feed>`
+	parsed, ttl, err := NewFetcher(nil).parseFeed([]byte(doc))
+	require.NoError(t, err)
+	assert.Equal(t, "Atom", parsed.Title)
+	assert.Zero(t, ttl)
+}
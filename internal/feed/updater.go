@@ -2,11 +2,17 @@ package feed
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log"
 	"math"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/aggregat4/rssgrid/internal/db"
+	"github.com/aggregat4/rssgrid/internal/events"
 )
 
 // FeedFetcher abstracts fetching a single feed by URL, so the updater can be
@@ -15,6 +21,27 @@ type FeedFetcher interface {
 	FetchFeed(ctx context.Context, url string) (*FeedContent, error)
 }
 
+// ImmediateFeedFetcher is implemented by fetchers that can bypass their
+// cache window for a manual refresh. *Fetcher satisfies it.
+type ImmediateFeedFetcher interface {
+	FetchFeedNow(ctx context.Context, url string) (*FeedContent, error)
+}
+
+// StoredFeedFetcher is implemented by fetchers that fetch a stored feed with
+// its own cache state and credentials rather than by URL, which private feeds
+// share with other feeds. *Fetcher satisfies it.
+type StoredFeedFetcher interface {
+	FetchStoredFeed(ctx context.Context, feed db.Feed, ignoreCacheWindow bool) (*FeedContent, error)
+}
+
+// RefreshResult is the outcome of a manual refresh of one feed.
+type RefreshResult struct {
+	Feed db.Feed
+	// Modified is false when the server reported no changes.
+	Modified bool
+	Err      error
+}
+
 // backoffThreshold is the number of consecutive failures after which the
 // updater starts backing off before retrying a feed.
 const backoffThreshold = 5
@@ -22,144 +49,449 @@ const backoffThreshold = 5
 // maxBackoff caps the exponential backoff window applied to failing feeds.
 const maxBackoff = 24 * time.Hour
 
+// Default fetch concurrency, overridable with SetConcurrency.
+const (
+	defaultWorkers        = 8
+	defaultWorkersPerHost = 2
+)
+
+// Default bounds on the per-feed polling interval, overridable with
+// SetScheduleBounds.
+const (
+	defaultMinFetchInterval = 10 * time.Minute
+	defaultMaxFetchInterval = 24 * time.Hour
+)
+
+// maxSchedulerTick is the longest the scheduler sleeps between looking for
+// due feeds.
+const maxSchedulerTick = time.Minute
+
+// Updater is a scheduler that polls each feed when it is due. interval is the
+// polling interval for feeds without enough history to estimate one.
 type Updater struct {
 	store           *db.Store
 	fetcher         FeedFetcher
 	interval        time.Duration
+	minInterval     time.Duration
+	maxInterval     time.Duration
 	ticker          *time.Ticker
-	done            chan bool
 	maxPostsPerFeed int
+	// workers caps the number of feeds fetched at once, workersPerHost the
+	// number fetched at once from any single host.
+	workers        int
+	workersPerHost int
+	// events receives feed changes; nil discards them.
+	events *events.Bus
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
 }
 
 func NewUpdater(store *db.Store, interval time.Duration, maxPostsPerFeed int) *Updater {
-	return &Updater{
-		store:           store,
-		fetcher:         NewFetcher(store),
-		interval:        interval,
-		ticker:          time.NewTicker(interval),
-		done:            make(chan bool),
-		maxPostsPerFeed: maxPostsPerFeed,
-	}
+	return NewUpdaterWithFetcher(store, interval, maxPostsPerFeed, NewFetcher(store))
 }
 
 // NewUpdaterWithFetcher constructs an Updater that uses the given fetcher,
-// primarily for tests. The ticker is not started by this constructor.
+// e.g. one configured with custom limits or a stub in tests. The ticker is
+// not started by this constructor.
 func NewUpdaterWithFetcher(store *db.Store, interval time.Duration, maxPostsPerFeed int, fetcher FeedFetcher) *Updater {
 	return &Updater{
 		store:           store,
 		fetcher:         fetcher,
 		interval:        interval,
-		ticker:          time.NewTicker(interval),
-		done:            make(chan bool),
+		minInterval:     defaultMinFetchInterval,
+		maxInterval:     defaultMaxFetchInterval,
+		ticker:          time.NewTicker(min(interval, maxSchedulerTick)),
 		maxPostsPerFeed: maxPostsPerFeed,
+		workers:         defaultWorkers,
+		workersPerHost:  defaultWorkersPerHost,
 	}
 }
 
+// SetConcurrency sets how many feeds are fetched in parallel overall and per
+// host. Values below 1 are treated as 1. It must be called before Start.
+func (u *Updater) SetConcurrency(workers, workersPerHost int) {
+	u.workers = max(workers, 1)
+	u.workersPerHost = max(workersPerHost, 1)
+}
+
+// SetScheduleBounds sets the shortest and longest interval at which any
+// single feed is polled. It must be called before Start.
+func (u *Updater) SetScheduleBounds(minInterval, maxInterval time.Duration) {
+	u.minInterval = minInterval
+	u.maxInterval = max(maxInterval, minInterval)
+}
+
+// SetEventBus makes the updater publish new posts and feed health changes to
+// bus. It must be called before Start.
+func (u *Updater) SetEventBus(bus *events.Bus) {
+	u.events = bus
+}
+
+// Start runs an update cycle on every tick until ctx is cancelled or Stop is
+// called. Cycles never overlap.
 func (u *Updater) Start(ctx context.Context) {
+	ctx, u.cancel = context.WithCancel(ctx)
+	u.wg.Add(1)
 	go func() {
+		defer u.wg.Done()
+		defer u.ticker.Stop()
 		for {
 			select {
 			case <-u.ticker.C:
 				if err := u.updateFeeds(ctx); err != nil {
 					log.Printf("Error updating feeds: %v", err)
 				}
-			case <-u.done:
-				u.ticker.Stop()
-				return
 			case <-ctx.Done():
-				u.ticker.Stop()
 				return
 			}
 		}
 	}()
 }
 
+// Stop cancels any in-flight fetches and waits for the update loop and its
+// workers to finish. It is safe to call after the Start context was cancelled.
 func (u *Updater) Stop() {
-	u.done <- true
+	if u.cancel != nil {
+		u.cancel()
+	}
+	u.wg.Wait()
+}
+
+// feedHost returns the host a feed is fetched from, used to limit how many
+// requests are made to one server at a time.
+func feedHost(feedURL string) string {
+	parsed, err := url.Parse(feedURL)
+	if err != nil || parsed.Hostname() == "" {
+		return feedURL
+	}
+	return strings.ToLower(parsed.Hostname())
+}
+
+// acquire takes a slot from sem, giving up if ctx is cancelled first.
+func acquire(ctx context.Context, sem chan struct{}) bool {
+	select {
+	case sem <- struct{}{}:
+		return true
+	case <-ctx.Done():
+		return false
+	}
 }
 
 func (u *Updater) updateFeeds(ctx context.Context) error {
 	log.Printf("Starting feed update cycle")
 
-	// Get all unique feed URLs
-	feeds, err := u.store.GetAllFeeds()
+	feeds, err := u.store.GetDueFeeds(time.Now())
 	if err != nil {
 		return err
 	}
 
-	log.Printf("Found %d feeds to update", len(feeds))
+	log.Printf("Found %d feeds due for an update", len(feeds))
 
 	now := time.Now()
+	hostLimits, err := u.store.GetHostRateLimits(now)
+	if err != nil {
+		return err
+	}
+	var toUpdate []db.Feed
 	for _, feed := range feeds {
+		if until := rateLimitedUntil(feed, hostLimits, now); !until.IsZero() {
+			log.Printf("Skipping feed %s (%s): rate limited by its host until %s",
+				feed.Title, feed.URL, until.Format(time.RFC3339))
+			u.scheduleNextFetch(feed, feed.TTL, until)
+			continue
+		}
 		if shouldBackOff(feed, now, u.interval) {
 			log.Printf("Skipping feed %s (%s): backing off after %d consecutive failures",
 				feed.Title, feed.URL, feed.ConsecutiveFailures)
 			continue
 		}
+		toUpdate = append(toUpdate, feed)
+	}
 
-		log.Printf("Updating feed: %s (%s)", feed.Title, feed.URL)
+	u.forEachFeed(ctx, toUpdate, func(feed db.Feed) {
+		u.updateFeed(ctx, feed, false)
+	})
 
-		// Fetch and parse feed with cache awareness
-		content, err := u.fetcher.FetchFeed(ctx, feed.URL)
+	if ctx.Err() != nil {
+		log.Printf("Feed update cycle cancelled")
+		return ctx.Err()
+	}
+	log.Printf("Feed update cycle completed")
+	return nil
+}
+
+// RefreshFeeds fetches the given feeds immediately, ignoring their schedule,
+// cache window and failure backoff, and returns one result per feed in the
+// same order. Feeds whose host asked not to be fetched yet report a
+// *RateLimitError, and feeds that could not be refreshed before ctx was
+// cancelled report ctx's error.
+func (u *Updater) RefreshFeeds(ctx context.Context, feeds []db.Feed) []RefreshResult {
+	results := make([]RefreshResult, len(feeds))
+	index := make(map[int64]int, len(feeds))
+	for i, feed := range feeds {
+		results[i] = RefreshResult{Feed: feed}
+		index[feed.ID] = i
+	}
+
+	var mu sync.Mutex
+	done := make(map[int64]bool, len(feeds))
+	now := time.Now()
+	hostLimits, err := u.store.GetHostRateLimits(now)
+	if err != nil {
+		log.Printf("Error reading host rate limits: %v", err)
+	}
+	var toRefresh []db.Feed
+	for _, feed := range feeds {
+		if until := rateLimitedUntil(feed, hostLimits, now); !until.IsZero() {
+			results[index[feed.ID]].Err = &RateLimitError{Until: until}
+			done[feed.ID] = true
+			continue
+		}
+		// A subscription carries the subscriber's custom title, which must
+		// not be taken for the feed's own title.
+		stored, err := u.store.GetFeedByID(feed.ID)
+		if err == nil && stored == nil {
+			err = fmt.Errorf("feed %d not found", feed.ID)
+		}
 		if err != nil {
-			log.Printf("Error fetching feed %s: %v", feed.URL, err)
-			if recordErr := u.store.RecordFeedFailure(feed.ID, err, time.Now()); recordErr != nil {
-				log.Printf("Error recording feed failure for %s: %v", feed.URL, recordErr)
-			}
+			results[index[feed.ID]].Err = err
+			done[feed.ID] = true
 			continue
 		}
+		toRefresh = append(toRefresh, *stored)
+	}
 
-		// A successful fetch (whether or not it returned new content) clears
-		// the failure state and records the success time.
-		if recordErr := u.store.RecordFeedSuccess(feed.ID, time.Now()); recordErr != nil {
-			log.Printf("Error recording feed success for %s: %v", feed.URL, recordErr)
+	u.forEachFeed(ctx, toRefresh, func(feed db.Feed) {
+		modified, err := u.updateFeed(ctx, feed, true)
+		mu.Lock()
+		defer mu.Unlock()
+		results[index[feed.ID]].Modified = modified
+		results[index[feed.ID]].Err = err
+		done[feed.ID] = true
+	})
+
+	for i := range results {
+		if !done[results[i].Feed.ID] {
+			results[i].Err = ctx.Err()
 		}
+	}
+	return results
+}
 
-		// If no content returned, feed was cached or not modified
-		if content == nil {
-			log.Printf("Feed %s was cached or not modified, skipping", feed.URL)
-		} else {
-			u.ingestContent(feed, content)
+// forEachFeed calls update for every feed within the worker pool limits and
+// waits for all calls to return. Every feed gets its own goroutine, which
+// first waits for a slot on its host and only then for a global slot, so
+// feeds queued behind a busy host never hold up feeds from other hosts.
+func (u *Updater) forEachFeed(ctx context.Context, feeds []db.Feed, update func(db.Feed)) {
+	workers := make(chan struct{}, u.workers)
+	hostSlots := make(map[string]chan struct{})
+	var wg sync.WaitGroup
+
+	for _, feed := range feeds {
+		host := feedHost(feed.URL)
+		if hostSlots[host] == nil {
+			hostSlots[host] = make(chan struct{}, u.workersPerHost)
 		}
+		hostSlot := hostSlots[host]
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if !acquire(ctx, hostSlot) {
+				return
+			}
+			defer func() { <-hostSlot }()
+			if !acquire(ctx, workers) {
+				return
+			}
+			defer func() { <-workers }()
+			update(feed)
+		}()
+	}
+	wg.Wait()
+}
+
+// updateFeed fetches a single feed and stores the result, reporting whether
+// the feed had new content. With force set the fetcher's cache window is
+// bypassed. It is called concurrently for different feeds.
+func (u *Updater) updateFeed(ctx context.Context, feed db.Feed, force bool) (bool, error) {
+	log.Printf("Updating feed: %s (%s)", feed.Title, feed.URL)
 
-		// Prune old posts to prevent unbounded database growth
-		if err := u.store.PruneFeedPosts(feed.ID, u.maxPostsPerFeed); err != nil {
-			log.Printf("Error pruning posts for feed %s: %v", feed.Title, err)
+	// Fetch and parse feed with cache awareness
+	var content *FeedContent
+	var err error
+	if stored, ok := u.fetcher.(StoredFeedFetcher); ok {
+		content, err = stored.FetchStoredFeed(ctx, feed, force)
+	} else if immediate, ok := u.fetcher.(ImmediateFeedFetcher); ok && force {
+		content, err = immediate.FetchFeedNow(ctx, feed.URL)
+	} else {
+		content, err = u.fetcher.FetchFeed(ctx, feed.URL)
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			// Shutting down; this is not the feed's fault.
+			return false, ctx.Err()
+		}
+		if errors.Is(err, ErrFeedGone) {
+			// Retired by the publisher: stop polling and let subscribers know.
+			log.Printf("Feed %s is gone, no longer polling it", feed.URL)
+			if markErr := u.store.MarkFeedGone(feed.ID, time.Now()); markErr != nil {
+				log.Printf("Error marking feed %s as gone: %v", feed.URL, markErr)
+			} else {
+				u.events.Publish(events.Event{Kind: events.HealthChanged, FeedID: feed.ID})
+			}
+			return false, err
+		}
+		var rateLimit *RateLimitError
+		if errors.As(err, &rateLimit) {
+			// Not the feed's fault either: wait as long as the host asked,
+			// for this and every other feed on it.
+			log.Printf("Feed %s is rate limited until %s", feed.URL, rateLimit.Until.Format(time.RFC3339))
+			if recordErr := u.store.RecordFeedRateLimited(feed.ID, rateLimit.Until); recordErr != nil {
+				log.Printf("Error recording rate limit for %s: %v", feed.URL, recordErr)
+			} else {
+				u.events.Publish(events.Event{Kind: events.HealthChanged, FeedID: feed.ID})
+			}
+			if recordErr := u.store.SetHostRateLimit(feedHost(feed.URL), rateLimit.Until); recordErr != nil {
+				log.Printf("Error recording rate limit for host of %s: %v", feed.URL, recordErr)
+			}
+			u.scheduleNextFetch(feed, feed.TTL, rateLimit.Until)
+			return false, err
 		}
+		log.Printf("Error fetching feed %s: %v", feed.URL, err)
+		if recordErr := u.store.RecordFeedFailure(feed.ID, err, time.Now()); recordErr != nil {
+			log.Printf("Error recording feed failure for %s: %v", feed.URL, recordErr)
+		} else {
+			u.events.Publish(events.Event{Kind: events.HealthChanged, FeedID: feed.ID})
+		}
+		// Retry after the minimum interval; repeated failures are further
+		// delayed by shouldBackOff.
+		u.scheduleNextFetch(feed, feed.TTL, time.Now().Add(u.minInterval))
+		return false, err
+	}
 
-		// Update last fetched timestamp
-		if err := u.store.UpdateFeedLastFetched(feed.ID, time.Now()); err != nil {
-			log.Printf("Error updating feed last fetched: %v", err)
+	// A successful fetch (whether or not it returned new content) clears
+	// the failure state and records the success time.
+	if recordErr := u.store.RecordFeedSuccess(feed.ID, time.Now()); recordErr != nil {
+		log.Printf("Error recording feed success for %s: %v", feed.URL, recordErr)
+	} else if feed.ConsecutiveFailures > 0 || !feed.RateLimitedUntil.IsZero() {
+		u.events.Publish(events.Event{Kind: events.HealthChanged, FeedID: feed.ID})
+	}
+
+	// If no content returned, feed was cached or not modified
+	if content == nil {
+		log.Printf("Feed %s was cached or not modified, skipping", feed.URL)
+	} else {
+		IngestContent(u.store, u.events, feed, content)
+	}
+
+	// Prune old posts to prevent unbounded database growth
+	if err := u.store.PruneFeedPosts(feed.ID, u.maxPostsPerFeed); err != nil {
+		log.Printf("Error pruning posts for feed %s: %v", feed.Title, err)
+	}
+
+	// Update last fetched timestamp
+	if err := u.store.UpdateFeedLastFetched(feed.ID, time.Now()); err != nil {
+		log.Printf("Error updating feed last fetched: %v", err)
+	}
+
+	// Keep the last known publisher hint when the feed was not modified.
+	ttl := feed.TTL
+	if content != nil {
+		ttl = content.TTL
+	}
+	u.scheduleNextFetch(feed, ttl, time.Time{})
+	return content != nil, nil
+}
+
+// scheduleNextFetch stores when the feed should next be polled. If at is zero
+// it is computed from the feed's posting history and caching hints.
+func (u *Updater) scheduleNextFetch(feed db.Feed, ttl time.Duration, at time.Time) {
+	now := time.Now()
+	if at.IsZero() {
+		postTimes, err := u.store.GetFeedPostTimes(feed.ID, scheduleSampleSize)
+		if err != nil {
+			log.Printf("Error reading post times for feed %s: %v", feed.URL, err)
 		}
+		// The fetch may just have updated the HTTP cache expiry, or moved the
+		// feed to a new URL.
+		cacheUntil := feed.CacheUntil
+		if current, err := u.store.GetFeedByID(feed.ID); err == nil && current != nil {
+			cacheUntil = current.CacheUntil
+		}
+		at = now.Add(nextFetchInterval(postTimes, ttl, cacheUntil, now, u.interval, u.minInterval, u.maxInterval))
+	}
+	if err := u.store.ScheduleFeedFetch(feed.ID, at, ttl); err != nil {
+		log.Printf("Error scheduling next fetch for feed %s: %v", feed.URL, err)
 	}
+}
 
-	log.Printf("Feed update cycle completed")
-	return nil
+// ContentStore is the part of the store that IngestContent writes to.
+// *db.Store satisfies it.
+type ContentStore interface {
+	UpdateFeedTitle(feedID int64, title string) error
+	UpsertPostWithMetadata(feedID int64, guid, title, link, author string, publishedAt time.Time, content string, metadata db.PostMetadata) (db.PostChange, error)
+	ApplyMarkSeenFilterRules(feedID int64, guid string) error
 }
 
-// ingestContent updates the feed title if it changed and adds any new posts.
-func (u *Updater) ingestContent(feed db.Feed, content *FeedContent) {
+// IngestContent stores freshly fetched content of feed: it updates the feed
+// title if it changed, adds any new posts and updates posts the publisher
+// has changed. New and changed posts matching a subscriber's mark-as-seen
+// filter rules are marked as seen for them, and the changes are published
+// on bus, which may be nil.
+func IngestContent(store ContentStore, bus *events.Bus, feed db.Feed, content *FeedContent) {
 	// Update feed title if it has changed
 	if content.Title != feed.Title {
 		log.Printf("Updating feed title from '%s' to '%s'", feed.Title, content.Title)
-		if err := u.store.UpdateFeedTitle(feed.ID, content.Title); err != nil {
+		if err := store.UpdateFeedTitle(feed.ID, content.Title); err != nil {
 			log.Printf("Error updating feed title: %v", err)
 		}
 	}
 
-	// Add new posts
-	newPostsCount := 0
+	// Add new posts and update changed ones
+	newPostsCount, updatedPostsCount := 0, 0
 	for _, item := range content.Items {
-		if err := u.store.AddPost(feed.ID, item.GUID, item.Title, item.Link, item.PublishedAt, item.Content); err != nil {
+		change, err := store.UpsertPostWithMetadata(feed.ID, item.GUID, item.Title, item.Link, item.Author, item.PublishedAt, item.Content, item.Metadata())
+		if err != nil {
 			log.Printf("Error adding post: %v", err)
-		} else {
+			continue
+		}
+		switch change {
+		case db.PostInserted:
 			newPostsCount++
+		case db.PostUpdated:
+			updatedPostsCount++
+		default:
+			continue
+		}
+		// New and changed posts may match a user's mark-as-seen filter rules.
+		if err := store.ApplyMarkSeenFilterRules(feed.ID, item.GUID); err != nil {
+			log.Printf("Error applying filter rules to post %s: %v", item.GUID, err)
 		}
 	}
 
 	if newPostsCount > 0 {
 		log.Printf("Added %d new posts from feed: %s", newPostsCount, feed.Title)
+		bus.Publish(events.Event{Kind: events.PostsAdded, FeedID: feed.ID})
+	}
+	if updatedPostsCount > 0 {
+		log.Printf("Updated %d changed posts from feed: %s", updatedPostsCount, feed.Title)
+		bus.Publish(events.Event{Kind: events.PostsUpdated, FeedID: feed.ID})
+	}
+}
+
+// rateLimitedUntil returns when the feed may be fetched again if it or its
+// host is rate limited at now, and the zero time otherwise.
+func rateLimitedUntil(feed db.Feed, hostLimits map[string]time.Time, now time.Time) time.Time {
+	until := hostLimits[feedHost(feed.URL)]
+	if feed.RateLimitedUntil.After(until) {
+		until = feed.RateLimitedUntil
+	}
+	if !until.After(now) {
+		return time.Time{}
 	}
+	return until
 }
 
 // shouldBackOff reports whether a feed should be skipped this cycle because it
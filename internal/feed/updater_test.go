@@ -3,11 +3,14 @@ package feed
 import (
 	"context"
 	"errors"
+	"fmt"
 	"os"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/aggregat4/rssgrid/internal/db"
+	"github.com/aggregat4/rssgrid/internal/events"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -64,11 +67,15 @@ func TestShouldBackOff(t *testing.T) {
 type stubFetcher struct {
 	content *FeedContent
 	err     error
-	calls   int
+
+	mu    sync.Mutex
+	calls int
 }
 
 func (s *stubFetcher) FetchFeed(_ context.Context, _ string) (*FeedContent, error) {
+	s.mu.Lock()
 	s.calls++
+	s.mu.Unlock()
 	return s.content, s.err
 }
 
@@ -121,6 +128,66 @@ func TestUpdateFeeds_RecordsFailureOnFetchError(t *testing.T) {
 	assert.False(t, feeds[0].LastErrorAt.IsZero())
 }
 
+func TestUpdateFeeds_RetiresGoneFeed(t *testing.T) {
+	store, cleanup := newUpdaterTestStore(t)
+	t.Cleanup(cleanup)
+
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	_, err = store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+
+	updater := NewUpdaterWithFetcher(store, 30*time.Minute, 100, &stubFetcher{err: ErrFeedGone})
+
+	require.NoError(t, updater.updateFeeds(context.Background()))
+
+	feeds, err := store.GetAllFeeds()
+	require.NoError(t, err)
+	require.Len(t, feeds, 1)
+	assert.False(t, feeds[0].GoneAt.IsZero(), "gone_at should be set")
+	assert.Equal(t, 0, feeds[0].ConsecutiveFailures, "a gone feed is not a failure")
+	due, err := store.GetDueFeeds(time.Now().Add(24 * time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, due, "gone feeds are no longer polled")
+}
+
+func TestUpdateFeeds_RateLimitHoldsOffWholeHost(t *testing.T) {
+	store, cleanup := newUpdaterTestStore(t)
+	t.Cleanup(cleanup)
+
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+
+	until := time.Now().Add(time.Hour)
+	limited := NewUpdaterWithFetcher(store, 30*time.Minute, 100, &stubFetcher{err: &RateLimitError{Until: until}})
+	require.NoError(t, limited.updateFeeds(context.Background()))
+
+	feed, err := store.GetFeedByID(feedID)
+	require.NoError(t, err)
+	assert.Equal(t, 0, feed.ConsecutiveFailures, "a rate limit is not a failure")
+	assert.WithinDuration(t, until, feed.RateLimitedUntil, time.Second)
+	assert.WithinDuration(t, until, feed.NextFetchAt, time.Second, "the next fetch waits for the host")
+
+	// Another feed on the same host is held off as well, also on a manual
+	// refresh.
+	otherID, err := store.AddFeedForUser(userID, "https://example.com/other.xml")
+	require.NoError(t, err)
+	stub := &stubFetcher{content: &FeedContent{Title: "Other"}}
+	updater := NewUpdaterWithFetcher(store, 30*time.Minute, 100, stub)
+	require.NoError(t, updater.updateFeeds(context.Background()))
+	assert.Equal(t, 0, stub.calls)
+	other, err := store.GetFeedByID(otherID)
+	require.NoError(t, err)
+	assert.WithinDuration(t, until, other.NextFetchAt, time.Second)
+
+	results := updater.RefreshFeeds(context.Background(), []db.Feed{*other})
+	var rateLimit *RateLimitError
+	assert.ErrorAs(t, results[0].Err, &rateLimit)
+	assert.Equal(t, 0, stub.calls)
+}
+
 func TestUpdateFeeds_RecordsSuccessOnContent(t *testing.T) {
 	store, cleanup := newUpdaterTestStore(t)
 	t.Cleanup(cleanup)
@@ -199,3 +266,398 @@ func TestUpdateFeeds_SkipsFeedUnderBackoff(t *testing.T) {
 	require.Len(t, feeds, 1)
 	assert.Equal(t, 5, feeds[0].ConsecutiveFailures)
 }
+
+// concurrencyFetcher records how many fetches run at once, overall and per
+// host, holding each fetch open for a short while.
+type concurrencyFetcher struct {
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+	perHost     map[string]int
+	maxPerHost  int
+	calls       int
+}
+
+func (f *concurrencyFetcher) FetchFeed(ctx context.Context, url string) (*FeedContent, error) {
+	host := feedHost(url)
+	f.mu.Lock()
+	f.calls++
+	f.inFlight++
+	f.perHost[host]++
+	f.maxInFlight = max(f.maxInFlight, f.inFlight)
+	f.maxPerHost = max(f.maxPerHost, f.perHost[host])
+	f.mu.Unlock()
+
+	select {
+	case <-time.After(20 * time.Millisecond):
+	case <-ctx.Done():
+	}
+
+	f.mu.Lock()
+	f.inFlight--
+	f.perHost[host]--
+	f.mu.Unlock()
+	return nil, ctx.Err()
+}
+
+func TestUpdateFeeds_FetchesConcurrentlyWithinLimits(t *testing.T) {
+	store, cleanup := newUpdaterTestStore(t)
+	t.Cleanup(cleanup)
+
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	// Six feeds on one busy host and six spread over other hosts.
+	for i := 0; i < 6; i++ {
+		_, err = store.AddFeedForUser(userID, fmt.Sprintf("https://busy.example.com/feed%d.xml", i))
+		require.NoError(t, err)
+		_, err = store.AddFeedForUser(userID, fmt.Sprintf("https://host%d.example.com/feed.xml", i))
+		require.NoError(t, err)
+	}
+
+	fetcher := &concurrencyFetcher{perHost: make(map[string]int)}
+	updater := NewUpdaterWithFetcher(store, 30*time.Minute, 100, fetcher)
+	updater.SetConcurrency(4, 2)
+
+	require.NoError(t, updater.updateFeeds(context.Background()))
+
+	assert.Equal(t, 12, fetcher.calls, "every feed should be fetched")
+	assert.LessOrEqual(t, fetcher.maxInFlight, 4, "global limit exceeded")
+	assert.Greater(t, fetcher.maxInFlight, 1, "feeds should be fetched in parallel")
+	assert.LessOrEqual(t, fetcher.maxPerHost, 2, "per-host limit exceeded")
+
+	feeds, err := store.GetAllFeeds()
+	require.NoError(t, err)
+	for _, f := range feeds {
+		assert.False(t, f.LastSuccessAt.IsZero(), "feed %s should have been recorded as fetched", f.URL)
+	}
+}
+
+// blockingFetcher blocks every fetch until its context is cancelled.
+type blockingFetcher struct {
+	started   chan struct{}
+	cancelled chan struct{}
+}
+
+func (f *blockingFetcher) FetchFeed(ctx context.Context, _ string) (*FeedContent, error) {
+	f.started <- struct{}{}
+	<-ctx.Done()
+	f.cancelled <- struct{}{}
+	return nil, ctx.Err()
+}
+
+func TestUpdater_StopDrainsInFlightFetches(t *testing.T) {
+	store, cleanup := newUpdaterTestStore(t)
+	t.Cleanup(cleanup)
+
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	_, err = store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+
+	fetcher := &blockingFetcher{started: make(chan struct{}, 1), cancelled: make(chan struct{}, 1)}
+	updater := NewUpdaterWithFetcher(store, 10*time.Millisecond, 100, fetcher)
+	updater.Start(context.Background())
+
+	select {
+	case <-fetcher.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("update cycle did not start")
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		updater.Stop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop did not return")
+	}
+	select {
+	case <-fetcher.cancelled:
+	default:
+		t.Fatal("in-flight fetch should have been cancelled before Stop returned")
+	}
+
+	feeds, err := store.GetAllFeeds()
+	require.NoError(t, err)
+	assert.Equal(t, 0, feeds[0].ConsecutiveFailures, "a fetch cancelled by shutdown is not a feed failure")
+}
+
+func TestUpdater_StopAfterContextCancelled(t *testing.T) {
+	store, cleanup := newUpdaterTestStore(t)
+	t.Cleanup(cleanup)
+
+	updater := NewUpdaterWithFetcher(store, time.Hour, 100, &stubFetcher{})
+	ctx, cancel := context.WithCancel(context.Background())
+	updater.Start(ctx)
+	cancel()
+
+	stopped := make(chan struct{})
+	go func() {
+		updater.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stop blocked after the context was already cancelled")
+	}
+}
+
+func TestUpdateFeeds_OnlyFetchesDueFeedsAndSchedulesThem(t *testing.T) {
+	store, cleanup := newUpdaterTestStore(t)
+	t.Cleanup(cleanup)
+
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	dueID, err := store.AddFeedForUser(userID, "https://due.example.com/feed.xml")
+	require.NoError(t, err)
+	laterID, err := store.AddFeedForUser(userID, "https://later.example.com/feed.xml")
+	require.NoError(t, err)
+	require.NoError(t, store.ScheduleFeedFetch(laterID, time.Now().Add(time.Hour), 0))
+
+	stub := &stubFetcher{content: &FeedContent{Title: "Hinted", TTL: 3 * time.Hour}}
+	updater := NewUpdaterWithFetcher(store, 30*time.Minute, 100, stub)
+
+	before := time.Now()
+	require.NoError(t, updater.updateFeeds(context.Background()))
+	assert.Equal(t, 1, stub.calls, "only the due feed should be fetched")
+
+	feeds, err := store.GetAllFeeds()
+	require.NoError(t, err)
+	for _, f := range feeds {
+		if f.ID != dueID {
+			continue
+		}
+		assert.Equal(t, 3*time.Hour, f.TTL, "the publisher's hint is stored")
+		assert.WithinDuration(t, before.Add(3*time.Hour), f.NextFetchAt, time.Minute,
+			"the next fetch honours the publisher's ttl")
+	}
+
+	// Nothing is due any more, so a second cycle fetches nothing.
+	require.NoError(t, updater.updateFeeds(context.Background()))
+	assert.Equal(t, 1, stub.calls)
+}
+
+// immediateFetcher records whether fetches went through FetchFeedNow.
+type immediateFetcher struct {
+	stubFetcher
+	immediateCalls int
+}
+
+func (f *immediateFetcher) FetchFeedNow(ctx context.Context, url string) (*FeedContent, error) {
+	f.mu.Lock()
+	f.immediateCalls++
+	f.mu.Unlock()
+	return f.content, f.err
+}
+
+func TestRefreshFeeds_BypassesBackoffAndCacheWindow(t *testing.T) {
+	store, cleanup := newUpdaterTestStore(t)
+	t.Cleanup(cleanup)
+
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	_, err = store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+
+	feeds, err := store.GetAllFeeds()
+	require.NoError(t, err)
+	require.Len(t, feeds, 1)
+	feedID := feeds[0].ID
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, store.RecordFeedFailure(feedID, errors.New("boom"), time.Now()))
+	}
+	feeds, err = store.GetAllFeeds()
+	require.NoError(t, err)
+
+	fetcher := &immediateFetcher{stubFetcher: stubFetcher{content: &FeedContent{
+		Title: "Refreshed",
+		Items: []FeedItem{{GUID: "1", Title: "Post", Link: "https://example.com/1"}},
+	}}}
+	updater := NewUpdaterWithFetcher(store, 30*time.Minute, 100, fetcher)
+
+	results := updater.RefreshFeeds(context.Background(), feeds)
+	require.Len(t, results, 1)
+	assert.NoError(t, results[0].Err)
+	assert.True(t, results[0].Modified)
+	assert.Equal(t, feedID, results[0].Feed.ID)
+	assert.Equal(t, 1, fetcher.immediateCalls, "manual refresh must bypass the cache window")
+	assert.Equal(t, 0, fetcher.calls)
+
+	feeds, err = store.GetAllFeeds()
+	require.NoError(t, err)
+	require.Len(t, feeds, 1)
+	assert.Equal(t, 0, feeds[0].ConsecutiveFailures)
+	assert.Equal(t, "Refreshed", feeds[0].Title)
+
+	posts, err := store.GetFeedPosts(feedID, userID, 10)
+	require.NoError(t, err)
+	assert.Len(t, posts, 1)
+}
+
+func TestRefreshFeeds_ComparesWithStoredTitle(t *testing.T) {
+	store, cleanup := newUpdaterTestStore(t)
+	t.Cleanup(cleanup)
+
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+	require.NoError(t, store.UpdateFeedTitle(feedID, "Original"))
+	require.NoError(t, store.SetFeedSettingsForUser(userID, feedID, db.FeedSettings{CustomTitle: "Renamed"}))
+
+	// The publisher picks the title the subscriber already gave the feed.
+	fetcher := &immediateFetcher{stubFetcher: stubFetcher{content: &FeedContent{Title: "Renamed"}}}
+	updater := NewUpdaterWithFetcher(store, 30*time.Minute, 100, fetcher)
+	feeds, err := store.GetUserFeeds(userID)
+	require.NoError(t, err)
+	require.Len(t, feeds, 1)
+
+	results := updater.RefreshFeeds(context.Background(), feeds)
+	require.Len(t, results, 1)
+	require.NoError(t, results[0].Err)
+	assert.Equal(t, "Renamed", results[0].Feed.Title, "results keep the subscriber's view of the feed")
+
+	feed, err := store.GetFeedByID(feedID)
+	require.NoError(t, err)
+	assert.Equal(t, "Renamed", feed.Title)
+}
+
+func TestRefreshFeeds_ReportsErrorsPerFeed(t *testing.T) {
+	store, cleanup := newUpdaterTestStore(t)
+	t.Cleanup(cleanup)
+
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	_, err = store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+
+	feeds, err := store.GetAllFeeds()
+	require.NoError(t, err)
+
+	stub := &stubFetcher{err: errors.New("connection refused")}
+	updater := NewUpdaterWithFetcher(store, 30*time.Minute, 100, stub)
+
+	results := updater.RefreshFeeds(context.Background(), feeds)
+	require.Len(t, results, 1)
+	assert.EqualError(t, results[0].Err, "connection refused")
+	assert.False(t, results[0].Modified)
+	assert.Equal(t, 1, stub.calls, "fetchers without FetchFeedNow fall back to FetchFeed")
+
+	feeds, err = store.GetAllFeeds()
+	require.NoError(t, err)
+	assert.Equal(t, 1, feeds[0].ConsecutiveFailures)
+}
+
+func TestUpdateFeeds_PublishesEvents(t *testing.T) {
+	store, cleanup := newUpdaterTestStore(t)
+	t.Cleanup(cleanup)
+
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+
+	bus := events.NewBus()
+	received, unsubscribe := bus.Subscribe()
+	defer unsubscribe()
+
+	stub := &stubFetcher{err: errors.New("boom")}
+	updater := NewUpdaterWithFetcher(store, 30*time.Minute, 100, stub)
+	updater.SetEventBus(bus)
+
+	// A failure changes the feed's health.
+	feeds, err := store.GetAllFeeds()
+	require.NoError(t, err)
+	updater.RefreshFeeds(context.Background(), feeds)
+	require.Len(t, received, 1)
+	assert.Equal(t, events.Event{Kind: events.HealthChanged, FeedID: feedID}, <-received)
+
+	// Recovering with new posts reports both.
+	stub.err = nil
+	stub.content = &FeedContent{Title: "Feed", Items: []FeedItem{{GUID: "1", Title: "Post", Link: "https://example.com/1"}}}
+	feeds, err = store.GetAllFeeds()
+	require.NoError(t, err)
+	updater.RefreshFeeds(context.Background(), feeds)
+	require.Len(t, received, 2)
+	assert.Equal(t, events.Event{Kind: events.HealthChanged, FeedID: feedID}, <-received)
+	assert.Equal(t, events.Event{Kind: events.PostsAdded, FeedID: feedID}, <-received)
+
+	// Fetching the same posts again publishes nothing.
+	feeds, err = store.GetAllFeeds()
+	require.NoError(t, err)
+	updater.RefreshFeeds(context.Background(), feeds)
+	assert.Empty(t, received)
+}
+
+func TestUpdateFeeds_PublishesUpdatedPosts(t *testing.T) {
+	store, cleanup := newUpdaterTestStore(t)
+	t.Cleanup(cleanup)
+
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+	require.NoError(t, store.AddPost(feedID, "1", "Typo", "https://example.com/1", time.Now(), ""))
+
+	bus := events.NewBus()
+	received, unsubscribe := bus.Subscribe()
+	defer unsubscribe()
+
+	stub := &stubFetcher{content: &FeedContent{Title: "Feed", Items: []FeedItem{{GUID: "1", Title: "Fixed", Link: "https://example.com/1"}}}}
+	updater := NewUpdaterWithFetcher(store, 30*time.Minute, 100, stub)
+	updater.SetEventBus(bus)
+
+	feeds, err := store.GetAllFeeds()
+	require.NoError(t, err)
+	updater.RefreshFeeds(context.Background(), feeds)
+
+	require.Len(t, received, 1)
+	assert.Equal(t, events.Event{Kind: events.PostsUpdated, FeedID: feedID}, <-received)
+	posts, err := store.GetFeedPosts(feedID, userID, 10)
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	assert.Equal(t, "Fixed", posts[0].Title)
+}
+
+func TestUpdateFeeds_AppliesMarkSeenFilterRules(t *testing.T) {
+	store, cleanup := newUpdaterTestStore(t)
+	t.Cleanup(cleanup)
+
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	otherID, err := store.GetOrCreateUser("other", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+	_, err = store.AddFeedForUser(otherID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+	_, err = store.CreateFilterRuleForUser(userID, db.FilterRule{
+		Field: db.FilterFieldAuthor, Pattern: "bot", Action: db.FilterActionMarkSeen,
+	})
+	require.NoError(t, err)
+
+	content := &FeedContent{Title: "Test Feed", Items: []FeedItem{
+		{GUID: "1", Title: "Automated digest", Link: "https://example.com/1", Author: "Release Bot", PublishedAt: time.Now().Add(-time.Hour)},
+		{GUID: "2", Title: "Hand written", Link: "https://example.com/2", Author: "Jo", PublishedAt: time.Now()},
+	}}
+	updater := NewUpdaterWithFetcher(store, 30*time.Minute, 100, &stubFetcher{content: content})
+	require.NoError(t, updater.updateFeeds(context.Background()))
+
+	posts, err := store.GetFeedPosts(feedID, userID, 10)
+	require.NoError(t, err)
+	require.Len(t, posts, 2)
+	assert.False(t, posts[0].Seen)
+	assert.True(t, posts[1].Seen, "the bot's post should be marked as seen")
+
+	// Other subscribers are not affected by the rule.
+	posts, err = store.GetFeedPosts(feedID, otherID, 10)
+	require.NoError(t, err)
+	require.Len(t, posts, 2)
+	assert.False(t, posts[1].Seen)
+}
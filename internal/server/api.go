@@ -0,0 +1,529 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aggregat4/rssgrid/internal/db"
+	"github.com/aggregat4/rssgrid/internal/feed"
+	"github.com/go-chi/chi/v5"
+)
+
+// maxAPIPostsLimit caps the number of posts returned by one API request.
+const maxAPIPostsLimit = 200
+
+// maxAPIRequestBodySize caps the size of JSON request bodies.
+const maxAPIRequestBodySize = 1 << 20
+
+type apiUserIDKey struct{}
+
+// apiFeed is the JSON representation of a subscribed feed.
+type apiFeed struct {
+	ID                  int64      `json:"id"`
+	URL                 string     `json:"url"`
+	Title               string     `json:"title"`
+	LastFetchedAt       *time.Time `json:"last_fetched_at"`
+	LastSuccessAt       *time.Time `json:"last_success_at"`
+	LastError           string     `json:"last_error,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	Unread              int        `json:"unread"`
+}
+
+// apiPost is the JSON representation of a post.
+type apiPost struct {
+	ID          int64      `json:"id"`
+	Title       string     `json:"title"`
+	Link        string     `json:"link"`
+	PublishedAt *time.Time `json:"published_at"`
+	UpdatedAt   *time.Time `json:"updated_at"`
+	Content     string     `json:"content"`
+	Seen        bool       `json:"seen"`
+	Starred     bool       `json:"starred"`
+}
+
+// apiPreferences is the JSON representation of a user's preferences. On
+// update, omitted fields are left unchanged.
+type apiPreferences struct {
+	PostsPerFeed   *int  `json:"posts_per_feed"`
+	Columns        *int  `json:"columns"`
+	UnseenOnUpdate *bool `json:"unseen_on_update"`
+	HideRead       *bool `json:"hide_read"`
+}
+
+type apiError struct {
+	Error      string               `json:"error"`
+	Candidates []feed.FeedCandidate `json:"candidates,omitempty"`
+}
+
+// optionalTime maps the zero time to a JSON null.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func toAPIFeed(f db.Feed, unread int) apiFeed {
+	return apiFeed{
+		ID:                  f.ID,
+		URL:                 f.URL,
+		Title:               f.Title,
+		LastFetchedAt:       optionalTime(f.LastFetchedAt),
+		LastSuccessAt:       optionalTime(f.LastSuccessAt),
+		LastError:           f.LastError,
+		ConsecutiveFailures: f.ConsecutiveFailures,
+		Unread:              unread,
+	}
+}
+
+func toAPIPost(p db.Post) apiPost {
+	return apiPost{
+		ID:          p.ID,
+		Title:       p.Title,
+		Link:        p.Link,
+		PublishedAt: optionalTime(p.PublishedAt),
+		UpdatedAt:   optionalTime(p.UpdatedAt),
+		Content:     p.Content,
+		Seen:        p.Seen,
+		Starred:     p.Starred,
+	}
+}
+
+func (s *Server) apiRoutes(r chi.Router) {
+	r.Use(s.apiAuthMiddleware)
+
+	r.Get("/feeds", s.handleAPIListFeeds)
+	r.Post("/feeds", s.handleAPISubscribe)
+	r.Get("/feeds/{feedId}", s.handleAPIGetFeed)
+	r.Delete("/feeds/{feedId}", s.handleAPIUnsubscribe)
+	r.Get("/feeds/{feedId}/posts", s.handleAPIListPosts)
+	r.Post("/feeds/{feedId}/seen", s.handleAPIMarkFeedSeen)
+	r.Get("/posts/{postId}", s.handleAPIGetPost)
+	r.Post("/posts/{postId}/seen", s.handleAPIMarkPostSeen)
+	r.Get("/starred", s.handleAPIListStarred)
+	r.Put("/posts/{postId}/star", s.handleAPISetPostStarred(true))
+	r.Delete("/posts/{postId}/star", s.handleAPISetPostStarred(false))
+	r.Get("/preferences", s.handleAPIGetPreferences)
+	r.Put("/preferences", s.handleAPIUpdatePreferences)
+}
+
+// apiAuthMiddleware authenticates API requests with a personal access token
+// passed as "Authorization: Bearer <token>".
+func (s *Server) apiAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		token = strings.TrimSpace(token)
+		if !ok || token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="rssgrid"`)
+			writeAPIError(w, http.StatusUnauthorized, "missing bearer token")
+			return
+		}
+
+		userId, err := s.store.GetUserIDForAPIToken(token)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				log.Printf("Error looking up API token: %v\nStack trace:\n%s", err, debug.Stack())
+				writeAPIError(w, http.StatusInternalServerError, "error authenticating request")
+				return
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="rssgrid", error="invalid_token"`)
+			writeAPIError(w, http.StatusUnauthorized, "invalid or revoked token")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiUserIDKey{}, userId)))
+	})
+}
+
+// apiUserID returns the user authenticated by apiAuthMiddleware.
+func apiUserID(r *http.Request) int64 {
+	userId, _ := r.Context().Value(apiUserIDKey{}).(int64)
+	return userId
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Error encoding JSON response: %v", err)
+	}
+}
+
+func writeAPIError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, apiError{Error: message})
+}
+
+// apiInternalError logs err with context and responds with a generic 500.
+func apiInternalError(w http.ResponseWriter, logMessage string, err error, context ...interface{}) {
+	log.Printf("%s: %v\nContext: %v\nStack trace:\n%s", logMessage, err, context, debug.Stack())
+	writeAPIError(w, http.StatusInternalServerError, "internal server error")
+}
+
+// apiIDParam parses a numeric URL parameter, responding with 400 if invalid.
+func apiIDParam(w http.ResponseWriter, r *http.Request, name string) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, name), 10, 64)
+	if err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid "+name)
+		return 0, false
+	}
+	return id, true
+}
+
+// decodeJSONBody decodes the request body into v, responding with 400 if it
+// is not valid JSON.
+func decodeJSONBody(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxAPIRequestBodySize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid JSON body: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// findUserFeed returns the user's subscription to feedId, or sql.ErrNoRows if
+// the user is not subscribed to it.
+func (s *Server) findUserFeed(userId, feedId int64) (*db.Feed, error) {
+	feeds, err := s.store.GetUserFeeds(userId)
+	if err != nil {
+		return nil, err
+	}
+	for i := range feeds {
+		if feeds[i].ID == feedId {
+			return &feeds[i], nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *Server) handleAPIListFeeds(w http.ResponseWriter, r *http.Request) {
+	userId := apiUserID(r)
+
+	feeds, err := s.store.GetUserFeeds(userId)
+	if err != nil {
+		apiInternalError(w, "Error fetching feeds for user", err, "userId", userId)
+		return
+	}
+
+	unreadCounts, err := s.store.GetUnreadCountsForUser(userId)
+	if err != nil {
+		apiInternalError(w, "Error fetching unread counts for user", err, "userId", userId)
+		return
+	}
+
+	result := make([]apiFeed, 0, len(feeds))
+	for _, f := range feeds {
+		result = append(result, toAPIFeed(f, unreadCounts[f.ID]))
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) handleAPIGetFeed(w http.ResponseWriter, r *http.Request) {
+	feedId, ok := apiIDParam(w, r, "feedId")
+	if !ok {
+		return
+	}
+	userId := apiUserID(r)
+
+	f, err := s.findUserFeed(userId, feedId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeAPIError(w, http.StatusNotFound, "feed not found")
+			return
+		}
+		apiInternalError(w, "Error fetching feed for user", err, "feedId", feedId, "userId", userId)
+		return
+	}
+	unreadCounts, err := s.store.GetUnreadCountsForUser(userId)
+	if err != nil {
+		apiInternalError(w, "Error fetching unread counts for user", err, "userId", userId)
+		return
+	}
+	writeJSON(w, http.StatusOK, toAPIFeed(*f, unreadCounts[f.ID]))
+}
+
+func (s *Server) handleAPISubscribe(w http.ResponseWriter, r *http.Request) {
+	userId := apiUserID(r)
+
+	var body struct {
+		URL string `json:"url"`
+	}
+	if !decodeJSONBody(w, r, &body) {
+		return
+	}
+	if !isValidFeedURL(body.URL) {
+		writeAPIError(w, http.StatusBadRequest, "url must be an absolute http(s) URL")
+		return
+	}
+
+	feedURL, content, candidates, err := s.fetchOrDiscoverFeed(r.Context(), body.URL)
+	if len(candidates) > 0 {
+		writeJSON(w, http.StatusUnprocessableEntity, apiError{
+			Error:      "the page advertises several feeds; subscribe to one of the candidates",
+			Candidates: candidates,
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching feed from URL: %v\nContext: [url %s]", err, body.URL)
+		writeAPIError(w, http.StatusUnprocessableEntity, "invalid feed URL or unable to fetch feed")
+		return
+	}
+
+	feedId, err := s.subscribeToFetchedFeed(userId, feedURL, content)
+	if err != nil {
+		apiInternalError(w, "Error adding feed for user", err, "url", feedURL, "userId", userId)
+		return
+	}
+
+	f, err := s.findUserFeed(userId, feedId)
+	if err != nil {
+		apiInternalError(w, "Error fetching new feed for user", err, "feedId", feedId, "userId", userId)
+		return
+	}
+	writeJSON(w, http.StatusCreated, toAPIFeed(*f, 0))
+}
+
+func (s *Server) handleAPIUnsubscribe(w http.ResponseWriter, r *http.Request) {
+	feedId, ok := apiIDParam(w, r, "feedId")
+	if !ok {
+		return
+	}
+	userId := apiUserID(r)
+
+	if err := s.store.DeleteFeedForUser(userId, feedId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeAPIError(w, http.StatusNotFound, "feed not found")
+			return
+		}
+		apiInternalError(w, "Error deleting feed for user", err, "feedId", feedId, "userId", userId)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleAPIListPosts(w http.ResponseWriter, r *http.Request) {
+	feedId, ok := apiIDParam(w, r, "feedId")
+	if !ok {
+		return
+	}
+	userId := apiUserID(r)
+
+	// GetFeedPosts is not scoped to subscriptions, so check that first.
+	if _, err := s.findUserFeed(userId, feedId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeAPIError(w, http.StatusNotFound, "feed not found")
+			return
+		}
+		apiInternalError(w, "Error fetching feed for user", err, "feedId", feedId, "userId", userId)
+		return
+	}
+
+	var limit int
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxAPIPostsLimit {
+			writeAPIError(w, http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxAPIPostsLimit))
+			return
+		}
+	} else {
+		postsPerFeed, err := s.store.GetUserPostsPerFeed(userId)
+		if err != nil {
+			apiInternalError(w, "Error fetching posts per feed preference", err, "userId", userId)
+			return
+		}
+		limit = postsPerFeed
+	}
+
+	posts, err := s.store.GetFeedPosts(feedId, userId, limit)
+	if err != nil {
+		apiInternalError(w, "Error fetching posts for feed", err, "feedId", feedId, "userId", userId)
+		return
+	}
+
+	result := make([]apiPost, 0, len(posts))
+	for _, p := range posts {
+		result = append(result, toAPIPost(p))
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (s *Server) handleAPIMarkFeedSeen(w http.ResponseWriter, r *http.Request) {
+	feedId, ok := apiIDParam(w, r, "feedId")
+	if !ok {
+		return
+	}
+	userId := apiUserID(r)
+
+	if err := s.store.MarkAllFeedPostsAsSeenForUser(userId, feedId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeAPIError(w, http.StatusNotFound, "feed not found")
+			return
+		}
+		apiInternalError(w, "Error marking all posts as seen for feed", err, "feedId", feedId, "userId", userId)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleAPIGetPost(w http.ResponseWriter, r *http.Request) {
+	postId, ok := apiIDParam(w, r, "postId")
+	if !ok {
+		return
+	}
+	userId := apiUserID(r)
+
+	post, err := s.store.GetPostForUser(userId, postId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeAPIError(w, http.StatusNotFound, "post not found")
+			return
+		}
+		apiInternalError(w, "Error fetching post for user", err, "postId", postId, "userId", userId)
+		return
+	}
+	writeJSON(w, http.StatusOK, toAPIPost(*post))
+}
+
+func (s *Server) handleAPIMarkPostSeen(w http.ResponseWriter, r *http.Request) {
+	postId, ok := apiIDParam(w, r, "postId")
+	if !ok {
+		return
+	}
+	userId := apiUserID(r)
+
+	if err := s.store.MarkPostAsSeenForUser(userId, postId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeAPIError(w, http.StatusNotFound, "post not found")
+			return
+		}
+		apiInternalError(w, "Error marking post as seen for user", err, "postId", postId, "userId", userId)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleAPIListStarred(w http.ResponseWriter, r *http.Request) {
+	userId := apiUserID(r)
+
+	posts, err := s.store.GetStarredPostsForUser(userId)
+	if err != nil {
+		apiInternalError(w, "Error fetching starred posts for user", err, "userId", userId)
+		return
+	}
+	result := make([]apiPost, 0, len(posts))
+	for _, p := range posts {
+		result = append(result, toAPIPost(p.Post))
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// handleAPISetPostStarred returns a handler that stars or unstars a post.
+func (s *Server) handleAPISetPostStarred(starred bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		postId, ok := apiIDParam(w, r, "postId")
+		if !ok {
+			return
+		}
+		userId := apiUserID(r)
+
+		if err := s.store.SetPostStarredForUser(userId, postId, starred); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				writeAPIError(w, http.StatusNotFound, "post not found")
+				return
+			}
+			apiInternalError(w, "Error setting post starred state for user", err, "postId", postId, "userId", userId)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func (s *Server) apiPreferences(userId int64) (apiPreferences, error) {
+	postsPerFeed, err := s.store.GetUserPostsPerFeed(userId)
+	if err != nil {
+		return apiPreferences{}, err
+	}
+	columns, err := s.store.GetUserColumns(userId)
+	if err != nil {
+		return apiPreferences{}, err
+	}
+	unseenOnUpdate, err := s.store.GetUserUnseenOnUpdate(userId)
+	if err != nil {
+		return apiPreferences{}, err
+	}
+	hideRead, err := s.store.GetUserHideRead(userId)
+	if err != nil {
+		return apiPreferences{}, err
+	}
+	return apiPreferences{PostsPerFeed: &postsPerFeed, Columns: &columns, UnseenOnUpdate: &unseenOnUpdate, HideRead: &hideRead}, nil
+}
+
+func (s *Server) handleAPIGetPreferences(w http.ResponseWriter, r *http.Request) {
+	userId := apiUserID(r)
+
+	prefs, err := s.apiPreferences(userId)
+	if err != nil {
+		apiInternalError(w, "Error fetching preferences for user", err, "userId", userId)
+		return
+	}
+	writeJSON(w, http.StatusOK, prefs)
+}
+
+func (s *Server) handleAPIUpdatePreferences(w http.ResponseWriter, r *http.Request) {
+	userId := apiUserID(r)
+
+	var body apiPreferences
+	if !decodeJSONBody(w, r, &body) {
+		return
+	}
+	if body.PostsPerFeed != nil && *body.PostsPerFeed < 1 {
+		writeAPIError(w, http.StatusBadRequest, "posts_per_feed must be at least 1")
+		return
+	}
+	if body.Columns != nil && *body.Columns < 1 {
+		writeAPIError(w, http.StatusBadRequest, "columns must be at least 1")
+		return
+	}
+
+	if body.PostsPerFeed != nil {
+		if err := s.store.SetUserPostsPerFeed(userId, *body.PostsPerFeed); err != nil {
+			apiInternalError(w, "Error updating posts per feed for user", err, "userId", userId)
+			return
+		}
+	}
+	if body.Columns != nil {
+		if err := s.store.SetUserColumns(userId, *body.Columns); err != nil {
+			apiInternalError(w, "Error updating columns for user", err, "userId", userId)
+			return
+		}
+	}
+	if body.UnseenOnUpdate != nil {
+		if err := s.store.SetUserUnseenOnUpdate(userId, *body.UnseenOnUpdate); err != nil {
+			apiInternalError(w, "Error updating unseen on update for user", err, "userId", userId)
+			return
+		}
+	}
+	if body.HideRead != nil {
+		if err := s.store.SetUserHideRead(userId, *body.HideRead); err != nil {
+			apiInternalError(w, "Error updating hide read for user", err, "userId", userId)
+			return
+		}
+	}
+
+	prefs, err := s.apiPreferences(userId)
+	if err != nil {
+		apiInternalError(w, "Error fetching preferences for user", err, "userId", userId)
+		return
+	}
+	writeJSON(w, http.StatusOK, prefs)
+}
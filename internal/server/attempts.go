@@ -0,0 +1,95 @@
+package server
+
+import (
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Limits on failed password sign-ins and registrations. Failures are counted
+// per client address and, for sign-ins, per username, so guessing is slow
+// whether it targets one account from many addresses or many accounts from
+// one address.
+const (
+	maxLoginFailuresPerAddress    = 20
+	maxLoginFailuresPerUsername   = 10
+	maxRegisterFailuresPerAddress = 10
+	attemptWindow                 = 15 * time.Minute
+)
+
+// attemptLimiter counts failures per key over a fixed window and reports when
+// a key has failed too often. It is safe for concurrent use.
+type attemptLimiter struct {
+	max    int
+	window time.Duration
+	now    func() time.Time
+
+	mu       sync.Mutex
+	failures map[string]*failureCount
+}
+
+type failureCount struct {
+	count int
+	start time.Time
+}
+
+func newAttemptLimiter(max int, window time.Duration) *attemptLimiter {
+	return &attemptLimiter{
+		max:      max,
+		window:   window,
+		now:      time.Now,
+		failures: make(map[string]*failureCount),
+	}
+}
+
+// Allowed reports whether key may make another attempt.
+func (l *attemptLimiter) Allowed(key string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, ok := l.failures[key]
+	if !ok || l.now().Sub(f.start) >= l.window {
+		return true
+	}
+	return f.count < l.max
+}
+
+// Fail records a failed attempt by key.
+func (l *attemptLimiter) Fail(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	f, ok := l.failures[key]
+	if !ok || now.Sub(f.start) >= l.window {
+		l.prune(now)
+		f = &failureCount{start: now}
+		l.failures[key] = f
+	}
+	f.count++
+}
+
+// Reset forgets the failures of key, e.g. after it succeeded.
+func (l *attemptLimiter) Reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.failures, key)
+}
+
+// prune drops expired windows so that the map does not grow without bound.
+func (l *attemptLimiter) prune(now time.Time) {
+	for key, f := range l.failures {
+		if now.Sub(f.start) >= l.window {
+			delete(l.failures, key)
+		}
+	}
+}
+
+// clientAddress is the address a request came from. Forwarding headers are
+// ignored since clients can set them to anything.
+func clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
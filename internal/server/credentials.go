@@ -0,0 +1,92 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aggregat4/rssgrid/internal/db"
+	"github.com/go-chi/chi/v5"
+)
+
+// maxCustomHeaders caps the custom request headers of a feed.
+const maxCustomHeaders = 20
+
+// headerNamePattern matches the characters allowed in an HTTP header name.
+var headerNamePattern = regexp.MustCompile("^[!#$%&'*+.^_`|~0-9A-Za-z-]+$")
+
+// parseCustomHeaders parses one "Name: value" header per line, skipping
+// blank lines.
+func parseCustomHeaders(value string) ([]db.FeedHeader, error) {
+	var headers []db.FeedHeader
+	for _, line := range strings.Split(value, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		name, headerValue, ok := strings.Cut(line, ":")
+		name = strings.TrimSpace(name)
+		if !ok || !headerNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("%q is not a header of the form \"Name: value\"", line)
+		}
+		headers = append(headers, db.FeedHeader{Name: name, Value: strings.TrimSpace(headerValue)})
+	}
+	if len(headers) > maxCustomHeaders {
+		return nil, fmt.Errorf("a feed may have at most %d custom headers", maxCustomHeaders)
+	}
+	return headers, nil
+}
+
+// handleSetFeedCredentials replaces the credentials a feed is fetched with by
+// the ones in the form, or removes them when the form is sent with "clear".
+// Setting credentials makes the feed private to the user.
+func (s *Server) handleSetFeedCredentials(w http.ResponseWriter, r *http.Request) {
+	feedId, err := strconv.ParseInt(chi.URLParam(r, "feedId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid feed ID format", http.StatusBadRequest)
+		return
+	}
+
+	userId := s.getUserID(r)
+
+	var creds db.FeedCredentials
+	if r.FormValue("clear") == "" {
+		headers, err := parseCustomHeaders(r.FormValue("headers"))
+		if err != nil {
+			s.addErrorFlash(w, r, "Could not save credentials: "+err.Error())
+			http.Redirect(w, r, "/settings", http.StatusSeeOther)
+			return
+		}
+		creds = db.FeedCredentials{
+			Username:    strings.TrimSpace(r.FormValue("username")),
+			Password:    r.FormValue("password"),
+			BearerToken: strings.TrimSpace(r.FormValue("bearerToken")),
+			Cookie:      strings.TrimSpace(r.FormValue("cookie")),
+			Headers:     headers,
+		}
+	}
+
+	if _, err := s.store.SetFeedCredentialsForUser(userId, feedId, creds); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			http.Error(w, "Feed not found", http.StatusNotFound)
+		case errors.Is(err, db.ErrNoCredentialsKey):
+			s.addErrorFlash(w, r, "Feed credentials cannot be stored until a credentials_key is configured.")
+			http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		default:
+			s.logErrorAndRespond(w, http.StatusInternalServerError, "Error saving credentials", "Error setting feed credentials for user", err, "feedId", feedId, "userId", userId)
+		}
+		return
+	}
+
+	if creds.IsZero() {
+		s.addSuccessFlash(w, r, "Feed credentials removed.")
+	} else {
+		s.addSuccessFlash(w, r, "Feed credentials saved. The feed will be fetched with them shortly.")
+	}
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
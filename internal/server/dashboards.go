@@ -0,0 +1,151 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/aggregat4/rssgrid/internal/db"
+	"github.com/go-chi/chi/v5"
+)
+
+// maxDashboardNameLength bounds dashboard names so tabs stay readable.
+const maxDashboardNameLength = 50
+
+// dashboardSettings is a dashboard with its feeds as listed on the settings
+// page.
+type dashboardSettings struct {
+	Dashboard db.Dashboard
+	Feeds     []db.Feed
+}
+
+// feedPlacement tells whether a feed is on a dashboard, for the dashboard
+// checkboxes of a feed on the settings page.
+type feedPlacement struct {
+	Dashboard db.Dashboard
+	Placed    bool
+}
+
+// dashboardName validates a submitted dashboard name, adding an error flash
+// if it is unusable.
+func (s *Server) dashboardName(w http.ResponseWriter, r *http.Request) (string, bool) {
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" || len(name) > maxDashboardNameLength {
+		s.addErrorFlash(w, r, fmt.Sprintf("Dashboard name is required and may be at most %d characters", maxDashboardNameLength))
+		return "", false
+	}
+	return name, true
+}
+
+func (s *Server) handleCreateDashboard(w http.ResponseWriter, r *http.Request) {
+	userId := s.getUserID(r)
+
+	name, ok := s.dashboardName(w, r)
+	if !ok {
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		return
+	}
+
+	dashboardId, err := s.store.CreateDashboardForUser(userId, name)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error creating dashboard", "Error creating dashboard for user", err, "userId", userId)
+		return
+	}
+
+	s.addSuccessFlash(w, r, fmt.Sprintf("Dashboard %q created. Choose which feeds to show on it below.", name))
+	http.Redirect(w, r, "/settings#dashboard-"+strconv.FormatInt(dashboardId, 10), http.StatusSeeOther)
+}
+
+func (s *Server) handleRenameDashboard(w http.ResponseWriter, r *http.Request) {
+	dashboardId, err := strconv.ParseInt(chi.URLParam(r, "dashboardId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid dashboard ID format", http.StatusBadRequest)
+		return
+	}
+
+	userId := s.getUserID(r)
+
+	name, ok := s.dashboardName(w, r)
+	if !ok {
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		return
+	}
+
+	if err := s.store.RenameDashboardForUser(userId, dashboardId, name); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Dashboard not found", http.StatusNotFound)
+			return
+		}
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error renaming dashboard", "Error renaming dashboard for user", err, "dashboardId", dashboardId, "userId", userId)
+		return
+	}
+
+	s.addSuccessFlash(w, r, "Dashboard renamed.")
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
+
+func (s *Server) handleDeleteDashboard(w http.ResponseWriter, r *http.Request) {
+	dashboardId, err := strconv.ParseInt(chi.URLParam(r, "dashboardId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid dashboard ID format", http.StatusBadRequest)
+		return
+	}
+
+	userId := s.getUserID(r)
+
+	if err := s.store.DeleteDashboardForUser(userId, dashboardId); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			http.Error(w, "Dashboard not found", http.StatusNotFound)
+		case errors.Is(err, db.ErrLastDashboard):
+			s.addErrorFlash(w, r, "You need at least one dashboard.")
+			http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		default:
+			s.logErrorAndRespond(w, http.StatusInternalServerError, "Error deleting dashboard", "Error deleting dashboard for user", err, "dashboardId", dashboardId, "userId", userId)
+		}
+		return
+	}
+
+	s.addSuccessFlash(w, r, "Dashboard deleted. Its feeds are still subscribed.")
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
+
+// handleSetFeedDashboards places a feed on the dashboards checked in the form.
+func (s *Server) handleSetFeedDashboards(w http.ResponseWriter, r *http.Request) {
+	feedId, err := strconv.ParseInt(chi.URLParam(r, "feedId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid feed ID format", http.StatusBadRequest)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+
+	var dashboardIds []int64
+	for _, value := range r.PostForm["dashboard"] {
+		dashboardId, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid dashboard ID format", http.StatusBadRequest)
+			return
+		}
+		dashboardIds = append(dashboardIds, dashboardId)
+	}
+
+	userId := s.getUserID(r)
+
+	if err := s.store.SetFeedDashboardsForUser(userId, feedId, dashboardIds); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Feed or dashboard not found", http.StatusNotFound)
+			return
+		}
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error updating dashboards", "Error setting feed dashboards for user", err, "feedId", feedId, "userId", userId)
+		return
+	}
+
+	s.addSuccessFlash(w, r, "Feed dashboards updated.")
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
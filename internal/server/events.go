@@ -0,0 +1,128 @@
+package server
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/aggregat4/rssgrid/internal/events"
+)
+
+// sseKeepaliveInterval is how often an idle event stream sends a comment so
+// proxies do not time out the connection.
+const sseKeepaliveInterval = 30 * time.Second
+
+// widgetUpdate is the payload of a "widget" event: the freshly rendered
+// widget for one feed.
+type widgetUpdate struct {
+	FeedID int64       `json:"feedId"`
+	Kind   events.Kind `json:"kind"`
+	HTML   string      `json:"html"`
+}
+
+// handleEvents streams server-sent events to the dashboard. Whenever one of
+// the user's feeds gets new posts or changes health, the feed's widget is
+// re-rendered for the user and sent as a "widget" event.
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	if s.events == nil {
+		http.Error(w, "Live updates are not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	userId := s.getUserID(r)
+	rc := http.NewResponseController(w)
+
+	updates, unsubscribe := s.events.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		log.Printf("Event stream for user %d does not support flushing: %v", userId, err)
+		return
+	}
+
+	keepalive := time.NewTicker(sseKeepaliveInterval)
+	defer keepalive.Stop()
+
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.shuttingDown:
+			return
+		case <-keepalive.C:
+			_, err = fmt.Fprint(w, ": keepalive\n\n")
+		case event, ok := <-updates:
+			if !ok {
+				return
+			}
+			err = s.writeWidgetEvent(w, userId, event)
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			log.Printf("Closing event stream for user %d: %v", userId, err)
+			return
+		}
+	}
+}
+
+// writeWidgetEvent sends the user's current rendering of the event's feed.
+// Events for feeds the user is not subscribed to are skipped, as are feeds
+// that cannot be rendered right now; only write errors are returned.
+func (s *Server) writeWidgetEvent(w http.ResponseWriter, userId int64, event events.Event) error {
+	f, err := s.findUserFeed(userId, event.FeedID)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Error looking up feed %d for user %d: %v", event.FeedID, userId, err)
+		}
+		return nil
+	}
+
+	postsPerFeed, err := s.store.GetUserPostsPerFeed(userId)
+	if err != nil {
+		log.Printf("Error fetching posts per feed preference for user %d: %v", userId, err)
+		return nil
+	}
+	posts, err := s.store.GetFeedPosts(f.ID, userId, feedPostLimit(*f, postsPerFeed))
+	if err != nil {
+		log.Printf("Error fetching posts for feed %d, user %d: %v", f.ID, userId, err)
+		return nil
+	}
+
+	hideRead, err := s.store.GetUserHideRead(userId)
+	if err != nil {
+		log.Printf("Error fetching hide read preference for user %d: %v", userId, err)
+		return nil
+	}
+	unreadCounts, err := s.store.GetUnreadCountsForUser(userId)
+	if err != nil {
+		log.Printf("Error fetching unread counts for user %d: %v", userId, err)
+		return nil
+	}
+
+	widget := widgetData{Feed: *f, Posts: posts, Unread: unreadCounts[f.ID], AlwaysHideRead: hideRead}
+	var html bytes.Buffer
+	if err := s.templates.ExecuteTemplate(&html, "widget", widget); err != nil {
+		log.Printf("Error rendering widget for feed %d: %v", f.ID, err)
+		return nil
+	}
+
+	payload, err := json.Marshal(widgetUpdate{FeedID: f.ID, Kind: event.Kind, HTML: html.String()})
+	if err != nil {
+		log.Printf("Error encoding widget update for feed %d: %v", f.ID, err)
+		return nil
+	}
+	_, err = fmt.Fprintf(w, "event: widget\ndata: %s\n\n", payload)
+	return err
+}
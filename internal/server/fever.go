@@ -0,0 +1,387 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aggregat4/rssgrid/internal/db"
+)
+
+// The Fever API (https://feedafever.com/api) is a small read-and-mark sync
+// protocol spoken by many mobile feed readers. Clients POST to /fever/?api
+// with an api_key of md5(username:password) and add query flags naming what
+// they want back. Dashboards are exposed as Fever groups.
+
+// feverAPIVersion is the version of the Fever API we implement.
+const feverAPIVersion = 3
+
+// maxFeverItems is the number of items returned per request, fixed by the
+// Fever API.
+const maxFeverItems = 50
+
+type feverGroup struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+}
+
+type feverFeedsGroup struct {
+	GroupID int64  `json:"group_id"`
+	FeedIDs string `json:"feed_ids"`
+}
+
+type feverFeed struct {
+	ID                int64  `json:"id"`
+	FaviconID         int64  `json:"favicon_id"`
+	Title             string `json:"title"`
+	URL               string `json:"url"`
+	SiteURL           string `json:"site_url"`
+	IsSpark           int    `json:"is_spark"`
+	LastUpdatedOnTime int64  `json:"last_updated_on_time"`
+}
+
+type feverItem struct {
+	ID            int64  `json:"id"`
+	FeedID        int64  `json:"feed_id"`
+	Title         string `json:"title"`
+	Author        string `json:"author"`
+	HTML          string `json:"html"`
+	URL           string `json:"url"`
+	IsSaved       int    `json:"is_saved"`
+	IsRead        int    `json:"is_read"`
+	CreatedOnTime int64  `json:"created_on_time"`
+}
+
+// feverBool maps a boolean to the 0 or 1 Fever expects.
+func feverBool(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// feverTime maps a time to Unix seconds, with 0 for the zero time.
+func feverTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// feverIDList joins ids into the comma-separated string Fever uses.
+func feverIDList(ids []int64) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+// feverSiteURL guesses a feed's web site from its URL.
+func feverSiteURL(feedURL string) string {
+	u, err := url.Parse(feedURL)
+	if err != nil || u.Host == "" {
+		return feedURL
+	}
+	return u.Scheme + "://" + u.Host + "/"
+}
+
+func (s *Server) handleFever(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	has := func(name string) bool {
+		_, ok := r.Form[name]
+		return ok
+	}
+
+	response := map[string]any{"api_version": feverAPIVersion, "auth": 0}
+	apiKey := r.FormValue("api_key")
+	if apiKey == "" {
+		writeJSON(w, http.StatusOK, response)
+		return
+	}
+	userId, err := s.store.GetUserIDForFeverAPIKey(apiKey)
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			apiInternalError(w, "Error looking up Fever API key", err)
+			return
+		}
+		writeJSON(w, http.StatusOK, response)
+		return
+	}
+	response["auth"] = 1
+
+	// Writes come first so the reads below reflect them.
+	wantUnread, wantSaved := has("unread_item_ids"), has("saved_item_ids")
+	if has("mark") {
+		readChanged, savedChanged, err := s.feverMark(userId, r)
+		if err != nil {
+			apiInternalError(w, "Error marking Fever items", err, "userId", userId)
+			return
+		}
+		wantUnread = wantUnread || readChanged
+		wantSaved = wantSaved || savedChanged
+	}
+
+	feeds, err := s.store.GetUserFeeds(userId)
+	if err != nil {
+		apiInternalError(w, "Error fetching feeds for Fever", err, "userId", userId)
+		return
+	}
+	var lastRefreshed time.Time
+	for _, f := range feeds {
+		if f.LastFetchedAt.After(lastRefreshed) {
+			lastRefreshed = f.LastFetchedAt
+		}
+	}
+	response["last_refreshed_on_time"] = feverTime(lastRefreshed)
+
+	if has("groups") || has("feeds") {
+		groups, feedsGroups, err := s.feverGroups(userId)
+		if err != nil {
+			apiInternalError(w, "Error fetching dashboards for Fever", err, "userId", userId)
+			return
+		}
+		if has("groups") {
+			response["groups"] = groups
+		}
+		response["feeds_groups"] = feedsGroups
+	}
+
+	if has("feeds") {
+		feverFeeds := make([]feverFeed, 0, len(feeds))
+		for _, f := range feeds {
+			feverFeeds = append(feverFeeds, feverFeed{
+				ID:                f.ID,
+				Title:             f.Title,
+				URL:               f.URL,
+				SiteURL:           feverSiteURL(f.URL),
+				LastUpdatedOnTime: feverTime(f.LastFetchedAt),
+			})
+		}
+		response["feeds"] = feverFeeds
+	}
+
+	if has("favicons") {
+		response["favicons"] = []any{}
+	}
+	if has("links") {
+		response["links"] = []any{}
+	}
+
+	if has("items") {
+		items, total, err := s.feverItems(userId, r)
+		if err != nil {
+			apiInternalError(w, "Error fetching Fever items", err, "userId", userId)
+			return
+		}
+		response["items"] = items
+		response["total_items"] = total
+	}
+
+	if wantUnread {
+		ids, err := s.store.GetUnreadPostIDsForUser(userId)
+		if err != nil {
+			apiInternalError(w, "Error fetching unread posts for Fever", err, "userId", userId)
+			return
+		}
+		response["unread_item_ids"] = feverIDList(ids)
+	}
+	if wantSaved {
+		ids, err := s.store.GetStarredPostIDsForUser(userId)
+		if err != nil {
+			apiInternalError(w, "Error fetching starred posts for Fever", err, "userId", userId)
+			return
+		}
+		response["saved_item_ids"] = feverIDList(ids)
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// feverGroups lists the user's dashboards as Fever groups together with the
+// feeds on each.
+func (s *Server) feverGroups(userId int64) ([]feverGroup, []feverFeedsGroup, error) {
+	dashboards, err := s.store.GetDashboardsForUser(userId)
+	if err != nil {
+		return nil, nil, err
+	}
+	groups := make([]feverGroup, 0, len(dashboards))
+	feedsGroups := make([]feverFeedsGroup, 0, len(dashboards))
+	for _, dashboard := range dashboards {
+		dashboardFeeds, err := s.store.GetDashboardFeeds(userId, dashboard.ID)
+		if err != nil {
+			return nil, nil, err
+		}
+		feedIds := make([]int64, len(dashboardFeeds))
+		for i, f := range dashboardFeeds {
+			feedIds[i] = f.ID
+		}
+		groups = append(groups, feverGroup{ID: dashboard.ID, Title: dashboard.Name})
+		feedsGroups = append(feedsGroups, feverFeedsGroup{GroupID: dashboard.ID, FeedIDs: feverIDList(feedIds)})
+	}
+	return groups, feedsGroups, nil
+}
+
+// feverItems pages through the user's posts by id as requested with
+// since_id, max_id or with_ids.
+func (s *Server) feverItems(userId int64, r *http.Request) ([]feverItem, int, error) {
+	total, err := s.store.CountPostsForUser(userId)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := db.PostQuery{Limit: maxFeverItems}
+	switch {
+	case r.FormValue("max_id") != "":
+		query.MaxID, _ = strconv.ParseInt(r.FormValue("max_id"), 10, 64)
+		query.NewestFirst = true
+	case r.FormValue("with_ids") != "":
+		for _, value := range strings.Split(r.FormValue("with_ids"), ",") {
+			if id, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil && len(query.IDs) < maxFeverItems {
+				query.IDs = append(query.IDs, id)
+			}
+		}
+		if len(query.IDs) == 0 {
+			return []feverItem{}, total, nil
+		}
+	default:
+		query.SinceID, _ = strconv.ParseInt(r.FormValue("since_id"), 10, 64)
+	}
+
+	posts, err := s.store.QueryPostsForUser(userId, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	items := make([]feverItem, 0, len(posts))
+	for _, p := range posts {
+		items = append(items, feverItem{
+			ID:            p.ID,
+			FeedID:        p.FeedID,
+			Title:         p.Title,
+			Author:        p.Author,
+			HTML:          p.Content,
+			URL:           p.Link,
+			IsSaved:       feverBool(p.Starred),
+			IsRead:        feverBool(p.Seen),
+			CreatedOnTime: feverTime(p.PublishedAt),
+		})
+	}
+	return items, total, nil
+}
+
+// feverMark applies a mark request and reports whether it changed read or
+// saved states. Items, feeds and groups the user cannot see are ignored, as
+// Fever has no way to report errors.
+func (s *Server) feverMark(userId int64, r *http.Request) (readChanged, savedChanged bool, err error) {
+	id, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	if err != nil {
+		return false, false, nil
+	}
+	as := r.FormValue("as")
+
+	if r.FormValue("mark") == "item" {
+		switch as {
+		case "read":
+			err = s.store.MarkPostAsSeenForUser(userId, id)
+			readChanged = true
+		case "unread":
+			err = s.store.MarkPostAsUnseenForUser(userId, id)
+			readChanged = true
+		case "saved":
+			err = s.store.SetPostStarredForUser(userId, id, true)
+			savedChanged = true
+		case "unsaved":
+			err = s.store.SetPostStarredForUser(userId, id, false)
+			savedChanged = true
+		}
+		if errors.Is(err, sql.ErrNoRows) {
+			err = nil
+		}
+		return readChanged, savedChanged, err
+	}
+
+	if as != "read" {
+		return false, false, nil
+	}
+	before := time.Now()
+	if seconds, err := strconv.ParseInt(r.FormValue("before"), 10, 64); err == nil && seconds > 0 {
+		before = time.Unix(seconds, 0)
+	}
+
+	var feedIds []int64
+	switch r.FormValue("mark") {
+	case "feed":
+		feedIds = []int64{id}
+	case "group":
+		// Group 0 is Fever's group of all feeds; other negative ids are
+		// special groups we do not have.
+		var groupFeeds []db.Feed
+		switch {
+		case id == 0:
+			groupFeeds, err = s.store.GetUserFeeds(userId)
+		case id > 0:
+			groupFeeds, err = s.store.GetDashboardFeeds(userId, id)
+		}
+		if err != nil {
+			return false, false, err
+		}
+		for _, f := range groupFeeds {
+			feedIds = append(feedIds, f.ID)
+		}
+	}
+	for _, feedId := range feedIds {
+		if err := s.store.MarkFeedPostsAsSeenBeforeForUser(userId, feedId, before); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return false, false, err
+		}
+	}
+	return len(feedIds) > 0, false, nil
+}
+
+// minFeverPasswordLength is the shortest accepted Fever password. Fever
+// clients send an unsalted hash of it, so it should not be guessable.
+const minFeverPasswordLength = 8
+
+func (s *Server) handleSetFeverCredentials(w http.ResponseWriter, r *http.Request) {
+	userId := s.getUserID(r)
+
+	username := strings.TrimSpace(r.FormValue("username"))
+	password := r.FormValue("password")
+	if username == "" || len(password) < minFeverPasswordLength {
+		s.addErrorFlash(w, r, "Fever username is required and the password must be at least 8 characters")
+		http.Redirect(w, r, "/settings#fever", http.StatusSeeOther)
+		return
+	}
+
+	if err := s.store.SetFeverCredentialsForUser(userId, username, password); err != nil {
+		if errors.Is(err, db.ErrFeverCredentialsInUse) {
+			s.addErrorFlash(w, r, "Please choose a different Fever username or password.")
+			http.Redirect(w, r, "/settings#fever", http.StatusSeeOther)
+			return
+		}
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error saving Fever credentials", "Error setting Fever credentials for user", err, "userId", userId)
+		return
+	}
+
+	s.addSuccessFlash(w, r, "Fever API enabled.")
+	http.Redirect(w, r, "/settings#fever", http.StatusSeeOther)
+}
+
+func (s *Server) handleDeleteFeverCredentials(w http.ResponseWriter, r *http.Request) {
+	userId := s.getUserID(r)
+
+	if err := s.store.ClearFeverCredentialsForUser(userId); err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error disabling Fever API", "Error clearing Fever credentials for user", err, "userId", userId)
+		return
+	}
+
+	s.addSuccessFlash(w, r, "Fever API disabled.")
+	http.Redirect(w, r, "/settings#fever", http.StatusSeeOther)
+}
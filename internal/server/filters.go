@@ -0,0 +1,101 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/aggregat4/rssgrid/internal/db"
+	"github.com/go-chi/chi/v5"
+)
+
+// maxFilterPatternLength bounds filter patterns; they are matched against
+// every post shown on the dashboard.
+const maxFilterPatternLength = 200
+
+var filterFields = map[string]bool{
+	db.FilterFieldTitle:   true,
+	db.FilterFieldContent: true,
+	db.FilterFieldAuthor:  true,
+	db.FilterFieldLink:    true,
+}
+
+var filterActions = map[string]bool{
+	db.FilterActionHide:      true,
+	db.FilterActionMarkSeen:  true,
+	db.FilterActionHighlight: true,
+}
+
+func (s *Server) handleCreateFilterRule(w http.ResponseWriter, r *http.Request) {
+	userId := s.getUserID(r)
+
+	rule := db.FilterRule{
+		Field:   r.FormValue("field"),
+		Regex:   r.FormValue("match") == "regex",
+		Pattern: strings.TrimSpace(r.FormValue("pattern")),
+		Action:  r.FormValue("action"),
+	}
+	if !filterFields[rule.Field] || !filterActions[rule.Action] {
+		http.Error(w, "Invalid filter rule", http.StatusBadRequest)
+		return
+	}
+	if feedIdStr := r.FormValue("feedId"); feedIdStr != "" {
+		feedId, err := strconv.ParseInt(feedIdStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid feed ID format", http.StatusBadRequest)
+			return
+		}
+		rule.FeedID = feedId
+	}
+
+	if rule.Pattern == "" || len(rule.Pattern) > maxFilterPatternLength {
+		s.addErrorFlash(w, r, fmt.Sprintf("Filter pattern is required and may be at most %d characters", maxFilterPatternLength))
+		http.Redirect(w, r, "/settings#filters", http.StatusSeeOther)
+		return
+	}
+	if rule.Regex {
+		if _, err := regexp.Compile(rule.Pattern); err != nil {
+			s.addErrorFlash(w, r, fmt.Sprintf("Invalid regular expression: %v", err))
+			http.Redirect(w, r, "/settings#filters", http.StatusSeeOther)
+			return
+		}
+	}
+
+	if _, err := s.store.CreateFilterRuleForUser(userId, rule); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Feed not found", http.StatusNotFound)
+			return
+		}
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error creating filter rule", "Error creating filter rule for user", err, "userId", userId)
+		return
+	}
+
+	s.addSuccessFlash(w, r, "Filter rule added.")
+	http.Redirect(w, r, "/settings#filters", http.StatusSeeOther)
+}
+
+func (s *Server) handleDeleteFilterRule(w http.ResponseWriter, r *http.Request) {
+	ruleId, err := strconv.ParseInt(chi.URLParam(r, "ruleId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid filter rule ID format", http.StatusBadRequest)
+		return
+	}
+
+	userId := s.getUserID(r)
+
+	if err := s.store.DeleteFilterRuleForUser(userId, ruleId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Filter rule not found", http.StatusNotFound)
+			return
+		}
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error deleting filter rule", "Error deleting filter rule for user", err, "ruleId", ruleId, "userId", userId)
+		return
+	}
+
+	s.addSuccessFlash(w, r, "Filter rule deleted.")
+	http.Redirect(w, r, "/settings#filters", http.StatusSeeOther)
+}
@@ -0,0 +1,865 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aggregat4/rssgrid/internal/db"
+	"github.com/go-chi/chi/v5"
+)
+
+// The Google Reader API, as implemented by FreshRSS and Miniflux, is spoken by
+// many desktop and mobile clients. Clients log in at /accounts/ClientLogin
+// with any username and a personal access token as the password, and send
+// the returned token as "Authorization: GoogleLogin auth=<token>". Dashboards
+// are exposed as labels.
+
+const (
+	greaderReadingList = "user/-/state/com.google/reading-list"
+	greaderRead        = "user/-/state/com.google/read"
+	greaderKeptUnread  = "user/-/state/com.google/kept-unread"
+	greaderStarred     = "user/-/state/com.google/starred"
+	greaderLabelPrefix = "user/-/label/"
+	greaderFeedPrefix  = "feed/"
+	greaderItemPrefix  = "tag:google.com,2005:reader/item/"
+)
+
+// defaultGReaderItems and maxGReaderItems bound the n parameter of stream
+// requests.
+const (
+	defaultGReaderItems = 20
+	maxGReaderItems     = 1000
+)
+
+// greaderUserPrefix matches the user part of a stream id, which clients may
+// send as "user/-" or with a user id.
+var greaderUserPrefix = regexp.MustCompile(`^user/[^/]+/`)
+
+type greaderCategory struct {
+	ID    string `json:"id"`
+	Label string `json:"label"`
+}
+
+type greaderSubscription struct {
+	ID         string            `json:"id"`
+	Title      string            `json:"title"`
+	Categories []greaderCategory `json:"categories"`
+	URL        string            `json:"url"`
+	HTMLURL    string            `json:"htmlUrl"`
+	IconURL    string            `json:"iconUrl"`
+}
+
+type greaderTag struct {
+	ID   string `json:"id"`
+	Type string `json:"type,omitempty"`
+}
+
+type greaderUnreadCount struct {
+	ID                      string `json:"id"`
+	Count                   int    `json:"count"`
+	NewestItemTimestampUsec string `json:"newestItemTimestampUsec"`
+}
+
+type greaderLink struct {
+	Href string `json:"href"`
+	Type string `json:"type,omitempty"`
+}
+
+type greaderContent struct {
+	Direction string `json:"direction"`
+	Content   string `json:"content"`
+}
+
+type greaderOrigin struct {
+	StreamID string `json:"streamId"`
+	Title    string `json:"title"`
+	HTMLURL  string `json:"htmlUrl"`
+}
+
+type greaderItem struct {
+	ID            string         `json:"id"`
+	CrawlTimeMsec string         `json:"crawlTimeMsec"`
+	TimestampUsec string         `json:"timestampUsec"`
+	Published     int64          `json:"published"`
+	Updated       int64          `json:"updated"`
+	Title         string         `json:"title"`
+	Author        string         `json:"author,omitempty"`
+	Canonical     []greaderLink  `json:"canonical"`
+	Alternate     []greaderLink  `json:"alternate"`
+	Summary       greaderContent `json:"summary"`
+	Categories    []string       `json:"categories"`
+	Origin        greaderOrigin  `json:"origin"`
+}
+
+type greaderItemRef struct {
+	ID              string   `json:"id"`
+	DirectStreamIDs []string `json:"directStreamIds"`
+	TimestampUsec   string   `json:"timestampUsec"`
+}
+
+func (s *Server) greaderRoutes(r chi.Router) {
+	r.HandleFunc("/accounts/ClientLogin", s.handleGReaderClientLogin)
+
+	r.Route("/reader/api/0", func(r chi.Router) {
+		r.Use(s.greaderAuthMiddleware)
+
+		r.Get("/token", s.handleGReaderToken)
+		r.Get("/user-info", s.handleGReaderUserInfo)
+		r.Get("/subscription/list", s.handleGReaderSubscriptionList)
+		r.Post("/subscription/edit", s.handleGReaderSubscriptionEdit)
+		r.Post("/subscription/quickadd", s.handleGReaderQuickAdd)
+		r.Get("/tag/list", s.handleGReaderTagList)
+		r.Get("/unread-count", s.handleGReaderUnreadCount)
+		r.Get("/stream/contents", s.handleGReaderStreamContents)
+		r.Get("/stream/contents/*", s.handleGReaderStreamContents)
+		r.HandleFunc("/stream/items/ids", s.handleGReaderStreamItemIDs)
+		r.Post("/stream/items/contents", s.handleGReaderItemContents)
+		r.Post("/edit-tag", s.handleGReaderEditTag)
+		r.Post("/mark-all-as-read", s.handleGReaderMarkAllAsRead)
+	})
+}
+
+// handleGReaderClientLogin exchanges a personal access token, sent as the
+// password, for the token clients send on every request. That is the access
+// token itself.
+func (s *Server) handleGReaderClientLogin(w http.ResponseWriter, r *http.Request) {
+	token := r.FormValue("Passwd")
+	if _, err := s.store.GetUserIDForAPIToken(token); err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			s.logErrorAndRespond(w, http.StatusInternalServerError, "Error authenticating", "Error looking up API token for ClientLogin", err)
+			return
+		}
+		http.Error(w, "Error=BadAuthentication", http.StatusUnauthorized)
+		return
+	}
+
+	if r.FormValue("output") == "json" {
+		writeJSON(w, http.StatusOK, map[string]string{"SID": token, "LSID": token, "Auth": token})
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintf(w, "SID=%s\nLSID=%s\nAuth=%s\n", token, token, token)
+}
+
+// greaderAuthMiddleware authenticates requests carrying a ClientLogin token.
+func (s *Server) greaderAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "GoogleLogin auth=")
+		token = strings.TrimSpace(token)
+		if !ok || token == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		userId, err := s.store.GetUserIDForAPIToken(token)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				log.Printf("Error looking up API token: %v\nStack trace:\n%s", err, debug.Stack())
+				http.Error(w, "Error authenticating request", http.StatusInternalServerError)
+				return
+			}
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiUserIDKey{}, userId)))
+	})
+}
+
+// greaderOK is the plain text response of successful edits.
+func greaderOK(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, "OK")
+}
+
+// handleGReaderToken returns the token clients send with edits. Requests are
+// authenticated by header rather than cookie, so it is not checked.
+func (s *Server) handleGReaderToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprint(w, "rssgrid")
+}
+
+func (s *Server) handleGReaderUserInfo(w http.ResponseWriter, r *http.Request) {
+	userId := strconv.FormatInt(apiUserID(r), 10)
+	writeJSON(w, http.StatusOK, map[string]string{
+		"userId":        userId,
+		"userName":      "user-" + userId,
+		"userProfileId": userId,
+	})
+}
+
+func greaderFeedStream(feedId int64) string {
+	return greaderFeedPrefix + strconv.FormatInt(feedId, 10)
+}
+
+func greaderLabel(dashboard db.Dashboard) greaderCategory {
+	return greaderCategory{ID: greaderLabelPrefix + dashboard.Name, Label: dashboard.Name}
+}
+
+// greaderItemID formats a post id in the long form clients expect.
+func greaderItemID(postId int64) string {
+	return fmt.Sprintf("%s%016x", greaderItemPrefix, postId)
+}
+
+// parseGReaderItemID accepts item ids in the long hexadecimal or the short
+// decimal form.
+func parseGReaderItemID(value string) (int64, bool) {
+	if hexId, ok := strings.CutPrefix(value, greaderItemPrefix); ok {
+		id, err := strconv.ParseUint(hexId, 16, 64)
+		return int64(id), err == nil
+	}
+	id, err := strconv.ParseInt(value, 10, 64)
+	return id, err == nil
+}
+
+// greaderUsec formats a time in microseconds, as a string like Google did.
+func greaderUsec(t time.Time) string {
+	return strconv.FormatInt(t.UnixMicro(), 10)
+}
+
+// greaderLabels maps each of the user's feeds to the labels of the
+// dashboards it is on.
+func (s *Server) greaderLabels(userId int64) ([]db.Dashboard, map[int64][]greaderCategory, error) {
+	dashboards, err := s.store.GetDashboardsForUser(userId)
+	if err != nil {
+		return nil, nil, err
+	}
+	byId := make(map[int64]db.Dashboard, len(dashboards))
+	for _, dashboard := range dashboards {
+		byId[dashboard.ID] = dashboard
+	}
+	feedDashboardIds, err := s.store.GetFeedDashboardIDsForUser(userId)
+	if err != nil {
+		return nil, nil, err
+	}
+	labels := make(map[int64][]greaderCategory, len(feedDashboardIds))
+	for feedId, dashboardIds := range feedDashboardIds {
+		for _, dashboardId := range dashboardIds {
+			labels[feedId] = append(labels[feedId], greaderLabel(byId[dashboardId]))
+		}
+	}
+	return dashboards, labels, nil
+}
+
+func (s *Server) handleGReaderSubscriptionList(w http.ResponseWriter, r *http.Request) {
+	userId := apiUserID(r)
+
+	feeds, err := s.store.GetUserFeeds(userId)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error fetching feeds", "Error fetching feeds for GReader", err, "userId", userId)
+		return
+	}
+	_, labels, err := s.greaderLabels(userId)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error fetching dashboards", "Error fetching dashboards for GReader", err, "userId", userId)
+		return
+	}
+
+	subscriptions := make([]greaderSubscription, 0, len(feeds))
+	for _, f := range feeds {
+		categories := labels[f.ID]
+		if categories == nil {
+			categories = []greaderCategory{}
+		}
+		subscriptions = append(subscriptions, greaderSubscription{
+			ID:         greaderFeedStream(f.ID),
+			Title:      f.Title,
+			Categories: categories,
+			URL:        f.URL,
+			HTMLURL:    feverSiteURL(f.URL),
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"subscriptions": subscriptions})
+}
+
+// greaderSubscribe subscribes the user to the feed at rawURL, responding with
+// an error if that is not possible.
+func (s *Server) greaderSubscribe(w http.ResponseWriter, r *http.Request, userId int64, rawURL string) (int64, bool) {
+	if !isValidFeedURL(rawURL) {
+		http.Error(w, "Invalid feed URL", http.StatusBadRequest)
+		return 0, false
+	}
+	feedURL, content, candidates, err := s.fetchOrDiscoverFeed(r.Context(), rawURL)
+	if len(candidates) > 0 {
+		// Clients have no way to let the user pick; take the first.
+		feedURL = candidates[0].URL
+		content, err = s.fetcher.FetchFeed(r.Context(), feedURL)
+	}
+	if err != nil {
+		log.Printf("Error fetching feed from URL: %v\nContext: [url %s]", err, rawURL)
+		http.Error(w, "Invalid feed URL or unable to fetch feed", http.StatusBadRequest)
+		return 0, false
+	}
+
+	feedId, err := s.subscribeToFetchedFeed(userId, feedURL, content)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error adding feed", "Error adding feed for GReader", err, "url", feedURL, "userId", userId)
+		return 0, false
+	}
+	return feedId, true
+}
+
+// greaderFeedID resolves a "feed/..." stream id, which clients send with
+// either our feed id or the feed URL, to one of the user's feeds.
+func greaderFeedID(feeds []db.Feed, streamId string) (int64, bool) {
+	value, ok := strings.CutPrefix(streamId, greaderFeedPrefix)
+	if !ok {
+		return 0, false
+	}
+	for _, f := range feeds {
+		if strconv.FormatInt(f.ID, 10) == value || f.URL == value {
+			return f.ID, true
+		}
+	}
+	return 0, false
+}
+
+func (s *Server) handleGReaderSubscriptionEdit(w http.ResponseWriter, r *http.Request) {
+	userId := apiUserID(r)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+
+	feeds, err := s.store.GetUserFeeds(userId)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error fetching feeds", "Error fetching feeds for GReader", err, "userId", userId)
+		return
+	}
+
+	action := r.FormValue("ac")
+	for _, streamId := range r.Form["s"] {
+		feedId, subscribed := greaderFeedID(feeds, streamId)
+		switch action {
+		case "subscribe":
+			if !subscribed {
+				var ok bool
+				if feedId, ok = s.greaderSubscribe(w, r, userId, strings.TrimPrefix(streamId, greaderFeedPrefix)); !ok {
+					return
+				}
+			}
+		case "unsubscribe":
+			if !subscribed {
+				continue
+			}
+			if err := s.store.DeleteFeedForUser(userId, feedId); err != nil && !errors.Is(err, sql.ErrNoRows) {
+				s.logErrorAndRespond(w, http.StatusInternalServerError, "Error unsubscribing", "Error deleting feed for GReader", err, "feedId", feedId, "userId", userId)
+				return
+			}
+			continue
+		case "edit":
+			if !subscribed {
+				http.Error(w, "Feed not found", http.StatusNotFound)
+				return
+			}
+		default:
+			http.Error(w, "Unknown action", http.StatusBadRequest)
+			return
+		}
+
+		if err := s.greaderEditFeed(userId, feedId, r); err != nil {
+			s.logErrorAndRespond(w, http.StatusInternalServerError, "Error editing subscription", "Error editing feed for GReader", err, "feedId", feedId, "userId", userId)
+			return
+		}
+	}
+	greaderOK(w)
+}
+
+// greaderEditFeed applies the title (t) and the labels to add (a) and
+// remove (r) of a subscription edit. Labels that do not exist yet are
+// created as dashboards.
+func (s *Server) greaderEditFeed(userId, feedId int64, r *http.Request) error {
+	if title := strings.TrimSpace(r.FormValue("t")); title != "" {
+		feeds, err := s.store.GetUserFeeds(userId)
+		if err != nil {
+			return err
+		}
+		for _, f := range feeds {
+			if f.ID == feedId && f.Title != title {
+				settings := f.Settings
+				settings.CustomTitle = title
+				if err := s.store.SetFeedSettingsForUser(userId, feedId, settings); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	add, remove := r.Form["a"], r.Form["r"]
+	if len(add) == 0 && len(remove) == 0 {
+		return nil
+	}
+	dashboards, err := s.store.GetDashboardsForUser(userId)
+	if err != nil {
+		return err
+	}
+	feedDashboardIds, err := s.store.GetFeedDashboardIDsForUser(userId)
+	if err != nil {
+		return err
+	}
+	placed := make(map[int64]bool)
+	for _, dashboardId := range feedDashboardIds[feedId] {
+		placed[dashboardId] = true
+	}
+	dashboardByName := func(label string) (int64, bool) {
+		name, ok := strings.CutPrefix(greaderUserPrefix.ReplaceAllString(label, "user/-/"), greaderLabelPrefix)
+		if !ok {
+			return 0, false
+		}
+		for _, dashboard := range dashboards {
+			if dashboard.Name == name {
+				return dashboard.ID, true
+			}
+		}
+		return 0, false
+	}
+	for _, label := range add {
+		dashboardId, ok := dashboardByName(label)
+		if !ok {
+			name, isLabel := strings.CutPrefix(greaderUserPrefix.ReplaceAllString(label, "user/-/"), greaderLabelPrefix)
+			if !isLabel || name == "" || len(name) > maxDashboardNameLength {
+				continue
+			}
+			if dashboardId, err = s.store.CreateDashboardForUser(userId, name); err != nil {
+				return err
+			}
+			dashboards = append(dashboards, db.Dashboard{ID: dashboardId, Name: name})
+		}
+		placed[dashboardId] = true
+	}
+	for _, label := range remove {
+		if dashboardId, ok := dashboardByName(label); ok {
+			delete(placed, dashboardId)
+		}
+	}
+	dashboardIds := make([]int64, 0, len(placed))
+	for dashboardId := range placed {
+		dashboardIds = append(dashboardIds, dashboardId)
+	}
+	return s.store.SetFeedDashboardsForUser(userId, feedId, dashboardIds)
+}
+
+func (s *Server) handleGReaderQuickAdd(w http.ResponseWriter, r *http.Request) {
+	userId := apiUserID(r)
+	rawURL := strings.TrimPrefix(r.FormValue("quickadd"), greaderFeedPrefix)
+
+	feedId, ok := s.greaderSubscribe(w, r, userId, rawURL)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"numResults": 1,
+		"query":      rawURL,
+		"streamId":   greaderFeedStream(feedId),
+	})
+}
+
+func (s *Server) handleGReaderTagList(w http.ResponseWriter, r *http.Request) {
+	userId := apiUserID(r)
+
+	dashboards, err := s.store.GetDashboardsForUser(userId)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error fetching dashboards", "Error fetching dashboards for GReader", err, "userId", userId)
+		return
+	}
+	tags := []greaderTag{{ID: greaderStarred}}
+	for _, dashboard := range dashboards {
+		tags = append(tags, greaderTag{ID: greaderLabel(dashboard).ID, Type: "folder"})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"tags": tags})
+}
+
+func (s *Server) handleGReaderUnreadCount(w http.ResponseWriter, r *http.Request) {
+	userId := apiUserID(r)
+
+	counts, err := s.store.GetUnreadCountsForUser(userId)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error counting unread posts", "Error counting unread posts for GReader", err, "userId", userId)
+		return
+	}
+	dashboards, labels, err := s.greaderLabels(userId)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error fetching dashboards", "Error fetching dashboards for GReader", err, "userId", userId)
+		return
+	}
+
+	var total int
+	labelCounts := make(map[string]int)
+	unreadCounts := []greaderUnreadCount{}
+	for feedId, count := range counts {
+		total += count
+		for _, label := range labels[feedId] {
+			labelCounts[label.ID] += count
+		}
+		unreadCounts = append(unreadCounts, greaderUnreadCount{ID: greaderFeedStream(feedId), Count: count, NewestItemTimestampUsec: "0"})
+	}
+	for _, dashboard := range dashboards {
+		id := greaderLabel(dashboard).ID
+		unreadCounts = append(unreadCounts, greaderUnreadCount{ID: id, Count: labelCounts[id], NewestItemTimestampUsec: "0"})
+	}
+	unreadCounts = append(unreadCounts, greaderUnreadCount{ID: greaderReadingList, Count: total, NewestItemTimestampUsec: "0"})
+	writeJSON(w, http.StatusOK, map[string]any{"max": maxGReaderItems, "unreadcounts": unreadCounts})
+}
+
+// greaderStreamQuery builds the post query for a stream request: the stream
+// id and its parameters n, r, c, xt, it, ot and nt.
+func (s *Server) greaderStreamQuery(userId int64, streamId string, r *http.Request) (db.PostQuery, error) {
+	query := db.PostQuery{Limit: defaultGReaderItems, NewestFirst: r.FormValue("r") != "o"}
+	if n, err := strconv.Atoi(r.FormValue("n")); err == nil && n > 0 {
+		query.Limit = min(n, maxGReaderItems)
+	}
+	if c, err := strconv.ParseInt(r.FormValue("c"), 10, 64); err == nil && c > 0 {
+		if query.NewestFirst {
+			query.MaxID = c
+		} else {
+			query.SinceID = c
+		}
+	}
+	if ot, err := strconv.ParseInt(r.FormValue("ot"), 10, 64); err == nil && ot > 0 {
+		query.PublishedAfter = time.Unix(ot, 0)
+	}
+	if nt, err := strconv.ParseInt(r.FormValue("nt"), 10, 64); err == nil && nt > 0 {
+		query.PublishedBefore = time.Unix(nt, 0)
+	}
+
+	targets := []string{streamId}
+	targets = append(targets, r.Form["it"]...)
+	for _, target := range targets {
+		target = greaderUserPrefix.ReplaceAllString(target, "user/-/")
+		switch {
+		case target == "" || target == greaderReadingList:
+		case target == greaderStarred:
+			query.Starred = true
+		case target == greaderRead:
+			query.OnlyRead = true
+		case target == greaderKeptUnread:
+			query.OnlyUnread = true
+		case strings.HasPrefix(target, greaderFeedPrefix):
+			feeds, err := s.store.GetUserFeeds(userId)
+			if err != nil {
+				return query, err
+			}
+			feedId, _ := greaderFeedID(feeds, target)
+			query.FeedIDs = []int64{feedId}
+		case strings.HasPrefix(target, greaderLabelPrefix):
+			feedIds, err := s.greaderLabelFeedIDs(userId, strings.TrimPrefix(target, greaderLabelPrefix))
+			if err != nil {
+				return query, err
+			}
+			query.FeedIDs = feedIds
+		default:
+			// Unknown streams are empty.
+			query.FeedIDs = []int64{}
+		}
+	}
+	for _, target := range r.Form["xt"] {
+		switch greaderUserPrefix.ReplaceAllString(target, "user/-/") {
+		case greaderRead:
+			query.OnlyUnread = true
+		case greaderKeptUnread:
+			query.OnlyRead = true
+		}
+	}
+	return query, nil
+}
+
+// greaderLabelFeedIDs lists the feeds on the dashboard with the given name.
+func (s *Server) greaderLabelFeedIDs(userId int64, name string) ([]int64, error) {
+	dashboards, err := s.store.GetDashboardsForUser(userId)
+	if err != nil {
+		return nil, err
+	}
+	feedIds := []int64{}
+	for _, dashboard := range dashboards {
+		if dashboard.Name != name {
+			continue
+		}
+		feeds, err := s.store.GetDashboardFeeds(userId, dashboard.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range feeds {
+			feedIds = append(feedIds, f.ID)
+		}
+	}
+	return feedIds, nil
+}
+
+// greaderStreamID returns the stream id of a stream request, given either
+// in the path after /stream/contents/ or as the s parameter.
+func greaderStreamID(r *http.Request) string {
+	if streamId := chi.URLParam(r, "*"); streamId != "" {
+		if unescaped, err := url.PathUnescape(streamId); err == nil {
+			return unescaped
+		}
+		return streamId
+	}
+	return r.FormValue("s")
+}
+
+// greaderContinuation is the continuation token for the page after posts, or
+// an empty string if this was the last page.
+func greaderContinuation(posts []db.FeedPost, limit int) string {
+	if len(posts) < limit {
+		return ""
+	}
+	return strconv.FormatInt(posts[len(posts)-1].ID, 10)
+}
+
+func (s *Server) handleGReaderStreamContents(w http.ResponseWriter, r *http.Request) {
+	userId := apiUserID(r)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	streamId := greaderStreamID(r)
+
+	query, err := s.greaderStreamQuery(userId, streamId, r)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error reading stream", "Error building GReader stream query", err, "streamId", streamId, "userId", userId)
+		return
+	}
+	posts, err := s.store.QueryPostsForUser(userId, query)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error reading stream", "Error querying posts for GReader", err, "streamId", streamId, "userId", userId)
+		return
+	}
+	items, err := s.greaderItems(userId, posts)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error reading stream", "Error fetching feeds for GReader items", err, "userId", userId)
+		return
+	}
+
+	response := map[string]any{
+		"id":      streamId,
+		"updated": time.Now().Unix(),
+		"items":   items,
+	}
+	if continuation := greaderContinuation(posts, query.Limit); continuation != "" {
+		response["continuation"] = continuation
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) handleGReaderStreamItemIDs(w http.ResponseWriter, r *http.Request) {
+	userId := apiUserID(r)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+	streamId := greaderStreamID(r)
+
+	query, err := s.greaderStreamQuery(userId, streamId, r)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error reading stream", "Error building GReader stream query", err, "streamId", streamId, "userId", userId)
+		return
+	}
+	posts, err := s.store.QueryPostsForUser(userId, query)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error reading stream", "Error querying posts for GReader", err, "streamId", streamId, "userId", userId)
+		return
+	}
+
+	refs := make([]greaderItemRef, 0, len(posts))
+	for _, p := range posts {
+		refs = append(refs, greaderItemRef{
+			ID:              strconv.FormatInt(p.ID, 10),
+			DirectStreamIDs: []string{greaderFeedStream(p.FeedID)},
+			TimestampUsec:   greaderUsec(p.PublishedAt),
+		})
+	}
+	response := map[string]any{"itemRefs": refs}
+	if continuation := greaderContinuation(posts, query.Limit); continuation != "" {
+		response["continuation"] = continuation
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// greaderItemIDs parses the item ids in the i parameters, skipping any that
+// are malformed.
+func greaderItemIDs(r *http.Request) []int64 {
+	var ids []int64
+	for _, value := range r.Form["i"] {
+		if id, ok := parseGReaderItemID(value); ok {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func (s *Server) handleGReaderItemContents(w http.ResponseWriter, r *http.Request) {
+	userId := apiUserID(r)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+
+	items := []greaderItem{}
+	if ids := greaderItemIDs(r); len(ids) > 0 {
+		posts, err := s.store.QueryPostsForUser(userId, db.PostQuery{IDs: ids, Limit: len(ids)})
+		if err != nil {
+			s.logErrorAndRespond(w, http.StatusInternalServerError, "Error reading items", "Error querying posts for GReader", err, "userId", userId)
+			return
+		}
+		if items, err = s.greaderItems(userId, posts); err != nil {
+			s.logErrorAndRespond(w, http.StatusInternalServerError, "Error reading items", "Error fetching feeds for GReader items", err, "userId", userId)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"id":      greaderReadingList,
+		"updated": time.Now().Unix(),
+		"items":   items,
+	})
+}
+
+// greaderItems converts posts to GReader items with their feed as origin.
+func (s *Server) greaderItems(userId int64, posts []db.FeedPost) ([]greaderItem, error) {
+	feeds, err := s.store.GetUserFeeds(userId)
+	if err != nil {
+		return nil, err
+	}
+	feedsById := make(map[int64]db.Feed, len(feeds))
+	for _, f := range feeds {
+		feedsById[f.ID] = f
+	}
+	_, labels, err := s.greaderLabels(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]greaderItem, 0, len(posts))
+	for _, p := range posts {
+		f := feedsById[p.FeedID]
+		categories := []string{greaderReadingList}
+		if p.Seen {
+			categories = append(categories, greaderRead)
+		}
+		if p.Starred {
+			categories = append(categories, greaderStarred)
+		}
+		for _, label := range labels[p.FeedID] {
+			categories = append(categories, label.ID)
+		}
+		updated := p.PublishedAt
+		if !p.UpdatedAt.IsZero() {
+			updated = p.UpdatedAt
+		}
+		items = append(items, greaderItem{
+			ID:            greaderItemID(p.ID),
+			CrawlTimeMsec: strconv.FormatInt(p.PublishedAt.UnixMilli(), 10),
+			TimestampUsec: greaderUsec(p.PublishedAt),
+			Published:     p.PublishedAt.Unix(),
+			Updated:       updated.Unix(),
+			Title:         p.Title,
+			Author:        p.Author,
+			Canonical:     []greaderLink{{Href: p.Link}},
+			Alternate:     []greaderLink{{Href: p.Link, Type: "text/html"}},
+			Summary:       greaderContent{Direction: "ltr", Content: p.Content},
+			Categories:    categories,
+			Origin: greaderOrigin{
+				StreamID: greaderFeedStream(p.FeedID),
+				Title:    f.Title,
+				HTMLURL:  feverSiteURL(f.URL),
+			},
+		})
+	}
+	return items, nil
+}
+
+// handleGReaderEditTag adds (a) or removes (r) the read and starred states
+// of the items in i. Items the user cannot see are ignored.
+func (s *Server) handleGReaderEditTag(w http.ResponseWriter, r *http.Request) {
+	userId := apiUserID(r)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+
+	type change struct {
+		tag string
+		add bool
+	}
+	var changes []change
+	for _, tag := range r.Form["a"] {
+		changes = append(changes, change{greaderUserPrefix.ReplaceAllString(tag, "user/-/"), true})
+	}
+	for _, tag := range r.Form["r"] {
+		changes = append(changes, change{greaderUserPrefix.ReplaceAllString(tag, "user/-/"), false})
+	}
+
+	for _, postId := range greaderItemIDs(r) {
+		for _, c := range changes {
+			var err error
+			switch {
+			case c.tag == greaderRead && c.add, c.tag == greaderKeptUnread && !c.add:
+				err = s.store.MarkPostAsSeenForUser(userId, postId)
+			case c.tag == greaderRead, c.tag == greaderKeptUnread:
+				err = s.store.MarkPostAsUnseenForUser(userId, postId)
+			case c.tag == greaderStarred:
+				err = s.store.SetPostStarredForUser(userId, postId, c.add)
+			}
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				s.logErrorAndRespond(w, http.StatusInternalServerError, "Error editing items", "Error editing item tags for GReader", err, "postId", postId, "userId", userId)
+				return
+			}
+		}
+	}
+	greaderOK(w)
+}
+
+// handleGReaderMarkAllAsRead marks the posts of the stream s published
+// before ts (in microseconds, default now) as read.
+func (s *Server) handleGReaderMarkAllAsRead(w http.ResponseWriter, r *http.Request) {
+	userId := apiUserID(r)
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+
+	before := time.Now()
+	if ts, err := strconv.ParseInt(r.FormValue("ts"), 10, 64); err == nil && ts > 0 {
+		before = time.UnixMicro(ts)
+	}
+
+	streamId := greaderUserPrefix.ReplaceAllString(r.FormValue("s"), "user/-/")
+	feeds, err := s.store.GetUserFeeds(userId)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error marking as read", "Error fetching feeds for GReader", err, "userId", userId)
+		return
+	}
+	var feedIds []int64
+	switch {
+	case streamId == greaderReadingList:
+		for _, f := range feeds {
+			feedIds = append(feedIds, f.ID)
+		}
+	case strings.HasPrefix(streamId, greaderFeedPrefix):
+		if feedId, ok := greaderFeedID(feeds, streamId); ok {
+			feedIds = []int64{feedId}
+		}
+	case strings.HasPrefix(streamId, greaderLabelPrefix):
+		if feedIds, err = s.greaderLabelFeedIDs(userId, strings.TrimPrefix(streamId, greaderLabelPrefix)); err != nil {
+			s.logErrorAndRespond(w, http.StatusInternalServerError, "Error marking as read", "Error fetching dashboard feeds for GReader", err, "streamId", streamId, "userId", userId)
+			return
+		}
+	}
+
+	for _, feedId := range feedIds {
+		if err := s.store.MarkFeedPostsAsSeenBeforeForUser(userId, feedId, before); err != nil && !errors.Is(err, sql.ErrNoRows) {
+			s.logErrorAndRespond(w, http.StatusInternalServerError, "Error marking as read", "Error marking feed posts as seen for GReader", err, "feedId", feedId, "userId", userId)
+			return
+		}
+	}
+	greaderOK(w)
+}
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/aggregat4/rssgrid/internal/db"
+	"github.com/go-chi/chi/v5"
+)
+
+// maxWidgetHeight is the most grid rows a single widget may span.
+const maxWidgetHeight = 6
+
+// layoutGrid tracks which cells of a dashboard grid are taken.
+type layoutGrid struct {
+	columns int
+	taken   map[[2]int]bool
+}
+
+func newLayoutGrid(columns int) *layoutGrid {
+	return &layoutGrid{columns: columns, taken: make(map[[2]int]bool)}
+}
+
+// fits reports whether l lies inside the grid without covering a taken cell.
+func (g *layoutGrid) fits(l db.WidgetLayout) bool {
+	if l.Column < 1 || l.Row < 1 || l.Column+l.Width-1 > g.columns {
+		return false
+	}
+	for c := l.Column; c < l.Column+l.Width; c++ {
+		for r := l.Row; r < l.Row+l.Height; r++ {
+			if g.taken[[2]int{c, r}] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (g *layoutGrid) take(l db.WidgetLayout) {
+	for c := l.Column; c < l.Column+l.Width; c++ {
+		for r := l.Row; r < l.Row+l.Height; r++ {
+			g.taken[[2]int{c, r}] = true
+		}
+	}
+}
+
+// placeFirstFree moves l to the first cell, in reading order, where it fits.
+func (g *layoutGrid) placeFirstFree(l db.WidgetLayout) db.WidgetLayout {
+	for l.Row = 1; ; l.Row++ {
+		for l.Column = 1; l.Column+l.Width-1 <= g.columns; l.Column++ {
+			if g.fits(l) {
+				return l
+			}
+		}
+	}
+}
+
+// placeWidgets gives every widget a place on a grid with the given number of
+// columns. Widgets keep their saved place where it still fits, for example
+// after the column count shrank; the others go in the first free cell, so a
+// dashboard without a saved layout fills row by row.
+func placeWidgets(widgets []widgetData, columns int) []widgetData {
+	if columns < 1 {
+		columns = 1
+	}
+	grid := newLayoutGrid(columns)
+	var unplaced []int
+	for i := range widgets {
+		l := &widgets[i].Layout
+		l.Width = min(max(l.Width, 1), columns)
+		l.Height = min(max(l.Height, 1), maxWidgetHeight)
+		if l.Column > 0 && grid.fits(*l) {
+			grid.take(*l)
+			continue
+		}
+		unplaced = append(unplaced, i)
+	}
+	for _, i := range unplaced {
+		widgets[i].Layout = grid.placeFirstFree(widgets[i].Layout)
+		grid.take(widgets[i].Layout)
+	}
+	return widgets
+}
+
+// layoutRequest is the body of a save layout request.
+type layoutRequest struct {
+	Widgets []struct {
+		FeedID int64 `json:"feedId"`
+		Column int   `json:"column"`
+		Row    int   `json:"row"`
+		Width  int   `json:"width"`
+		Height int   `json:"height"`
+	} `json:"widgets"`
+}
+
+// handleSaveDashboardLayout stores the place and size of the widgets on a
+// dashboard, as arranged in the layout editor.
+func (s *Server) handleSaveDashboardLayout(w http.ResponseWriter, r *http.Request) {
+	dashboardId, err := strconv.ParseInt(chi.URLParam(r, "dashboardId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid dashboard ID format", http.StatusBadRequest)
+		return
+	}
+
+	var req layoutRequest
+	if !decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	userId := s.getUserID(r)
+
+	columns, err := s.store.GetUserColumns(userId)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error fetching user preferences", "Error fetching columns preference", err, "userId", userId)
+		return
+	}
+
+	grid := newLayoutGrid(columns)
+	layout := make(map[int64]db.WidgetLayout, len(req.Widgets))
+	for _, widget := range req.Widgets {
+		l := db.WidgetLayout{Column: widget.Column, Row: widget.Row, Width: widget.Width, Height: widget.Height}
+		if _, duplicate := layout[widget.FeedID]; duplicate {
+			writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("feed %d appears twice", widget.FeedID))
+			return
+		}
+		if l.Width < 1 || l.Height < 1 || l.Height > maxWidgetHeight || !grid.fits(l) {
+			writeAPIError(w, http.StatusBadRequest, fmt.Sprintf("feed %d does not fit on the grid", widget.FeedID))
+			return
+		}
+		grid.take(l)
+		layout[widget.FeedID] = l
+	}
+
+	if err := s.store.SaveDashboardLayoutForUser(userId, dashboardId, layout); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			writeAPIError(w, http.StatusNotFound, "dashboard or feed not found")
+			return
+		}
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error saving layout", "Error saving dashboard layout", err, "dashboardId", dashboardId, "userId", userId)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,629 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"runtime/debug"
+	"strconv"
+	"strings"
+
+	"github.com/aggregat4/rssgrid/internal/config"
+	"github.com/aggregat4/rssgrid/internal/db"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// LocalAuth configures sign in with accounts stored by RSSGrid itself,
+// instead of an external OIDC provider.
+type LocalAuth struct {
+	// Registration is one of the config.Registration* policies.
+	Registration string
+	// WebAuthn enables passkeys when set.
+	WebAuthn *webauthn.WebAuthn
+}
+
+// SetLocalAuth switches the web interface from OIDC to local accounts.
+func (s *Server) SetLocalAuth(auth LocalAuth) {
+	s.localAuth = &auth
+	s.loginAddressFailures = newAttemptLimiter(maxLoginFailuresPerAddress, attemptWindow)
+	s.loginUsernameFailures = newAttemptLimiter(maxLoginFailuresPerUsername, attemptWindow)
+	s.registerAddressFailures = newAttemptLimiter(maxRegisterFailuresPerAddress, attemptWindow)
+}
+
+// NewWebAuthn configures passkeys for RSSGrid served at publicURL.
+func NewWebAuthn(publicURL string) (*webauthn.WebAuthn, error) {
+	u, err := url.Parse(publicURL)
+	if err != nil || u.Hostname() == "" {
+		return nil, fmt.Errorf("invalid public URL %q", publicURL)
+	}
+	return webauthn.New(&webauthn.Config{
+		RPID:          u.Hostname(),
+		RPDisplayName: "RSSGrid",
+		RPOrigins:     []string{u.Scheme + "://" + u.Host},
+	})
+}
+
+// Username and password limits for local accounts. bcrypt only looks at the
+// first 72 bytes of a password.
+const (
+	minPasswordLength = 8
+	maxPasswordLength = 72
+	maxPasskeyName    = 100
+)
+
+var usernamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]{2,49}$`)
+
+// normalizeUsername makes usernames compare case-insensitively.
+func normalizeUsername(username string) string {
+	return strings.ToLower(strings.TrimSpace(username))
+}
+
+func validatePassword(password string) error {
+	if len(password) < minPasswordLength || len(password) > maxPasswordLength {
+		return fmt.Errorf("passwords must be between %d and %d characters", minPasswordLength, maxPasswordLength)
+	}
+	return nil
+}
+
+// localAuthMiddleware sends visitors without a session to the sign in page.
+func localAuthMiddleware(isAuthenticated, skipper func(r *http.Request) bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !skipper(r) && !isAuthenticated(r) {
+				if r.Method == http.MethodGet || r.Method == http.MethodHead {
+					http.Redirect(w, r, "/login", http.StatusFound)
+					return
+				}
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// localAuthRoutes mounts the public sign in and registration pages.
+func (s *Server) localAuthRoutes(r chi.Router) {
+	r.Get("/login", s.handleLoginPage)
+	r.Post("/login", s.handleLogin)
+	r.Get("/register", s.handleRegisterPage)
+	r.Post("/register", s.handleRegister)
+	r.Post("/passkeys/login/begin", s.handleBeginPasskeyLogin)
+	r.Post("/passkeys/login/finish", s.handleFinishPasskeyLogin)
+}
+
+// isLocalAuthPublicPath reports whether a path is reachable without signing
+// in when using local accounts.
+func isLocalAuthPublicPath(path string) bool {
+	return path == "/login" || path == "/register" || strings.HasPrefix(path, "/passkeys/login/") ||
+		strings.HasPrefix(path, "/static/")
+}
+
+// registrationMode returns how a new account may be registered right now:
+// the first account is always allowed, after that the configured policy
+// applies.
+func (s *Server) registrationMode() (string, error) {
+	count, err := s.store.CountLocalUsers()
+	if err != nil {
+		return "", err
+	}
+	if count == 0 {
+		return config.RegistrationOpen, nil
+	}
+	return s.localAuth.Registration, nil
+}
+
+// signIn stores the user in the session.
+func (s *Server) signIn(w http.ResponseWriter, r *http.Request, userId int64) error {
+	session, err := s.sessions.Get(r, "user_session")
+	if err != nil {
+		return fmt.Errorf("error getting session: %w", err)
+	}
+	session.Values["user_id"] = userId
+	if err := session.Save(r, w); err != nil {
+		return fmt.Errorf("error saving session: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) handleLoginPage(w http.ResponseWriter, r *http.Request) {
+	mode, err := s.registrationMode()
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Internal server error", "Error getting registration mode", err)
+		return
+	}
+
+	data := struct {
+		FlashMessages   []FlashMessage
+		CanRegister     bool
+		PasskeysEnabled bool
+	}{
+		FlashMessages:   s.getFlashMessages(w, r),
+		CanRegister:     mode != config.RegistrationClosed,
+		PasskeysEnabled: s.localAuth.WebAuthn != nil,
+	}
+	if err := s.templates.ExecuteTemplate(w, "login.html", data); err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error rendering template", "Error rendering login template", err)
+	}
+}
+
+func (s *Server) handleLogin(w http.ResponseWriter, r *http.Request) {
+	username := normalizeUsername(r.FormValue("username"))
+	address := clientAddress(r)
+	if !s.loginAddressFailures.Allowed(address) || !s.loginUsernameFailures.Allowed(username) {
+		s.addErrorFlash(w, r, "Too many failed sign-in attempts. Try again later.")
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	userId, err := s.store.AuthenticateLocalUser(username, r.FormValue("password"))
+	if err != nil {
+		if errors.Is(err, db.ErrInvalidCredentials) {
+			s.loginAddressFailures.Fail(address)
+			s.loginUsernameFailures.Fail(username)
+			s.addErrorFlash(w, r, "Invalid username or password.")
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+			return
+		}
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error signing in", "Error authenticating local user", err)
+		return
+	}
+	s.loginUsernameFailures.Reset(username)
+
+	if err := s.signIn(w, r, userId); err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error signing in", "Error signing in local user", err, "userId", userId)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (s *Server) handleRegisterPage(w http.ResponseWriter, r *http.Request) {
+	mode, err := s.registrationMode()
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Internal server error", "Error getting registration mode", err)
+		return
+	}
+
+	data := struct {
+		FlashMessages  []FlashMessage
+		Closed         bool
+		InviteRequired bool
+		Invite         string
+	}{
+		FlashMessages:  s.getFlashMessages(w, r),
+		Closed:         mode == config.RegistrationClosed,
+		InviteRequired: mode == config.RegistrationInvite,
+		Invite:         r.URL.Query().Get("invite"),
+	}
+	if err := s.templates.ExecuteTemplate(w, "register.html", data); err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error rendering template", "Error rendering register template", err)
+	}
+}
+
+func (s *Server) handleRegister(w http.ResponseWriter, r *http.Request) {
+	mode, err := s.registrationMode()
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Internal server error", "Error getting registration mode", err)
+		return
+	}
+	if mode == config.RegistrationClosed {
+		http.Error(w, "Registration is closed", http.StatusForbidden)
+		return
+	}
+
+	invite := strings.TrimSpace(r.FormValue("invite"))
+	retry := "/register"
+	if invite != "" {
+		retry += "?invite=" + url.QueryEscape(invite)
+	}
+
+	// Taken usernames and invalid invites count as failures, so that neither
+	// can be guessed quickly.
+	address := clientAddress(r)
+	if !s.registerAddressFailures.Allowed(address) {
+		s.addErrorFlash(w, r, "Too many failed registration attempts. Try again later.")
+		http.Redirect(w, r, retry, http.StatusSeeOther)
+		return
+	}
+
+	username := normalizeUsername(r.FormValue("username"))
+	if !usernamePattern.MatchString(username) {
+		s.addErrorFlash(w, r, "Usernames must be 3 to 50 letters, digits, dots, dashes or underscores.")
+		http.Redirect(w, r, retry, http.StatusSeeOther)
+		return
+	}
+	password := r.FormValue("password")
+	if err := validatePassword(password); err != nil {
+		s.addErrorFlash(w, r, "Could not register: "+err.Error())
+		http.Redirect(w, r, retry, http.StatusSeeOther)
+		return
+	}
+	if mode != config.RegistrationInvite {
+		invite = ""
+	} else if invite == "" {
+		s.addErrorFlash(w, r, "An invite code is required to register.")
+		http.Redirect(w, r, retry, http.StatusSeeOther)
+		return
+	}
+
+	userId, err := s.store.CreateLocalUser(username, password, invite)
+	if err != nil {
+		switch {
+		case errors.Is(err, db.ErrUsernameTaken):
+			s.registerAddressFailures.Fail(address)
+			s.addErrorFlash(w, r, "That username is already taken.")
+		case errors.Is(err, db.ErrInvalidInvite):
+			s.registerAddressFailures.Fail(address)
+			s.addErrorFlash(w, r, "That invite code is invalid or has already been used.")
+		default:
+			s.logErrorAndRespond(w, http.StatusInternalServerError, "Error registering", "Error creating local user", err, "username", username)
+			return
+		}
+		http.Redirect(w, r, retry, http.StatusSeeOther)
+		return
+	}
+
+	if err := s.signIn(w, r, userId); err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error signing in", "Error signing in new local user", err, "userId", userId)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// accountSettings is the local account section of the settings page.
+type accountSettings struct {
+	db.LocalAccount
+	PasskeysEnabled bool
+	Passkeys        []db.Passkey
+	// Invites are only listed for the admin when registration needs them.
+	InvitesEnabled bool
+	Invites        []db.Invite
+}
+
+// getAccountSettings returns nil for users who sign in with OIDC.
+func (s *Server) getAccountSettings(userId int64) (*accountSettings, error) {
+	if s.localAuth == nil {
+		return nil, nil
+	}
+	account, err := s.store.GetLocalAccountForUser(userId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	settings := &accountSettings{
+		LocalAccount:    account,
+		PasskeysEnabled: s.localAuth.WebAuthn != nil,
+		InvitesEnabled:  account.IsAdmin && s.localAuth.Registration == config.RegistrationInvite,
+	}
+	if settings.PasskeysEnabled {
+		if settings.Passkeys, err = s.store.GetPasskeysForUser(userId); err != nil {
+			return nil, err
+		}
+	}
+	if settings.InvitesEnabled {
+		if settings.Invites, err = s.store.GetInvitesForUser(userId); err != nil {
+			return nil, err
+		}
+	}
+	return settings, nil
+}
+
+func (s *Server) handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	userId := s.getUserID(r)
+
+	newPassword := r.FormValue("newPassword")
+	if err := validatePassword(newPassword); err != nil {
+		s.addErrorFlash(w, r, "Could not change password: "+err.Error())
+		http.Redirect(w, r, "/settings#account", http.StatusSeeOther)
+		return
+	}
+
+	if err := s.store.ChangePasswordForUser(userId, r.FormValue("currentPassword"), newPassword); err != nil {
+		if errors.Is(err, db.ErrInvalidCredentials) {
+			s.addErrorFlash(w, r, "The current password is not correct.")
+			http.Redirect(w, r, "/settings#account", http.StatusSeeOther)
+			return
+		}
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error changing password", "Error changing password for user", err, "userId", userId)
+		return
+	}
+
+	s.addSuccessFlash(w, r, "Password changed.")
+	http.Redirect(w, r, "/settings#account", http.StatusSeeOther)
+}
+
+// requireAdmin responds with 403 and returns false unless the user is the
+// admin of local accounts.
+func (s *Server) requireAdmin(w http.ResponseWriter, userId int64) bool {
+	account, err := s.store.GetLocalAccountForUser(userId)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Internal server error", "Error getting local account", err, "userId", userId)
+		return false
+	}
+	if !account.IsAdmin {
+		http.Error(w, "Only the admin can do this", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func (s *Server) handleCreateInvite(w http.ResponseWriter, r *http.Request) {
+	userId := s.getUserID(r)
+	if !s.requireAdmin(w, userId) {
+		return
+	}
+
+	code, err := s.store.CreateInviteForUser(userId)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error creating invite", "Error creating invite for user", err, "userId", userId)
+		return
+	}
+
+	// Render instead of redirecting: the invite link is only ever shown on this page.
+	s.renderSettings(w, r, settingsExtras{NewInviteURL: requestBaseURL(r) + "/register?invite=" + code})
+}
+
+func (s *Server) handleDeleteInvite(w http.ResponseWriter, r *http.Request) {
+	inviteId, err := strconv.ParseInt(chi.URLParam(r, "inviteId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid invite ID format", http.StatusBadRequest)
+		return
+	}
+
+	userId := s.getUserID(r)
+
+	if err := s.store.DeleteInviteForUser(userId, inviteId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Invite not found", http.StatusNotFound)
+			return
+		}
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error deleting invite", "Error deleting invite for user", err, "inviteId", inviteId, "userId", userId)
+		return
+	}
+
+	s.addSuccessFlash(w, r, "Invite withdrawn.")
+	http.Redirect(w, r, "/settings#account", http.StatusSeeOther)
+}
+
+// passkeyUser adapts a local account to the WebAuthn library. The user
+// handle is the decimal user ID.
+type passkeyUser struct {
+	id          int64
+	name        string
+	credentials []webauthn.Credential
+}
+
+func (u *passkeyUser) WebAuthnID() []byte {
+	return []byte(strconv.FormatInt(u.id, 10))
+}
+
+func (u *passkeyUser) WebAuthnName() string {
+	return u.name
+}
+
+func (u *passkeyUser) WebAuthnDisplayName() string {
+	return u.name
+}
+
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+// loadPasskeyUser loads a local account together with its passkeys.
+func (s *Server) loadPasskeyUser(userId int64) (*passkeyUser, error) {
+	account, err := s.store.GetLocalAccountForUser(userId)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := s.store.GetPasskeyCredentialsForUser(userId)
+	if err != nil {
+		return nil, err
+	}
+	user := &passkeyUser{id: userId, name: account.Username}
+	for _, data := range stored {
+		var credential webauthn.Credential
+		if err := json.Unmarshal([]byte(data), &credential); err != nil {
+			return nil, fmt.Errorf("error decoding passkey: %w", err)
+		}
+		user.credentials = append(user.credentials, credential)
+	}
+	return user, nil
+}
+
+// saveCeremony keeps the state of a passkey ceremony in the session until
+// the browser answers.
+func (s *Server) saveCeremony(w http.ResponseWriter, r *http.Request, key string, data *webauthn.SessionData) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("error encoding passkey session: %w", err)
+	}
+	session, err := s.sessions.Get(r, "user_session")
+	if err != nil {
+		return fmt.Errorf("error getting session: %w", err)
+	}
+	session.Values[key] = string(encoded)
+	return session.Save(r, w)
+}
+
+// takeCeremony returns and forgets the state saved by saveCeremony.
+func (s *Server) takeCeremony(w http.ResponseWriter, r *http.Request, key string) (webauthn.SessionData, error) {
+	var data webauthn.SessionData
+	session, err := s.sessions.Get(r, "user_session")
+	if err != nil {
+		return data, fmt.Errorf("error getting session: %w", err)
+	}
+	encoded, ok := session.Values[key].(string)
+	if !ok {
+		return data, errors.New("no passkey ceremony in progress")
+	}
+	delete(session.Values, key)
+	if err := session.Save(r, w); err != nil {
+		return data, fmt.Errorf("error saving session: %w", err)
+	}
+	if err := json.Unmarshal([]byte(encoded), &data); err != nil {
+		return data, fmt.Errorf("error decoding passkey session: %w", err)
+	}
+	return data, nil
+}
+
+func (s *Server) handleBeginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	if s.localAuth == nil || s.localAuth.WebAuthn == nil {
+		http.NotFound(w, r)
+		return
+	}
+	userId := s.getUserID(r)
+
+	user, err := s.loadPasskeyUser(userId)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error adding passkey", "Error loading passkey user", err, "userId", userId)
+		return
+	}
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(user.credentials))
+	for _, credential := range user.credentials {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+	creation, ceremony, err := s.localAuth.WebAuthn.BeginRegistration(user,
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired))
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error adding passkey", "Error beginning passkey registration", err, "userId", userId)
+		return
+	}
+	if err := s.saveCeremony(w, r, "passkey_registration", ceremony); err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error adding passkey", "Error saving passkey registration", err, "userId", userId)
+		return
+	}
+	writeJSON(w, http.StatusOK, creation)
+}
+
+func (s *Server) handleFinishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	if s.localAuth == nil || s.localAuth.WebAuthn == nil {
+		http.NotFound(w, r)
+		return
+	}
+	userId := s.getUserID(r)
+
+	name := strings.TrimSpace(r.URL.Query().Get("name"))
+	if name == "" || len(name) > maxPasskeyName {
+		http.Error(w, fmt.Sprintf("Passkey name is required and may be at most %d characters", maxPasskeyName), http.StatusBadRequest)
+		return
+	}
+
+	ceremony, err := s.takeCeremony(w, r, "passkey_registration")
+	if err != nil {
+		http.Error(w, "No passkey registration in progress", http.StatusBadRequest)
+		return
+	}
+	user, err := s.loadPasskeyUser(userId)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error adding passkey", "Error loading passkey user", err, "userId", userId)
+		return
+	}
+	credential, err := s.localAuth.WebAuthn.FinishRegistration(user, ceremony, r)
+	if err != nil {
+		log.Printf("Passkey registration failed for user %d: %v", userId, err)
+		http.Error(w, "The passkey could not be verified", http.StatusBadRequest)
+		return
+	}
+
+	encoded, err := json.Marshal(credential)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error adding passkey", "Error encoding passkey", err, "userId", userId)
+		return
+	}
+	if err := s.store.AddPasskeyForUser(userId, name, credential.ID, string(encoded)); err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error adding passkey", "Error storing passkey", err, "userId", userId)
+		return
+	}
+	s.addSuccessFlash(w, r, "Passkey added.")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleDeletePasskey(w http.ResponseWriter, r *http.Request) {
+	passkeyId, err := strconv.ParseInt(chi.URLParam(r, "passkeyId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid passkey ID format", http.StatusBadRequest)
+		return
+	}
+
+	userId := s.getUserID(r)
+
+	if err := s.store.DeletePasskeyForUser(userId, passkeyId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Passkey not found", http.StatusNotFound)
+			return
+		}
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error removing passkey", "Error deleting passkey for user", err, "passkeyId", passkeyId, "userId", userId)
+		return
+	}
+
+	s.addSuccessFlash(w, r, "Passkey removed.")
+	http.Redirect(w, r, "/settings#account", http.StatusSeeOther)
+}
+
+func (s *Server) handleBeginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	if s.localAuth.WebAuthn == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	assertion, ceremony, err := s.localAuth.WebAuthn.BeginDiscoverableLogin()
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error signing in", "Error beginning passkey login", err)
+		return
+	}
+	if err := s.saveCeremony(w, r, "passkey_login", ceremony); err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error signing in", "Error saving passkey login", err)
+		return
+	}
+	writeJSON(w, http.StatusOK, assertion)
+}
+
+func (s *Server) handleFinishPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	if s.localAuth.WebAuthn == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	ceremony, err := s.takeCeremony(w, r, "passkey_login")
+	if err != nil {
+		http.Error(w, "No passkey sign in in progress", http.StatusBadRequest)
+		return
+	}
+	user, credential, err := s.localAuth.WebAuthn.FinishPasskeyLogin(func(rawID, userHandle []byte) (webauthn.User, error) {
+		userId, err := strconv.ParseInt(string(userHandle), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user handle: %w", err)
+		}
+		return s.loadPasskeyUser(userId)
+	}, ceremony, r)
+	if err != nil {
+		log.Printf("Passkey sign in failed: %v", err)
+		http.Error(w, "The passkey could not be verified", http.StatusUnauthorized)
+		return
+	}
+
+	userId := user.(*passkeyUser).id
+	// Remember the new signature counter so cloned authenticators can be detected
+	if encoded, err := json.Marshal(credential); err != nil {
+		log.Printf("Error encoding passkey for user %d: %v\nStack trace:\n%s", userId, err, debug.Stack())
+	} else if err := s.store.UpdatePasskeyCredential(credential.ID, string(encoded)); err != nil {
+		log.Printf("Error updating passkey for user %d: %v\nStack trace:\n%s", userId, err, debug.Stack())
+	}
+
+	if err := s.signIn(w, r, userId); err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error signing in", "Error signing in passkey user", err, "userId", userId)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
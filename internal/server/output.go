@@ -0,0 +1,216 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aggregat4/rssgrid/internal/db"
+	"github.com/aggregat4/rssgrid/internal/feed"
+	"github.com/go-chi/chi/v5"
+)
+
+// defaultOutputItems and maxOutputItems bound the number of posts in an
+// output feed.
+const (
+	defaultOutputItems = 50
+	maxOutputItems     = 500
+)
+
+// outputRoutes serve the user's posts from all their feeds as a single Atom
+// or JSON feed. Feed readers cannot send headers, so the token may be given
+// as the token query parameter. Since such URLs get passed around, only
+// read-only feed tokens are accepted.
+func (s *Server) outputRoutes(r chi.Router) {
+	r.Use(s.outputAuthMiddleware)
+
+	r.Get("/atom.xml", s.handleAtomOutput)
+	r.Get("/feed.json", s.handleJSONFeedOutput)
+}
+
+// outputAuthMiddleware authenticates requests with a read-only feed token
+// from the token query parameter or a bearer Authorization header.
+func (s *Server) outputAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if bearer, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+			token = bearer
+		}
+		token = strings.TrimSpace(token)
+		if token == "" {
+			http.Error(w, "Missing token", http.StatusUnauthorized)
+			return
+		}
+
+		userId, err := s.store.GetUserIDForFeedToken(token)
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				log.Printf("Error looking up API token: %v\nStack trace:\n%s", err, debug.Stack())
+				http.Error(w, "Error authenticating request", http.StatusInternalServerError)
+				return
+			}
+			http.Error(w, "Invalid or revoked token", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiUserIDKey{}, userId)))
+	})
+}
+
+func (s *Server) handleAtomOutput(w http.ResponseWriter, r *http.Request) {
+	out, ok := s.outputFeed(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/atom+xml; charset=utf-8")
+	if err := feed.WriteAtom(w, out); err != nil {
+		log.Printf("Error writing Atom output feed: %v\nContext: [userId %d]", err, apiUserID(r))
+	}
+}
+
+func (s *Server) handleJSONFeedOutput(w http.ResponseWriter, r *http.Request) {
+	out, ok := s.outputFeed(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/feed+json; charset=utf-8")
+	if err := feed.WriteJSONFeed(w, out); err != nil {
+		log.Printf("Error writing JSON output feed: %v\nContext: [userId %d]", err, apiUserID(r))
+	}
+}
+
+// requestBaseURL reconstructs the scheme and host the request was sent to.
+func requestBaseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
+
+// outputFeed collects the newest posts of the request's user, limited to the
+// dashboard and filter rule given by the dashboard and filter parameters. It
+// responds with an error and returns false if they are not the user's.
+func (s *Server) outputFeed(w http.ResponseWriter, r *http.Request) (feed.OutputFeed, bool) {
+	userId := apiUserID(r)
+	title := "RSSGrid"
+	query := db.PostQuery{ByPublished: true, NewestFirst: true, Limit: defaultOutputItems}
+	if n, err := strconv.Atoi(r.URL.Query().Get("n")); err == nil && n > 0 {
+		query.Limit = min(n, maxOutputItems)
+	}
+
+	if value := r.URL.Query().Get("dashboard"); value != "" {
+		dashboardId, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid dashboard ID", http.StatusBadRequest)
+			return feed.OutputFeed{}, false
+		}
+		dashboards, err := s.store.GetDashboardsForUser(userId)
+		if err != nil {
+			s.logErrorAndRespond(w, http.StatusInternalServerError, "Error fetching dashboards", "Error fetching dashboards for output feed", err, "userId", userId)
+			return feed.OutputFeed{}, false
+		}
+		var dashboard *db.Dashboard
+		for i := range dashboards {
+			if dashboards[i].ID == dashboardId {
+				dashboard = &dashboards[i]
+			}
+		}
+		if dashboard == nil {
+			http.Error(w, "Dashboard not found", http.StatusNotFound)
+			return feed.OutputFeed{}, false
+		}
+		feeds, err := s.store.GetDashboardFeeds(userId, dashboardId)
+		if err != nil {
+			s.logErrorAndRespond(w, http.StatusInternalServerError, "Error fetching feeds", "Error fetching dashboard feeds for output feed", err, "dashboardId", dashboardId, "userId", userId)
+			return feed.OutputFeed{}, false
+		}
+		query.FeedIDs = []int64{}
+		for _, f := range feeds {
+			query.FeedIDs = append(query.FeedIDs, f.ID)
+		}
+		title += ": " + dashboard.Name
+	}
+
+	if value := r.URL.Query().Get("filter"); value != "" {
+		ruleId, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid filter ID", http.StatusBadRequest)
+			return feed.OutputFeed{}, false
+		}
+		rules, err := s.store.GetFilterRulesForUser(userId)
+		if err != nil {
+			s.logErrorAndRespond(w, http.StatusInternalServerError, "Error fetching filters", "Error fetching filter rules for output feed", err, "userId", userId)
+			return feed.OutputFeed{}, false
+		}
+		var rule *db.FilterRule
+		for i := range rules {
+			if rules[i].ID == ruleId {
+				rule = &rules[i]
+			}
+		}
+		if rule == nil {
+			http.Error(w, "Filter not found", http.StatusNotFound)
+			return feed.OutputFeed{}, false
+		}
+		query.FilterRuleID = ruleId
+		title += fmt.Sprintf(" matching %q", rule.Pattern)
+	}
+
+	posts, err := s.store.QueryPostsForUser(userId, query)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error fetching posts", "Error querying posts for output feed", err, "userId", userId)
+		return feed.OutputFeed{}, false
+	}
+	feeds, err := s.store.GetUserFeeds(userId)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error fetching feeds", "Error fetching feeds for output feed", err, "userId", userId)
+		return feed.OutputFeed{}, false
+	}
+	feedsById := make(map[int64]db.Feed, len(feeds))
+	for _, f := range feeds {
+		feedsById[f.ID] = f
+	}
+
+	// The token is left out of the self URL, which aggregators and proxies
+	// show and log; readers keep using the URL they were subscribed with.
+	baseURL := requestBaseURL(r)
+	selfURL := *r.URL
+	selfQuery := selfURL.Query()
+	selfQuery.Del("token")
+	selfURL.RawQuery = selfQuery.Encode()
+	out := feed.OutputFeed{
+		Title:   title,
+		SelfURL: baseURL + selfURL.RequestURI(),
+		HomeURL: baseURL + "/",
+		Updated: time.Now(),
+	}
+	for i, p := range posts {
+		if i == 0 {
+			out.Updated = p.PublishedAt
+		}
+		if p.UpdatedAt.After(out.Updated) {
+			out.Updated = p.UpdatedAt
+		}
+		source := feedsById[p.FeedID]
+		out.Items = append(out.Items, feed.OutputItem{
+			ID:          fmt.Sprintf("%s/posts/%d", baseURL, p.ID),
+			Title:       p.Title,
+			Link:        p.Link,
+			Author:      p.Author,
+			Content:     p.Content,
+			Published:   p.PublishedAt,
+			Updated:     p.UpdatedAt,
+			SourceTitle: source.Title,
+			SourceURL:   source.URL,
+		})
+	}
+	return out, true
+}
@@ -5,15 +5,20 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"html"
 	"html/template"
 	"log"
 	"net/http"
+	"net/url"
 	"runtime/debug"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	baseliboidc "github.com/aggregat4/go-baselib-services/v3/oidc"
 	"github.com/aggregat4/rssgrid/internal/db"
+	"github.com/aggregat4/rssgrid/internal/events"
 	"github.com/aggregat4/rssgrid/internal/feed"
 	"github.com/aggregat4/rssgrid/internal/templates"
 	"github.com/coreos/go-oidc/v3/oidc"
@@ -26,8 +31,42 @@ type Server struct {
 	store      StoreInterface
 	sessions   *sessions.CookieStore
 	fetcher    *feed.Fetcher
+	refresher  FeedRefresher
+	events     *events.Bus
 	templates  *template.Template
 	oidcConfig *baseliboidc.OidcConfiguration
+	// localAuth replaces OIDC with local accounts when set.
+	localAuth *LocalAuth
+	// Failed sign-ins and registrations are throttled against password and
+	// invite guessing; see attempts.go.
+	loginAddressFailures    *attemptLimiter
+	loginUsernameFailures   *attemptLimiter
+	registerAddressFailures *attemptLimiter
+
+	// shuttingDown is closed when the HTTP server starts shutting down, so
+	// long-lived event streams let go of their connections.
+	shuttingDown chan struct{}
+}
+
+// FeedRefresher fetches feeds on demand. *feed.Updater satisfies it.
+type FeedRefresher interface {
+	RefreshFeeds(ctx context.Context, feeds []db.Feed) []feed.RefreshResult
+}
+
+// SetRefresher enables the manual refresh actions.
+func (s *Server) SetRefresher(refresher FeedRefresher) {
+	s.refresher = refresher
+}
+
+// SetFetcher replaces the fetcher used to subscribe to feeds, e.g. with one
+// configured with the same limits as the updater's.
+func (s *Server) SetFetcher(fetcher *feed.Fetcher) {
+	s.fetcher = fetcher
+}
+
+// SetEventBus enables live dashboard updates for changes published on bus.
+func (s *Server) SetEventBus(bus *events.Bus) {
+	s.events = bus
 }
 
 // StoreInterface defines the interface that the server needs
@@ -39,16 +78,76 @@ type StoreInterface interface {
 	AddFeed(url string) (int64, error)
 	AddFeedForUser(userID int64, url string) (int64, error)
 	UpdateFeedTitle(feedID int64, title string) error
-	AddPost(feedID int64, guid, title, link string, publishedAt time.Time, content string) error
+	UpdateFeedTitleIfEmpty(feedID int64, title string) error
+	GetFeedByID(feedID int64) (*db.Feed, error)
+	UpsertPostWithMetadata(feedID int64, guid, title, link, author string, publishedAt time.Time, content string, metadata db.PostMetadata) (db.PostChange, error)
+	ApplyMarkSeenFilterRules(feedID int64, guid string) error
 	DeleteFeedForUser(userID, feedID int64) error
 	MarkPostAsSeenForUser(userID, postID int64) error
 	MarkAllFeedPostsAsSeenForUser(userID, feedID int64) error
 	GetUserPostsPerFeed(userID int64) (int, error)
 	SetUserPostsPerFeed(userID int64, postsPerFeed int) error
-	MoveFeedUp(userID int64, feedID int64) error
-	MoveFeedDown(userID int64, feedID int64) error
 	GetUserColumns(userID int64) (int, error)
 	SetUserColumns(userID int64, columns int) error
+	SearchPostsForUser(userID int64, query string, limit int) ([]db.SearchResult, error)
+	CreateAPITokenForUser(userID int64, name string) (string, error)
+	CreateFeedTokenForUser(userID int64, name string) (string, error)
+	GetAPITokensForUser(userID int64) ([]db.APIToken, error)
+	DeleteAPITokenForUser(userID, tokenID int64) error
+	GetUserIDForAPIToken(token string) (int64, error)
+	GetUserIDForFeedToken(token string) (int64, error)
+	SetPostStarredForUser(userID, postID int64, starred bool) error
+	GetStarredPostsForUser(userID int64) ([]db.StarredPost, error)
+	GetPostRevisions(postID int64) ([]db.PostRevision, error)
+	GetUserUnseenOnUpdate(userID int64) (bool, error)
+	SetUserUnseenOnUpdate(userID int64, unseenOnUpdate bool) error
+	GetDashboardsForUser(userID int64) ([]db.Dashboard, error)
+	CreateDashboardForUser(userID int64, name string) (int64, error)
+	RenameDashboardForUser(userID, dashboardID int64, name string) error
+	DeleteDashboardForUser(userID, dashboardID int64) error
+	GetDashboardFeeds(userID, dashboardID int64) ([]db.Feed, error)
+	GetFeedDashboardIDsForUser(userID int64) (map[int64][]int64, error)
+	SetFeedDashboardsForUser(userID, feedID int64, dashboardIDs []int64) error
+	GetDashboardLayout(userID, dashboardID int64) (map[int64]db.WidgetLayout, error)
+	SetFeedSettingsForUser(userID, feedID int64, settings db.FeedSettings) error
+	SetFeedTagsForUser(userID, feedID int64, tags []string) error
+	SetFeedCredentialsForUser(userID, feedID int64, creds db.FeedCredentials) (int64, error)
+	AddFeedTagsForUser(userID, feedID int64, tags []string) error
+	GetTagsForUser(userID int64) ([]string, error)
+	MarkTagPostsAsSeenForUser(userID int64, tag string) error
+	GetUserHideRead(userID int64) (bool, error)
+	SetUserHideRead(userID int64, hideRead bool) error
+	SetFeedHideReadForUser(userID, feedID int64, hideRead bool) error
+	GetUnreadCountsForUser(userID int64) (map[int64]int, error)
+	GetFilterRulesForUser(userID int64) ([]db.FilterRule, error)
+	CreateFilterRuleForUser(userID int64, rule db.FilterRule) (int64, error)
+	DeleteFilterRuleForUser(userID, ruleID int64) error
+	QueryPostsForUser(userID int64, query db.PostQuery) ([]db.FeedPost, error)
+	CountPostsForUser(userID int64) (int, error)
+	GetUnreadPostIDsForUser(userID int64) ([]int64, error)
+	GetStarredPostIDsForUser(userID int64) ([]int64, error)
+	MarkPostAsUnseenForUser(userID, postID int64) error
+	MarkFeedPostsAsSeenBeforeForUser(userID, feedID int64, before time.Time) error
+	SetFeverCredentialsForUser(userID int64, username, password string) error
+	ClearFeverCredentialsForUser(userID int64) error
+	GetFeverUsernameForUser(userID int64) (string, error)
+	GetUserIDForFeverAPIKey(apiKey string) (int64, error)
+	SaveDashboardLayoutForUser(userID, dashboardID int64, layout map[int64]db.WidgetLayout) error
+	GetLastDashboardID(userID int64) (int64, error)
+	SetLastDashboardID(userID, dashboardID int64) error
+	CountLocalUsers() (int, error)
+	CreateLocalUser(username, password, inviteCode string) (int64, error)
+	AuthenticateLocalUser(username, password string) (int64, error)
+	ChangePasswordForUser(userID int64, currentPassword, newPassword string) error
+	GetLocalAccountForUser(userID int64) (db.LocalAccount, error)
+	CreateInviteForUser(userID int64) (string, error)
+	GetInvitesForUser(userID int64) ([]db.Invite, error)
+	DeleteInviteForUser(userID, inviteID int64) error
+	AddPasskeyForUser(userID int64, name string, credentialID []byte, credential string) error
+	GetPasskeysForUser(userID int64) ([]db.Passkey, error)
+	GetPasskeyCredentialsForUser(userID int64) ([]string, error)
+	UpdatePasskeyCredential(credentialID []byte, credential string) error
+	DeletePasskeyForUser(userID, passkeyID int64) error
 }
 
 type FlashMessage struct {
@@ -143,7 +242,7 @@ func NewServer(store StoreInterface, oidcConfig *baseliboidc.OidcConfiguration,
 	}
 
 	// Validate that required templates exist
-	requiredTemplates := []string{"dashboard.html", "settings.html", "post.html"}
+	requiredTemplates := []string{"dashboard.html", "settings.html", "post.html", "search.html"}
 	for _, tmplName := range requiredTemplates {
 		if tmpl := templates.Lookup(tmplName); tmpl == nil {
 			log.Printf("Warning: Required template '%s' not found", tmplName)
@@ -192,22 +291,10 @@ func (s *Server) Start(addr string) error {
 	return s.StartWithContext(context.Background(), addr)
 }
 
-func (s *Server) StartWithContext(ctx context.Context, addr string) error {
-	oidcAuthenticationMiddleware := s.oidcConfig.CreateOidcAuthenticationMiddleware(
-		func(r *http.Request) bool {
-			session, err := s.sessions.Get(r, "user_session")
-			if err != nil {
-				log.Printf("Error getting session in auth middleware: %v\nStack trace:\n%s", err, debug.Stack())
-				return false
-			}
-			return session.Values["user_id"] != nil
-		},
-		func(r *http.Request) bool {
-			return r.URL.Path == "/auth/callback"
-		},
-	)
-
-	oidcCallbackHandler := s.oidcConfig.CreateOidcCallbackHandler(
+// oidcCallbackHandler signs in the user returned by the OIDC provider,
+// creating them on their first visit.
+func (s *Server) oidcCallbackHandler() http.HandlerFunc {
+	return s.oidcConfig.CreateOidcCallbackHandler(
 		baseliboidc.CreateSTDSessionBasedOidcDelegate(
 			func(w http.ResponseWriter, r *http.Request, idToken *oidc.IDToken) error {
 				userId, err := s.store.GetOrCreateUser(idToken.Subject, idToken.Issuer)
@@ -231,17 +318,48 @@ func (s *Server) StartWithContext(ctx context.Context, addr string) error {
 			"/",
 		),
 	)
+}
+
+func (s *Server) StartWithContext(ctx context.Context, addr string) error {
+	isAuthenticated := func(r *http.Request) bool {
+		session, err := s.sessions.Get(r, "user_session")
+		if err != nil {
+			log.Printf("Error getting session in auth middleware: %v\nStack trace:\n%s", err, debug.Stack())
+			return false
+		}
+		return session.Values["user_id"] != nil
+	}
+	skipper := func(r *http.Request) bool {
+		// The APIs authenticate with their own credentials instead of sessions.
+		if strings.HasPrefix(r.URL.Path, "/api/") ||
+			r.URL.Path == "/fever" || strings.HasPrefix(r.URL.Path, "/fever/") ||
+			strings.HasPrefix(r.URL.Path, "/greader/") || strings.HasPrefix(r.URL.Path, "/output/") {
+			return true
+		}
+		if s.localAuth != nil {
+			return isLocalAuthPublicPath(r.URL.Path)
+		}
+		return r.URL.Path == "/auth/callback"
+	}
 
 	r := chi.NewRouter()
 
 	// Middleware
 	r.Use(panicRecoveryMiddleware) // Add our custom panic recovery first
-	r.Use(oidcAuthenticationMiddleware)
+	if s.localAuth != nil {
+		r.Use(localAuthMiddleware(isAuthenticated, skipper))
+	} else {
+		r.Use(s.oidcConfig.CreateOidcAuthenticationMiddleware(isAuthenticated, skipper))
+	}
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
 
 	// Public routes
-	r.Get("/auth/callback", oidcCallbackHandler)
+	if s.localAuth != nil {
+		s.localAuthRoutes(r)
+	} else {
+		r.Get("/auth/callback", s.oidcCallbackHandler())
+	}
 
 	// Static files
 	fileServer := templates.CreateStaticFileServer()
@@ -250,22 +368,68 @@ func (s *Server) StartWithContext(ctx context.Context, addr string) error {
 	// Protected routes
 	r.Group(func(r chi.Router) {
 		r.Get("/", s.handleDashboard)
+		r.Get("/dashboards/{dashboardId}", s.handleShowDashboard)
+		r.Post("/dashboards/{dashboardId}/layout", s.handleSaveDashboardLayout)
 		r.Get("/settings", s.handleSettings)
 		r.Get("/posts/{postId}", s.handleGetPost)
+		r.Get("/search", s.handleSearch)
+		r.Get("/starred", s.handleStarred)
+		r.Get("/events", s.handleEvents)
 		r.Post("/logout", s.handleLogout)
 		r.Post("/settings/feeds", s.handleAddFeed)
+		r.Post("/settings/opml/import", s.handleImportOPML)
+		r.Get("/settings/opml/export", s.handleExportOPML)
 		r.Post("/settings/feeds/{feedId}/delete", s.handleDeleteFeed)
 		r.Post("/settings/preferences", s.handleUpdatePreferences)
-		r.Post("/settings/feeds/{feedId}/move-up", s.handleMoveFeedUp)
-		r.Post("/settings/feeds/{feedId}/move-down", s.handleMoveFeedDown)
+		r.Post("/settings/feeds/{feedId}/dashboards", s.handleSetFeedDashboards)
+		r.Post("/settings/feeds/{feedId}/display", s.handleUpdateFeedSettings)
+		r.Post("/settings/feeds/{feedId}/tags", s.handleSetFeedTags)
+		r.Post("/settings/feeds/{feedId}/credentials", s.handleSetFeedCredentials)
+		r.Post("/settings/dashboards", s.handleCreateDashboard)
+		r.Post("/settings/dashboards/{dashboardId}/rename", s.handleRenameDashboard)
+		r.Post("/settings/dashboards/{dashboardId}/delete", s.handleDeleteDashboard)
+		r.Post("/settings/filters", s.handleCreateFilterRule)
+		r.Post("/settings/filters/{ruleId}/delete", s.handleDeleteFilterRule)
+		r.Post("/settings/fever", s.handleSetFeverCredentials)
+		r.Post("/settings/fever/delete", s.handleDeleteFeverCredentials)
+		r.Post("/settings/tokens", s.handleCreateAPIToken)
+		r.Post("/settings/tokens/{tokenId}/delete", s.handleDeleteAPIToken)
+		r.Post("/settings/password", s.handleChangePassword)
+		r.Post("/settings/invites", s.handleCreateInvite)
+		r.Post("/settings/invites/{inviteId}/delete", s.handleDeleteInvite)
+		r.Post("/settings/passkeys/begin", s.handleBeginPasskeyRegistration)
+		r.Post("/settings/passkeys/finish", s.handleFinishPasskeyRegistration)
+		r.Post("/settings/passkeys/{passkeyId}/delete", s.handleDeletePasskey)
 		r.Post("/posts/{postId}/seen", s.handleMarkPostSeen)
+		r.Post("/posts/{postId}/star", s.handleSetPostStarred(true))
+		r.Post("/posts/{postId}/unstar", s.handleSetPostStarred(false))
 		r.Post("/feeds/{feedId}/seen", s.handleMarkAllSeen)
+		r.Post("/feeds/{feedId}/hide-read", s.handleSetFeedHideRead(true))
+		r.Post("/feeds/{feedId}/show-read", s.handleSetFeedHideRead(false))
+		r.Post("/feeds/{feedId}/refresh", s.handleRefreshFeed)
+		r.Post("/feeds/refresh", s.handleRefreshAllFeeds)
+		r.Post("/tags/seen", s.handleMarkTagSeen)
 	})
 
+	// JSON API, authenticated with personal access tokens
+	r.Route("/api/v1", s.apiRoutes)
+
+	// Fever API for mobile clients, authenticated with its own API key
+	r.HandleFunc("/fever", s.handleFever)
+	r.HandleFunc("/fever/", s.handleFever)
+
+	// Google Reader API for sync clients, authenticated with personal access tokens
+	r.Route("/greader", s.greaderRoutes)
+
+	// Combined Atom and JSON feeds of the user's posts, authenticated with personal access tokens
+	r.Route("/output", s.outputRoutes)
+
 	server := &http.Server{
 		Addr:    addr,
 		Handler: r,
 	}
+	s.shuttingDown = make(chan struct{})
+	server.RegisterOnShutdown(func() { close(s.shuttingDown) })
 
 	log.Printf("Starting server on %s", addr)
 
@@ -294,27 +458,107 @@ func (s *Server) StartWithContext(ctx context.Context, addr string) error {
 	return nil
 }
 
-func splitFeedsIntoColumns[T any](feeds []T, numCols int) [][]T {
-	if numCols < 1 {
-		numCols = 1
+// feedPostLimit is the number of posts to show in a feed's widget: the
+// feed's own setting if the user made one, their default otherwise.
+func feedPostLimit(f db.Feed, postsPerFeed int) int {
+	if f.Settings.PostsPerFeed > 0 {
+		return f.Settings.PostsPerFeed
 	}
-	columns := make([][]T, numCols)
-	for i, feed := range feeds {
-		col := i % numCols
-		columns[col] = append(columns[col], feed)
-	}
-	return columns
+	return postsPerFeed
 }
 
+// widgetData is what the "widget" template renders for a single feed.
+type widgetData struct {
+	Feed   db.Feed
+	Posts  []db.Post
+	Layout db.WidgetLayout
+	// Unread is the number of posts in the feed the user has not seen.
+	Unread int
+	// AlwaysHideRead is set when the user hides read posts on every widget,
+	// which makes the feed's own setting moot.
+	AlwaysHideRead bool
+}
+
+// handleDashboard shows the dashboard the user viewed last, or their first
+// dashboard.
 func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
 	userId := s.getUserID(r)
 
-	feeds, err := s.store.GetUserFeeds(userId)
+	dashboards, err := s.store.GetDashboardsForUser(userId)
 	if err != nil {
-		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error fetching feeds", "Error fetching feeds for user", err, "userId", userId)
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error fetching dashboards", "Error fetching dashboards for user", err, "userId", userId)
+		return
+	}
+
+	lastDashboardId, err := s.store.GetLastDashboardID(userId)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error fetching user preferences", "Error fetching last dashboard", err, "userId", userId)
+		return
+	}
+
+	current := dashboards[0]
+	for _, d := range dashboards {
+		if d.ID == lastDashboardId {
+			current = d
+		}
+	}
+	s.renderDashboard(w, r, dashboards, current)
+}
+
+// handleShowDashboard shows one of the user's dashboards and remembers it as
+// the one to show on /.
+func (s *Server) handleShowDashboard(w http.ResponseWriter, r *http.Request) {
+	dashboardId, err := strconv.ParseInt(chi.URLParam(r, "dashboardId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid dashboard ID format", http.StatusBadRequest)
 		return
 	}
 
+	userId := s.getUserID(r)
+
+	dashboards, err := s.store.GetDashboardsForUser(userId)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error fetching dashboards", "Error fetching dashboards for user", err, "userId", userId)
+		return
+	}
+
+	for _, d := range dashboards {
+		if d.ID == dashboardId {
+			if err := s.store.SetLastDashboardID(userId, dashboardId); err != nil {
+				log.Printf("Error remembering last dashboard %d for user %d: %v", dashboardId, userId, err)
+			}
+			s.renderDashboard(w, r, dashboards, d)
+			return
+		}
+	}
+	http.Error(w, "Dashboard not found", http.StatusNotFound)
+}
+
+func (s *Server) renderDashboard(w http.ResponseWriter, r *http.Request, dashboards []db.Dashboard, current db.Dashboard) {
+	userId := s.getUserID(r)
+
+	dashboardFeeds, err := s.store.GetDashboardFeeds(userId, current.ID)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error fetching feeds", "Error fetching dashboard feeds for user", err, "userId", userId, "dashboardId", current.ID)
+		return
+	}
+
+	// The tags on the dashboard's feeds filter the widgets shown
+	currentTag := r.URL.Query().Get("tag")
+	var tags []string
+	var feeds []db.Feed
+	for _, f := range dashboardFeeds {
+		for _, tag := range f.Tags {
+			if !slices.ContainsFunc(tags, func(t string) bool { return strings.EqualFold(t, tag) }) {
+				tags = append(tags, tag)
+			}
+		}
+		if currentTag == "" || f.HasTag(currentTag) {
+			feeds = append(feeds, f)
+		}
+	}
+	slices.SortFunc(tags, func(a, b string) int { return strings.Compare(strings.ToLower(a), strings.ToLower(b)) })
+
 	// Get user's posts per feed preference
 	postsPerFeed, err := s.store.GetUserPostsPerFeed(userId)
 	if err != nil {
@@ -329,32 +573,63 @@ func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	type FeedData struct {
-		Feed  db.Feed
-		Posts []db.Post
+	layout, err := s.store.GetDashboardLayout(userId, current.ID)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error fetching layout", "Error fetching dashboard layout", err, "userId", userId, "dashboardId", current.ID)
+		return
+	}
+
+	hideRead, err := s.store.GetUserHideRead(userId)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error fetching user preferences", "Error fetching hide read preference", err, "userId", userId)
+		return
+	}
+
+	unreadCounts, err := s.store.GetUnreadCountsForUser(userId)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error fetching unread counts", "Error fetching unread counts for user", err, "userId", userId)
+		return
 	}
 
-	var feedData []FeedData
+	var feedData []widgetData
+	unreadTotal := 0
 	for _, f := range feeds {
-		posts, err := s.store.GetFeedPosts(f.ID, userId, postsPerFeed)
+		posts, err := s.store.GetFeedPosts(f.ID, userId, feedPostLimit(f, postsPerFeed))
 		if err != nil {
 			s.logErrorAndRespond(w, http.StatusInternalServerError, "Error fetching posts", "Error fetching posts for feed", err, "feedId", f.ID, "userId", userId)
 			return
 		}
-		feedData = append(feedData, FeedData{Feed: f, Posts: posts})
+		feedData = append(feedData, widgetData{
+			Feed:           f,
+			Posts:          posts,
+			Layout:         layout[f.ID],
+			Unread:         unreadCounts[f.ID],
+			AlwaysHideRead: hideRead,
+		})
+		unreadTotal += unreadCounts[f.ID]
 	}
 
-	columnsData := splitFeedsIntoColumns(feedData, columns)
-
 	data := struct {
-		Columns     [][]FeedData
-		ColumnCount int
+		Dashboards       []db.Dashboard
+		CurrentDashboard db.Dashboard
+		Tags             []string
+		CurrentTag       string
+		Widgets          []widgetData
+		ColumnCount      int
+		UnreadTotal      int
+		FlashMessages    []FlashMessage
 	}{
-		Columns:     columnsData,
-		ColumnCount: columns,
+		Dashboards:       dashboards,
+		CurrentDashboard: current,
+		Tags:             tags,
+		CurrentTag:       currentTag,
+		Widgets:          placeWidgets(feedData, columns),
+		ColumnCount:      columns,
+		UnreadTotal:      unreadTotal,
+		FlashMessages:    s.getFlashMessages(w, r),
 	}
 
-	log.Printf("Rendering dashboard template with %d feeds in %d columns", len(feedData), columns)
+	log.Printf("Rendering dashboard %d with %d feeds in %d columns", current.ID, len(feedData), columns)
 	if err := s.templates.ExecuteTemplate(w, "dashboard.html", data); err != nil {
 		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error rendering template", "Error rendering dashboard template", err, "templateData", data)
 		return
@@ -362,6 +637,26 @@ func (s *Server) handleDashboard(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) handleSettings(w http.ResponseWriter, r *http.Request) {
+	s.renderSettings(w, r, settingsExtras{})
+}
+
+// settingsExtras carries one-off state for a single rendering of the settings
+// page that is not persisted anywhere.
+type settingsExtras struct {
+	// DiscoveredFrom and FeedCandidates ask the user to pick one of the feeds
+	// discovered on a web page.
+	DiscoveredFrom string
+	FeedCandidates []feed.FeedCandidate
+	// NewAPIToken is the secret of a just-created token, shown exactly once.
+	NewAPIToken     string
+	NewAPITokenName string
+	// NewInviteURL is the registration link of a just-created invite, shown
+	// exactly once.
+	NewInviteURL string
+}
+
+// renderSettings renders the settings page together with any extras.
+func (s *Server) renderSettings(w http.ResponseWriter, r *http.Request, extras settingsExtras) {
 	userId := s.getUserID(r)
 
 	feeds, err := s.store.GetUserFeeds(userId)
@@ -384,19 +679,122 @@ func (s *Server) handleSettings(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	unseenOnUpdate, err := s.store.GetUserUnseenOnUpdate(userId)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error fetching user preferences", "Error fetching unseen on update preference", err, "userId", userId)
+		return
+	}
+
+	hideRead, err := s.store.GetUserHideRead(userId)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error fetching user preferences", "Error fetching hide read preference", err, "userId", userId)
+		return
+	}
+
+	tags, err := s.store.GetTagsForUser(userId)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error fetching tags", "Error fetching tags for user", err, "userId", userId)
+		return
+	}
+
+	filterRules, err := s.store.GetFilterRulesForUser(userId)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error fetching filter rules", "Error fetching filter rules for user", err, "userId", userId)
+		return
+	}
+
+	feverUsername, err := s.store.GetFeverUsernameForUser(userId)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error fetching Fever settings", "Error fetching Fever username for user", err, "userId", userId)
+		return
+	}
+
+	apiTokens, err := s.store.GetAPITokensForUser(userId)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error fetching API tokens", "Error fetching API tokens for user", err, "userId", userId)
+		return
+	}
+
+	account, err := s.getAccountSettings(userId)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error fetching account", "Error fetching local account for user", err, "userId", userId)
+		return
+	}
+
+	dashboards, err := s.store.GetDashboardsForUser(userId)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error fetching dashboards", "Error fetching dashboards for user", err, "userId", userId)
+		return
+	}
+	dashboardSettingsList := make([]dashboardSettings, 0, len(dashboards))
+	for _, dashboard := range dashboards {
+		dashboardFeeds, err := s.store.GetDashboardFeeds(userId, dashboard.ID)
+		if err != nil {
+			s.logErrorAndRespond(w, http.StatusInternalServerError, "Error fetching dashboards", "Error fetching dashboard feeds", err, "dashboardId", dashboard.ID, "userId", userId)
+			return
+		}
+		dashboardSettingsList = append(dashboardSettingsList, dashboardSettings{Dashboard: dashboard, Feeds: dashboardFeeds})
+	}
+
+	feedDashboardIds, err := s.store.GetFeedDashboardIDsForUser(userId)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error fetching dashboards", "Error fetching feed dashboards for user", err, "userId", userId)
+		return
+	}
+	feedPlacements := make(map[int64][]feedPlacement, len(feeds))
+	for _, f := range feeds {
+		placed := make(map[int64]bool)
+		for _, dashboardId := range feedDashboardIds[f.ID] {
+			placed[dashboardId] = true
+		}
+		for _, dashboard := range dashboards {
+			feedPlacements[f.ID] = append(feedPlacements[f.ID], feedPlacement{Dashboard: dashboard, Placed: placed[dashboard.ID]})
+		}
+	}
+
 	// Get flash messages
 	flashMessages := s.getFlashMessages(w, r)
 
 	data := struct {
-		Feeds         []db.Feed
-		FlashMessages []FlashMessage
-		PostsPerFeed  int
-		Columns       int
+		Feeds           []db.Feed
+		Tags            []string
+		CurrentTag      string
+		FeedPlacements  map[int64][]feedPlacement
+		Dashboards      []dashboardSettings
+		FlashMessages   []FlashMessage
+		PostsPerFeed    int
+		Columns         int
+		UnseenOnUpdate  bool
+		HideRead        bool
+		DiscoveredFrom  string
+		FeedCandidates  []feed.FeedCandidate
+		FilterRules     []db.FilterRule
+		FeverUsername   string
+		APITokens       []db.APIToken
+		NewAPIToken     string
+		NewAPITokenName string
+		Account         *accountSettings
+		NewInviteURL    string
 	}{
-		Feeds:         feeds,
-		FlashMessages: flashMessages,
-		PostsPerFeed:  postsPerFeed,
-		Columns:       columns,
+		Feeds:           feeds,
+		Tags:            tags,
+		CurrentTag:      r.URL.Query().Get("tag"),
+		FeedPlacements:  feedPlacements,
+		Dashboards:      dashboardSettingsList,
+		FlashMessages:   flashMessages,
+		PostsPerFeed:    postsPerFeed,
+		Columns:         columns,
+		UnseenOnUpdate:  unseenOnUpdate,
+		HideRead:        hideRead,
+		DiscoveredFrom:  extras.DiscoveredFrom,
+		FeedCandidates:  extras.FeedCandidates,
+		FilterRules:     filterRules,
+		FeverUsername:   feverUsername,
+		APITokens:       apiTokens,
+		NewAPIToken:     extras.NewAPIToken,
+		NewAPITokenName: extras.NewAPITokenName,
+		Account:         account,
+		NewInviteURL:    extras.NewInviteURL,
 	}
 
 	log.Printf("Rendering settings template with %d feeds", len(feeds))
@@ -421,7 +819,26 @@ func (s *Server) handleAddFeed(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	content, err := s.fetcher.FetchFeed(r.Context(), url)
+	feedURL, content, candidates, err := s.fetchOrDiscoverFeed(r.Context(), url)
+	if len(candidates) > 0 {
+		// Let the user choose; each choice posts back to this handler.
+		s.renderSettings(w, r, settingsExtras{DiscoveredFrom: url, FeedCandidates: candidates})
+		return
+	}
+	url = feedURL
+	if errors.Is(err, feed.ErrUnauthorized) {
+		// Subscribe anyway so the user can add the credentials the feed
+		// needs to it.
+		if _, err := s.subscribeToFetchedFeed(userId, url, nil); err != nil {
+			log.Printf("Error adding feed with URL: %v\nContext: [url %s]\nStack trace:\n%s", err, url, debug.Stack())
+			s.addErrorFlash(w, r, "Error adding feed. Please try again.")
+			http.Redirect(w, r, "/settings", http.StatusSeeOther)
+			return
+		}
+		s.addSuccessFlash(w, r, "Feed added, but it requires credentials. Add them under the feed's Credentials.")
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		return
+	}
 	if err != nil {
 		// Log the error for debugging
 		log.Printf("Error fetching feed from URL: %v\nContext: [url %s]\nStack trace:\n%s", err, url, debug.Stack())
@@ -432,8 +849,7 @@ func (s *Server) handleAddFeed(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	feedId, err := s.store.AddFeedForUser(userId, url)
-	if err != nil {
+	if _, err := s.subscribeToFetchedFeed(userId, url, content); err != nil {
 		// Log the error for debugging
 		log.Printf("Error adding feed with URL: %v\nContext: [url %s]\nStack trace:\n%s", err, url, debug.Stack())
 
@@ -443,25 +859,230 @@ func (s *Server) handleAddFeed(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Update feed title
-	if content.Title != "" {
-		if err := s.store.UpdateFeedTitle(feedId, content.Title); err != nil {
-			log.Printf("Error updating feed title for feed: %v\nContext: [feedId %d]\nStack trace:\n%s", err, feedId, debug.Stack())
-			// Don't fail the entire operation for title update errors
+	// Set a success message in the session
+	s.addSuccessFlash(w, r, "Feed added successfully!")
+
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
+
+// fetchOrDiscoverFeed fetches the feed at rawURL. If rawURL is a web page
+// rather than a feed, the feeds it advertises are discovered instead: a single
+// discovered feed is fetched in its place and its URL returned, while several
+// are returned as candidates for the user to choose from.
+func (s *Server) fetchOrDiscoverFeed(ctx context.Context, rawURL string) (string, *feed.FeedContent, []feed.FeedCandidate, error) {
+	content, err := s.fetcher.FetchFeed(ctx, rawURL)
+	var notAFeed *feed.NotAFeedError
+	if !errors.As(err, &notAFeed) {
+		return rawURL, content, nil, err
+	}
+
+	// The URL is probably a web page; look for the feeds it advertises.
+	candidates := s.fetcher.DiscoverFeedsOnPage(ctx, notAFeed.URL, notAFeed.Page)
+	switch {
+	case len(candidates) == 1:
+		content, err = s.fetcher.FetchFeed(ctx, candidates[0].URL)
+		return candidates[0].URL, content, nil, err
+	case len(candidates) > 1:
+		return rawURL, nil, candidates, nil
+	}
+	return rawURL, nil, nil, err
+}
+
+// subscribeToFetchedFeed subscribes the user to the feed at feedURL and stores
+// the freshly fetched content like the updater does. content may be nil when
+// the feed is already known and its cache has not expired yet.
+func (s *Server) subscribeToFetchedFeed(userId int64, feedURL string, content *feed.FeedContent) (int64, error) {
+	feedId, err := s.store.AddFeedForUser(userId, feedURL)
+	if err != nil {
+		return 0, err
+	}
+	if content == nil {
+		return feedId, nil
+	}
+
+	stored, err := s.store.GetFeedByID(feedId)
+	if err != nil || stored == nil {
+		log.Printf("Error loading feed: %v\nContext: [feedId %d]\nStack trace:\n%s", err, feedId, debug.Stack())
+		// The updater stores the content on its next fetch instead
+		return feedId, nil
+	}
+	feed.IngestContent(s.store, s.events, *stored, content)
+	return feedId, nil
+}
+
+// maxOPMLUploadSize caps the size of an uploaded OPML file.
+const maxOPMLUploadSize = 5 << 20
+
+// maxOPMLFailureFlashes caps the number of per-feed failure messages reported
+// after an OPML import so the session cookie does not overflow.
+const maxOPMLFailureFlashes = 10
+
+// isValidFeedURL reports whether the given string is an absolute http(s) URL.
+func isValidFeedURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+func (s *Server) handleImportOPML(w http.ResponseWriter, r *http.Request) {
+	userId := s.getUserID(r)
+	if userId == 0 {
+		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxOPMLUploadSize)
+	file, _, err := r.FormFile("opml")
+	if err != nil {
+		log.Printf("Error reading uploaded OPML file: %v\nContext: [userId %d]", err, userId)
+		s.addErrorFlash(w, r, "Please choose an OPML file to import")
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		return
+	}
+	defer file.Close()
+
+	outlines, err := feed.ParseOPML(file)
+	if err != nil {
+		log.Printf("Error parsing OPML file: %v\nContext: [userId %d]", err, userId)
+		s.addErrorFlash(w, r, "Could not read the OPML file. Is it a valid OPML export?")
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		return
+	}
+	if len(outlines) == 0 {
+		s.addErrorFlash(w, r, "The OPML file does not contain any feeds")
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		return
+	}
+
+	// Outlines are subscribed in document order; AddFeedForUser appends each
+	// new subscription at the end of the grid, so the OPML order is preserved.
+	imported := 0
+	var failures []string
+	for _, outline := range outlines {
+		label := outline.Title
+		if label == "" {
+			label = outline.XMLURL
+		}
+
+		if !isValidFeedURL(outline.XMLURL) {
+			failures = append(failures, fmt.Sprintf("Skipped %s: not a valid http(s) feed URL", label))
+			continue
 		}
+
+		feedId, err := s.store.AddFeedForUser(userId, outline.XMLURL)
+		if err != nil {
+			log.Printf("Error adding feed from OPML: %v\nContext: [url %s, userId %d]\nStack trace:\n%s", err, outline.XMLURL, userId, debug.Stack())
+			failures = append(failures, fmt.Sprintf("Could not import %s", label))
+			continue
+		}
+
+		// Use the OPML title until the updater fetches the real one.
+		if outline.Title != "" {
+			if err := s.store.UpdateFeedTitleIfEmpty(feedId, outline.Title); err != nil {
+				log.Printf("Error setting feed title from OPML: %v\nContext: [feedId %d]", err, feedId)
+			}
+		}
+
+		// Folders become tags, added to any the feed already has.
+		if len(outline.Tags) > 0 {
+			tags, err := parseTags(strings.Join(outline.Tags, ","))
+			if err == nil {
+				err = s.store.AddFeedTagsForUser(userId, feedId, tags)
+			}
+			if err != nil {
+				log.Printf("Error tagging feed from OPML: %v\nContext: [feedId %d, userId %d]", err, feedId, userId)
+			}
+		}
+		imported++
 	}
 
-	// Add posts
-	for _, item := range content.Items {
-		if err := s.store.AddPost(feedId, item.GUID, item.Title, item.Link, item.PublishedAt, item.Content); err != nil {
-			log.Printf("Error adding post with GUID to feed: %v\nContext: [guid %s, feedId %d]\nStack trace:\n%s", err, item.GUID, feedId, debug.Stack())
-			// Continue adding other posts even if one fails
+	for i, failure := range failures {
+		if i == maxOPMLFailureFlashes {
+			s.addErrorFlash(w, r, fmt.Sprintf("...and %d more feeds could not be imported", len(failures)-maxOPMLFailureFlashes))
+			break
 		}
+		s.addErrorFlash(w, r, failure)
+	}
+	if imported > 0 {
+		s.addSuccessFlash(w, r, fmt.Sprintf("Imported %d of %d feeds from OPML. New feeds will be fetched on the next update.", imported, len(outlines)))
 	}
 
-	// Set a success message in the session
-	s.addSuccessFlash(w, r, "Feed added successfully!")
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
+
+func (s *Server) handleExportOPML(w http.ResponseWriter, r *http.Request) {
+	userId := s.getUserID(r)
+
+	feeds, err := s.store.GetUserFeeds(userId)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error fetching feeds", "Error fetching feeds for OPML export", err, "userId", userId)
+		return
+	}
 
+	outlines := make([]feed.OPMLOutline, 0, len(feeds))
+	for _, f := range feeds {
+		title := f.Title
+		if title == "" {
+			title = f.URL
+		}
+		outlines = append(outlines, feed.OPMLOutline{Title: title, XMLURL: f.URL, Tags: f.Tags})
+	}
+
+	w.Header().Set("Content-Type", "text/x-opml+xml; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="rssgrid-subscriptions.opml"`)
+	if err := feed.WriteOPML(w, "RSSGrid subscriptions", outlines); err != nil {
+		log.Printf("Error writing OPML export: %v\nContext: [userId %d]", err, userId)
+	}
+}
+
+// maxAPITokenNameLength caps the length of a personal access token's name.
+const maxAPITokenNameLength = 100
+
+func (s *Server) handleCreateAPIToken(w http.ResponseWriter, r *http.Request) {
+	userId := s.getUserID(r)
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	if name == "" || len(name) > maxAPITokenNameLength {
+		s.addErrorFlash(w, r, fmt.Sprintf("Token name is required and may be at most %d characters", maxAPITokenNameLength))
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		return
+	}
+
+	createToken := s.store.CreateAPITokenForUser
+	if r.FormValue("access") == "feeds" {
+		createToken = s.store.CreateFeedTokenForUser
+	}
+	token, err := createToken(userId, name)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error creating API token", "Error creating API token for user", err, "userId", userId)
+		return
+	}
+
+	// Render instead of redirecting: the secret is only ever shown on this page.
+	s.renderSettings(w, r, settingsExtras{NewAPIToken: token, NewAPITokenName: name})
+}
+
+func (s *Server) handleDeleteAPIToken(w http.ResponseWriter, r *http.Request) {
+	tokenId, err := strconv.ParseInt(chi.URLParam(r, "tokenId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid token ID format", http.StatusBadRequest)
+		return
+	}
+
+	userId := s.getUserID(r)
+
+	if err := s.store.DeleteAPITokenForUser(userId, tokenId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Token not found", http.StatusNotFound)
+			return
+		}
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error revoking API token", "Error deleting API token for user", err, "tokenId", tokenId, "userId", userId)
+		return
+	}
+
+	s.addSuccessFlash(w, r, "API token revoked.")
 	http.Redirect(w, r, "/settings", http.StatusSeeOther)
 }
 
@@ -519,6 +1140,30 @@ func (s *Server) handleMarkPostSeen(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 }
 
+// handleSetPostStarred returns a handler that stars or unstars a post.
+func (s *Server) handleSetPostStarred(starred bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		postId, err := strconv.ParseInt(chi.URLParam(r, "postId"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid post ID format", http.StatusBadRequest)
+			return
+		}
+
+		userId := s.getUserID(r)
+
+		if err := s.store.SetPostStarredForUser(userId, postId, starred); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "Post not found", http.StatusNotFound)
+				return
+			}
+			s.logErrorAndRespond(w, http.StatusInternalServerError, "Error starring post", "Error setting post starred state for user", err, "postId", postId, "userId", userId, "starred", starred)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
 func (s *Server) handleMarkAllSeen(w http.ResponseWriter, r *http.Request) {
 	feedIdStr := chi.URLParam(r, "feedId")
 	if feedIdStr == "" {
@@ -543,6 +1188,128 @@ func (s *Server) handleMarkAllSeen(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The dashboard marks posts seen in place and needs no new page
+	if r.Header.Get("Accept") == "application/json" {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// handleSetFeedHideRead returns a handler that hides or shows read posts in
+// a feed's widget.
+func (s *Server) handleSetFeedHideRead(hideRead bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		feedId, err := strconv.ParseInt(chi.URLParam(r, "feedId"), 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid feed ID format", http.StatusBadRequest)
+			return
+		}
+
+		userId := s.getUserID(r)
+
+		if err := s.store.SetFeedHideReadForUser(userId, feedId, hideRead); err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				http.Error(w, "Feed not found", http.StatusNotFound)
+				return
+			}
+			s.logErrorAndRespond(w, http.StatusInternalServerError, "Error updating feed settings", "Error setting hide read for feed", err, "feedId", feedId, "userId", userId)
+			return
+		}
+
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+	}
+}
+
+// refreshTimeout bounds how long a manual refresh request may take.
+const refreshTimeout = 2 * time.Minute
+
+// maxRefreshFailureFlashes caps the number of per-feed failures reported
+// after refreshing all feeds.
+const maxRefreshFailureFlashes = 5
+
+func feedDisplayName(f db.Feed) string {
+	if f.Title != "" {
+		return f.Title
+	}
+	return f.URL
+}
+
+func (s *Server) handleRefreshFeed(w http.ResponseWriter, r *http.Request) {
+	feedId, err := strconv.ParseInt(chi.URLParam(r, "feedId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid feed ID format", http.StatusBadRequest)
+		return
+	}
+	if s.refresher == nil {
+		http.Error(w, "Refreshing feeds is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	userId := s.getUserID(r)
+
+	f, err := s.findUserFeed(userId, feedId)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Feed not found", http.StatusNotFound)
+			return
+		}
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error refreshing feed", "Error fetching feed for user", err, "feedId", feedId, "userId", userId)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), refreshTimeout)
+	defer cancel()
+	result := s.refresher.RefreshFeeds(ctx, []db.Feed{*f})[0]
+
+	name := feedDisplayName(*f)
+	switch {
+	case result.Err != nil:
+		s.addErrorFlash(w, r, fmt.Sprintf("Could not refresh %s: %v", name, result.Err))
+	case result.Modified:
+		s.addSuccessFlash(w, r, fmt.Sprintf("Refreshed %s.", name))
+	default:
+		s.addSuccessFlash(w, r, fmt.Sprintf("%s is already up to date.", name))
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+func (s *Server) handleRefreshAllFeeds(w http.ResponseWriter, r *http.Request) {
+	if s.refresher == nil {
+		http.Error(w, "Refreshing feeds is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	userId := s.getUserID(r)
+
+	feeds, err := s.store.GetUserFeeds(userId)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error refreshing feeds", "Error fetching feeds for user", err, "userId", userId)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), refreshTimeout)
+	defer cancel()
+	results := s.refresher.RefreshFeeds(ctx, feeds)
+
+	var modified, failed int
+	for _, result := range results {
+		switch {
+		case result.Err != nil:
+			failed++
+			if failed <= maxRefreshFailureFlashes {
+				s.addErrorFlash(w, r, fmt.Sprintf("Could not refresh %s: %v", feedDisplayName(result.Feed), result.Err))
+			}
+		case result.Modified:
+			modified++
+		}
+	}
+	if failed > maxRefreshFailureFlashes {
+		s.addErrorFlash(w, r, fmt.Sprintf("...and %d more feeds could not be refreshed", failed-maxRefreshFailureFlashes))
+	}
+	s.addSuccessFlash(w, r, fmt.Sprintf("Refreshed %d feeds: %d updated, %d already up to date, %d failed.",
+		len(results), modified, len(results)-modified-failed, failed))
+
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
@@ -578,6 +1345,16 @@ func (s *Server) handleUpdatePreferences(w http.ResponseWriter, r *http.Request)
 		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error updating columns", "Error updating columns for user", err, "userId", userId, "columns", columns)
 		return
 	}
+	unseenOnUpdate := r.FormValue("unseenOnUpdate") == "on"
+	if err := s.store.SetUserUnseenOnUpdate(userId, unseenOnUpdate); err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error updating preferences", "Error updating unseen on update for user", err, "userId", userId, "unseenOnUpdate", unseenOnUpdate)
+		return
+	}
+	hideRead := r.FormValue("hideRead") == "on"
+	if err := s.store.SetUserHideRead(userId, hideRead); err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error updating preferences", "Error updating hide read for user", err, "userId", userId, "hideRead", hideRead)
+		return
+	}
 
 	// Set a success message in the session
 	s.addSuccessFlash(w, r, "Preferences updated successfully!")
@@ -585,6 +1362,53 @@ func (s *Server) handleUpdatePreferences(w http.ResponseWriter, r *http.Request)
 	http.Redirect(w, r, "/settings", http.StatusSeeOther)
 }
 
+// maxCustomTitleLength bounds the custom title of a subscription.
+const maxCustomTitleLength = 200
+
+// handleUpdateFeedSettings stores the user's display overrides for one of
+// their feeds.
+func (s *Server) handleUpdateFeedSettings(w http.ResponseWriter, r *http.Request) {
+	feedId, err := strconv.ParseInt(chi.URLParam(r, "feedId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid feed ID format", http.StatusBadRequest)
+		return
+	}
+
+	userId := s.getUserID(r)
+
+	settings := db.FeedSettings{
+		CustomTitle:   strings.TrimSpace(r.FormValue("customTitle")),
+		HideRead:      r.FormValue("hideRead") == "on",
+		ShowSummaries: r.FormValue("showSummaries") == "on",
+		Collapsed:     r.FormValue("collapsed") == "on",
+	}
+	if len(settings.CustomTitle) > maxCustomTitleLength {
+		s.addErrorFlash(w, r, fmt.Sprintf("Custom titles may be at most %d characters", maxCustomTitleLength))
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		return
+	}
+	if value := r.FormValue("postsPerFeed"); value != "" {
+		settings.PostsPerFeed, err = strconv.Atoi(value)
+		if err != nil || settings.PostsPerFeed < 1 || settings.PostsPerFeed > 50 {
+			s.addErrorFlash(w, r, "Posts per feed must be a number from 1 to 50, or empty to use your default")
+			http.Redirect(w, r, "/settings", http.StatusSeeOther)
+			return
+		}
+	}
+
+	if err := s.store.SetFeedSettingsForUser(userId, feedId, settings); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Feed not found", http.StatusNotFound)
+			return
+		}
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error updating feed settings", "Error updating feed settings for user", err, "feedId", feedId, "userId", userId)
+		return
+	}
+
+	s.addSuccessFlash(w, r, "Feed settings updated.")
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
+
 func (s *Server) handleGetPost(w http.ResponseWriter, r *http.Request) {
 	postIdStr := chi.URLParam(r, "postId")
 	if postIdStr == "" {
@@ -610,28 +1434,75 @@ func (s *Server) handleGetPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data := struct {
-		Post struct {
-			ID          int64
-			Title       string
-			Link        string
-			PublishedAt time.Time
-			Content     template.HTML
+	type RevisionData struct {
+		Title      string
+		Link       string
+		Content    template.HTML
+		ReplacedAt time.Time
+	}
+
+	var revisions []RevisionData
+	if !post.UpdatedAt.IsZero() {
+		stored, err := s.store.GetPostRevisions(postId)
+		if err != nil {
+			s.logErrorAndRespond(w, http.StatusInternalServerError, "Error fetching post", "Error fetching post revisions", err, "postId", postId)
+			return
 		}
+		for _, rev := range stored {
+			// Revision content was sanitized when it was stored as the post.
+			revisions = append(revisions, RevisionData{Title: rev.Title, Link: rev.Link, Content: template.HTML(rev.Content), ReplacedAt: rev.ReplacedAt})
+		}
+	}
+
+	type PostData struct {
+		ID          int64
+		Title       string
+		Link        string
+		Author      string
+		PublishedAt time.Time
+		UpdatedAt   time.Time
+		// SourceUpdatedAt is when the feed says the post was updated, set
+		// only if that was after it was published.
+		SourceUpdatedAt time.Time
+		Summary         template.HTML
+		Content         template.HTML
+		Categories      []string
+		// ImageURL is the post's image, set only if the content does not
+		// show it already.
+		ImageURL    string
+		CommentsURL string
+		Enclosures  []db.Enclosure
+		Starred     bool
+	}
+
+	postData := PostData{
+		ID:          post.ID,
+		Title:       post.Title,
+		Link:        post.Link,
+		Author:      post.Author,
+		PublishedAt: post.PublishedAt,
+		UpdatedAt:   post.UpdatedAt,
+		// Summary and content were sanitized when the post was stored.
+		Summary:     template.HTML(post.Summary),
+		Content:     template.HTML(post.Content),
+		Categories:  post.Categories,
+		CommentsURL: post.CommentsURL,
+		Enclosures:  post.Enclosures,
+		Starred:     post.Starred,
+	}
+	if post.SourceUpdatedAt.After(post.PublishedAt) {
+		postData.SourceUpdatedAt = post.SourceUpdatedAt
+	}
+	if post.ImageURL != "" && !strings.Contains(post.Content, post.ImageURL) && !strings.Contains(post.Content, html.EscapeString(post.ImageURL)) {
+		postData.ImageURL = post.ImageURL
+	}
+
+	data := struct {
+		Post      PostData
+		Revisions []RevisionData
 	}{
-		Post: struct {
-			ID          int64
-			Title       string
-			Link        string
-			PublishedAt time.Time
-			Content     template.HTML
-		}{
-			ID:          post.ID,
-			Title:       post.Title,
-			Link:        post.Link,
-			PublishedAt: post.PublishedAt,
-			Content:     template.HTML(post.Content),
-		},
+		Post:      postData,
+		Revisions: revisions,
 	}
 
 	log.Printf("Rendering post template with post ID %d", postId)
@@ -641,66 +1512,109 @@ func (s *Server) handleGetPost(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
-	session, err := s.sessions.Get(r, "user_session")
-	if err != nil {
-		log.Printf("Error getting session for logout: %v\nStack trace:\n%s", err, debug.Stack())
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+// maxSearchResults caps how many matches the search page shows.
+const maxSearchResults = 50
+
+// highlightSnippet escapes a search snippet and turns the store's match
+// markers into <mark> elements.
+func highlightSnippet(snippet string) template.HTML {
+	escaped := template.HTMLEscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, db.SnippetMatchStart, "<mark>")
+	escaped = strings.ReplaceAll(escaped, db.SnippetMatchEnd, "</mark>")
+	return template.HTML(escaped)
+}
+
+func (s *Server) handleSearch(w http.ResponseWriter, r *http.Request) {
+	userId := s.getUserID(r)
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	type SearchResultData struct {
+		ID          int64
+		Title       string
+		PublishedAt time.Time
+		Seen        bool
+		FeedTitle   string
+		FeedURL     string
+		Snippet     template.HTML
 	}
 
-	session.Values["user_id"] = nil
-	if err := session.Save(r, w); err != nil {
-		log.Printf("Error saving session for logout: %v\nStack trace:\n%s", err, debug.Stack())
-		http.Error(w, "Internal server error", http.StatusInternalServerError)
-		return
+	var results []SearchResultData
+	if query != "" {
+		// Ask for one more than we show to know whether results were cut off.
+		matches, err := s.store.SearchPostsForUser(userId, query, maxSearchResults+1)
+		if err != nil {
+			s.logErrorAndRespond(w, http.StatusInternalServerError, "Error searching posts", "Error searching posts for user", err, "userId", userId, "query", query)
+			return
+		}
+		for _, m := range matches {
+			results = append(results, SearchResultData{
+				ID:          m.ID,
+				Title:       m.Title,
+				PublishedAt: m.PublishedAt,
+				Seen:        m.Seen,
+				FeedTitle:   m.FeedTitle,
+				FeedURL:     m.FeedURL,
+				Snippet:     highlightSnippet(m.Snippet),
+			})
+		}
 	}
 
-	http.Redirect(w, r, "/", http.StatusSeeOther)
-}
+	truncated := len(results) > maxSearchResults
+	if truncated {
+		results = results[:maxSearchResults]
+	}
 
-func (s *Server) handleMoveFeedUp(w http.ResponseWriter, r *http.Request) {
-	feedIdStr := chi.URLParam(r, "feedId")
-	if feedIdStr == "" {
-		http.Error(w, "Invalid feed ID", http.StatusBadRequest)
-		return
+	data := struct {
+		Query     string
+		Results   []SearchResultData
+		Truncated bool
+	}{
+		Query:     query,
+		Results:   results,
+		Truncated: truncated,
 	}
 
-	feedId, err := strconv.ParseInt(feedIdStr, 10, 64)
-	if err != nil {
-		http.Error(w, "Invalid feed ID format", http.StatusBadRequest)
+	if err := s.templates.ExecuteTemplate(w, "search.html", data); err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error rendering template", "Error rendering search template", err, "query", query)
 		return
 	}
+}
 
+func (s *Server) handleStarred(w http.ResponseWriter, r *http.Request) {
 	userId := s.getUserID(r)
 
-	if err := s.store.MoveFeedUp(userId, feedId); err != nil {
-		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error moving feed up", "Error moving feed up for user", err, "feedId", feedId, "userId", userId)
+	posts, err := s.store.GetStarredPostsForUser(userId)
+	if err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error fetching starred posts", "Error fetching starred posts for user", err, "userId", userId)
 		return
 	}
 
-	http.Redirect(w, r, "/settings", http.StatusSeeOther)
-}
+	data := struct {
+		Posts []db.StarredPost
+	}{
+		Posts: posts,
+	}
 
-func (s *Server) handleMoveFeedDown(w http.ResponseWriter, r *http.Request) {
-	feedIdStr := chi.URLParam(r, "feedId")
-	if feedIdStr == "" {
-		http.Error(w, "Invalid feed ID", http.StatusBadRequest)
+	if err := s.templates.ExecuteTemplate(w, "starred.html", data); err != nil {
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error rendering template", "Error rendering starred template", err, "userId", userId)
 		return
 	}
+}
 
-	feedId, err := strconv.ParseInt(feedIdStr, 10, 64)
+func (s *Server) handleLogout(w http.ResponseWriter, r *http.Request) {
+	session, err := s.sessions.Get(r, "user_session")
 	if err != nil {
-		http.Error(w, "Invalid feed ID format", http.StatusBadRequest)
+		log.Printf("Error getting session for logout: %v\nStack trace:\n%s", err, debug.Stack())
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	userId := s.getUserID(r)
-
-	if err := s.store.MoveFeedDown(userId, feedId); err != nil {
-		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error moving feed down", "Error moving feed down for user", err, "feedId", feedId, "userId", userId)
+	session.Values["user_id"] = nil
+	if err := session.Save(r, w); err != nil {
+		log.Printf("Error saving session for logout: %v\nStack trace:\n%s", err, debug.Stack())
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
 		return
 	}
 
-	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// apiRouter mounts only the API routes, so requests go through the bearer
+// token middleware exactly as in production.
+func apiRouter(server *Server) http.Handler {
+	r := chi.NewRouter()
+	r.Route("/api/v1", server.apiRoutes)
+	return r
+}
+
+func apiRequest(t *testing.T, handler http.Handler, method, path, token string, body io.Reader) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, body)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func TestAPI_RequiresValidToken(t *testing.T) {
+	store, cleanup := createTestStore(t)
+	defer cleanup()
+	server := createTestServerWithStore(t, store)
+	handler := apiRouter(server)
+
+	w := apiRequest(t, handler, "GET", "/api/v1/feeds", "", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Header().Get("WWW-Authenticate"), "Bearer")
+
+	w = apiRequest(t, handler, "GET", "/api/v1/feeds", "rsg_bogus", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "invalid or revoked token")
+}
+
+func TestAPI_FeedsPostsAndSeenState(t *testing.T) {
+	store, cleanup := createTestStore(t)
+	defer cleanup()
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+	require.NoError(t, store.UpdateFeedTitle(feedID, "Example"))
+	require.NoError(t, store.AddPost(feedID, "1", "Hello", "https://example.com/1", time.Now(), "<p>Hi</p>"))
+	token, err := store.CreateAPITokenForUser(userID, "test")
+	require.NoError(t, err)
+	handler := apiRouter(createTestServerWithStore(t, store))
+
+	w := apiRequest(t, handler, "GET", "/api/v1/feeds", token, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var feeds []apiFeed
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &feeds))
+	require.Len(t, feeds, 1)
+	assert.Equal(t, "Example", feeds[0].Title)
+	assert.Equal(t, 1, feeds[0].Unread)
+
+	w = apiRequest(t, handler, "GET", fmt.Sprintf("/api/v1/feeds/%d/posts", feedID), token, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var posts []apiPost
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &posts))
+	require.Len(t, posts, 1)
+	assert.False(t, posts[0].Seen)
+
+	w = apiRequest(t, handler, "POST", fmt.Sprintf("/api/v1/posts/%d/seen", posts[0].ID), token, nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = apiRequest(t, handler, "GET", fmt.Sprintf("/api/v1/posts/%d", posts[0].ID), token, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var post apiPost
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &post))
+	assert.True(t, post.Seen)
+	assert.Equal(t, "Hello", post.Title)
+
+	w = apiRequest(t, handler, "GET", fmt.Sprintf("/api/v1/feeds/%d", feedID), token, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var fetched apiFeed
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &fetched))
+	assert.Zero(t, fetched.Unread)
+
+	w = apiRequest(t, handler, "PUT", fmt.Sprintf("/api/v1/posts/%d/star", post.ID), token, nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = apiRequest(t, handler, "GET", "/api/v1/starred", token, nil)
+	require.Equal(t, http.StatusOK, w.Code)
+	var starred []apiPost
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &starred))
+	require.Len(t, starred, 1)
+	assert.True(t, starred[0].Starred)
+	w = apiRequest(t, handler, "DELETE", fmt.Sprintf("/api/v1/posts/%d/star", post.ID), token, nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	w = apiRequest(t, handler, "GET", fmt.Sprintf("/api/v1/feeds/%d/posts?limit=0", feedID), token, nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = apiRequest(t, handler, "DELETE", fmt.Sprintf("/api/v1/feeds/%d", feedID), token, nil)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	w = apiRequest(t, handler, "GET", fmt.Sprintf("/api/v1/feeds/%d", feedID), token, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestAPI_CannotAccessOtherUsersData(t *testing.T) {
+	store, cleanup := createTestStore(t)
+	defer cleanup()
+	alice, err := store.GetOrCreateUser("alice", "iss")
+	require.NoError(t, err)
+	bob, err := store.GetOrCreateUser("bob", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(alice, "https://alice.example.com/feed.xml")
+	require.NoError(t, err)
+	require.NoError(t, store.AddPost(feedID, "1", "Private", "https://alice.example.com/1", time.Now(), ""))
+	posts, err := store.GetFeedPosts(feedID, alice, 10)
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	bobToken, err := store.CreateAPITokenForUser(bob, "bob")
+	require.NoError(t, err)
+	handler := apiRouter(createTestServerWithStore(t, store))
+
+	for _, tc := range []struct{ method, path string }{
+		{"GET", fmt.Sprintf("/api/v1/feeds/%d", feedID)},
+		{"GET", fmt.Sprintf("/api/v1/feeds/%d/posts", feedID)},
+		{"POST", fmt.Sprintf("/api/v1/feeds/%d/seen", feedID)},
+		{"DELETE", fmt.Sprintf("/api/v1/feeds/%d", feedID)},
+		{"GET", fmt.Sprintf("/api/v1/posts/%d", posts[0].ID)},
+		{"POST", fmt.Sprintf("/api/v1/posts/%d/seen", posts[0].ID)},
+	} {
+		w := apiRequest(t, handler, tc.method, tc.path, bobToken, nil)
+		assert.Equal(t, http.StatusNotFound, w.Code, "%s %s", tc.method, tc.path)
+	}
+
+	feeds, err := store.GetUserFeeds(alice)
+	require.NoError(t, err)
+	assert.Len(t, feeds, 1, "alice's subscription must survive bob's delete attempt")
+}
+
+func TestAPI_SubscribeAndPreferences(t *testing.T) {
+	store, cleanup := createTestStore(t)
+	defer cleanup()
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	token, err := store.CreateAPITokenForUser(userID, "test")
+	require.NoError(t, err)
+	server := createTestServerWithStore(t, store)
+	server.fetcher = newLoopbackFetcher(t, store)
+	handler := apiRouter(server)
+
+	site := newDiscoverySite(t, "/feed.xml")
+
+	w := apiRequest(t, handler, "POST", "/api/v1/feeds", token, strings.NewReader(`{"url": "`+site.URL+`/feed.xml"}`))
+	require.Equal(t, http.StatusCreated, w.Code, w.Body.String())
+	var created apiFeed
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &created))
+	assert.Equal(t, site.URL+"/feed.xml", created.URL)
+	assert.Equal(t, "Feed /feed.xml", created.Title)
+
+	w = apiRequest(t, handler, "POST", "/api/v1/feeds", token, strings.NewReader(`{"url": "ftp://example.com"}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = apiRequest(t, handler, "PUT", "/api/v1/preferences", token, strings.NewReader(`{"columns": 3}`))
+	require.Equal(t, http.StatusOK, w.Code)
+	var prefs apiPreferences
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &prefs))
+	assert.Equal(t, 3, *prefs.Columns)
+	assert.Equal(t, 10, *prefs.PostsPerFeed, "omitted preferences are left unchanged")
+	assert.False(t, *prefs.HideRead)
+
+	w = apiRequest(t, handler, "PUT", "/api/v1/preferences", token, strings.NewReader(`{"hide_read": true}`))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &prefs))
+	assert.True(t, *prefs.HideRead)
+
+	w = apiRequest(t, handler, "PUT", "/api/v1/preferences", token, strings.NewReader(`{"posts_per_feed": 0}`))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestHandleCreateAPIToken_ShowsTokenOnce(t *testing.T) {
+	store, cleanup := createTestStore(t)
+	defer cleanup()
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	server := createTestServerWithStore(t, store)
+
+	req, w := requestAs(server, "POST", "/settings/tokens", userID, nil)
+	req.PostForm = map[string][]string{"name": {"My script"}}
+	server.handleCreateAPIToken(w, req)
+	assertResponseSuccess(t, w, "My script", "rsg_", "will not be shown again")
+
+	req, w = testRequest(server, "GET", "/settings", userID)
+	server.handleSettings(w, req)
+	assertResponseSuccess(t, w, "My script", "Revoke")
+	assertResponseNotContains(t, w, "will not be shown again")
+}
+
+func TestHandleCreateAPIToken_ReadOnlyFeedToken(t *testing.T) {
+	store, cleanup := createTestStore(t)
+	defer cleanup()
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	server := createTestServerWithStore(t, store)
+
+	req, w := requestAs(server, "POST", "/settings/tokens", userID, nil)
+	req.PostForm = map[string][]string{"name": {"Reader"}, "access": {"feeds"}}
+	server.handleCreateAPIToken(w, req)
+	assertResponseSuccess(t, w, "Read-only · Created")
+
+	tokens, err := store.GetAPITokensForUser(userID)
+	require.NoError(t, err)
+	require.Len(t, tokens, 1)
+	assert.True(t, tokens[0].ReadOnly)
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/aggregat4/rssgrid/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCustomHeaders(t *testing.T) {
+	headers, err := parseCustomHeaders("X-Api-Key: secret\n\n  Accept : application/atom+xml  \r\n")
+	require.NoError(t, err)
+	assert.Equal(t, []db.FeedHeader{
+		{Name: "X-Api-Key", Value: "secret"},
+		{Name: "Accept", Value: "application/atom+xml"},
+	}, headers)
+
+	_, err = parseCustomHeaders("no colon")
+	assert.Error(t, err)
+	_, err = parseCustomHeaders("Bad Name: value")
+	assert.Error(t, err)
+}
+
+func TestHandleSetFeedCredentials(t *testing.T) {
+	f := newServerAuthFixture(t)
+	feedID := strconv.FormatInt(f.feed1, 10)
+
+	req, w := requestAs(f.server, "POST", "/settings/feeds/"+feedID+"/credentials", f.user1, map[string]string{"feedId": feedID})
+	req.PostForm = map[string][]string{"username": {"reader"}, "password": {"hunter2"}}
+	f.server.handleSetFeedCredentials(w, req)
+	assertRedirect(t, w, "/settings")
+	feeds, err := f.store.GetUserFeeds(f.user1)
+	require.NoError(t, err)
+	assert.False(t, feeds[0].HasCredentials, "nothing is stored without a credentials key")
+
+	f.store.SetCredentialsKey("secret")
+	req, w = requestAs(f.server, "POST", "/settings/feeds/"+feedID+"/credentials", f.user1, map[string]string{"feedId": feedID})
+	req.PostForm = map[string][]string{"username": {"reader"}, "password": {"hunter2"}, "headers": {"X-Api-Key: key"}}
+	f.server.handleSetFeedCredentials(w, req)
+	assertRedirect(t, w, "/settings")
+	creds, err := f.store.GetFeedCredentials(f.feed1)
+	require.NoError(t, err)
+	assert.Equal(t, "reader", creds.Username)
+	assert.Equal(t, []db.FeedHeader{{Name: "X-Api-Key", Value: "key"}}, creds.Headers)
+
+	req, w = requestAs(f.server, "GET", "/settings", f.user1, nil)
+	f.server.handleSettings(w, req)
+	assertResponseSuccess(t, w, "Fetched with your credentials", "Remove credentials")
+	assertResponseNotContains(t, w, "hunter2")
+
+	req, w = requestAs(f.server, "POST", "/settings/feeds/"+feedID+"/credentials", f.user1, map[string]string{"feedId": feedID})
+	req.PostForm = map[string][]string{"clear": {"1"}}
+	f.server.handleSetFeedCredentials(w, req)
+	assertRedirect(t, w, "/settings")
+	feeds, err = f.store.GetUserFeeds(f.user1)
+	require.NoError(t, err)
+	assert.False(t, feeds[0].HasCredentials)
+
+	otherFeedID := strconv.FormatInt(f.feed2, 10)
+	req, w = requestAs(f.server, "POST", "/settings/feeds/"+otherFeedID+"/credentials", f.user1, map[string]string{"feedId": otherFeedID})
+	req.PostForm = map[string][]string{"cookie": {"session=1"}}
+	f.server.handleSetFeedCredentials(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code, "other users' feeds cannot be changed")
+}
+
+func TestHandleAddFeed_UnauthorizedFeedIsSubscribed(t *testing.T) {
+	store, cleanup := createTestStore(t)
+	defer cleanup()
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	server := createTestServerWithStore(t, store)
+	server.fetcher = newLoopbackFetcher(t, store)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	t.Cleanup(srv.Close)
+
+	req, w := addFeedRequest(server, userID, srv.URL+"/private.xml")
+	server.handleAddFeed(w, req)
+	assertRedirect(t, w, "/settings")
+
+	feeds, err := store.GetUserFeeds(userID)
+	require.NoError(t, err)
+	require.Len(t, feeds, 1, "the user can add credentials to the feed afterwards")
+	assert.Equal(t, srv.URL+"/private.xml", feeds[0].URL)
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleShowDashboard(t *testing.T) {
+	f := newServerAuthFixture(t)
+	reading, err := f.store.CreateDashboardForUser(f.user1, "Reading")
+	require.NoError(t, err)
+	readingID := strconv.FormatInt(reading, 10)
+
+	// The new dashboard starts out empty, the default one keeps the feed.
+	req, w := requestAs(f.server, "GET", "/dashboards/"+readingID, f.user1, map[string]string{"dashboardId": readingID})
+	f.server.handleShowDashboard(w, req)
+	assertResponseSuccess(t, w, `aria-current="page">Reading</a>`, "Home")
+	assert.NotContains(t, w.Body.String(), "Post 1")
+
+	// / shows the dashboard viewed last.
+	req, w = requestAs(f.server, "GET", "/", f.user1, nil)
+	f.server.handleDashboard(w, req)
+	assertResponseSuccess(t, w, `aria-current="page">Reading</a>`)
+
+	feedID := strconv.FormatInt(f.feed1, 10)
+	req, w = requestAs(f.server, "POST", "/settings/feeds/"+feedID+"/dashboards", f.user1, map[string]string{"feedId": feedID})
+	req.PostForm = map[string][]string{"dashboard": {readingID}}
+	f.server.handleSetFeedDashboards(w, req)
+	assertRedirect(t, w, "/settings")
+
+	req, w = requestAs(f.server, "GET", "/dashboards/"+readingID, f.user1, map[string]string{"dashboardId": readingID})
+	f.server.handleShowDashboard(w, req)
+	assertResponseSuccess(t, w, "Post 1")
+}
+
+func TestHandleShowDashboard_CrossUserDenied(t *testing.T) {
+	f := newServerAuthFixture(t)
+	dashboards, err := f.store.GetDashboardsForUser(f.user2)
+	require.NoError(t, err)
+	dashboardID := strconv.FormatInt(dashboards[0].ID, 10)
+
+	req, w := requestAs(f.server, "GET", "/dashboards/"+dashboardID, f.user1, map[string]string{"dashboardId": dashboardID})
+	f.server.handleShowDashboard(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	req, w = requestAs(f.server, "POST", "/settings/dashboards/"+dashboardID+"/delete", f.user1, map[string]string{"dashboardId": dashboardID})
+	f.server.handleDeleteDashboard(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestHandleDashboardSettings(t *testing.T) {
+	f := newServerAuthFixture(t)
+
+	req, w := requestAs(f.server, "POST", "/settings/dashboards", f.user1, nil)
+	req.PostForm = map[string][]string{"name": {"  "}}
+	f.server.handleCreateDashboard(w, req)
+	assertRedirect(t, w, "/settings")
+	assert.Len(t, flashesByType(f.server, req)["error"], 1)
+
+	req, w = requestAs(f.server, "POST", "/settings/dashboards", f.user1, nil)
+	req.PostForm = map[string][]string{"name": {"News"}}
+	f.server.handleCreateDashboard(w, req)
+	assert.Equal(t, http.StatusSeeOther, w.Code)
+
+	dashboards, err := f.store.GetDashboardsForUser(f.user1)
+	require.NoError(t, err)
+	require.Len(t, dashboards, 2)
+	assert.Equal(t, "News", dashboards[1].Name)
+
+	req, w = requestAs(f.server, "GET", "/settings", f.user1, nil)
+	f.server.handleSettings(w, req)
+	assertResponseSuccess(t, w, `value="News"`, `name="dashboard" value="`+strconv.FormatInt(dashboards[1].ID, 10)+`"`)
+
+	// Deleting down to a single dashboard works, deleting that one does not.
+	newsID := strconv.FormatInt(dashboards[1].ID, 10)
+	req, w = requestAs(f.server, "POST", "/settings/dashboards/"+newsID+"/delete", f.user1, map[string]string{"dashboardId": newsID})
+	f.server.handleDeleteDashboard(w, req)
+	assertRedirect(t, w, "/settings")
+
+	homeID := strconv.FormatInt(dashboards[0].ID, 10)
+	req, w = requestAs(f.server, "POST", "/settings/dashboards/"+homeID+"/delete", f.user1, map[string]string{"dashboardId": homeID})
+	f.server.handleDeleteDashboard(w, req)
+	assertRedirect(t, w, "/settings")
+	assert.Equal(t, []string{"You need at least one dashboard."}, flashesByType(f.server, req)["error"])
+
+	dashboards, err = f.store.GetDashboardsForUser(f.user1)
+	require.NoError(t, err)
+	assert.Len(t, dashboards, 1)
+}
@@ -0,0 +1,220 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/aggregat4/rssgrid/internal/db"
+	"github.com/aggregat4/rssgrid/internal/feed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const discoveryTestRSS = `<?xml version="1.0"?>
+<rss version="2.0"><channel><title>%s</title><link>https://example.com/</link>
+<item><guid>p1</guid><title>First Post</title><link>https://example.com/p1</link></item>
+</channel></rss>`
+
+// newDiscoverySite serves an HTML page at / advertising the given feed paths,
+// each of which serves a small RSS feed.
+func newDiscoverySite(t *testing.T, feedPaths ...string) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	var links strings.Builder
+	for _, path := range feedPaths {
+		title := "Feed " + path
+		fmt.Fprintf(&links, `<link rel="alternate" type="application/rss+xml" title="%s" href="%s">`, title, path)
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, discoveryTestRSS, title)
+		})
+	}
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, `<html><head>%s</head><body>Blog</body></html>`, links.String())
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// newLoopbackFetcher returns a fetcher that may fetch from httptest servers.
+func newLoopbackFetcher(t *testing.T, store *db.Store) *feed.Fetcher {
+	t.Helper()
+	fetcher := feed.NewFetcher(store)
+	require.NoError(t, fetcher.SetAllowedNetworks([]string{"127.0.0.0/8", "::1"}))
+	return fetcher
+}
+
+func addFeedRequest(server *Server, userID int64, feedURL string) (*http.Request, *httptest.ResponseRecorder) {
+	form := url.Values{"url": {feedURL}}
+	req := httptest.NewRequest("POST", "/settings/feeds", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	session, _ := server.sessions.Get(req, "user_session")
+	session.Values["user_id"] = userID
+	_ = session.Save(req, w)
+	return req, w
+}
+
+func TestHandleAddFeed_SingleDiscoveredFeedIsSubscribed(t *testing.T) {
+	store, cleanup := createTestStore(t)
+	defer cleanup()
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	server := createTestServerWithStore(t, store)
+	server.fetcher = newLoopbackFetcher(t, store)
+
+	site := newDiscoverySite(t, "/feed.xml")
+
+	req, w := addFeedRequest(server, userID, site.URL+"/")
+	server.handleAddFeed(w, req)
+	assertRedirect(t, w, "/settings")
+
+	feeds, err := store.GetUserFeeds(userID)
+	require.NoError(t, err)
+	require.Len(t, feeds, 1)
+	assert.Equal(t, site.URL+"/feed.xml", feeds[0].URL, "the discovered feed URL should be stored, not the page URL")
+	assert.Equal(t, "Feed /feed.xml", feeds[0].Title)
+}
+
+func TestHandleAddFeed_FetchesPageOnce(t *testing.T) {
+	store, cleanup := createTestStore(t)
+	defer cleanup()
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	server := createTestServerWithStore(t, store)
+	server.fetcher = newLoopbackFetcher(t, store)
+
+	pageRequests := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("/feed.xml", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, discoveryTestRSS, "Blog")
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		pageRequests++
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><head><link rel="alternate" type="application/rss+xml" href="/feed.xml"></head></html>`)
+	})
+	site := httptest.NewServer(mux)
+	t.Cleanup(site.Close)
+
+	req, w := addFeedRequest(server, userID, site.URL+"/")
+	server.handleAddFeed(w, req)
+	assertRedirect(t, w, "/settings")
+	assert.Equal(t, 1, pageRequests, "the page is searched for feed links as first fetched")
+}
+
+func TestHandleAddFeed_MultipleDiscoveredFeedsAskUserToChoose(t *testing.T) {
+	store, cleanup := createTestStore(t)
+	defer cleanup()
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	server := createTestServerWithStore(t, store)
+	server.fetcher = newLoopbackFetcher(t, store)
+
+	site := newDiscoverySite(t, "/posts.xml", "/comments.xml")
+
+	req, w := addFeedRequest(server, userID, site.URL+"/")
+	server.handleAddFeed(w, req)
+
+	assertResponseSuccess(t, w, "offers several feeds", site.URL+"/posts.xml", site.URL+"/comments.xml", "Feed /comments.xml")
+
+	feeds, err := store.GetUserFeeds(userID)
+	require.NoError(t, err)
+	assert.Empty(t, feeds, "nothing should be subscribed until the user picks a feed")
+
+	// Picking a candidate subscribes to it.
+	req, w = addFeedRequest(server, userID, site.URL+"/comments.xml")
+	server.handleAddFeed(w, req)
+	assertRedirect(t, w, "/settings")
+
+	feeds, err = store.GetUserFeeds(userID)
+	require.NoError(t, err)
+	require.Len(t, feeds, 1)
+	assert.Equal(t, site.URL+"/comments.xml", feeds[0].URL)
+}
+
+func TestHandleAddFeed_StoresPostMetadata(t *testing.T) {
+	store, cleanup := createTestStore(t)
+	defer cleanup()
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	server := createTestServerWithStore(t, store)
+	server.fetcher = newLoopbackFetcher(t, store)
+
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, `<?xml version="1.0"?>
+<rss version="2.0" xmlns:content="http://purl.org/rss/1.0/modules/content/" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<channel><title>Podcast</title><link>https://example.com/</link>
+<item><guid>ep1</guid><title>Episode 1</title><link>https://example.com/ep1</link>
+<dc:creator>Alice</dc:creator>
+<description>The short version.</description>
+<content:encoded><![CDATA[<p>The long version.</p>]]></content:encoded>
+<category>Go</category>
+<comments>https://example.com/ep1#comments</comments>
+<enclosure url="https://cdn.example.com/ep1.mp3" length="1234" type="audio/mpeg"/>
+</item>
+</channel></rss>`)
+	}))
+	t.Cleanup(site.Close)
+
+	req, w := addFeedRequest(server, userID, site.URL+"/feed.xml")
+	server.handleAddFeed(w, req)
+	assertRedirect(t, w, "/settings")
+
+	feeds, err := store.GetUserFeeds(userID)
+	require.NoError(t, err)
+	require.Len(t, feeds, 1)
+	posts, err := store.GetFeedPosts(feeds[0].ID, userID, 10)
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	post, err := store.GetPostForUser(userID, posts[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, "Alice", post.Author)
+	assert.Equal(t, "The short version.", post.Summary)
+	assert.Equal(t, []string{"Go"}, post.Categories)
+	assert.Equal(t, "https://example.com/ep1#comments", post.CommentsURL)
+	assert.Equal(t, []db.Enclosure{{URL: "https://cdn.example.com/ep1.mp3", Type: "audio/mpeg", Length: 1234}}, post.Enclosures)
+}
+
+func TestHandleAddFeed_AppliesMarkSeenFilterRules(t *testing.T) {
+	store, cleanup := createTestStore(t)
+	defer cleanup()
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	_, err = store.CreateFilterRuleForUser(userID, db.FilterRule{Field: db.FilterFieldAuthor, Pattern: "bot", Action: db.FilterActionMarkSeen})
+	require.NoError(t, err)
+	server := createTestServerWithStore(t, store)
+	server.fetcher = newLoopbackFetcher(t, store)
+
+	site := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprint(w, `<?xml version="1.0"?>
+<rss version="2.0" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<channel><title>Mixed</title><link>https://example.com/</link>
+<item><guid>1</guid><title>By a person</title><link>https://example.com/1</link><dc:creator>Alice</dc:creator></item>
+<item><guid>2</guid><title>By a bot</title><link>https://example.com/2</link><dc:creator>Release Bot</dc:creator></item>
+</channel></rss>`)
+	}))
+	t.Cleanup(site.Close)
+
+	req, w := addFeedRequest(server, userID, site.URL+"/feed.xml")
+	server.handleAddFeed(w, req)
+	assertRedirect(t, w, "/settings")
+
+	feeds, err := store.GetUserFeeds(userID)
+	require.NoError(t, err)
+	require.Len(t, feeds, 1)
+	posts, err := store.GetFeedPosts(feeds[0].ID, userID, 10)
+	require.NoError(t, err)
+	seen := make(map[string]bool)
+	for _, post := range posts {
+		seen[post.Title] = post.Seen
+	}
+	assert.Equal(t, map[string]bool{"By a person": false, "By a bot": true}, seen)
+}
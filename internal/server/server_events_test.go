@@ -0,0 +1,80 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aggregat4/rssgrid/internal/events"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readSSEEvent reads lines until the next complete event and returns its name
+// and data.
+func readSSEEvent(t *testing.T, reader *bufio.Reader) (string, string) {
+	t.Helper()
+	var name, data string
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "" && name != "":
+			return name, data
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestHandleEvents_StreamsWidgetsForOwnFeedsOnly(t *testing.T) {
+	f := newServerAuthFixture(t)
+	bus := events.NewBus()
+	f.server.SetEventBus(bus)
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session, _ := f.server.sessions.Get(r, "user_session")
+		session.Values["user_id"] = f.user1
+		f.server.handleEvents(w, r)
+	}))
+	defer ts.Close()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Get(ts.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// The stream is subscribed once the headers arrive. user2's feed must be
+	// filtered out, so the first event seen is for user1's feed.
+	bus.Publish(events.Event{Kind: events.PostsAdded, FeedID: f.feed2})
+	bus.Publish(events.Event{Kind: events.PostsAdded, FeedID: f.feed1})
+
+	name, data := readSSEEvent(t, bufio.NewReader(resp.Body))
+	assert.Equal(t, "widget", name)
+
+	var update widgetUpdate
+	require.NoError(t, json.Unmarshal([]byte(data), &update))
+	assert.Equal(t, f.feed1, update.FeedID)
+	assert.Equal(t, events.PostsAdded, update.Kind)
+	assert.Contains(t, update.HTML, `class="widget"`)
+	assert.Contains(t, update.HTML, "Post 1")
+	assert.NotContains(t, update.HTML, "Post 2")
+}
+
+func TestHandleEvents_UnavailableWithoutEventBus(t *testing.T) {
+	f := newServerAuthFixture(t)
+
+	req, w := requestAs(f.server, "GET", "/events", f.user1, nil)
+	f.server.handleEvents(w, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/aggregat4/rssgrid/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleUpdateFeedSettings(t *testing.T) {
+	f := newServerAuthFixture(t)
+	feedID := strconv.FormatInt(f.feed1, 10)
+
+	req, w := requestAs(f.server, "POST", "/settings/feeds/"+feedID+"/display", f.user1, map[string]string{"feedId": feedID})
+	req.PostForm = map[string][]string{
+		"customTitle":   {"  My feed  "},
+		"postsPerFeed":  {"25"},
+		"showSummaries": {"on"},
+		"collapsed":     {"on"},
+	}
+	f.server.handleUpdateFeedSettings(w, req)
+	assertRedirect(t, w, "/settings")
+
+	feeds, err := f.store.GetUserFeeds(f.user1)
+	require.NoError(t, err)
+	require.Len(t, feeds, 1)
+	assert.Equal(t, db.FeedSettings{CustomTitle: "My feed", PostsPerFeed: 25, ShowSummaries: true, Collapsed: true}, feeds[0].Settings)
+
+	req, w = requestAs(f.server, "GET", "/", f.user1, nil)
+	f.server.handleDashboard(w, req)
+	assertResponseSuccess(t, w, "My feed", `class="widget collapsed"`, `<p class="post-summary">content 1</p>`)
+
+	req, w = requestAs(f.server, "GET", "/settings", f.user1, nil)
+	f.server.handleSettings(w, req)
+	assertResponseSuccess(t, w, `value="My feed"`, `value="25"`)
+}
+
+func TestHandleUpdateFeedSettings_Validation(t *testing.T) {
+	f := newServerAuthFixture(t)
+	feedID := strconv.FormatInt(f.feed1, 10)
+
+	req, w := requestAs(f.server, "POST", "/settings/feeds/"+feedID+"/display", f.user1, map[string]string{"feedId": feedID})
+	req.PostForm = map[string][]string{"postsPerFeed": {"500"}}
+	f.server.handleUpdateFeedSettings(w, req)
+	assertRedirect(t, w, "/settings")
+	assert.Len(t, flashesByType(f.server, req)["error"], 1)
+
+	// Another user's subscription cannot be changed.
+	otherFeedID := strconv.FormatInt(f.feed2, 10)
+	req, w = requestAs(f.server, "POST", "/settings/feeds/"+otherFeedID+"/display", f.user1, map[string]string{"feedId": otherFeedID})
+	req.PostForm = map[string][]string{"customTitle": {"Hijacked"}}
+	f.server.handleUpdateFeedSettings(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	feeds, err := f.store.GetUserFeeds(f.user2)
+	require.NoError(t, err)
+	assert.Equal(t, db.FeedSettings{}, feeds[0].Settings)
+}
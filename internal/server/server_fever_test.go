@@ -0,0 +1,137 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aggregat4/rssgrid/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// feverRequest posts form to the Fever endpoint with the given query flags
+// and decodes the JSON response.
+func feverRequest(t *testing.T, s *Server, query string, form url.Values) map[string]any {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/fever/?"+query, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	s.handleFever(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	var response map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response
+}
+
+func TestFever_Auth(t *testing.T) {
+	f := newServerAuthFixture(t)
+	require.NoError(t, f.store.SetFeverCredentialsForUser(f.user1, "jo", "password1"))
+
+	response := feverRequest(t, f.server, "api", url.Values{"api_key": {db.FeverAPIKey("jo", "wrong")}})
+	assert.Equal(t, map[string]any{"api_version": float64(3), "auth": float64(0)}, response)
+
+	response = feverRequest(t, f.server, "api&feeds", nil)
+	assert.Equal(t, float64(0), response["auth"])
+	assert.NotContains(t, response, "feeds")
+
+	response = feverRequest(t, f.server, "api", url.Values{"api_key": {db.FeverAPIKey("jo", "password1")}})
+	assert.Equal(t, float64(1), response["auth"])
+	assert.Contains(t, response, "last_refreshed_on_time")
+}
+
+func TestFever_GroupsFeedsAndItems(t *testing.T) {
+	f := newServerAuthFixture(t)
+	require.NoError(t, f.store.SetFeverCredentialsForUser(f.user1, "jo", "password1"))
+	auth := url.Values{"api_key": {db.FeverAPIKey("jo", "password1")}}
+	dashboards, err := f.store.GetDashboardsForUser(f.user1)
+	require.NoError(t, err)
+	feedID := strconv.FormatInt(f.feed1, 10)
+
+	response := feverRequest(t, f.server, "api&groups", auth)
+	assert.Equal(t, []any{map[string]any{"id": float64(dashboards[0].ID), "title": "Home"}}, response["groups"])
+	assert.Equal(t, []any{map[string]any{"group_id": float64(dashboards[0].ID), "feed_ids": feedID}}, response["feeds_groups"])
+
+	response = feverRequest(t, f.server, "api&feeds", auth)
+	feeds := response["feeds"].([]any)
+	require.Len(t, feeds, 1)
+	assert.Equal(t, float64(f.feed1), feeds[0].(map[string]any)["id"])
+
+	response = feverRequest(t, f.server, "api&items&since_id=0", auth)
+	assert.Equal(t, float64(1), response["total_items"])
+	items := response["items"].([]any)
+	require.Len(t, items, 1)
+	item := items[0].(map[string]any)
+	assert.Equal(t, float64(f.post1), item["id"])
+	assert.Equal(t, float64(f.feed1), item["feed_id"])
+	assert.Equal(t, "content 1", item["html"])
+	assert.Equal(t, float64(0), item["is_read"])
+
+	response = feverRequest(t, f.server, "api&items&since_id="+strconv.FormatInt(f.post1, 10), auth)
+	assert.Empty(t, response["items"])
+
+	response = feverRequest(t, f.server, "api&items&with_ids="+strconv.FormatInt(f.post2, 10), auth)
+	assert.Empty(t, response["items"], "other users' posts are not returned")
+}
+
+func TestFever_Mark(t *testing.T) {
+	f := newServerAuthFixture(t)
+	require.NoError(t, f.store.SetFeverCredentialsForUser(f.user1, "jo", "password1"))
+	key := db.FeverAPIKey("jo", "password1")
+	postID := strconv.FormatInt(f.post1, 10)
+
+	response := feverRequest(t, f.server, "api&unread_item_ids", url.Values{"api_key": {key}})
+	assert.Equal(t, postID, response["unread_item_ids"])
+
+	response = feverRequest(t, f.server, "api", url.Values{"api_key": {key}, "mark": {"item"}, "as": {"read"}, "id": {postID}})
+	assert.Equal(t, "", response["unread_item_ids"])
+
+	response = feverRequest(t, f.server, "api", url.Values{"api_key": {key}, "mark": {"item"}, "as": {"saved"}, "id": {postID}})
+	assert.Equal(t, postID, response["saved_item_ids"])
+
+	response = feverRequest(t, f.server, "api", url.Values{"api_key": {key}, "mark": {"item"}, "as": {"unread"}, "id": {postID}})
+	assert.Equal(t, postID, response["unread_item_ids"])
+
+	// Marking another user's post is silently ignored.
+	response = feverRequest(t, f.server, "api", url.Values{"api_key": {key}, "mark": {"item"}, "as": {"read"}, "id": {strconv.FormatInt(f.post2, 10)}})
+	assert.Equal(t, float64(1), response["auth"])
+
+	response = feverRequest(t, f.server, "api", url.Values{"api_key": {key}, "mark": {"group"}, "as": {"read"}, "id": {"0"}, "before": {"1"}})
+	assert.Equal(t, postID, response["unread_item_ids"], "posts published after the before time stay unread")
+
+	response = feverRequest(t, f.server, "api", url.Values{"api_key": {key}, "mark": {"feed"}, "as": {"read"}, "id": {strconv.FormatInt(f.feed1, 10)}})
+	assert.Equal(t, "", response["unread_item_ids"])
+}
+
+func TestHandleSetFeverCredentials(t *testing.T) {
+	f := newServerAuthFixture(t)
+
+	req, w := requestAs(f.server, "POST", "/settings/fever", f.user1, nil)
+	req.PostForm = map[string][]string{"username": {"jo"}, "password": {"short"}}
+	f.server.handleSetFeverCredentials(w, req)
+	assertRedirect(t, w, "/settings#fever")
+	assert.Len(t, flashesByType(f.server, req)["error"], 1)
+
+	req, w = requestAs(f.server, "POST", "/settings/fever", f.user1, nil)
+	req.PostForm = map[string][]string{"username": {" jo "}, "password": {"password1"}}
+	f.server.handleSetFeverCredentials(w, req)
+	assertRedirect(t, w, "/settings#fever")
+	userID, err := f.store.GetUserIDForFeverAPIKey(db.FeverAPIKey("jo", "password1"))
+	require.NoError(t, err)
+	assert.Equal(t, f.user1, userID)
+
+	req, w = requestAs(f.server, "GET", "/settings", f.user1, nil)
+	f.server.handleSettings(w, req)
+	assertResponseSuccess(t, w, "Enabled for username <strong>jo</strong>")
+
+	req, w = requestAs(f.server, "POST", "/settings/fever/delete", f.user1, nil)
+	f.server.handleDeleteFeverCredentials(w, req)
+	assertRedirect(t, w, "/settings#fever")
+	username, err := f.store.GetFeverUsernameForUser(f.user1)
+	require.NoError(t, err)
+	assert.Empty(t, username)
+}
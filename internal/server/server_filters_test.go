@@ -0,0 +1,83 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/aggregat4/rssgrid/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleCreateFilterRule(t *testing.T) {
+	f := newServerAuthFixture(t)
+
+	req, w := requestAs(f.server, "POST", "/settings/filters", f.user1, nil)
+	req.PostForm = map[string][]string{
+		"field": {"content"}, "match": {"substring"}, "pattern": {" content 1 "},
+		"feedId": {strconv.FormatInt(f.feed1, 10)}, "action": {"hide"},
+	}
+	f.server.handleCreateFilterRule(w, req)
+	assertRedirect(t, w, "/settings#filters")
+
+	rules, err := f.store.GetFilterRulesForUser(f.user1)
+	require.NoError(t, err)
+	require.Len(t, rules, 1)
+	assert.Equal(t, "content 1", rules[0].Pattern)
+	assert.Equal(t, f.feed1, rules[0].FeedID)
+
+	req, w = requestAs(f.server, "GET", "/", f.user1, nil)
+	f.server.handleDashboard(w, req)
+	assertResponseNotContains(t, w, "Post 1")
+
+	req, w = requestAs(f.server, "GET", "/settings", f.user1, nil)
+	f.server.handleSettings(w, req)
+	assertResponseSuccess(t, w, "Hide posts whose content contains <code>content 1</code>")
+}
+
+func TestHandleCreateFilterRule_Invalid(t *testing.T) {
+	f := newServerAuthFixture(t)
+
+	req, w := requestAs(f.server, "POST", "/settings/filters", f.user1, nil)
+	req.PostForm = map[string][]string{"field": {"title"}, "match": {"regex"}, "pattern": {"("}, "action": {"hide"}}
+	f.server.handleCreateFilterRule(w, req)
+	assertRedirect(t, w, "/settings#filters")
+	assert.Contains(t, flashesByType(f.server, req)["error"][0], "Invalid regular expression")
+
+	req, w = requestAs(f.server, "POST", "/settings/filters", f.user1, nil)
+	req.PostForm = map[string][]string{"field": {"guid"}, "pattern": {"x"}, "action": {"hide"}}
+	f.server.handleCreateFilterRule(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	req, w = requestAs(f.server, "POST", "/settings/filters", f.user1, nil)
+	req.PostForm = map[string][]string{
+		"field": {"title"}, "pattern": {"x"}, "action": {"hide"},
+		"feedId": {strconv.FormatInt(f.feed2, 10)},
+	}
+	f.server.handleCreateFilterRule(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	rules, err := f.store.GetFilterRulesForUser(f.user1)
+	require.NoError(t, err)
+	assert.Empty(t, rules)
+}
+
+func TestHandleDeleteFilterRule(t *testing.T) {
+	f := newServerAuthFixture(t)
+	ruleID, err := f.store.CreateFilterRuleForUser(f.user1, db.FilterRule{Field: db.FilterFieldTitle, Pattern: "x", Action: db.FilterActionHighlight})
+	require.NoError(t, err)
+	path := "/settings/filters/" + strconv.FormatInt(ruleID, 10) + "/delete"
+
+	req, w := requestAs(f.server, "POST", path, f.user2, map[string]string{"ruleId": strconv.FormatInt(ruleID, 10)})
+	f.server.handleDeleteFilterRule(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	req, w = requestAs(f.server, "POST", path, f.user1, map[string]string{"ruleId": strconv.FormatInt(ruleID, 10)})
+	f.server.handleDeleteFilterRule(w, req)
+	assertRedirect(t, w, "/settings#filters")
+
+	rules, err := f.store.GetFilterRulesForUser(f.user1)
+	require.NoError(t, err)
+	assert.Empty(t, rules)
+}
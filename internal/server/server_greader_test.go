@@ -0,0 +1,230 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func greaderRouter(server *Server) http.Handler {
+	r := chi.NewRouter()
+	r.Route("/greader", server.greaderRoutes)
+	return r
+}
+
+// greaderRequest sends form to the GReader API with the given ClientLogin
+// token. GET requests carry the form in the query string.
+func greaderRequest(t *testing.T, handler http.Handler, method, path, token string, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	var req *http.Request
+	if method == "GET" {
+		req = httptest.NewRequest(method, path+"?"+form.Encode(), nil)
+	} else {
+		req = httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "GoogleLogin auth="+token)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	return w
+}
+
+func greaderJSON(t *testing.T, w *httptest.ResponseRecorder) map[string]any {
+	t.Helper()
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var response map[string]any
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	return response
+}
+
+func greaderItemTitles(response map[string]any) []string {
+	var titles []string
+	for _, item := range response["items"].([]any) {
+		titles = append(titles, item.(map[string]any)["title"].(string))
+	}
+	return titles
+}
+
+func TestGReader_ClientLogin(t *testing.T) {
+	f := newServerAuthFixture(t)
+	token, err := f.store.CreateAPITokenForUser(f.user1, "reader")
+	require.NoError(t, err)
+	handler := greaderRouter(f.server)
+
+	w := greaderRequest(t, handler, "POST", "/greader/accounts/ClientLogin", "", url.Values{"Email": {"jo"}, "Passwd": {"wrong"}})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	assert.Contains(t, w.Body.String(), "Error=BadAuthentication")
+
+	w = greaderRequest(t, handler, "POST", "/greader/accounts/ClientLogin", "", url.Values{"Email": {"jo"}, "Passwd": {token}})
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Auth="+token+"\n")
+
+	w = greaderRequest(t, handler, "GET", "/greader/reader/api/0/subscription/list", "", url.Values{"output": {"json"}})
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = greaderRequest(t, handler, "GET", "/greader/reader/api/0/subscription/list", "wrong", nil)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = greaderRequest(t, handler, "GET", "/greader/reader/api/0/token", token, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestGReader_SubscriptionsAndLabels(t *testing.T) {
+	f := newServerAuthFixture(t)
+	token, err := f.store.CreateAPITokenForUser(f.user1, "reader")
+	require.NoError(t, err)
+	handler := greaderRouter(f.server)
+	feedStream := "feed/" + strconv.FormatInt(f.feed1, 10)
+
+	response := greaderJSON(t, greaderRequest(t, handler, "GET", "/greader/reader/api/0/subscription/list", token, nil))
+	subscriptions := response["subscriptions"].([]any)
+	require.Len(t, subscriptions, 1, "only the user's own feeds are listed")
+	subscription := subscriptions[0].(map[string]any)
+	assert.Equal(t, feedStream, subscription["id"])
+	assert.Equal(t, "https://example.com/feed1.xml", subscription["url"])
+	assert.Equal(t, []any{map[string]any{"id": "user/-/label/Home", "label": "Home"}}, subscription["categories"])
+
+	w := greaderRequest(t, handler, "POST", "/greader/reader/api/0/subscription/edit", token, url.Values{
+		"ac": {"edit"},
+		"s":  {feedStream},
+		"t":  {"Renamed"},
+		"a":  {"user/-/label/News"},
+		"r":  {"user/-/label/Home"},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "OK", w.Body.String())
+
+	response = greaderJSON(t, greaderRequest(t, handler, "GET", "/greader/reader/api/0/subscription/list", token, nil))
+	subscription = response["subscriptions"].([]any)[0].(map[string]any)
+	assert.Equal(t, "Renamed", subscription["title"])
+	assert.Equal(t, []any{map[string]any{"id": "user/-/label/News", "label": "News"}}, subscription["categories"])
+
+	response = greaderJSON(t, greaderRequest(t, handler, "GET", "/greader/reader/api/0/tag/list", token, nil))
+	assert.Contains(t, response["tags"], map[string]any{"id": "user/-/label/News", "type": "folder"})
+
+	w = greaderRequest(t, handler, "POST", "/greader/reader/api/0/subscription/edit", token, url.Values{
+		"ac": {"edit"},
+		"s":  {"feed/" + strconv.FormatInt(f.feed2, 10)},
+		"t":  {"Hijacked"},
+	})
+	assert.Equal(t, http.StatusNotFound, w.Code, "other users' feeds cannot be edited")
+
+	w = greaderRequest(t, handler, "POST", "/greader/reader/api/0/subscription/edit", token, url.Values{"ac": {"unsubscribe"}, "s": {feedStream}})
+	require.Equal(t, http.StatusOK, w.Code)
+	feeds, err := f.store.GetUserFeeds(f.user1)
+	require.NoError(t, err)
+	assert.Empty(t, feeds)
+}
+
+func TestGReader_Subscribe(t *testing.T) {
+	f := newServerAuthFixture(t)
+	token, err := f.store.CreateAPITokenForUser(f.user1, "reader")
+	require.NoError(t, err)
+	f.server.fetcher = newLoopbackFetcher(t, f.store)
+	handler := greaderRouter(f.server)
+	site := newDiscoverySite(t, "/feed.xml")
+
+	w := greaderRequest(t, handler, "POST", "/greader/reader/api/0/subscription/edit", token, url.Values{
+		"ac": {"subscribe"},
+		"s":  {"feed/" + site.URL},
+		"a":  {"user/-/label/Blogs"},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	feeds, err := f.store.GetUserFeeds(f.user1)
+	require.NoError(t, err)
+	require.Len(t, feeds, 2)
+	assert.Equal(t, site.URL+"/feed.xml", feeds[1].URL, "the feed advertised by the page is subscribed")
+	assert.Equal(t, "Feed /feed.xml", feeds[1].Title)
+	dashboardIDs, err := f.store.GetFeedDashboardIDsForUser(f.user1)
+	require.NoError(t, err)
+	assert.Len(t, dashboardIDs[feeds[1].ID], 2, "the feed is on Home and the new Blogs dashboard")
+
+	w = greaderRequest(t, handler, "POST", "/greader/reader/api/0/subscription/quickadd", token, url.Values{"quickadd": {"ftp://example.com"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestGReader_StreamContentsAndEditTag(t *testing.T) {
+	f := newServerAuthFixture(t)
+	token, err := f.store.CreateAPITokenForUser(f.user1, "reader")
+	require.NoError(t, err)
+	handler := greaderRouter(f.server)
+
+	base := time.Now().Add(-time.Hour)
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, f.store.AddPost(f.feed1, fmt.Sprintf("extra%d", i), fmt.Sprintf("Extra %d", i), "https://example.com/extra", base.Add(time.Duration(i)*time.Minute), "extra"))
+	}
+
+	path := "/greader/reader/api/0/stream/contents/" + url.PathEscape("user/-/state/com.google/reading-list")
+	response := greaderJSON(t, greaderRequest(t, handler, "GET", path, token, url.Values{"n": {"3"}}))
+	require.Len(t, response["items"], 3)
+	continuation := response["continuation"].(string)
+	require.NotEmpty(t, continuation)
+	first := greaderItemTitles(response)
+
+	response = greaderJSON(t, greaderRequest(t, handler, "GET", path, token, url.Values{"n": {"3"}, "c": {continuation}}))
+	require.Len(t, response["items"], 1)
+	assert.NotContains(t, response, "continuation", "the last page has no continuation")
+	all := append(first, greaderItemTitles(response)...)
+	assert.ElementsMatch(t, []string{"Post 1", "Extra 1", "Extra 2", "Extra 3"}, all, "other users' posts are not included")
+
+	item := response["items"].([]any)[0].(map[string]any)
+	itemID := item["id"].(string)
+	assert.True(t, strings.HasPrefix(itemID, "tag:google.com,2005:reader/item/"))
+	assert.Equal(t, "feed/"+strconv.FormatInt(f.feed1, 10), item["origin"].(map[string]any)["streamId"])
+
+	w := greaderRequest(t, handler, "POST", "/greader/reader/api/0/edit-tag", token, url.Values{
+		"i": {itemID},
+		"a": {"user/-/state/com.google/read", "user/-/state/com.google/starred"},
+	})
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	response = greaderJSON(t, greaderRequest(t, handler, "GET", "/greader/reader/api/0/stream/items/ids", token, url.Values{
+		"s": {"user/-/state/com.google/starred"},
+	}))
+	refs := response["itemRefs"].([]any)
+	require.Len(t, refs, 1)
+	id, ok := parseGReaderItemID(itemID)
+	require.True(t, ok)
+	assert.Equal(t, strconv.FormatInt(id, 10), refs[0].(map[string]any)["id"])
+
+	response = greaderJSON(t, greaderRequest(t, handler, "GET", "/greader/reader/api/0/stream/items/ids", token, url.Values{
+		"s":  {"user/-/state/com.google/reading-list"},
+		"xt": {"user/-/state/com.google/read"},
+	}))
+	assert.Len(t, response["itemRefs"], 3, "read items are excluded")
+
+	w = greaderRequest(t, handler, "POST", "/greader/reader/api/0/edit-tag", token, url.Values{
+		"i": {strconv.FormatInt(f.post2, 10)},
+		"a": {"user/-/state/com.google/starred"},
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	starred, err := f.store.GetStarredPostIDsForUser(f.user2)
+	require.NoError(t, err)
+	assert.Empty(t, starred, "other users' posts cannot be tagged")
+
+	response = greaderJSON(t, greaderRequest(t, handler, "POST", "/greader/reader/api/0/stream/items/contents", token, url.Values{
+		"i": {strconv.FormatInt(id, 10), strconv.FormatInt(f.post2, 10)},
+	}))
+	items := response["items"].([]any)
+	require.Len(t, items, 1)
+	assert.Contains(t, items[0].(map[string]any)["categories"], "user/-/state/com.google/read")
+
+	w = greaderRequest(t, handler, "POST", "/greader/reader/api/0/mark-all-as-read", token, url.Values{
+		"s": {"user/-/state/com.google/reading-list"},
+	})
+	require.Equal(t, http.StatusOK, w.Code)
+	unread, err := f.store.GetUnreadPostIDsForUser(f.user1)
+	require.NoError(t, err)
+	assert.Empty(t, unread)
+}
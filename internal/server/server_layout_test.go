@@ -0,0 +1,110 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/aggregat4/rssgrid/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func layouts(widgets []widgetData) []db.WidgetLayout {
+	result := make([]db.WidgetLayout, 0, len(widgets))
+	for _, w := range widgets {
+		result = append(result, w.Layout)
+	}
+	return result
+}
+
+func TestPlaceWidgets(t *testing.T) {
+	t.Run("fills row by row without a saved layout", func(t *testing.T) {
+		widgets := placeWidgets(make([]widgetData, 4), 3)
+		assert.Equal(t, []db.WidgetLayout{
+			{Column: 1, Row: 1, Width: 1, Height: 1},
+			{Column: 2, Row: 1, Width: 1, Height: 1},
+			{Column: 3, Row: 1, Width: 1, Height: 1},
+			{Column: 1, Row: 2, Width: 1, Height: 1},
+		}, layouts(widgets))
+	})
+
+	t.Run("keeps saved places and fills the gaps", func(t *testing.T) {
+		widgets := placeWidgets([]widgetData{
+			{Layout: db.WidgetLayout{Column: 1, Row: 1, Width: 2, Height: 2}},
+			{},
+			{},
+		}, 3)
+		assert.Equal(t, []db.WidgetLayout{
+			{Column: 1, Row: 1, Width: 2, Height: 2},
+			{Column: 3, Row: 1, Width: 1, Height: 1},
+			{Column: 3, Row: 2, Width: 1, Height: 1},
+		}, layouts(widgets))
+	})
+
+	t.Run("moves widgets that no longer fit", func(t *testing.T) {
+		widgets := placeWidgets([]widgetData{
+			{Layout: db.WidgetLayout{Column: 3, Row: 1, Width: 1, Height: 1}},
+			{Layout: db.WidgetLayout{Column: 1, Row: 1, Width: 3, Height: 1}},
+		}, 2)
+		assert.Equal(t, []db.WidgetLayout{
+			{Column: 1, Row: 2, Width: 1, Height: 1},
+			{Column: 1, Row: 1, Width: 2, Height: 1},
+		}, layouts(widgets))
+	})
+}
+
+func saveLayoutRequest(f *serverAuthFixture, userID int64, dashboardID string, body string) *httptest.ResponseRecorder {
+	req, w := requestAs(f.server, "POST", "/dashboards/"+dashboardID+"/layout", userID, map[string]string{"dashboardId": dashboardID})
+	req.Body = io.NopCloser(strings.NewReader(body))
+	f.server.handleSaveDashboardLayout(w, req)
+	return w
+}
+
+func TestHandleSaveDashboardLayout(t *testing.T) {
+	f := newServerAuthFixture(t)
+	require.NoError(t, f.store.SetUserColumns(f.user1, 3))
+	dashboards, err := f.store.GetDashboardsForUser(f.user1)
+	require.NoError(t, err)
+	dashboardID := strconv.FormatInt(dashboards[0].ID, 10)
+	feedID := strconv.FormatInt(f.feed1, 10)
+
+	w := saveLayoutRequest(f, f.user1, dashboardID, `{"widgets":[{"feedId":`+feedID+`,"column":2,"row":3,"width":2,"height":2}]}`)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	req, w := requestAs(f.server, "GET", "/", f.user1, nil)
+	f.server.handleDashboard(w, req)
+	assertResponseSuccess(t, w, "grid-column: 2 / span 2; grid-row: 3 / span 2", "--grid-columns: 3")
+
+	// Widgets must stay on the grid.
+	w = saveLayoutRequest(f, f.user1, dashboardID, `{"widgets":[{"feedId":`+feedID+`,"column":3,"row":1,"width":2,"height":1}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	// Other users can neither change the dashboard nor place their feeds on it.
+	w = saveLayoutRequest(f, f.user2, dashboardID, `{"widgets":[{"feedId":`+feedID+`,"column":1,"row":1,"width":1,"height":1}]}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	otherFeedID := strconv.FormatInt(f.feed2, 10)
+	w = saveLayoutRequest(f, f.user1, dashboardID, `{"widgets":[{"feedId":`+otherFeedID+`,"column":1,"row":1,"width":1,"height":1}]}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	layout, err := f.store.GetDashboardLayout(f.user1, dashboards[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, db.WidgetLayout{Column: 2, Row: 3, Width: 2, Height: 2}, layout[f.feed1])
+}
+
+func TestHandleSaveDashboardLayout_RejectsOverlaps(t *testing.T) {
+	f := newServerAuthFixture(t)
+	feed3, err := f.store.AddFeedForUser(f.user1, "https://example.com/feed3.xml")
+	require.NoError(t, err)
+	dashboards, err := f.store.GetDashboardsForUser(f.user1)
+	require.NoError(t, err)
+	dashboardID := strconv.FormatInt(dashboards[0].ID, 10)
+
+	w := saveLayoutRequest(f, f.user1, dashboardID, `{"widgets":[`+
+		`{"feedId":`+strconv.FormatInt(f.feed1, 10)+`,"column":1,"row":1,"width":1,"height":2},`+
+		`{"feedId":`+strconv.FormatInt(feed3, 10)+`,"column":1,"row":2,"width":1,"height":1}]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,265 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aggregat4/rssgrid/internal/config"
+	"github.com/aggregat4/rssgrid/internal/db"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newLocalAuthServer(t *testing.T, registration string) (*Server, *db.Store) {
+	t.Helper()
+	store, cleanup := createTestStore(t)
+	t.Cleanup(cleanup)
+	server := createTestServerWithStore(t, store)
+	webAuthn, err := NewWebAuthn("http://localhost:8080")
+	require.NoError(t, err)
+	server.SetLocalAuth(LocalAuth{Registration: registration, WebAuthn: webAuthn})
+	return server, store
+}
+
+func formRequest(method, path string, form map[string][]string) (*http.Request, *httptest.ResponseRecorder) {
+	req := httptest.NewRequest(method, path, nil)
+	req.PostForm = form
+	return req, httptest.NewRecorder()
+}
+
+func TestRegisterWithInvites(t *testing.T) {
+	server, store := newLocalAuthServer(t, config.RegistrationInvite)
+
+	req, w := formRequest("GET", "/register", nil)
+	server.handleRegisterPage(w, req)
+	assertResponseSuccess(t, w, `name="username"`)
+	assertResponseNotContains(t, w, `name="invite"`)
+
+	// The first account needs no invite and becomes the admin
+	req, w = formRequest("POST", "/register", map[string][]string{"username": {"Admin"}, "password": {"password1"}})
+	server.handleRegister(w, req)
+	assertRedirect(t, w, "/")
+	adminID, err := store.AuthenticateLocalUser("admin", "password1")
+	require.NoError(t, err)
+
+	req, w = formRequest("POST", "/register", map[string][]string{"username": {"guest"}, "password": {"password2"}})
+	server.handleRegister(w, req)
+	assertRedirect(t, w, "/register")
+	_, err = store.AuthenticateLocalUser("guest", "password2")
+	assert.Equal(t, db.ErrInvalidCredentials, err, "later accounts need an invite")
+
+	req, w = requestAs(server, "POST", "/settings/invites", adminID, nil)
+	server.handleCreateInvite(w, req)
+	assertResponseSuccess(t, w, "http://example.com/register?invite=")
+	link := w.Body.String()[strings.Index(w.Body.String(), "?invite=")+len("?invite="):]
+	invite := link[:strings.Index(link, "<")]
+
+	req, w = formRequest("POST", "/register", map[string][]string{"username": {"guest"}, "password": {"password2"}, "invite": {invite}})
+	server.handleRegister(w, req)
+	assertRedirect(t, w, "/")
+	guestID, err := store.AuthenticateLocalUser("guest", "password2")
+	require.NoError(t, err)
+
+	req, w = requestAs(server, "POST", "/settings/invites", guestID, nil)
+	server.handleCreateInvite(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code, "only the admin can invite")
+}
+
+func TestRegisterValidatesInput(t *testing.T) {
+	server, _ := newLocalAuthServer(t, config.RegistrationOpen)
+
+	for _, form := range []map[string][]string{
+		{"username": {"a"}, "password": {"password1"}},
+		{"username": {"../admin"}, "password": {"password1"}},
+		{"username": {"alice"}, "password": {"short"}},
+	} {
+		req, w := formRequest("POST", "/register", form)
+		server.handleRegister(w, req)
+		assertRedirect(t, w, "/register")
+	}
+}
+
+func TestRegisterClosed(t *testing.T) {
+	server, store := newLocalAuthServer(t, config.RegistrationClosed)
+	_, err := store.CreateLocalUser("admin", "password1", "")
+	require.NoError(t, err)
+
+	req, w := formRequest("GET", "/login", nil)
+	server.handleLoginPage(w, req)
+	assertResponseSuccess(t, w, "Sign in with a passkey")
+	assertResponseNotContains(t, w, `href="/register"`)
+
+	req, w = formRequest("POST", "/register", map[string][]string{"username": {"guest"}, "password": {"password2"}})
+	server.handleRegister(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestLogin(t *testing.T) {
+	server, store := newLocalAuthServer(t, config.RegistrationOpen)
+	userID, err := store.CreateLocalUser("alice", "password1", "")
+	require.NoError(t, err)
+
+	req, w := formRequest("POST", "/login", map[string][]string{"username": {"alice"}, "password": {"wrong"}})
+	server.handleLogin(w, req)
+	assertRedirect(t, w, "/login")
+
+	req, w = formRequest("POST", "/login", map[string][]string{"username": {" Alice "}, "password": {"password1"}})
+	server.handleLogin(w, req)
+	assertRedirect(t, w, "/")
+
+	// The session cookie signs in later requests
+	req = httptest.NewRequest("GET", "/settings", nil)
+	for _, cookie := range w.Result().Cookies() {
+		req.AddCookie(cookie)
+	}
+	assert.Equal(t, userID, server.getUserID(req))
+}
+
+func TestLogin_ThrottlesFailedAttempts(t *testing.T) {
+	server, store := newLocalAuthServer(t, config.RegistrationOpen)
+	_, err := store.CreateLocalUser("alice", "password1", "")
+	require.NoError(t, err)
+	_, err = store.CreateLocalUser("bob", "password2", "")
+	require.NoError(t, err)
+
+	login := func(address, username, password string) *httptest.ResponseRecorder {
+		req, w := formRequest("POST", "/login", map[string][]string{"username": {username}, "password": {password}})
+		req.RemoteAddr = address + ":1234"
+		server.handleLogin(w, req)
+		return w
+	}
+
+	// Guessing one account from many addresses locks that account only.
+	for i := 0; i < maxLoginFailuresPerUsername; i++ {
+		assertRedirect(t, login(fmt.Sprintf("198.51.100.%d", i), "alice", "wrong"), "/login")
+	}
+	assertRedirect(t, login("203.0.113.1", "alice", "password1"), "/login")
+	assertRedirect(t, login("203.0.113.1", "bob", "password2"), "/")
+
+	// Guessing many accounts from one address locks that address only.
+	for i := 0; i < maxLoginFailuresPerAddress; i++ {
+		assertRedirect(t, login("192.0.2.1", fmt.Sprintf("user%d", i), "wrong"), "/login")
+	}
+	assertRedirect(t, login("192.0.2.1", "bob", "password2"), "/login")
+	assertRedirect(t, login("192.0.2.2", "bob", "password2"), "/")
+}
+
+func TestRegister_ThrottlesFailedAttempts(t *testing.T) {
+	server, store := newLocalAuthServer(t, config.RegistrationInvite)
+	_, err := store.CreateLocalUser("admin", "password1", "")
+	require.NoError(t, err)
+
+	for i := 0; i < maxRegisterFailuresPerAddress; i++ {
+		req, w := formRequest("POST", "/register", map[string][]string{"username": {"guest"}, "password": {"password2"}, "invite": {fmt.Sprintf("guess%d", i)}})
+		server.handleRegister(w, req)
+		assertRedirect(t, w, fmt.Sprintf("/register?invite=guess%d", i))
+	}
+
+	req, w := formRequest("POST", "/register", map[string][]string{"username": {"guest"}, "password": {"password2"}, "invite": {"another"}})
+	server.handleRegister(w, req)
+	assertRedirect(t, w, "/register?invite=another")
+	assert.Equal(t, []string{"Too many failed registration attempts. Try again later."}, flashesByType(server, req)["error"])
+}
+
+func TestAttemptLimiter_WindowExpires(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter := newAttemptLimiter(2, time.Minute)
+	limiter.now = func() time.Time { return now }
+
+	limiter.Fail("key")
+	assert.True(t, limiter.Allowed("key"))
+	limiter.Fail("key")
+	assert.False(t, limiter.Allowed("key"))
+	assert.True(t, limiter.Allowed("other"))
+
+	now = now.Add(time.Minute)
+	assert.True(t, limiter.Allowed("key"), "failures expire with their window")
+
+	limiter.Fail("key")
+	limiter.Fail("key")
+	limiter.Reset("key")
+	assert.True(t, limiter.Allowed("key"))
+}
+
+func TestLocalAuthMiddleware(t *testing.T) {
+	server, store := newLocalAuthServer(t, config.RegistrationOpen)
+	userID, err := store.CreateLocalUser("alice", "password1", "")
+	require.NoError(t, err)
+
+	handler := localAuthMiddleware(func(r *http.Request) bool {
+		return server.getUserID(r) != 0
+	}, func(r *http.Request) bool {
+		return isLocalAuthPublicPath(r.URL.Path)
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/settings", nil))
+	assert.Equal(t, http.StatusFound, w.Code)
+	assert.Equal(t, "/login", w.Header().Get("Location"))
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("POST", "/settings/feeds", nil))
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/login", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req, w := requestAs(server, "GET", "/settings", userID, nil)
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func TestAccountSettings(t *testing.T) {
+	server, store := newLocalAuthServer(t, config.RegistrationInvite)
+	userID, err := store.CreateLocalUser("alice", "password1", "")
+	require.NoError(t, err)
+	require.NoError(t, store.AddPasskeyForUser(userID, "Laptop", []byte{1}, `{}`))
+
+	req, w := requestAs(server, "GET", "/settings", userID, nil)
+	server.handleSettings(w, req)
+	assertResponseSuccess(t, w, "Signed in as <strong>alice</strong> (admin)", "Laptop", "Create Invite", "/static/passkeys.js")
+
+	req, w = requestAs(server, "POST", "/settings/password", userID, nil)
+	req.PostForm = map[string][]string{"currentPassword": {"wrong"}, "newPassword": {"password2"}}
+	server.handleChangePassword(w, req)
+	assertRedirect(t, w, "/settings#account")
+	_, err = store.AuthenticateLocalUser("alice", "password1")
+	assert.NoError(t, err, "a wrong current password keeps the old one")
+
+	req, w = requestAs(server, "POST", "/settings/password", userID, nil)
+	req.PostForm = map[string][]string{"currentPassword": {"password1"}, "newPassword": {"password2"}}
+	server.handleChangePassword(w, req)
+	assertRedirect(t, w, "/settings#account")
+	_, err = store.AuthenticateLocalUser("alice", "password2")
+	assert.NoError(t, err)
+
+	// OIDC users have no local account to manage
+	f := newServerAuthFixture(t)
+	req, w = requestAs(f.server, "GET", "/settings", f.user1, nil)
+	f.server.handleSettings(w, req)
+	assertResponseNotContains(t, w, `id="account"`)
+}
+
+func TestBeginPasskeyRegistration(t *testing.T) {
+	server, store := newLocalAuthServer(t, config.RegistrationOpen)
+	userID, err := store.CreateLocalUser("alice", "password1", "")
+	require.NoError(t, err)
+
+	req, w := requestAs(server, "POST", "/settings/passkeys/begin", userID, nil)
+	server.handleBeginPasskeyRegistration(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"challenge"`)
+	assert.Contains(t, w.Body.String(), `"name":"alice"`)
+
+	// Finishing needs the ceremony from the session of the begin request
+	req, w = requestAs(server, "POST", "/settings/passkeys/finish?name=Laptop", userID, nil)
+	server.handleFinishPasskeyRegistration(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,173 @@
+package server
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// opmlUploadRequest builds a multipart OPML upload authenticated as userID.
+func opmlUploadRequest(t *testing.T, server *Server, userID int64, opml string) (*http.Request, *httptest.ResponseRecorder) {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	part, err := mw.CreateFormFile("opml", "feeds.opml")
+	require.NoError(t, err)
+	_, err = part.Write([]byte(opml))
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+
+	req := httptest.NewRequest("POST", "/settings/opml/import", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	w := httptest.NewRecorder()
+	session, _ := server.sessions.Get(req, "user_session")
+	session.Values["user_id"] = userID
+	_ = session.Save(req, w)
+	return req, w
+}
+
+func TestHandleImportOPML_SubscribesInOutlineOrder(t *testing.T) {
+	store, cleanup := createTestStore(t)
+	defer cleanup()
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	server := createTestServerWithStore(t, store)
+
+	opml := `<?xml version="1.0"?>
+<opml version="2.0"><body>
+  <outline text="Zeta" xmlUrl="https://zeta.example.com/feed"/>
+  <outline text="Folder">
+    <outline text="Alpha" xmlUrl="https://alpha.example.com/feed"/>
+  </outline>
+  <outline text="Broken" xmlUrl="ftp://broken.example.com/feed"/>
+  <outline text="Mid" xmlUrl="https://mid.example.com/feed"/>
+</body></opml>`
+
+	req, w := opmlUploadRequest(t, server, userID, opml)
+	server.handleImportOPML(w, req)
+	assertRedirect(t, w, "/settings")
+
+	feeds, err := store.GetUserFeeds(userID)
+	require.NoError(t, err)
+	require.Len(t, feeds, 3, "the invalid outline must be skipped")
+	assert.Equal(t, "https://zeta.example.com/feed", feeds[0].URL)
+	assert.Equal(t, "https://alpha.example.com/feed", feeds[1].URL)
+	assert.Equal(t, "https://mid.example.com/feed", feeds[2].URL)
+	assert.Equal(t, "Zeta", feeds[0].Title, "OPML title should be used until the feed is fetched")
+
+	flashes := server.getFlashMessages(httptest.NewRecorder(), req)
+	var errorsSeen, successSeen bool
+	for _, f := range flashes {
+		if f.Type == "error" {
+			errorsSeen = true
+			assert.Contains(t, f.Message, "Broken")
+		}
+		if f.Type == "success" {
+			successSeen = true
+			assert.Contains(t, f.Message, "Imported 3 of 4 feeds")
+		}
+	}
+	assert.True(t, errorsSeen, "the invalid feed should be reported as an error flash")
+	assert.True(t, successSeen, "a summary success flash should be added")
+}
+
+func TestHandleImportOPML_DoesNotOverwriteExistingTitle(t *testing.T) {
+	store, cleanup := createTestStore(t)
+	defer cleanup()
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://known.example.com/feed")
+	require.NoError(t, err)
+	require.NoError(t, store.UpdateFeedTitle(feedID, "Real Title"))
+	server := createTestServerWithStore(t, store)
+
+	req, w := opmlUploadRequest(t, server, userID, `<opml version="2.0"><body><outline text="Other Title" xmlUrl="https://known.example.com/feed"/></body></opml>`)
+	server.handleImportOPML(w, req)
+	assertRedirect(t, w, "/settings")
+
+	feeds, err := store.GetUserFeeds(userID)
+	require.NoError(t, err)
+	require.Len(t, feeds, 1)
+	assert.Equal(t, "Real Title", feeds[0].Title)
+}
+
+func TestHandleImportOPML_InvalidFileReportsError(t *testing.T) {
+	store, cleanup := createTestStore(t)
+	defer cleanup()
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	server := createTestServerWithStore(t, store)
+
+	req, w := opmlUploadRequest(t, server, userID, "not an opml file")
+	server.handleImportOPML(w, req)
+	assertRedirect(t, w, "/settings")
+
+	feeds, err := store.GetUserFeeds(userID)
+	require.NoError(t, err)
+	assert.Empty(t, feeds)
+}
+
+func TestHandleExportOPML(t *testing.T) {
+	store, cleanup := createTestStore(t)
+	defer cleanup()
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://a.example.com/feed")
+	require.NoError(t, err)
+	require.NoError(t, store.UpdateFeedTitle(feedID, "Feed A"))
+	_, err = store.AddFeedForUser(userID, "https://untitled.example.com/feed")
+	require.NoError(t, err)
+	server := createTestServerWithStore(t, store)
+
+	req, w := testRequest(server, "GET", "/settings/opml/export", userID)
+	server.handleExportOPML(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Header().Get("Content-Type"), "opml")
+	assert.Contains(t, w.Header().Get("Content-Disposition"), "attachment")
+	body := w.Body.String()
+	assert.Contains(t, body, `xmlUrl="https://a.example.com/feed"`)
+	assert.Contains(t, body, `text="Feed A"`)
+	assert.Contains(t, body, `text="https://untitled.example.com/feed"`, "untitled feeds fall back to their URL")
+}
+
+func TestOPML_TagsRoundTripAsFolders(t *testing.T) {
+	store, cleanup := createTestStore(t)
+	defer cleanup()
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	server := createTestServerWithStore(t, store)
+
+	opml := `<?xml version="1.0"?>
+<opml version="2.0"><body>
+  <outline text="Top" xmlUrl="https://top.example.com/feed"/>
+  <outline text="News">
+    <outline text="Daily" xmlUrl="https://daily.example.com/feed"/>
+  </outline>
+  <outline text="Favourites">
+    <outline text="Daily" xmlUrl="https://daily.example.com/feed"/>
+  </outline>
+</body></opml>`
+	req, w := opmlUploadRequest(t, server, userID, opml)
+	server.handleImportOPML(w, req)
+	assertRedirect(t, w, "/settings")
+
+	feeds, err := store.GetUserFeeds(userID)
+	require.NoError(t, err)
+	require.Len(t, feeds, 2)
+	assert.Empty(t, feeds[0].Tags)
+	assert.Equal(t, []string{"Favourites", "News"}, feeds[1].Tags)
+
+	req, w = testRequest(server, "GET", "/settings/opml/export", userID)
+	server.handleExportOPML(w, req)
+	require.Equal(t, http.StatusOK, w.Code)
+	body := w.Body.String()
+	assert.Contains(t, body, `<outline text="Favourites" title="Favourites">`)
+	assert.Equal(t, 2, strings.Count(body, `xmlUrl="https://daily.example.com/feed"`), "the feed is filed under each of its tags")
+}
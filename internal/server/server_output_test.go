@@ -0,0 +1,95 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aggregat4/rssgrid/internal/db"
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func outputRequest(t *testing.T, server *Server, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := chi.NewRouter()
+	r.Route("/output", server.outputRoutes)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	return w
+}
+
+func TestOutput_JSONFeed(t *testing.T) {
+	f := newServerAuthFixture(t)
+	token, err := f.store.CreateFeedTokenForUser(f.user1, "output")
+	require.NoError(t, err)
+	require.NoError(t, f.store.AddPost(f.feed1, "old", "Older post", "https://example.com/old", time.Now().Add(-time.Hour), "<p>old</p>"))
+
+	w := outputRequest(t, f.server, "/output/feed.json")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = outputRequest(t, f.server, "/output/feed.json?token=wrong")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	apiToken, err := f.store.CreateAPITokenForUser(f.user1, "api")
+	require.NoError(t, err)
+	w = outputRequest(t, f.server, "/output/feed.json?token="+apiToken)
+	assert.Equal(t, http.StatusUnauthorized, w.Code, "full access tokens are not accepted")
+
+	w = outputRequest(t, f.server, "/output/feed.json?token="+token)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/feed+json; charset=utf-8", w.Header().Get("Content-Type"))
+	var doc struct {
+		Title   string `json:"title"`
+		FeedURL string `json:"feed_url"`
+		Items   []struct {
+			Title       string `json:"title"`
+			ContentHTML string `json:"content_html"`
+		} `json:"items"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, "RSSGrid", doc.Title)
+	assert.Equal(t, "http://example.com/output/feed.json", doc.FeedURL, "the token is not in the self URL")
+	assert.NotContains(t, w.Body.String(), token)
+	require.Len(t, doc.Items, 2, "other users' posts are not included")
+	assert.Equal(t, "Post 1", doc.Items[0].Title, "newest posts come first")
+	assert.Equal(t, "<p>old</p>", doc.Items[1].ContentHTML)
+}
+
+func TestOutput_AtomFilteredByDashboardAndRule(t *testing.T) {
+	f := newServerAuthFixture(t)
+	token, err := f.store.CreateFeedTokenForUser(f.user1, "output")
+	require.NoError(t, err)
+	dashboards, err := f.store.GetDashboardsForUser(f.user1)
+	require.NoError(t, err)
+	otherDashboards, err := f.store.GetDashboardsForUser(f.user2)
+	require.NoError(t, err)
+	emptyID, err := f.store.CreateDashboardForUser(f.user1, "Empty")
+	require.NoError(t, err)
+	ruleID, err := f.store.CreateFilterRuleForUser(f.user1, db.FilterRule{Field: db.FilterFieldTitle, Pattern: "nothing", Action: db.FilterActionHighlight})
+	require.NoError(t, err)
+	otherRuleID, err := f.store.CreateFilterRuleForUser(f.user2, db.FilterRule{Field: db.FilterFieldTitle, Pattern: "post", Action: db.FilterActionHighlight})
+	require.NoError(t, err)
+
+	w := outputRequest(t, f.server, "/output/atom.xml?token="+token+"&dashboard="+strconv.FormatInt(dashboards[0].ID, 10))
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	assert.Equal(t, "application/atom+xml; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Contains(t, w.Body.String(), "<title>RSSGrid: Home</title>")
+	assert.Contains(t, w.Body.String(), "<title>Post 1</title>")
+	assert.Contains(t, w.Body.String(), `<content type="html">content 1</content>`)
+
+	w = outputRequest(t, f.server, "/output/atom.xml?token="+token+"&dashboard="+strconv.FormatInt(emptyID, 10))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "<entry>")
+
+	w = outputRequest(t, f.server, "/output/atom.xml?token="+token+"&filter="+strconv.FormatInt(ruleID, 10))
+	require.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), "<entry>")
+
+	w = outputRequest(t, f.server, "/output/atom.xml?token="+token+"&dashboard="+strconv.FormatInt(otherDashboards[0].ID, 10))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = outputRequest(t, f.server, "/output/atom.xml?token="+token+"&filter="+strconv.FormatInt(otherRuleID, 10))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
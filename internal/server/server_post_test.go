@@ -0,0 +1,51 @@
+package server
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aggregat4/rssgrid/internal/db"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleGetPost_ShowsUpdatesAndRevisions(t *testing.T) {
+	f := newServerAuthFixture(t)
+	require.NoError(t, f.store.AddPost(f.feed1, "g1", "Post 1 (corrected)", "https://example.com/p1", time.Now(), "content 1"))
+
+	postID := strconv.FormatInt(f.post1, 10)
+	req, w := requestAs(f.server, "GET", "/posts/"+postID, f.user1, map[string]string{"postId": postID})
+	f.server.handleGetPost(w, req)
+
+	assertResponseSuccess(t, w, "Post 1 (corrected)", "Updated just now", "Previous versions (1)")
+}
+
+func TestHandleGetPost_ShowsMetadata(t *testing.T) {
+	f := newServerAuthFixture(t)
+	published := time.Date(2026, 3, 2, 10, 0, 0, 0, time.UTC)
+	_, err := f.store.UpsertPostWithMetadata(f.feed1, "g-meta", "Episode 1", "https://example.com/ep1", "Alice, Bob", published, "<p>Show notes</p>", db.PostMetadata{
+		Summary:         "<p>In short</p>",
+		Categories:      []string{"Podcasts"},
+		ImageURL:        "https://example.com/ep1.jpg",
+		CommentsURL:     "https://example.com/ep1#comments",
+		Enclosures:      []db.Enclosure{{URL: "https://cdn.example.com/ep1.mp3", Type: "audio/mpeg", Length: 12345678}},
+		SourceUpdatedAt: published.Add(24 * time.Hour),
+	})
+	require.NoError(t, err)
+	posts, err := f.store.GetFeedPosts(f.feed1, f.user1, 10)
+	require.NoError(t, err)
+	var postID string
+	for _, p := range posts {
+		if p.Title == "Episode 1" {
+			postID = strconv.FormatInt(p.ID, 10)
+		}
+	}
+	require.NotEmpty(t, postID)
+
+	req, w := requestAs(f.server, "GET", "/posts/"+postID, f.user1, map[string]string{"postId": postID})
+	f.server.handleGetPost(w, req)
+
+	assertResponseSuccess(t, w, "by Alice, Bob", "updated March 3, 2026", "<li>Podcasts</li>",
+		`src="https://example.com/ep1.jpg"`, "<p>In short</p>", `href="https://example.com/ep1#comments"`,
+		"ep1.mp3", "audio/mpeg, 12.3 MB")
+}
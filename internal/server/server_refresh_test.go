@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/aggregat4/rssgrid/internal/db"
+	"github.com/aggregat4/rssgrid/internal/feed"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRefresher records the feeds it was asked to refresh and answers with
+// canned per-URL outcomes.
+type fakeRefresher struct {
+	mu        sync.Mutex
+	refreshed []string
+	errs      map[string]error
+	modified  map[string]bool
+}
+
+func (f *fakeRefresher) RefreshFeeds(_ context.Context, feeds []db.Feed) []feed.RefreshResult {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	results := make([]feed.RefreshResult, len(feeds))
+	for i, fd := range feeds {
+		f.refreshed = append(f.refreshed, fd.URL)
+		results[i] = feed.RefreshResult{Feed: fd, Modified: f.modified[fd.URL], Err: f.errs[fd.URL]}
+	}
+	return results
+}
+
+func flashesByType(server *Server, req *http.Request) map[string][]string {
+	byType := map[string][]string{}
+	for _, f := range server.getFlashMessages(httptest.NewRecorder(), req) {
+		byType[f.Type] = append(byType[f.Type], f.Message)
+	}
+	return byType
+}
+
+func TestHandleRefreshFeed(t *testing.T) {
+	f := newServerAuthFixture(t)
+	refresher := &fakeRefresher{modified: map[string]bool{"https://example.com/feed1.xml": true}}
+	f.server.SetRefresher(refresher)
+
+	feedID := strconv.FormatInt(f.feed1, 10)
+	req, w := requestAs(f.server, "POST", "/feeds/"+feedID+"/refresh", f.user1, map[string]string{"feedId": feedID})
+	f.server.handleRefreshFeed(w, req)
+
+	assertRedirect(t, w, "/")
+	assert.Equal(t, []string{"https://example.com/feed1.xml"}, refresher.refreshed)
+	flashes := flashesByType(f.server, req)
+	require.Len(t, flashes["success"], 1)
+	assert.Contains(t, flashes["success"][0], "Refreshed")
+}
+
+func TestHandleRefreshFeed_ReportsFailure(t *testing.T) {
+	f := newServerAuthFixture(t)
+	f.server.SetRefresher(&fakeRefresher{errs: map[string]error{"https://example.com/feed1.xml": errors.New("HTTP 500")}})
+
+	feedID := strconv.FormatInt(f.feed1, 10)
+	req, w := requestAs(f.server, "POST", "/feeds/"+feedID+"/refresh", f.user1, map[string]string{"feedId": feedID})
+	f.server.handleRefreshFeed(w, req)
+
+	assertRedirect(t, w, "/")
+	flashes := flashesByType(f.server, req)
+	require.Len(t, flashes["error"], 1)
+	assert.Contains(t, flashes["error"][0], "HTTP 500")
+}
+
+func TestHandleRefreshFeed_CrossUserDenied(t *testing.T) {
+	f := newServerAuthFixture(t)
+	refresher := &fakeRefresher{}
+	f.server.SetRefresher(refresher)
+
+	feedID := strconv.FormatInt(f.feed2, 10)
+	req, w := requestAs(f.server, "POST", "/feeds/"+feedID+"/refresh", f.user1, map[string]string{"feedId": feedID})
+	f.server.handleRefreshFeed(w, req)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Empty(t, refresher.refreshed, "another user's feed must not be fetched")
+}
+
+func TestHandleRefreshFeed_UnavailableWithoutRefresher(t *testing.T) {
+	f := newServerAuthFixture(t)
+
+	feedID := strconv.FormatInt(f.feed1, 10)
+	req, w := requestAs(f.server, "POST", "/feeds/"+feedID+"/refresh", f.user1, map[string]string{"feedId": feedID})
+	f.server.handleRefreshFeed(w, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestHandleRefreshAllFeeds_OnlyRefreshesOwnFeeds(t *testing.T) {
+	f := newServerAuthFixture(t)
+	_, err := f.store.AddFeedForUser(f.user1, "https://example.com/broken.xml")
+	require.NoError(t, err)
+	refresher := &fakeRefresher{
+		modified: map[string]bool{"https://example.com/feed1.xml": true},
+		errs:     map[string]error{"https://example.com/broken.xml": errors.New("timeout")},
+	}
+	f.server.SetRefresher(refresher)
+
+	req, w := requestAs(f.server, "POST", "/feeds/refresh", f.user1, nil)
+	f.server.handleRefreshAllFeeds(w, req)
+
+	assertRedirect(t, w, "/")
+	assert.ElementsMatch(t, []string{"https://example.com/feed1.xml", "https://example.com/broken.xml"}, refresher.refreshed)
+	flashes := flashesByType(f.server, req)
+	require.Len(t, flashes["error"], 1)
+	assert.Contains(t, flashes["error"][0], "timeout")
+	require.Len(t, flashes["success"], 1)
+	assert.Contains(t, flashes["success"][0], "Refreshed 2 feeds: 1 updated, 0 already up to date, 1 failed.")
+}
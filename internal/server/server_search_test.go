@@ -0,0 +1,47 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleSearch_RendersHighlightedResults(t *testing.T) {
+	store, cleanup := createTestStore(t)
+	defer cleanup()
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	feedID, err := store.AddFeedForUser(userID, "https://example.com/feed.xml")
+	require.NoError(t, err)
+	require.NoError(t, store.UpdateFeedTitle(feedID, "Example Feed"))
+	require.NoError(t, store.AddPost(feedID, "1", "Compilers <3", "https://example.com/1", time.Now(), "<p>Writing a parser by hand.</p>"))
+	server := createTestServerWithStore(t, store)
+
+	req, w := testRequest(server, "GET", "/search?q=parser", userID)
+	server.handleSearch(w, req)
+
+	assertResponseSuccess(t, w, "Compilers &lt;3", "<mark>parser</mark>", "Example Feed", `data-post-id="`)
+}
+
+func TestHandleSearch_NoMatchesAndEmptyQuery(t *testing.T) {
+	store, cleanup := createTestStore(t)
+	defer cleanup()
+	userID, err := store.GetOrCreateUser("sub", "iss")
+	require.NoError(t, err)
+	server := createTestServerWithStore(t, store)
+
+	req, w := testRequest(server, "GET", "/search?q=nothing", userID)
+	server.handleSearch(w, req)
+	assertResponseSuccess(t, w, "No posts match your search.")
+
+	req, w = testRequest(server, "GET", "/search", userID)
+	server.handleSearch(w, req)
+	assertResponseSuccess(t, w, "Enter one or more words")
+}
+
+func TestHighlightSnippet_EscapesContent(t *testing.T) {
+	got := highlightSnippet("<script>\x02x\x03</script>")
+	assert.Equal(t, "&lt;script&gt;<mark>x</mark>&lt;/script&gt;", string(got))
+}
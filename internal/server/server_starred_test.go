@@ -0,0 +1,52 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleSetPostStarred(t *testing.T) {
+	f := newServerAuthFixture(t)
+	postID := strconv.FormatInt(f.post1, 10)
+
+	req, w := requestAs(f.server, "POST", "/posts/"+postID+"/star", f.user1, map[string]string{"postId": postID})
+	f.server.handleSetPostStarred(true)(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	post, err := f.store.GetPostForUser(f.user1, f.post1)
+	require.NoError(t, err)
+	assert.True(t, post.Starred)
+
+	req, w = requestAs(f.server, "GET", "/starred", f.user1, nil)
+	f.server.handleStarred(w, req)
+	assertResponseSuccess(t, w, "Post 1", `class="star-toggle starred"`)
+
+	req, w = requestAs(f.server, "GET", "/posts/"+postID, f.user1, map[string]string{"postId": postID})
+	f.server.handleGetPost(w, req)
+	assertResponseSuccess(t, w, `data-starred="true"`, "★ Starred")
+
+	req, w = requestAs(f.server, "POST", "/posts/"+postID+"/unstar", f.user1, map[string]string{"postId": postID})
+	f.server.handleSetPostStarred(false)(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	req, w = requestAs(f.server, "GET", "/starred", f.user1, nil)
+	f.server.handleStarred(w, req)
+	assertResponseSuccess(t, w, "No starred posts yet.")
+}
+
+func TestHandleSetPostStarred_CrossUserDenied(t *testing.T) {
+	f := newServerAuthFixture(t)
+	postID := strconv.FormatInt(f.post2, 10)
+
+	req, w := requestAs(f.server, "POST", "/posts/"+postID+"/star", f.user1, map[string]string{"postId": postID})
+	f.server.handleSetPostStarred(true)(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	starred, err := f.store.GetStarredPostsForUser(f.user2)
+	require.NoError(t, err)
+	assert.Empty(t, starred)
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTags(t *testing.T) {
+	tags, err := parseTags(" news ,Tech,,  deep   dive, NEWS ")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"news", "Tech", "deep dive"}, tags)
+
+	tags, err = parseTags("")
+	require.NoError(t, err)
+	assert.Empty(t, tags)
+
+	_, err = parseTags(strings.Repeat("x", maxTagLength+1))
+	assert.Error(t, err)
+}
+
+func TestHandleSetFeedTags(t *testing.T) {
+	f := newServerAuthFixture(t)
+	feedID := strconv.FormatInt(f.feed1, 10)
+
+	req, w := requestAs(f.server, "POST", "/settings/feeds/"+feedID+"/tags", f.user1, map[string]string{"feedId": feedID})
+	req.PostForm = map[string][]string{"tags": {"news, tech"}}
+	f.server.handleSetFeedTags(w, req)
+	assertRedirect(t, w, "/settings")
+
+	feeds, err := f.store.GetUserFeeds(f.user1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"news", "tech"}, feeds[0].Tags)
+
+	req, w = requestAs(f.server, "GET", "/settings", f.user1, nil)
+	f.server.handleSettings(w, req)
+	assertResponseSuccess(t, w, `value="news, tech"`, `href="/settings?tag=news#feeds"`)
+
+	req, w = requestAs(f.server, "GET", "/settings?tag=other", f.user1, nil)
+	f.server.handleSettings(w, req)
+	assertResponseNotContains(t, w, "https://example.com/feed1.xml")
+
+	otherFeedID := strconv.FormatInt(f.feed2, 10)
+	req, w = requestAs(f.server, "POST", "/settings/feeds/"+otherFeedID+"/tags", f.user1, map[string]string{"feedId": otherFeedID})
+	req.PostForm = map[string][]string{"tags": {"mine"}}
+	f.server.handleSetFeedTags(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code, "other users' feeds cannot be tagged")
+}
+
+func TestDashboardTagFilterAndMarkSeen(t *testing.T) {
+	f := newServerAuthFixture(t)
+	untaggedID, err := f.store.AddFeedForUser(f.user1, "https://example.com/untagged.xml")
+	require.NoError(t, err)
+	require.NoError(t, f.store.UpdateFeedTitle(untaggedID, "Untagged feed"))
+	require.NoError(t, f.store.UpdateFeedTitle(f.feed1, "Tagged feed"))
+	require.NoError(t, f.store.SetFeedTagsForUser(f.user1, f.feed1, []string{"news"}))
+	dashboards, err := f.store.GetDashboardsForUser(f.user1)
+	require.NoError(t, err)
+	dashboardID := strconv.FormatInt(dashboards[0].ID, 10)
+
+	req, w := requestAs(f.server, "GET", "/", f.user1, nil)
+	f.server.handleDashboard(w, req)
+	assertResponseSuccess(t, w, "Tagged feed", "Untagged feed", `href="/dashboards/`+dashboardID+`?tag=news"`, "Edit layout")
+
+	req, w = requestAs(f.server, "GET", "/?tag=news", f.user1, nil)
+	f.server.handleDashboard(w, req)
+	assertResponseSuccess(t, w, "Tagged feed", "Mark all in news as read")
+	assertResponseNotContains(t, w, "Untagged feed", "Edit layout")
+
+	req, w = requestAs(f.server, "POST", "/tags/seen", f.user1, nil)
+	req.PostForm = map[string][]string{"tag": {"news"}, "dashboardId": {dashboardID}}
+	f.server.handleMarkTagSeen(w, req)
+	assertRedirect(t, w, "/dashboards/"+dashboardID+"?tag=news")
+	counts, err := f.store.GetUnreadCountsForUser(f.user1)
+	require.NoError(t, err)
+	assert.Equal(t, 0, counts[f.feed1])
+
+	req, w = requestAs(f.server, "POST", "/tags/seen", f.user2, nil)
+	req.PostForm = map[string][]string{"tag": {"news"}}
+	f.server.handleMarkTagSeen(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code, "tags are per user")
+}
@@ -2,6 +2,7 @@ package server
 
 import (
 	"bytes"
+	"database/sql"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
@@ -12,12 +13,9 @@ import (
 
 	"html/template"
 
-	"context"
-
 	baseliboidc "github.com/aggregat4/go-baselib-services/v3/oidc"
 	"github.com/aggregat4/rssgrid/internal/db"
 	"github.com/aggregat4/rssgrid/internal/templates"
-	"github.com/go-chi/chi/v5"
 	"github.com/gorilla/sessions"
 )
 
@@ -195,10 +193,22 @@ func (m *mockStore) UpdateFeedTitle(feedID int64, title string) error {
 	return nil
 }
 
-func (m *mockStore) AddPost(feedID int64, guid, title, link string, publishedAt time.Time, content string) error {
+func (m *mockStore) UpdateFeedTitleIfEmpty(feedID int64, title string) error {
+	return nil
+}
+
+func (m *mockStore) GetFeedByID(feedID int64) (*db.Feed, error) {
+	return &db.Feed{ID: feedID}, nil
+}
+
+func (m *mockStore) ApplyMarkSeenFilterRules(feedID int64, guid string) error {
 	return nil
 }
 
+func (m *mockStore) UpsertPostWithMetadata(feedID int64, guid, title, link, author string, publishedAt time.Time, content string, metadata db.PostMetadata) (db.PostChange, error) {
+	return db.PostInserted, nil
+}
+
 func (m *mockStore) DeleteFeedForUser(userID, feedID int64) error {
 	return nil
 }
@@ -235,14 +245,6 @@ func (m *mockStore) GetPostForUser(userID, postID int64) (*db.Post, error) {
 	return nil, fmt.Errorf("post not found")
 }
 
-func (m *mockStore) MoveFeedUp(userID int64, feedID int64) error {
-	return nil
-}
-
-func (m *mockStore) MoveFeedDown(userID int64, feedID int64) error {
-	return nil
-}
-
 func (m *mockStore) GetUserColumns(userID int64) (int, error) {
 	if m.columns == 0 {
 		return 2, nil
@@ -258,6 +260,242 @@ func (m *mockStore) SetUserColumns(userID int64, columns int) error {
 	return nil
 }
 
+func (m *mockStore) SearchPostsForUser(userID int64, query string, limit int) ([]db.SearchResult, error) {
+	return nil, nil
+}
+
+func (m *mockStore) CreateAPITokenForUser(userID int64, name string) (string, error) {
+	return "rsg_test", nil
+}
+
+func (m *mockStore) CreateFeedTokenForUser(userID int64, name string) (string, error) {
+	return "rsg_test", nil
+}
+
+func (m *mockStore) GetAPITokensForUser(userID int64) ([]db.APIToken, error) {
+	return nil, nil
+}
+
+func (m *mockStore) DeleteAPITokenForUser(userID, tokenID int64) error {
+	return nil
+}
+
+func (m *mockStore) GetUserIDForAPIToken(token string) (int64, error) {
+	return 0, sql.ErrNoRows
+}
+
+func (m *mockStore) GetUserIDForFeedToken(token string) (int64, error) {
+	return 0, sql.ErrNoRows
+}
+
+func (m *mockStore) SetPostStarredForUser(userID, postID int64, starred bool) error {
+	return nil
+}
+
+func (m *mockStore) GetStarredPostsForUser(userID int64) ([]db.StarredPost, error) {
+	return nil, nil
+}
+
+func (m *mockStore) GetPostRevisions(postID int64) ([]db.PostRevision, error) {
+	return nil, nil
+}
+
+func (m *mockStore) GetUserUnseenOnUpdate(userID int64) (bool, error) {
+	return false, nil
+}
+
+func (m *mockStore) SetUserUnseenOnUpdate(userID int64, unseenOnUpdate bool) error {
+	return nil
+}
+
+func (m *mockStore) GetDashboardsForUser(userID int64) ([]db.Dashboard, error) {
+	return []db.Dashboard{{ID: 1, Name: "Home"}}, nil
+}
+
+func (m *mockStore) CreateDashboardForUser(userID int64, name string) (int64, error) {
+	return 2, nil
+}
+
+func (m *mockStore) RenameDashboardForUser(userID, dashboardID int64, name string) error {
+	return nil
+}
+
+func (m *mockStore) DeleteDashboardForUser(userID, dashboardID int64) error {
+	return nil
+}
+
+func (m *mockStore) GetDashboardFeeds(userID, dashboardID int64) ([]db.Feed, error) {
+	return m.feeds, nil
+}
+
+func (m *mockStore) GetFeedDashboardIDsForUser(userID int64) (map[int64][]int64, error) {
+	return map[int64][]int64{}, nil
+}
+
+func (m *mockStore) SetFeedDashboardsForUser(userID, feedID int64, dashboardIDs []int64) error {
+	return nil
+}
+
+func (m *mockStore) GetDashboardLayout(userID, dashboardID int64) (map[int64]db.WidgetLayout, error) {
+	return map[int64]db.WidgetLayout{}, nil
+}
+
+func (m *mockStore) GetUserHideRead(userID int64) (bool, error) {
+	return false, nil
+}
+
+func (m *mockStore) SetUserHideRead(userID int64, hideRead bool) error {
+	return nil
+}
+
+func (m *mockStore) SetFeedHideReadForUser(userID, feedID int64, hideRead bool) error {
+	return nil
+}
+
+func (m *mockStore) GetUnreadCountsForUser(userID int64) (map[int64]int, error) {
+	return map[int64]int{}, nil
+}
+
+func (m *mockStore) GetFilterRulesForUser(userID int64) ([]db.FilterRule, error) {
+	return nil, nil
+}
+
+func (m *mockStore) CreateFilterRuleForUser(userID int64, rule db.FilterRule) (int64, error) {
+	return 1, nil
+}
+
+func (m *mockStore) DeleteFilterRuleForUser(userID, ruleID int64) error {
+	return nil
+}
+
+func (m *mockStore) QueryPostsForUser(userID int64, query db.PostQuery) ([]db.FeedPost, error) {
+	return nil, nil
+}
+
+func (m *mockStore) CountPostsForUser(userID int64) (int, error) {
+	return 0, nil
+}
+
+func (m *mockStore) GetUnreadPostIDsForUser(userID int64) ([]int64, error) {
+	return nil, nil
+}
+
+func (m *mockStore) GetStarredPostIDsForUser(userID int64) ([]int64, error) {
+	return nil, nil
+}
+
+func (m *mockStore) MarkPostAsUnseenForUser(userID, postID int64) error {
+	return nil
+}
+
+func (m *mockStore) MarkFeedPostsAsSeenBeforeForUser(userID, feedID int64, before time.Time) error {
+	return nil
+}
+
+func (m *mockStore) SetFeverCredentialsForUser(userID int64, username, password string) error {
+	return nil
+}
+
+func (m *mockStore) ClearFeverCredentialsForUser(userID int64) error {
+	return nil
+}
+
+func (m *mockStore) GetFeverUsernameForUser(userID int64) (string, error) {
+	return "", nil
+}
+
+func (m *mockStore) GetUserIDForFeverAPIKey(apiKey string) (int64, error) {
+	return 0, sql.ErrNoRows
+}
+
+func (m *mockStore) SetFeedSettingsForUser(userID, feedID int64, settings db.FeedSettings) error {
+	return nil
+}
+
+func (m *mockStore) SetFeedTagsForUser(userID, feedID int64, tags []string) error {
+	return nil
+}
+
+func (m *mockStore) SetFeedCredentialsForUser(userID, feedID int64, creds db.FeedCredentials) (int64, error) {
+	return feedID, nil
+}
+
+func (m *mockStore) AddFeedTagsForUser(userID, feedID int64, tags []string) error {
+	return nil
+}
+
+func (m *mockStore) GetTagsForUser(userID int64) ([]string, error) {
+	return nil, nil
+}
+
+func (m *mockStore) MarkTagPostsAsSeenForUser(userID int64, tag string) error {
+	return nil
+}
+
+func (m *mockStore) SaveDashboardLayoutForUser(userID, dashboardID int64, layout map[int64]db.WidgetLayout) error {
+	return nil
+}
+
+func (m *mockStore) GetLastDashboardID(userID int64) (int64, error) {
+	return 0, nil
+}
+
+func (m *mockStore) SetLastDashboardID(userID, dashboardID int64) error {
+	return nil
+}
+
+func (m *mockStore) CountLocalUsers() (int, error) {
+	return 0, nil
+}
+
+func (m *mockStore) CreateLocalUser(username, password, inviteCode string) (int64, error) {
+	return 0, nil
+}
+
+func (m *mockStore) AuthenticateLocalUser(username, password string) (int64, error) {
+	return 0, db.ErrInvalidCredentials
+}
+
+func (m *mockStore) ChangePasswordForUser(userID int64, currentPassword, newPassword string) error {
+	return nil
+}
+
+func (m *mockStore) GetLocalAccountForUser(userID int64) (db.LocalAccount, error) {
+	return db.LocalAccount{}, sql.ErrNoRows
+}
+
+func (m *mockStore) CreateInviteForUser(userID int64) (string, error) {
+	return "", nil
+}
+
+func (m *mockStore) GetInvitesForUser(userID int64) ([]db.Invite, error) {
+	return nil, nil
+}
+
+func (m *mockStore) DeleteInviteForUser(userID, inviteID int64) error {
+	return nil
+}
+
+func (m *mockStore) AddPasskeyForUser(userID int64, name string, credentialID []byte, credential string) error {
+	return nil
+}
+
+func (m *mockStore) GetPasskeysForUser(userID int64) ([]db.Passkey, error) {
+	return nil, nil
+}
+
+func (m *mockStore) GetPasskeyCredentialsForUser(userID int64) ([]string, error) {
+	return nil, nil
+}
+
+func (m *mockStore) UpdatePasskeyCredential(credentialID []byte, credential string) error {
+	return nil
+}
+
+func (m *mockStore) DeletePasskeyForUser(userID, passkeyID int64) error {
+	return nil
+}
+
 // Test basic template loading and rendering
 func TestTemplateLoading(t *testing.T) {
 	templates, err := templates.LoadTemplates()
@@ -266,7 +504,7 @@ func TestTemplateLoading(t *testing.T) {
 	}
 
 	// Check that required templates exist
-	requiredTemplates := []string{"dashboard.html", "settings.html", "post.html"}
+	requiredTemplates := []string{"dashboard.html", "settings.html", "post.html", "search.html"}
 	for _, tmplName := range requiredTemplates {
 		if tmpl := templates.Lookup(tmplName); tmpl == nil {
 			t.Errorf("Required template '%s' not found", tmplName)
@@ -275,23 +513,22 @@ func TestTemplateLoading(t *testing.T) {
 
 	// Test rendering dashboard template with test data
 	data := struct {
-		Columns [][]struct {
-			Feed  db.Feed
-			Posts []db.Post
-		}
-		ColumnCount int
+		Widgets          []widgetData
+		Dashboards       []db.Dashboard
+		CurrentDashboard db.Dashboard
+		Tags             []string
+		CurrentTag       string
+		ColumnCount      int
+		UnreadTotal      int
+		FlashMessages    []FlashMessage
 	}{
-		Columns: [][]struct {
-			Feed  db.Feed
-			Posts []db.Post
-		}{
+		Widgets: []widgetData{
 			{
-				{
-					Feed: db.Feed{ID: 1, Title: "Test Feed"},
-					Posts: []db.Post{
-						{ID: 1, Title: "Test Post", Link: "https://example.com"},
-					},
+				Feed: db.Feed{ID: 1, Title: "Test Feed"},
+				Posts: []db.Post{
+					{ID: 1, Title: "Test Post", Link: "https://example.com"},
 				},
+				Layout: db.WidgetLayout{Column: 1, Row: 1, Width: 1, Height: 1},
 			},
 		},
 		ColumnCount: 1,
@@ -415,89 +652,7 @@ func TestUserPreferences(t *testing.T) {
 	}
 }
 
-// Test feed reordering functionality
-func TestFeedReordering(t *testing.T) {
-	store, cleanup := createTestStore(t)
-	defer cleanup()
-
-	userID, err := store.GetOrCreateUser("test-subject", "test-issuer")
-	if err != nil {
-		t.Fatalf("Failed to create test user: %v", err)
-	}
-
-	// Add test feeds
-	feed1ID, err := store.AddFeedForUser(userID, "https://example.com/feed1.xml")
-	if err != nil {
-		t.Fatalf("Failed to add test feed 1: %v", err)
-	}
-	feed2ID, err := store.AddFeedForUser(userID, "https://example.com/feed2.xml")
-	if err != nil {
-		t.Fatalf("Failed to add test feed 2: %v", err)
-	}
-	feed3ID, err := store.AddFeedForUser(userID, "https://example.com/feed3.xml")
-	if err != nil {
-		t.Fatalf("Failed to add test feed 3: %v", err)
-	}
-
-	// Update feed titles
-	store.UpdateFeedTitle(feed1ID, "Feed 1")
-	store.UpdateFeedTitle(feed2ID, "Feed 2")
-	store.UpdateFeedTitle(feed3ID, "Feed 3")
-
-	// Test initial order
-	feeds, err := store.GetUserFeeds(userID)
-	if err != nil {
-		t.Fatalf("Failed to get feeds: %v", err)
-	}
-	if len(feeds) != 3 {
-		t.Fatalf("Expected 3 feeds, got %d", len(feeds))
-	}
-
-	// Test reordering operations
-	tests := []struct {
-		name      string
-		operation func() error
-		expected  []string
-	}{
-		{
-			name:      "move feed 2 down",
-			operation: func() error { return store.MoveFeedDown(userID, feed2ID) },
-			expected:  []string{"Feed 1", "Feed 3", "Feed 2"},
-		},
-		{
-			name:      "move feed 1 down",
-			operation: func() error { return store.MoveFeedDown(userID, feed1ID) },
-			expected:  []string{"Feed 3", "Feed 1", "Feed 2"},
-		},
-		{
-			name:      "move feed 2 up",
-			operation: func() error { return store.MoveFeedUp(userID, feed2ID) },
-			expected:  []string{"Feed 3", "Feed 2", "Feed 1"},
-		},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			err := tt.operation()
-			if err != nil {
-				t.Fatalf("Failed to %s: %v", tt.name, err)
-			}
-
-			feeds, err := store.GetUserFeeds(userID)
-			if err != nil {
-				t.Fatalf("Failed to get feeds: %v", err)
-			}
-
-			for i, expected := range tt.expected {
-				if feeds[i].Title != expected {
-					t.Errorf("Expected feed %d to be %s, got %s", i, expected, feeds[i].Title)
-				}
-			}
-		})
-	}
-}
-
-// Test feed lifecycle (add, delete, reorder)
+// Test feed lifecycle (add, delete)
 func TestFeedLifecycle(t *testing.T) {
 	store, cleanup := createTestStore(t)
 	defer cleanup()
@@ -550,47 +705,6 @@ func TestFeedLifecycle(t *testing.T) {
 	assertResponseNotContains(t, w, "Feed 1")
 }
 
-// Test move feed handlers
-func TestMoveFeedHandlers(t *testing.T) {
-	server := testServer(t, mockStoreWithFeeds([]db.Feed{
-		{ID: 1, URL: "https://example.com/feed1", Title: "Test Feed 1"},
-		{ID: 2, URL: "https://example.com/feed2", Title: "Test Feed 2"},
-	}, nil))
-
-	tests := []struct {
-		name   string
-		method string
-		path   string
-		feedID string
-	}{
-		{"move up", "POST", "/settings/feeds/2/move-up", "2"},
-		{"move down", "POST", "/settings/feeds/1/move-down", "1"},
-	}
-
-	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			req := httptest.NewRequest(tt.method, tt.path, nil)
-			w := httptest.NewRecorder()
-
-			session, _ := server.sessions.Get(req, "user_session")
-			session.Values["user_id"] = int64(1)
-			session.Save(req, w)
-
-			rctx := chi.NewRouteContext()
-			rctx.URLParams.Add("feedId", tt.feedID)
-			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
-
-			if tt.name == "move up" {
-				server.handleMoveFeedUp(w, req)
-			} else {
-				server.handleMoveFeedDown(w, req)
-			}
-
-			assertRedirect(t, w, "/settings")
-		})
-	}
-}
-
 // Test logout functionality
 func TestLogout(t *testing.T) {
 	server := testServer(t, mockStoreEmpty())
@@ -608,11 +722,20 @@ func TestPostTemplateRendering(t *testing.T) {
 	}
 
 	testPost := struct {
-		ID          int64
-		Title       string
-		Link        string
-		PublishedAt time.Time
-		Content     template.HTML
+		ID              int64
+		Title           string
+		Link            string
+		Author          string
+		PublishedAt     time.Time
+		UpdatedAt       time.Time
+		SourceUpdatedAt time.Time
+		Summary         template.HTML
+		Content         template.HTML
+		Categories      []string
+		ImageURL        string
+		CommentsURL     string
+		Enclosures      []db.Enclosure
+		Starred         bool
 	}{
 		ID:          1,
 		Title:       "Test Post for Display",
@@ -622,7 +745,8 @@ func TestPostTemplateRendering(t *testing.T) {
 	}
 
 	data := struct {
-		Post interface{}
+		Post      interface{}
+		Revisions []struct{}
 	}{
 		Post: testPost,
 	}
@@ -657,32 +781,28 @@ func TestDashboardTemplateWithDates(t *testing.T) {
 	}
 
 	testTime := time.Date(2024, 1, 15, 14, 30, 0, 0, time.UTC)
-	testFeeds := []struct {
-		Feed  db.Feed
-		Posts []db.Post
-	}{
+	testFeeds := []widgetData{
 		{
 			Feed: db.Feed{ID: 1, Title: "Test Feed 1"},
 			Posts: []db.Post{
 				{ID: 1, Title: "Test Post 1", Link: "https://example.com/post1", PublishedAt: testTime, Seen: false},
 				{ID: 2, Title: "Test Post 2", Link: "https://example.com/post2", PublishedAt: testTime.Add(-24 * time.Hour), Seen: true},
 			},
+			Layout: db.WidgetLayout{Column: 1, Row: 1, Width: 1, Height: 1},
 		},
 	}
 
 	data := struct {
-		Columns [][]struct {
-			Feed  db.Feed
-			Posts []db.Post
-		}
-		ColumnCount int
+		Widgets          []widgetData
+		Dashboards       []db.Dashboard
+		CurrentDashboard db.Dashboard
+		Tags             []string
+		CurrentTag       string
+		ColumnCount      int
+		UnreadTotal      int
+		FlashMessages    []FlashMessage
 	}{
-		Columns: [][]struct {
-			Feed  db.Feed
-			Posts []db.Post
-		}{
-			testFeeds,
-		},
+		Widgets:     testFeeds,
 		ColumnCount: 1,
 	}
 
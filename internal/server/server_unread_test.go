@@ -0,0 +1,63 @@
+package server
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDashboardShowsUnreadCounts(t *testing.T) {
+	f := newServerAuthFixture(t)
+
+	req, w := requestAs(f.server, "GET", "/", f.user1, nil)
+	f.server.handleDashboard(w, req)
+	assertResponseSuccess(t, w, "<title>(1) RSSGrid</title>", `data-unread="1"`)
+
+	require.NoError(t, f.store.MarkAllFeedPostsAsSeenForUser(f.user1, f.feed1))
+	req, w = requestAs(f.server, "GET", "/", f.user1, nil)
+	f.server.handleDashboard(w, req)
+	assertResponseSuccess(t, w, "<title>RSSGrid</title>", `data-unread="0"`)
+}
+
+func TestHandleMarkAllSeen_InPlace(t *testing.T) {
+	f := newServerAuthFixture(t)
+	feedID := strconv.FormatInt(f.feed1, 10)
+
+	req, w := requestAs(f.server, "POST", "/feeds/"+feedID+"/seen", f.user1, map[string]string{"feedId": feedID})
+	req.Header.Set("Accept", "application/json")
+	f.server.handleMarkAllSeen(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	counts, err := f.store.GetUnreadCountsForUser(f.user1)
+	require.NoError(t, err)
+	assert.Empty(t, counts)
+}
+
+func TestHandleSetFeedHideRead(t *testing.T) {
+	f := newServerAuthFixture(t)
+	feedID := strconv.FormatInt(f.feed1, 10)
+	require.NoError(t, f.store.MarkPostAsSeenForUser(f.user1, f.post1))
+
+	req, w := requestAs(f.server, "POST", "/feeds/"+feedID+"/hide-read", f.user1, map[string]string{"feedId": feedID})
+	f.server.handleSetFeedHideRead(true)(w, req)
+	assertRedirect(t, w, "/")
+
+	req, w = requestAs(f.server, "GET", "/", f.user1, nil)
+	f.server.handleDashboard(w, req)
+	assertResponseSuccess(t, w, "/feeds/"+feedID+"/show-read")
+	assertResponseNotContains(t, w, "Post 1")
+
+	// With read posts hidden everywhere the per-widget toggle goes away.
+	require.NoError(t, f.store.SetUserHideRead(f.user1, true))
+	req, w = requestAs(f.server, "GET", "/", f.user1, nil)
+	f.server.handleDashboard(w, req)
+	assertResponseNotContains(t, w, "/show-read", "/hide-read")
+
+	otherFeedID := strconv.FormatInt(f.feed2, 10)
+	req, w = requestAs(f.server, "POST", "/feeds/"+otherFeedID+"/hide-read", f.user1, map[string]string{"feedId": otherFeedID})
+	f.server.handleSetFeedHideRead(true)(w, req)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
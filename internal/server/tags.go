@@ -0,0 +1,99 @@
+package server
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// maxTagLength and maxTagsPerFeed keep tags short enough to show as chips.
+const (
+	maxTagLength   = 50
+	maxTagsPerFeed = 20
+)
+
+// parseTags splits a comma-separated list of tags, collapsing whitespace and
+// dropping empty and duplicate tags. Tags compare case-insensitively.
+func parseTags(value string) ([]string, error) {
+	var tags []string
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.Join(strings.Fields(tag), " ")
+		if tag == "" || slices.ContainsFunc(tags, func(t string) bool { return strings.EqualFold(t, tag) }) {
+			continue
+		}
+		if len(tag) > maxTagLength {
+			return nil, fmt.Errorf("tags may be at most %d characters", maxTagLength)
+		}
+		tags = append(tags, tag)
+	}
+	if len(tags) > maxTagsPerFeed {
+		return nil, fmt.Errorf("a feed may have at most %d tags", maxTagsPerFeed)
+	}
+	return tags, nil
+}
+
+// handleSetFeedTags replaces the tags of a feed with the comma-separated
+// tags in the form.
+func (s *Server) handleSetFeedTags(w http.ResponseWriter, r *http.Request) {
+	feedId, err := strconv.ParseInt(chi.URLParam(r, "feedId"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid feed ID format", http.StatusBadRequest)
+		return
+	}
+
+	userId := s.getUserID(r)
+
+	tags, err := parseTags(r.FormValue("tags"))
+	if err != nil {
+		s.addErrorFlash(w, r, "Could not save tags: "+err.Error())
+		http.Redirect(w, r, "/settings", http.StatusSeeOther)
+		return
+	}
+
+	if err := s.store.SetFeedTagsForUser(userId, feedId, tags); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Feed not found", http.StatusNotFound)
+			return
+		}
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error updating tags", "Error setting feed tags for user", err, "feedId", feedId, "userId", userId)
+		return
+	}
+
+	s.addSuccessFlash(w, r, "Feed tags updated.")
+	http.Redirect(w, r, "/settings", http.StatusSeeOther)
+}
+
+// handleMarkTagSeen marks every post in the feeds with the tag in the form
+// as seen and returns to the dashboard it was sent from.
+func (s *Server) handleMarkTagSeen(w http.ResponseWriter, r *http.Request) {
+	tag := strings.TrimSpace(r.FormValue("tag"))
+	if tag == "" {
+		http.Error(w, "Invalid tag", http.StatusBadRequest)
+		return
+	}
+
+	userId := s.getUserID(r)
+
+	if err := s.store.MarkTagPostsAsSeenForUser(userId, tag); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Tag not found", http.StatusNotFound)
+			return
+		}
+		s.logErrorAndRespond(w, http.StatusInternalServerError, "Error marking all posts as seen", "Error marking all posts as seen for tag", err, "tag", tag, "userId", userId)
+		return
+	}
+
+	// Return to the dashboard the user was looking at
+	redirect := "/"
+	if dashboardId, err := strconv.ParseInt(r.FormValue("dashboardId"), 10, 64); err == nil {
+		redirect = "/dashboards/" + strconv.FormatInt(dashboardId, 10)
+	}
+	http.Redirect(w, r, redirect+"?tag="+url.QueryEscape(tag), http.StatusSeeOther)
+}
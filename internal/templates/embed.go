@@ -2,17 +2,24 @@ package templates
 
 import (
 	"embed"
+	"fmt"
+	"html"
 	"html/template"
 	"io/fs"
 	"net/http"
+	"net/url"
+	"path"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/microcosm-cc/bluemonday"
 )
 
 //go:embed *.html
 var templateFS embed.FS
 
-//go:embed *.css
+//go:embed *.css *.js
 var staticFS embed.FS
 
 // LoadTemplates loads all HTML templates from the embedded filesystem
@@ -28,7 +35,11 @@ func LoadTemplates() (*template.Template, error) {
 			}
 			return b
 		},
-		"reltime": reltime,
+		"reltime":  reltime,
+		"summary":  summary,
+		"join":     strings.Join,
+		"filename": filename,
+		"filesize": filesize,
 	}
 
 	tmpl := template.New("").Funcs(funcMap)
@@ -71,40 +82,92 @@ func pluralize(n int, unit string) string {
 }
 
 // reltime renders a time.Time as a human-friendly relative string such as
-// "just now", "5 minutes ago", "3 hours ago", or "2 days ago". A zero time
-// renders as "never".
+// "just now", "5 minutes ago", "3 hours ago", or "2 days ago", and future
+// times as "in 5 minutes" and so on. A zero time renders as "never".
 func reltime(t time.Time) string {
 	if t.IsZero() {
 		return "never"
 	}
 	d := time.Since(t)
-	switch {
-	case d < 0:
-		return "in the future"
-	case d < time.Minute:
+	if d < 0 {
+		if d > -time.Minute {
+			return "in a moment"
+		}
+		return "in " + relduration(-d)
+	}
+	if d < time.Minute {
 		return "just now"
+	}
+	return relduration(d) + " ago"
+}
+
+// relduration renders a duration of at least a minute in its largest whole
+// unit, such as "1 minute", "3 hours" or "2 days".
+func relduration(d time.Duration) string {
+	switch {
 	case d < time.Hour:
-		mins := int(d.Minutes())
-		if mins == 1 {
-			return "1 minute ago"
-		}
-		return pluralize(mins, "minute") + " ago"
+		return pluralize(int(d.Minutes()), "minute")
 	case d < 24*time.Hour:
-		hours := int(d.Hours())
-		if hours == 1 {
-			return "1 hour ago"
-		}
-		return pluralize(hours, "hour") + " ago"
+		return pluralize(int(d.Hours()), "hour")
 	default:
-		days := int(d.Hours() / 24)
-		if days == 1 {
-			return "1 day ago"
-		}
-		return pluralize(days, "day") + " ago"
+		return pluralize(int(d.Hours()/24), "day")
+	}
+}
+
+// summaryPolicy strips all markup from post content for summaries.
+var summaryPolicy = bluemonday.StrictPolicy().AddSpaceWhenStrippingTag(true)
+
+// summaryLength is the most characters a post summary shows.
+const summaryLength = 200
+
+// summary renders post content as a short plain-text teaser, cut at a word
+// boundary if it is longer than summaryLength characters.
+func summary(content string) string {
+	text := strings.Join(strings.Fields(html.UnescapeString(summaryPolicy.Sanitize(content))), " ")
+	runes := []rune(text)
+	if len(runes) <= summaryLength {
+		return text
 	}
+	cut := string(runes[:summaryLength])
+	if i := strings.LastIndex(cut, " "); i > len(cut)/2 {
+		cut = cut[:i]
+	}
+	return cut + "…"
 }
 
 // CreateStaticFileServer creates an http.Handler that serves static files from the embedded filesystem
 func CreateStaticFileServer() http.Handler {
 	return http.FileServer(http.FS(staticFS))
 }
+
+// filename returns the last path segment of a URL, or the URL itself if it
+// has none.
+func filename(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	name := path.Base(parsed.Path)
+	if name == "/" || name == "." {
+		return rawURL
+	}
+	if unescaped, err := url.PathUnescape(name); err == nil {
+		return unescaped
+	}
+	return name
+}
+
+// filesize renders a size in bytes as "512 B", "1.5 KB", "12.3 MB" and so on.
+func filesize(size int64) string {
+	if size < 1000 {
+		return fmt.Sprintf("%d B", size)
+	}
+	value := float64(size)
+	for _, unit := range []string{"KB", "MB", "GB"} {
+		value /= 1000
+		if value < 1000 {
+			return fmt.Sprintf("%.1f %s", value, unit)
+		}
+	}
+	return fmt.Sprintf("%.1f TB", value/1000)
+}
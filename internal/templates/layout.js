@@ -0,0 +1,214 @@
+// Drag-and-drop editor for the dashboard grid. In edit mode widgets can be
+// dragged to another cell and resized with the width and height inputs;
+// widgets in the way are pushed down. Saving sends the whole layout to
+// /dashboards/{id}/layout in one request.
+(function() {
+    const grid = document.getElementById('dashboardGrid');
+    // The layout cannot be edited while the dashboard is filtered by a tag
+    if (!grid || !document.getElementById('editLayout')) {
+        return;
+    }
+    const columns = parseInt(grid.dataset.columns, 10) || 1;
+    const maxHeight = 6;
+    const editButton = document.getElementById('editLayout');
+    const saveButton = document.getElementById('saveLayout');
+    const cancelButton = document.getElementById('cancelLayout');
+    const status = document.getElementById('layoutStatus');
+
+    let saved = null;
+    let dragged = null;
+    const dropTarget = document.createElement('div');
+    dropTarget.className = 'grid-drop-target';
+
+    function cells() {
+        return Array.from(grid.querySelectorAll('.grid-cell'));
+    }
+
+    function readLayout(cell) {
+        return {
+            column: parseInt(cell.dataset.column, 10),
+            row: parseInt(cell.dataset.row, 10),
+            width: parseInt(cell.dataset.width, 10),
+            height: parseInt(cell.dataset.height, 10),
+        };
+    }
+
+    function writeLayout(cell, layout) {
+        cell.dataset.column = layout.column;
+        cell.dataset.row = layout.row;
+        cell.dataset.width = layout.width;
+        cell.dataset.height = layout.height;
+        cell.style.gridColumn = `${layout.column} / span ${layout.width}`;
+        cell.style.gridRow = `${layout.row} / span ${layout.height}`;
+        cell.querySelector('.layout-width').value = layout.width;
+        cell.querySelector('.layout-height').value = layout.height;
+    }
+
+    function overlaps(a, b) {
+        return a.column < b.column + b.width && b.column < a.column + a.width &&
+            a.row < b.row + b.height && b.row < a.row + a.height;
+    }
+
+    function clamp(layout) {
+        layout.width = Math.min(Math.max(layout.width || 1, 1), columns);
+        layout.height = Math.min(Math.max(layout.height || 1, 1), maxHeight);
+        layout.column = Math.min(Math.max(layout.column || 1, 1), columns - layout.width + 1);
+        layout.row = Math.max(layout.row || 1, 1);
+        return layout;
+    }
+
+    // Puts the moved cell where it was asked to go and pushes every other
+    // cell that now overlaps down until it fits.
+    function settle(moved, layout) {
+        const placed = [clamp(layout)];
+        writeLayout(moved, layout);
+        const others = cells()
+            .filter(function(cell) { return cell !== moved; })
+            .map(function(cell) { return { cell: cell, layout: readLayout(cell) }; })
+            .sort(function(a, b) {
+                return a.layout.row - b.layout.row || a.layout.column - b.layout.column;
+            });
+        others.forEach(function(other) {
+            while (placed.some(function(p) { return overlaps(p, other.layout); })) {
+                other.layout.row++;
+            }
+            placed.push(other.layout);
+            writeLayout(other.cell, other.layout);
+        });
+    }
+
+    // Maps a pointer position to the grid cell underneath it.
+    function cellAt(x, y) {
+        const rect = grid.getBoundingClientRect();
+        const style = getComputedStyle(grid);
+        const columnGap = parseFloat(style.columnGap) || 0;
+        const rowGap = parseFloat(style.rowGap) || 0;
+        const columnWidth = (rect.width - columnGap * (columns - 1)) / columns;
+        const column = Math.floor((x - rect.left) / (columnWidth + columnGap)) + 1;
+
+        const rows = style.gridTemplateRows.split(' ').map(parseFloat).filter(function(h) { return !isNaN(h); });
+        let top = rect.top;
+        let row = 1;
+        for (const height of rows) {
+            if (y < top + height + rowGap) {
+                return { column: column, row: row };
+            }
+            top += height + rowGap;
+            row++;
+        }
+        const lastHeight = rows.length ? rows[rows.length - 1] : 100;
+        return { column: column, row: row + Math.max(0, Math.floor((y - top) / (lastHeight + rowGap))) };
+    }
+
+    function target(e) {
+        const layout = readLayout(dragged);
+        const at = cellAt(e.clientX, e.clientY);
+        layout.column = at.column;
+        layout.row = at.row;
+        return clamp(layout);
+    }
+
+    function setEditing(editing) {
+        grid.classList.toggle('editing', editing);
+        editButton.hidden = editing;
+        saveButton.hidden = !editing;
+        cancelButton.hidden = !editing;
+        cells().forEach(function(cell) { cell.draggable = editing; });
+    }
+
+    editButton.addEventListener('click', function() {
+        saved = cells().map(function(cell) { return { cell: cell, layout: readLayout(cell) }; });
+        status.textContent = '';
+        setEditing(true);
+    });
+
+    cancelButton.addEventListener('click', function() {
+        saved.forEach(function(s) { writeLayout(s.cell, s.layout); });
+        setEditing(false);
+    });
+
+    saveButton.addEventListener('click', function() {
+        const widgets = cells().map(function(cell) {
+            const layout = readLayout(cell);
+            layout.feedId = parseInt(cell.dataset.feedId, 10);
+            return layout;
+        });
+        saveButton.disabled = true;
+        fetch(`/dashboards/${grid.dataset.dashboardId}/layout`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ widgets: widgets }),
+        }).then(function(response) {
+            if (!response.ok) {
+                return response.json().then(function(body) { throw new Error(body.error); });
+            }
+            status.textContent = 'Layout saved';
+            setEditing(false);
+        }).catch(function(err) {
+            status.textContent = `Could not save layout: ${err.message}`;
+        }).finally(function() {
+            saveButton.disabled = false;
+        });
+    });
+
+    grid.addEventListener('change', function(e) {
+        const cell = e.target.closest('.grid-cell');
+        if (!cell || !grid.classList.contains('editing')) {
+            return;
+        }
+        const layout = readLayout(cell);
+        if (e.target.matches('.layout-width')) {
+            layout.width = parseInt(e.target.value, 10);
+        } else if (e.target.matches('.layout-height')) {
+            layout.height = parseInt(e.target.value, 10);
+        }
+        settle(cell, layout);
+    });
+
+    // Widgets are not interactive while the layout is being edited
+    grid.addEventListener('click', function(e) {
+        if (grid.classList.contains('editing') && !e.target.closest('.layout-controls')) {
+            e.preventDefault();
+            e.stopPropagation();
+        }
+    }, true);
+
+    grid.addEventListener('dragstart', function(e) {
+        dragged = e.target.closest('.grid-cell');
+        if (!dragged) {
+            return;
+        }
+        e.dataTransfer.effectAllowed = 'move';
+        e.dataTransfer.setData('text/plain', dragged.dataset.feedId);
+        dragged.classList.add('dragging');
+    });
+
+    grid.addEventListener('dragover', function(e) {
+        if (!dragged) {
+            return;
+        }
+        e.preventDefault();
+        const layout = target(e);
+        dropTarget.style.gridColumn = `${layout.column} / span ${layout.width}`;
+        dropTarget.style.gridRow = `${layout.row} / span ${layout.height}`;
+        if (!dropTarget.isConnected) {
+            grid.appendChild(dropTarget);
+        }
+    });
+
+    grid.addEventListener('drop', function(e) {
+        if (!dragged) {
+            return;
+        }
+        e.preventDefault();
+        settle(dragged, target(e));
+    });
+
+    grid.addEventListener('dragend', function() {
+        if (dragged) {
+            dragged.classList.remove('dragging');
+        }
+        dragged = null;
+        dropTarget.remove();
+    });
+})();
@@ -0,0 +1,36 @@
+// Keeps dashboard widgets current by replacing them with the fresh rendering
+// the server pushes over /events whenever a feed gets new posts or its health
+// changes. The browser reconnects on its own if the stream drops.
+const liveUpdates = new EventSource('/events');
+
+liveUpdates.addEventListener('widget', function(e) {
+    const update = JSON.parse(e.data);
+    const current = document.querySelector(`.widget[data-feed-id="${update.feedId}"]`);
+    if (!current) {
+        return;
+    }
+
+    const known = new Set();
+    current.querySelectorAll('.post-link').forEach(function(link) {
+        known.add(link.dataset.postId);
+    });
+
+    const template = document.createElement('template');
+    template.innerHTML = update.html.trim();
+    const replacement = template.content.firstElementChild;
+
+    // Animate posts that were not shown before
+    replacement.querySelectorAll('.post-link').forEach(function(link) {
+        if (!known.has(link.dataset.postId)) {
+            link.closest('.post-item').classList.add('post-item-new');
+        }
+    });
+
+    // Keep the widget collapsed or expanded as the user left it
+    replacement.classList.toggle('collapsed', current.classList.contains('collapsed'));
+    replacement.querySelector('.widget-collapse-toggle')
+        .setAttribute('aria-expanded', String(!current.classList.contains('collapsed')));
+
+    current.replaceWith(replacement);
+    updateUnreadTitle();
+});
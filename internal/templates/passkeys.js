@@ -0,0 +1,65 @@
+// Passkey sign in and registration. The server speaks the JSON encoding of
+// the WebAuthn options, which the browser converts with
+// parse*OptionsFromJSON; browsers without it keep the buttons hidden.
+(function() {
+    if (!window.PublicKeyCredential || !PublicKeyCredential.parseRequestOptionsFromJSON) {
+        return;
+    }
+    const status = document.getElementById('passkeyStatus');
+
+    function report(message) {
+        if (status) {
+            status.textContent = message;
+        }
+    }
+
+    async function post(url, body) {
+        const response = await fetch(url, {
+            method: 'POST',
+            headers: body ? { 'Content-Type': 'application/json' } : {},
+            body: body ? JSON.stringify(body) : undefined,
+        });
+        if (!response.ok) {
+            throw new Error((await response.text()).trim() || response.statusText);
+        }
+        return response;
+    }
+
+    const loginButton = document.getElementById('passkeyLogin');
+    if (loginButton) {
+        loginButton.hidden = false;
+        loginButton.addEventListener('click', async () => {
+            report('');
+            try {
+                const options = await (await post('/passkeys/login/begin')).json();
+                const credential = await navigator.credentials.get({
+                    publicKey: PublicKeyCredential.parseRequestOptionsFromJSON(options.publicKey),
+                });
+                await post('/passkeys/login/finish', credential.toJSON());
+                window.location.href = '/';
+            } catch (err) {
+                report('Passkey sign in failed: ' + err.message);
+            }
+        });
+    }
+
+    const addForm = document.getElementById('addPasskey');
+    if (addForm) {
+        addForm.hidden = false;
+        addForm.addEventListener('submit', async (event) => {
+            event.preventDefault();
+            report('');
+            try {
+                const name = addForm.elements.name.value;
+                const options = await (await post('/settings/passkeys/begin')).json();
+                const credential = await navigator.credentials.create({
+                    publicKey: PublicKeyCredential.parseCreationOptionsFromJSON(options.publicKey),
+                });
+                await post('/settings/passkeys/finish?name=' + encodeURIComponent(name), credential.toJSON());
+                window.location.reload();
+            } catch (err) {
+                report('Could not add passkey: ' + err.message);
+            }
+        });
+    }
+})();
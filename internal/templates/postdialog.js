@@ -0,0 +1,86 @@
+// Opens posts in the modal dialog and marks them as seen. Used by every page
+// that lists posts as .post-link elements next to a #postDialog.
+let lastOpenedPostButton = null;
+
+// Mark post as seen when clicked
+document.addEventListener('click', function(e) {
+    if (e.target.matches('.post-link')) {
+        e.preventDefault(); // Prevent navigation since href="#"
+        
+        const postId = e.target.dataset.postId;
+        if (postId) {
+            // Mark as seen
+            fetch(`/posts/${postId}/seen`, {
+                method: 'POST',
+            }).catch(console.error);
+            
+            // Remember the button for later styling
+            lastOpenedPostButton = e.target;
+            
+            // Open post dialog
+            openPostDialog(postId);
+        }
+    }
+});
+
+// Listen for dialog close event (triggered by Escape, clicking outside, or close button)
+document.getElementById('postDialog').addEventListener('close', function() {
+    // Mark the last opened post as seen in the UI
+    if (lastOpenedPostButton) {
+        if (!lastOpenedPostButton.classList.contains('seen')) {
+            lastOpenedPostButton.classList.add('seen');
+            lastOpenedPostButton.dispatchEvent(new CustomEvent('postseen', { bubbles: true }));
+        }
+        lastOpenedPostButton = null;
+    }
+    
+    // Clear the iframe source to prevent showing old content
+    const iframe = document.getElementById('postIframe');
+    iframe.src = 'about:blank';
+});
+
+// Handle clicking outside the dialog to dismiss it
+document.getElementById('postDialog').addEventListener('click', function(e) {
+    if (e.target === this) {
+        this.close();
+    }
+});
+
+// Listen for messages from the iframe
+window.addEventListener('message', function(event) {
+    if (event.data.type === 'closeDialog') {
+        document.getElementById('postDialog').close();
+    } else if (event.data.type === 'starChanged') {
+        showStarred(event.data.postId, event.data.starred);
+    }
+});
+
+// Star or unstar a post from its star toggle
+document.addEventListener('click', function(e) {
+    if (e.target.matches('.star-toggle')) {
+        const postId = e.target.dataset.postId;
+        const starred = !e.target.classList.contains('starred');
+        fetch(`/posts/${postId}/${starred ? 'star' : 'unstar'}`, {
+            method: 'POST',
+        }).then(function(response) {
+            if (response.ok) {
+                showStarred(postId, starred);
+            }
+        }).catch(console.error);
+    }
+});
+
+// Update every star toggle for the post on this page
+function showStarred(postId, starred) {
+    document.querySelectorAll(`.star-toggle[data-post-id="${postId}"]`).forEach(function(toggle) {
+        toggle.classList.toggle('starred', starred);
+        toggle.setAttribute('aria-pressed', starred);
+    });
+}
+
+function openPostDialog(postId) {
+    const dialog = document.getElementById('postDialog');
+    const iframe = document.getElementById('postIframe');
+    iframe.src = `/posts/${postId}`;
+    dialog.showModal();
+}
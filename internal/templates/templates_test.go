@@ -2,6 +2,7 @@ package templates
 
 import (
 	"bytes"
+	"strings"
 	"testing"
 	"time"
 )
@@ -20,6 +21,9 @@ func TestReltime(t *testing.T) {
 		{"hours", time.Now().Add(-3 * time.Hour), "3 hours ago"},
 		{"one day", time.Now().Add(-24 * time.Hour), "1 day ago"},
 		{"days", time.Now().Add(-72 * time.Hour), "3 days ago"},
+		{"in a moment", time.Now().Add(10 * time.Second), "in a moment"},
+		{"in minutes", time.Now().Add(5*time.Minute + 30*time.Second), "in 5 minutes"},
+		{"in hours", time.Now().Add(3*time.Hour + 30*time.Second), "in 3 hours"},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -30,6 +34,26 @@ func TestReltime(t *testing.T) {
 	}
 }
 
+func TestSummary(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"strips markup", "<p>Hello <b>world</b> &amp; friends</p>", "Hello world & friends"},
+		{"collapses whitespace", "<p>one</p>\n\n<p>two</p>", "one two"},
+		{"empty", "", ""},
+		{"cuts at a word", strings.Repeat("word ", 60), strings.TrimSpace(strings.Repeat("word ", 40)) + "…"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := summary(tt.content); got != tt.want {
+				t.Errorf("summary() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestSettingsTemplate_RendersFeedHealthBadge(t *testing.T) {
 	tmpl, err := LoadTemplates()
 	if err != nil {
@@ -50,13 +74,73 @@ func TestSettingsTemplate_RendersFeedHealthBadge(t *testing.T) {
 		LastErrorAt         time.Time
 		LastSuccessAt       time.Time
 		LastFetchedAt       time.Time
+		FinalURL            string
+		GoneAt              time.Time
+		RateLimited         bool
+		RateLimitedUntil    time.Time
+		OwnerUserID         int64
+		HasCredentials      bool
+		Tags                []string
+		Settings            struct {
+			CustomTitle                        string
+			PostsPerFeed                       int
+			HideRead, ShowSummaries, Collapsed bool
+		}
+	}
+
+	type dashboardLike struct {
+		ID   int64
+		Name string
 	}
 
 	data := struct {
-		Feeds         []feedLike
-		FlashMessages []struct{ Type, Message string }
-		PostsPerFeed  int
-		Columns       int
+		Feeds          []feedLike
+		Tags           []string
+		CurrentTag     string
+		FeedPlacements map[int64][]struct {
+			Dashboard dashboardLike
+			Placed    bool
+		}
+		Dashboards []struct {
+			Dashboard dashboardLike
+			Feeds     []feedLike
+		}
+		FlashMessages  []struct{ Type, Message string }
+		PostsPerFeed   int
+		Columns        int
+		UnseenOnUpdate bool
+		HideRead       bool
+		DiscoveredFrom string
+		FeedCandidates []struct{ URL, Title string }
+		FilterRules    []struct {
+			ID, FeedID                        int64
+			FeedTitle, Field, Pattern, Action string
+			Regex                             bool
+		}
+		FeverUsername string
+		APITokens     []struct {
+			ID                    int64
+			Name                  string
+			CreatedAt, LastUsedAt time.Time
+		}
+		NewAPIToken     string
+		NewAPITokenName string
+		Account         *struct {
+			Username                        string
+			IsAdmin                         bool
+			PasskeysEnabled, InvitesEnabled bool
+			Passkeys                        []struct {
+				ID                    int64
+				Name                  string
+				CreatedAt, LastUsedAt time.Time
+			}
+			Invites []struct {
+				ID                int64
+				UsedBy            string
+				CreatedAt, UsedAt time.Time
+			}
+		}
+		NewInviteURL string
 	}{
 		Feeds: []feedLike{
 			{ID: 1, Title: "Healthy Feed", URL: "https://example.com/healthy.xml"},
@@ -102,3 +186,35 @@ func occurrences(s, sub string) int {
 	}
 	return n
 }
+
+func TestFilesize(t *testing.T) {
+	tests := []struct {
+		size int64
+		want string
+	}{
+		{512, "512 B"},
+		{1500, "1.5 KB"},
+		{12345678, "12.3 MB"},
+		{2000000000, "2.0 GB"},
+	}
+	for _, tt := range tests {
+		if got := filesize(tt.size); got != tt.want {
+			t.Errorf("filesize(%d) = %q, want %q", tt.size, got, tt.want)
+		}
+	}
+}
+
+func TestFilename(t *testing.T) {
+	tests := []struct {
+		url  string
+		want string
+	}{
+		{"https://cdn.example.com/media/episode%201.mp3?token=x", "episode 1.mp3"},
+		{"https://example.com/", "https://example.com/"},
+	}
+	for _, tt := range tests {
+		if got := filename(tt.url); got != tt.want {
+			t.Errorf("filename(%q) = %q, want %q", tt.url, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+// Controls on dashboard widgets that update the page in place: collapsing
+// widgets, marking all their posts as read and keeping unread counts current.
+document.addEventListener('click', function(e) {
+    const toggle = e.target.closest('.widget-collapse-toggle');
+    if (!toggle) {
+        return;
+    }
+    const widget = toggle.closest('.widget');
+    const collapsed = widget.classList.toggle('collapsed');
+    toggle.setAttribute('aria-expanded', String(!collapsed));
+});
+
+// Shows a widget's unread count and the dashboard total in the page title
+function setUnread(widget, count) {
+    widget.dataset.unread = Math.max(count, 0);
+    const badge = widget.querySelector('.unread-count');
+    badge.textContent = widget.dataset.unread;
+    badge.hidden = widget.dataset.unread === '0';
+    updateUnreadTitle();
+}
+
+function updateUnreadTitle() {
+    let total = 0;
+    document.querySelectorAll('.widget[data-unread]').forEach(function(widget) {
+        total += parseInt(widget.dataset.unread, 10) || 0;
+    });
+    document.title = total > 0 ? `(${total}) RSSGrid` : 'RSSGrid';
+}
+
+document.addEventListener('submit', function(e) {
+    const form = e.target.closest('.mark-all-seen');
+    if (!form) {
+        return;
+    }
+    e.preventDefault();
+    fetch(form.action, {
+        method: 'POST',
+        headers: { 'Accept': 'application/json' },
+    }).then(function(response) {
+        if (!response.ok) {
+            throw new Error(`HTTP ${response.status}`);
+        }
+        const widget = form.closest('.widget');
+        widget.querySelectorAll('.post-link').forEach(function(link) {
+            link.classList.add('seen');
+        });
+        setUnread(widget, 0);
+    }).catch(console.error);
+});
+
+// Sent by postdialog.js when a post is read for the first time
+document.addEventListener('postseen', function(e) {
+    const widget = e.target.closest('.widget');
+    if (widget) {
+        setUnread(widget, parseInt(widget.dataset.unread, 10) - 1);
+    }
+});
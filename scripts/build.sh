@@ -1,3 +1,3 @@
 #!/bin/bash
 
-go build -o bin/rssgrid cmd/rssgrid/main.go
+go build -tags sqlite_fts5 -o bin/rssgrid cmd/rssgrid/main.go
@@ -3,13 +3,13 @@
 set -e
 
 echo "Running tests"
-go test ./...
+go test -tags sqlite_fts5 ./...
 
 #echo "Checking race conditions"
-#go test -race ./...
+#go test -tags sqlite_fts5 -race ./...
 
 #echo "Creating coverage report"
-#go test -coverprofile=coverage.out ./...
+#go test -tags sqlite_fts5 -coverprofile=coverage.out ./...
 #go tool cover -func coverage.out
 #go tool cover -html=coverage.out -o coverage.html
 